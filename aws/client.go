@@ -94,10 +94,18 @@ func (c *awsClient) getRDSClusters(
 	// Used for pagination
 	var marker *string
 	for {
-		output, err := c.rds.DescribeDBClusters(
+		output, err := observeAPICall(
 			ctx,
-			&rds.DescribeDBClustersInput{
-				Marker: marker,
+			c.config.Region,
+			"RDS",
+			"DescribeDBClusters",
+			func(ctx context.Context) (*rds.DescribeDBClustersOutput, error) {
+				return c.rds.DescribeDBClusters(
+					ctx,
+					&rds.DescribeDBClustersInput{
+						Marker: marker,
+					},
+				)
 			},
 		)
 		if err != nil {
@@ -122,10 +130,18 @@ func (c *awsClient) getRDSInstances(
 	// Used for pagination
 	var marker *string
 	for {
-		output, err := c.rds.DescribeDBInstances(
+		output, err := observeAPICall(
 			ctx,
-			&rds.DescribeDBInstancesInput{
-				Marker: marker,
+			c.config.Region,
+			"RDS",
+			"DescribeDBInstances",
+			func(ctx context.Context) (*rds.DescribeDBInstancesOutput, error) {
+				return c.rds.DescribeDBInstances(
+					ctx,
+					&rds.DescribeDBInstancesInput{
+						Marker: marker,
+					},
+				)
 			},
 		)
 		if err != nil {
@@ -150,10 +166,18 @@ func (c *awsClient) getRedshiftClusters(
 	// Used for pagination
 	var marker *string
 	for {
-		output, err := c.redshift.DescribeClusters(
+		output, err := observeAPICall(
 			ctx,
-			&redshift.DescribeClustersInput{
-				Marker: marker,
+			c.config.Region,
+			"Redshift",
+			"DescribeClusters",
+			func(ctx context.Context) (*redshift.DescribeClustersOutput, error) {
+				return c.redshift.DescribeClusters(
+					ctx,
+					&redshift.DescribeClustersInput{
+						Marker: marker,
+					},
+				)
 			},
 		)
 		if err != nil {
@@ -183,10 +207,18 @@ func (c *awsClient) getDynamoDBTables(
 	// Used for pagination
 	var exclusiveStartTableName *string
 	for {
-		output, err := c.dynamodb.ListTables(
+		output, err := observeAPICall(
 			ctx,
-			&dynamodb.ListTablesInput{
-				ExclusiveStartTableName: exclusiveStartTableName,
+			c.config.Region,
+			"DynamoDB",
+			"ListTables",
+			func(ctx context.Context) (*dynamodb.ListTablesOutput, error) {
+				return c.dynamodb.ListTables(
+					ctx,
+					&dynamodb.ListTablesInput{
+						ExclusiveStartTableName: exclusiveStartTableName,
+					},
+				)
 			},
 		)
 		if err != nil {
@@ -205,10 +237,18 @@ func (c *awsClient) getDynamoDBTables(
 	tables := make([]dynamoDBTable, 0, len(tableNames))
 	for i := range tableNames {
 		tableName := tableNames[i]
-		describeTableOutput, err := c.dynamodb.DescribeTable(
+		describeTableOutput, err := observeAPICall(
 			ctx,
-			&dynamodb.DescribeTableInput{
-				TableName: &tableName,
+			c.config.Region,
+			"DynamoDB",
+			"DescribeTable",
+			func(ctx context.Context) (*dynamodb.DescribeTableOutput, error) {
+				return c.dynamodb.DescribeTable(
+					ctx,
+					&dynamodb.DescribeTableInput{
+						TableName: &tableName,
+					},
+				)
 			},
 		)
 		if err != nil {
@@ -220,11 +260,19 @@ func (c *awsClient) getDynamoDBTables(
 		// Used for pagination
 		var nextToken *string
 		for {
-			tagsOutput, err := c.dynamodb.ListTagsOfResource(
+			tagsOutput, err := observeAPICall(
 				ctx,
-				&dynamodb.ListTagsOfResourceInput{
-					ResourceArn: table.TableArn,
-					NextToken:   nextToken,
+				c.config.Region,
+				"DynamoDB",
+				"ListTagsOfResource",
+				func(ctx context.Context) (*dynamodb.ListTagsOfResourceOutput, error) {
+					return c.dynamodb.ListTagsOfResource(
+						ctx,
+						&dynamodb.ListTagsOfResourceInput{
+							ResourceArn: table.TableArn,
+							NextToken:   nextToken,
+						},
+					)
 				},
 			)
 			if err != nil {
@@ -266,7 +314,15 @@ func (c *awsClient) getS3Buckets(
 	}
 
 	// First we fetch all the buckets
-	buckets, err := c.s3.ListBuckets(ctx, &s3.ListBucketsInput{})
+	buckets, err := observeAPICall(
+		ctx,
+		c.config.Region,
+		"S3",
+		"ListBuckets",
+		func(ctx context.Context) (*s3.ListBucketsOutput, error) {
+			return c.s3.ListBuckets(ctx, &s3.ListBucketsInput{})
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -274,9 +330,17 @@ func (c *awsClient) getS3Buckets(
 	// Then, for each bucket, we extract all tags
 	tagMap := make(map[string][]s3Types.Tag, len(buckets.Buckets))
 	for _, bucket := range buckets.Buckets {
-		tags, err := c.s3.GetBucketTagging(
+		tags, err := observeAPICall(
 			ctx,
-			&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+			c.config.Region,
+			"S3",
+			"GetBucketTagging",
+			func(ctx context.Context) (*s3.GetBucketTaggingOutput, error) {
+				return c.s3.GetBucketTagging(
+					ctx,
+					&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+				)
+			},
 		)
 		if err != nil {
 			// For some buckets we get an error here. This is not fatal, it just means
@@ -184,18 +184,53 @@ func scanRegion(
 func (s *AWSScanner) assumeRole(
 	ctx context.Context,
 ) error {
-	stsClient := sts.NewFromConfig(s.awsConfig)
-	credsProvider := stscreds.NewAssumeRoleProvider(
-		stsClient,
-		s.scannerConfig.AssumeRole.IAMRoleARN,
-		func(o *stscreds.AssumeRoleOptions) {
-			o.ExternalID = &s.scannerConfig.AssumeRole.ExternalID
-		},
+	credsProvider, err := assumeRoleCredentials(ctx, s.awsConfig, s.scannerConfig.AssumeRole)
+	if err != nil {
+		return err
+	}
+	s.awsConfig.Credentials = credsProvider
+	return nil
+}
+
+// assumeRoleCredentials returns the cached credentials provider of the given
+// IAM role, assumed with the credentials of awsConfig. The credentials are
+// retrieved once, to validate that the role can be assumed.
+func assumeRoleCredentials(
+	ctx context.Context,
+	awsConfig aws.Config,
+	assumeRole *AssumeRoleConfig,
+) (aws.CredentialsProvider, error) {
+	stsClient := sts.NewFromConfig(awsConfig)
+	credsProvider := aws.NewCredentialsCache(
+		stscreds.NewAssumeRoleProvider(
+			stsClient,
+			assumeRole.IAMRoleARN,
+			func(o *stscreds.AssumeRoleOptions) {
+				o.ExternalID = &assumeRole.ExternalID
+			},
+		),
 	)
-	s.awsConfig.Credentials = aws.NewCredentialsCache(credsProvider)
 	// Validate AWS credentials provider.
-	if _, err := s.awsConfig.Credentials.Retrieve(ctx); err != nil {
-		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	if _, err := credsProvider.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
 	}
-	return nil
+	return credsProvider, nil
+}
+
+// LoadConfig loads the AWS default external configuration. If assumeRole is
+// not nil, the IAM role is assumed, and its credentials are used instead of the
+// default ones.
+func LoadConfig(ctx context.Context, assumeRole *AssumeRoleConfig) (aws.Config, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	if assumeRole != nil {
+		credsProvider, err := assumeRoleCredentials(ctx, awsConfig, assumeRole)
+		if err != nil {
+			return aws.Config{}, fmt.Errorf("error assuming IAM role: %w", err)
+		}
+		awsConfig.Credentials = credsProvider
+	}
+	return awsConfig, nil
 }
@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the OpenTelemetry tracer and meter used by
+// this package. Like the sql package, only the global OpenTelemetry providers
+// are used, so spans and metrics are no-ops unless the application configures
+// them.
+const instrumentationName = "github.com/cyralinc/dmap/aws"
+
+// Attribute keys used for spans and metrics. The service, operation and region
+// keys follow the OpenTelemetry semantic conventions for AWS SDK calls.
+const (
+	attrRPCService = attribute.Key("rpc.service")
+	attrRPCMethod  = attribute.Key("rpc.method")
+	attrAWSRegion  = attribute.Key("cloud.region")
+)
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	// Instrument creation only fails for invalid instrument names, in which
+	// case a no-op instrument is returned, so the errors are safe to ignore.
+	apiCallDurationHistogram, _ = meter.Float64Histogram(
+		"dmap.aws.api.duration",
+		metric.WithDescription("Duration of AWS API calls."),
+		metric.WithUnit("s"),
+	)
+	apiErrorsCounter, _ = meter.Int64Counter(
+		"dmap.aws.api.errors",
+		metric.WithDescription("Number of failed AWS API calls."),
+		metric.WithUnit("{error}"),
+	)
+)
+
+// observeAPICall performs an AWS API call within a new span named after the
+// service and operation, and records the call duration and any returned error
+// in the package metrics.
+func observeAPICall[T any](
+	ctx context.Context,
+	region, service, operation string,
+	call func(ctx context.Context) (T, error),
+) (T, error) {
+	attrs := []attribute.KeyValue{
+		attrRPCService.String(service),
+		attrRPCMethod.String(operation),
+		attrAWSRegion.String(region),
+	}
+	ctx, span := tracer.Start(
+		ctx,
+		service+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	start := time.Now()
+	out, err := call(ctx)
+	apiCallDurationHistogram.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	if err != nil {
+		apiErrorsCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return out, err
+}
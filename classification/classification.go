@@ -22,6 +22,41 @@ type Classifier interface {
 	Classify(ctx context.Context, input map[string]any) (Result, error)
 }
 
+// MetadataClassifier is an optional interface which may be implemented by a
+// Classifier to also classify data attributes by their metadata, e.g. their
+// comments, rather than by their values. This allows attributes to be
+// classified even when their sampled values are empty or inconclusive.
+type MetadataClassifier interface {
+	// ClassifyMetadata classifies the attributes of the table described by the
+	// given metadata, and returns the data classifications of the attributes,
+	// keyed by attribute name (see Classifier.Classify).
+	ClassifyMetadata(ctx context.Context, input TableMetadata) (Result, error)
+}
+
+// TableMetadata is the metadata of a table (or any other collection of data
+// attributes), as classified by a MetadataClassifier.
+type TableMetadata struct {
+	// Schema is the name of the schema of the table.
+	Schema string `json:"schema"`
+	// Name is the name of the table.
+	Name string `json:"name"`
+	// Comment is the comment describing the table, or empty if there is none.
+	Comment string `json:"comment"`
+	// Attributes is the metadata of each attribute of the table, keyed by
+	// attribute name.
+	Attributes map[string]AttributeMetadata `json:"attributes"`
+}
+
+// AttributeMetadata is the metadata of a data attribute (e.g. a column), as
+// classified by a MetadataClassifier.
+type AttributeMetadata struct {
+	// DataType is the data type of the attribute.
+	DataType string `json:"dataType"`
+	// Comment is the comment describing the attribute, or empty if there is
+	// none.
+	Comment string `json:"comment"`
+}
+
 // Result represents the classifications for a set of data attributes. The key
 // is the attribute (i.e. column) name and the value is the set of labels
 // that attribute was classified as.
@@ -40,6 +75,20 @@ func (l LabelSet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(keys)
 }
 
+// UnmarshalJSON unmarshals a JSON array of label names, as produced by
+// MarshalJSON, into the LabelSet.
+func (l *LabelSet) UnmarshalJSON(data []byte) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	*l = make(LabelSet, len(keys))
+	for _, k := range keys {
+		(*l)[k] = struct{}{}
+	}
+	return nil
+}
+
 // Classification represents the classification of a data repository attribute.
 type Classification struct {
 	// AttributePath is the full path of the data repository attribute
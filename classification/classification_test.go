@@ -0,0 +1,20 @@
+package classification
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelSet_JSONRoundTrip(t *testing.T) {
+	c := Classification{
+		AttributePath: []string{"db", "schema", "table", "ssn"},
+		Labels:        LabelSet{"SSN": {}, "PII": {}},
+	}
+	data, err := json.Marshal(c)
+	require.NoError(t, err)
+	var actual Classification
+	require.NoError(t, json.Unmarshal(data, &actual))
+	require.Equal(t, c, actual)
+}
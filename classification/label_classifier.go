@@ -5,22 +5,35 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	log "github.com/sirupsen/logrus"
 )
 
+// metadataOutputRule is the name of the optional rule of a classification rule
+// module which classifies data attributes by their metadata (see
+// LabelClassifier.ClassifyMetadata).
+const metadataOutputRule = "metadata_output"
+
 // LabelClassifier is a Classifier implementation that uses a set of labels and
 // their classification rules to classify data.
 type LabelClassifier struct {
 	queries map[string]rego.PreparedEvalQuery
+	// metadataQueries are the queries of the labels whose classification rules
+	// define a metadata_output rule.
+	metadataQueries map[string]rego.PreparedEvalQuery
 }
 
-// LabelClassifier implements Classifier
-var _ Classifier = (*LabelClassifier)(nil)
+// LabelClassifier implements Classifier and MetadataClassifier
+var (
+	_ Classifier         = (*LabelClassifier)(nil)
+	_ MetadataClassifier = (*LabelClassifier)(nil)
+)
 
 // NewLabelClassifier creates a new LabelClassifier with the provided labels.
 func NewLabelClassifier(ctx context.Context, labels ...Label) (*LabelClassifier, error) {
 	queries := make(map[string]rego.PreparedEvalQuery, len(labels))
+	metadataQueries := make(map[string]rego.PreparedEvalQuery)
 	for _, lbl := range labels {
 		query, err := rego.New(
 			// We only care about the 'output' variable.
@@ -35,8 +48,34 @@ func NewLabelClassifier(ctx context.Context, labels ...Label) (*LabelClassifier,
 		} else {
 			queries[lbl.Name] = query
 		}
+		if !definesRule(lbl.ClassificationRule, metadataOutputRule) {
+			continue
+		}
+		query, err = rego.New(
+			rego.Query(lbl.ClassificationRule.Package.Path.String()+"."+metadataOutputRule),
+			rego.ParsedModule(lbl.ClassificationRule),
+		).PrepareForEval(ctx)
+		if err != nil {
+			log.WithError(err).Errorf(
+				"error preparing metadata query for label %s; label will not be evaluated for metadata classification",
+				lbl.Name,
+			)
+		} else {
+			metadataQueries[lbl.Name] = query
+		}
+	}
+	return &LabelClassifier{queries: queries, metadataQueries: metadataQueries}, nil
+}
+
+// definesRule returns true if the given module defines a rule with the given
+// name.
+func definesRule(module *ast.Module, name string) bool {
+	for _, rule := range module.Rules {
+		if ref := rule.Head.Ref(); len(ref) > 0 && ref[0].Equal(ast.VarTerm(name)) {
+			return true
+		}
 	}
-	return &LabelClassifier{queries: queries}, nil
+	return false
 }
 
 // Classify performs the classification of the provided input using the
@@ -45,9 +84,47 @@ func NewLabelClassifier(ctx context.Context, labels ...Label) (*LabelClassifier,
 // database row. The classifier returns a Result, which is a map of attribute
 // names to the set of labels that the attribute was classified as.
 func (c *LabelClassifier) Classify(ctx context.Context, input map[string]any) (Result, error) {
-	result := make(Result, len(c.queries))
+	return classifyWithQueries(ctx, c.queries, input)
+}
+
+// ClassifyMetadata performs the classification of the attributes described by
+// the provided table metadata, using the metadata_output rules of the
+// classifier's labels. Labels whose classification rules don't define a
+// metadata_output rule are not evaluated. The rules receive the metadata as
+// input, e.g.:
+//
+//	{
+//	  "schema": "public",
+//	  "name": "customers",
+//	  "comment": "Registered customers",
+//	  "attributes": {
+//	    "tax_id": {"dataType": "varchar", "comment": "Customer tax id"}
+//	  }
+//	}
+//
+// Like the output rule, the metadata_output rule must be an object of attribute
+// names to booleans indicating whether the attribute is classified as the
+// label.
+func (c *LabelClassifier) ClassifyMetadata(ctx context.Context, input TableMetadata) (Result, error) {
+	attrs := make(map[string]any, len(input.Attributes))
+	for name, attr := range input.Attributes {
+		attrs[name] = map[string]any{"dataType": attr.DataType, "comment": attr.Comment}
+	}
+	regoInput := map[string]any{
+		"schema":     input.Schema,
+		"name":       input.Name,
+		"comment":    input.Comment,
+		"attributes": attrs,
+	}
+	return classifyWithQueries(ctx, c.metadataQueries, regoInput)
+}
+
+// classifyWithQueries evaluates the given queries of each label with the given
+// input, and combines their outputs into a Result.
+func classifyWithQueries(ctx context.Context, queries map[string]rego.PreparedEvalQuery, input map[string]any) (Result, error) {
+	result := make(Result, len(queries))
 	var errs error
-	for lbl, query := range c.queries {
+	for lbl, query := range queries {
 		output, err := evalQuery(ctx, query, input)
 		if err != nil {
 			// A single error should not prevent the classification of other
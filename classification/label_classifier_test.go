@@ -118,6 +118,27 @@ func TestLabelClassifier_Classify(t *testing.T) {
 	}
 }
 
+func TestLabelClassifier_ClassifyMetadata(t *testing.T) {
+	classifier := newTestLabelClassifier(t, "AGE", "SSN")
+	// Only the SSN label defines a metadata_output rule.
+	require.Len(t, classifier.metadataQueries, 1)
+	got, err := classifier.ClassifyMetadata(
+		context.Background(),
+		TableMetadata{
+			Schema:  "public",
+			Name:    "customers",
+			Comment: "Registered customers",
+			Attributes: map[string]AttributeMetadata{
+				"tax_id": {DataType: "varchar", Comment: "Customer SSN, if any"},
+				"age":    {DataType: "integer", Comment: "Age in years"},
+				"notes":  {DataType: "text"},
+			},
+		},
+	)
+	require.NoError(t, err)
+	requireResultEqual(t, Result{"tax_id": {"SSN": {}}}, got)
+}
+
 func requireResultEqual(t *testing.T, want, got Result) {
 	require.Len(t, got, len(want))
 	for k, v := range want {
@@ -24,3 +24,10 @@ classify(key, val) if {
 	e_check := substring(t_val, 5, 4)
 	e_check != "0000"
 }
+
+# METADATA
+# entrypoint: true
+metadata_output[k] := v if {
+	some k in object.keys(input.attributes)
+	v := regex.match(`(?i)\b(ssn|social security( number)?)\b`, input.attributes[k].comment)
+}
@@ -71,3 +71,19 @@ test_valid_ssn_no_dashes_sequential if {
 test_valid_ssn_no_dashes_in_value if {
 	classifier_ssn.output.message == true with input as {"message": "this has a ssn 111111111 that is valid"}
 }
+
+test_metadata_ssn_comment if {
+	classifier_ssn.metadata_output.tax_id with input as {"attributes": {"tax_id": {"comment": "Customer SSN"}}}
+}
+
+test_metadata_social_security_comment if {
+	classifier_ssn.metadata_output.col with input as {"attributes": {"col": {"comment": "Social security number"}}}
+}
+
+test_metadata_no_comment if {
+	classifier_ssn.metadata_output.col == false with input as {"attributes": {"col": {"comment": ""}}}
+}
+
+test_metadata_unrelated_comment if {
+	classifier_ssn.metadata_output.col == false with input as {"attributes": {"col": {"comment": "Lessons learned"}}}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/alecthomas/kong"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/cyralinc/dmap/internal/telemetry"
 )
 
 type Globals struct {
@@ -13,6 +16,8 @@ type Globals struct {
 	ApiBaseUrl   string           `help:"Base URL of the Dmap API." default:"https://api.dmap.cyral.io"`
 	LogLevel     logLevelFlag     `help:"Set the logging level (trace|debug|info|warn|error|fatal)" enum:"trace,debug,info,warn,error,fatal" default:"info"`
 	LogFormat    logFormatFlag    `help:"Set the logging format (text|json)" enum:"text,json" default:"text"`
+	Traces       string           `help:"Exporter for OpenTelemetry traces (none|otlp). The OTLP exporter is configured through the standard OTEL_EXPORTER_OTLP_* environment variables." enum:"none,otlp" default:"none"`
+	Metrics      string           `help:"Exporter for metrics (none|otlp|prometheus). The Prometheus exporter is only supported by the serve command, which exposes the metrics at /metrics." enum:"none,otlp,prometheus" default:"none"`
 	Version      kong.VersionFlag `name:"version" help:"Print version information and quit"`
 }
 
@@ -51,6 +56,7 @@ func (l logFormatFlag) AfterApply() error {
 type CLI struct {
 	*Globals
 	RepoScan RepoScanCmd `cmd:"" help:"Perform data discovery and classification on a data repository."`
+	Serve    ServeCmd    `cmd:"" help:"Run an HTTP API server to submit and manage scan jobs."`
 }
 
 var (
@@ -82,3 +88,29 @@ func main() {
 	err := ctx.Run(cli.Globals)
 	ctx.FatalIfErrorf(err)
 }
+
+// setupTelemetry configures the OpenTelemetry providers according to the global
+// flags. The returned provider must be shut down before the command returns.
+func setupTelemetry(ctx context.Context, globals *Globals) (*telemetry.Provider, error) {
+	p, err := telemetry.Setup(
+		ctx,
+		telemetry.Config{
+			ServiceName:     "dmap",
+			ServiceVersion:  version,
+			TracesExporter:  globals.Traces,
+			MetricsExporter: globals.Metrics,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up telemetry: %w", err)
+	}
+	return p, nil
+}
+
+// shutdownTelemetry flushes and shuts down the telemetry provider, logging any
+// error, since it should not cause the command to fail.
+func shutdownTelemetry(p *telemetry.Provider) {
+	if err := p.Shutdown(context.Background()); err != nil {
+		log.WithError(err).Warn("error shutting down telemetry")
+	}
+}
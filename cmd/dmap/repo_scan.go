@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -11,32 +13,112 @@ import (
 	"github.com/alecthomas/kong"
 	"github.com/gobwas/glob"
 
+	"github.com/cyralinc/dmap/aws"
 	"github.com/cyralinc/dmap/internal/api"
+	"github.com/cyralinc/dmap/scan"
 	"github.com/cyralinc/dmap/sql"
 )
 
 type RepoScanCmd struct {
-	Type           string         `help:"Type of repository to connect to (postgres|mysql|oracle|sqlserver|snowflake|redshift|denodo)." enum:"postgres,mysql,oracle,sqlserver,snowflake,redshift,denodo" required:""`
-	Host           string         `help:"Hostname of the repository." required:""`
-	Port           uint16         `help:"Port of the repository." required:""`
-	User           string         `help:"Username to connect to the repository." required:""`
-	Password       string         `help:"Password to connect to the repository." required:""`
-	RepoID         string         `help:"The ID of the repository used by the Dmap service to identify the data repository. For RDS or Redshift, this is the ARN of the database. Optional, but required to publish the scan results Dmap service."`
-	Database       string         `help:"Name of the database to connect to. If not specified, the default database is used (if possible)."`
-	Advanced       map[string]any `help:"Advanced configuration for the repository, semicolon separated (e.g. key1=value1;key2=value2). Please see the documentation for details on how to provide this argument for specific repository types."`
-	IncludePaths   GlobFlag       `help:"List of glob patterns to include when introspecting the database(s), semicolon separated (e.g. foo*;bar*;*.baz)." default:"*"`
-	ExcludePaths   GlobFlag       `help:"List of glob patterns to exclude when introspecting the database(s), semicolon separated (e.g. foo*;bar*;*.baz)."`
-	MaxOpenConns   uint           `help:"Maximum number of open connections to the database." default:"10"`
-	MaxParallelDbs uint           `help:"Maximum number of parallel databases scanned at once. If zero, there is no limit." default:"0"`
-	MaxConcurrency uint           `help:"Maximum number of concurrent query goroutines. If zero, there is no limit." default:"0"`
-	QueryTimeout   time.Duration  `help:"Maximum time a query can run before being cancelled. If zero, there is no timeout." default:"0s"`
-	SampleSize     uint           `help:"Number of rows to sample from the repository (per table)." default:"5"`
-	Offset         uint           `help:"Offset to start sampling each table from." default:"0"`
-	LabelYamlFile  string         `help:"Filename of the yaml file containing the custom set of data labels (e.g. /path/to/labels.yaml). If omitted, a set of predefined labels is used."`
-	Silent         bool           `help:"Do not print the results to stdout." short:"s"`
+	Type               string         `help:"Type of repository to connect to (postgres|mysql|oracle|sqlserver|snowflake|redshift|denodo|mariadb|cockroachdb|tidb|clickhouse|trino)." enum:"postgres,mysql,oracle,sqlserver,snowflake,redshift,denodo,mariadb,cockroachdb,tidb,clickhouse,trino" required:""`
+	Host               string         `help:"Hostname of the repository." required:""`
+	Port               uint16         `help:"Port of the repository." required:""`
+	User               string         `help:"Username to connect to the repository." required:""`
+	Password           string         `help:"Password to connect to the repository. Required unless --iam-auth is set, the snowflake user authenticates with a private key or an OAuth token, or the trino user authenticates with an access token or not at all (see --advanced)."`
+	RepoID             string         `help:"The ID of the repository used by the Dmap service to identify the data repository. For RDS or Redshift, this is the ARN of the database. Optional, but required to publish the scan results Dmap service."`
+	Database           string         `help:"Name of the database to connect to. If not specified, the default database is used (if possible)."`
+	TLSMode            string         `help:"TLS mode of the connections to the repository (disable|require|verify-ca|verify-full). If omitted, the default of the repository driver is used." name:"tls-mode"`
+	TLSCAFile          string         `help:"PEM bundle of the certificate authorities trusted to issue the server certificate. If omitted, the system certificate authorities are trusted." name:"tls-ca-file"`
+	TLSCertFile        string         `help:"PEM client certificate to authenticate to the repository with." name:"tls-cert-file"`
+	TLSKeyFile         string         `help:"PEM private key of the client certificate." name:"tls-key-file"`
+	TLSServerName      string         `help:"Name the server certificate is verified against in the verify-full mode. If omitted, the host is used." name:"tls-server-name"`
+	IAMAuth            bool           `help:"Authenticate to the repository with AWS IAM instead of a password, using the default AWS credentials: RDS authentication tokens for postgres and mysql (RDS and Aurora), and temporary cluster credentials for redshift." name:"iam-auth"`
+	AWSRegion          string         `help:"AWS region of the repository, for --iam-auth. If omitted, the region of the default AWS configuration is used." name:"aws-region"`
+	IAMRoleARN         string         `help:"ARN of the IAM role to assume for --iam-auth. If omitted, the default AWS credentials are used directly." name:"iam-role-arn"`
+	IAMExternalID      string         `help:"External ID of the IAM role to assume for --iam-auth." name:"iam-external-id"`
+	RedshiftClusterID  string         `help:"Identifier of the Redshift cluster, for --iam-auth. If omitted, it is derived from the host." name:"redshift-cluster-id"`
+	SSHHost            string         `help:"Hostname of the SSH server (e.g. a bastion host) to tunnel the connections to the repository through. If omitted, the repository is connected to directly." name:"ssh-host"`
+	SSHPort            uint16         `help:"Port of the SSH server." name:"ssh-port" default:"22"`
+	SSHUser            string         `help:"Username to authenticate to the SSH server with." name:"ssh-user"`
+	SSHKeyFile         string         `help:"Private key to authenticate to the SSH server with." name:"ssh-key-file"`
+	SSHKeyPassphrase   string         `help:"Passphrase of the SSH private key, if it is encrypted." name:"ssh-key-passphrase"`
+	SSHAgent           bool           `help:"Authenticate to the SSH server with the keys of the SSH agent (SSH_AUTH_SOCK)." name:"ssh-agent"`
+	SSHKnownHostsFile  string         `help:"known_hosts file to verify the host key of the SSH server against. If omitted, ~/.ssh/known_hosts is used." name:"ssh-known-hosts-file"`
+	Advanced           map[string]any `help:"Advanced configuration for the repository, semicolon separated (e.g. key1=value1;key2=value2). Please see the documentation for details on how to provide this argument for specific repository types."`
+	IncludePaths       GlobFlag       `help:"List of glob patterns to include when introspecting the database(s), semicolon separated (e.g. foo*;bar*;*.baz)." default:"*"`
+	ExcludePaths       GlobFlag       `help:"List of glob patterns to exclude when introspecting the database(s), semicolon separated (e.g. foo*;bar*;*.baz)."`
+	IncludeObjectTypes []string       `help:"List of object types of the tables to include when introspecting the database(s), semicolon separated (table|view|materialized_view|external_table|foreign_table|partition). If omitted, all object types are included." sep:";"`
+	ExcludeObjectTypes []string       `help:"List of object types of the tables to exclude when introspecting the database(s), semicolon separated (e.g. view;partition)." sep:";"`
+	IncludeColumns     GlobFlag       `help:"List of glob patterns of the columns to sample, semicolon separated, matched against the full column path (e.g. *.email;*.ssn). If omitted, all columns are sampled."`
+	ExcludeColumns     GlobFlag       `help:"List of glob patterns of the columns not to sample, semicolon separated, matched against the full column path (e.g. *.raw_payload;db.schema.table.*_blob)."`
+	ExcludeDataTypes   []string       `help:"List of data types of the columns not to sample, semicolon separated, compared case-insensitively (e.g. bytea;image;geometry)." sep:";"`
+	MaxValueLength     uint           `help:"Maximum length of the sampled values of textual columns, longer values are truncated. If zero, the values are not truncated." default:"0"`
+	MaxOpenConns       uint           `help:"Maximum number of open connections to the database." default:"10"`
+	MaxParallelDbs     uint           `help:"Maximum number of parallel databases scanned at once. If zero, there is no limit." default:"0"`
+	MaxConcurrency     uint           `help:"Maximum number of concurrent query goroutines per database. If zero, --max-open-conns is used, or the number of classification workers if it is zero too." default:"0"`
+	QueryTimeout       time.Duration  `help:"Maximum time a query can run before being cancelled. If zero, there is no timeout." default:"0s"`
+	MaxQPS             float64        `help:"Maximum number of queries per second issued to the repository, across all databases. If zero, there is no limit." name:"max-qps" default:"0"`
+	QPSBurst           uint           `help:"Maximum number of queries issued at once within --max-qps, after the scanner has been idle." name:"qps-burst" default:"0"`
+	AdaptiveQPS        bool           `help:"Lower the query rate when the queries get slower than --target-latency or the repository load exceeds --max-load, and raise it back up to --max-qps once they are fast again." name:"adaptive-qps"`
+	TargetLatency      time.Duration  `help:"Query latency above which --adaptive-qps lowers the query rate. If zero, one second is used." default:"0s"`
+	MaxLoad            float64        `help:"Repository load above which --adaptive-qps lowers the query rate: the active connections for postgres, the running threads for mysql and mariadb, the running queries for clickhouse and the queued queries for snowflake and trino. Other repository types do not report their load. If zero, the load is not polled." default:"0"`
+	RetryAttempts      uint           `help:"Maximum number of attempts of each repository call (connect, list, introspect and sample) failing with a transient error, e.g. a dropped connection or a deadlock. If zero or one, the calls are not retried." default:"0"`
+	RetryBackoff       time.Duration  `help:"Maximum backoff before the first retry, doubled for each subsequent retry. The actual backoff is randomized." default:"500ms"`
+	RetryMaxBackoff    time.Duration  `help:"Maximum backoff between two retries." default:"30s"`
+	Relationships      bool           `help:"Collect the primary and foreign keys of each table. The foreign key relationships are included in the results, and the columns referencing tables with sensitive data are reported as linked to its labels."`
+	RelationshipGraph  string         `help:"File to write the graph of the foreign key relationships to (implies --relationships). The graph is written in Graphviz DOT format if the file has a .dot or .gv extension, and as JSON otherwise."`
+	TableStats         bool           `help:"Collect the estimated row count and size of each table from the database catalog. They are included in the results, and tables which the database reports as empty with an exact row count (Snowflake and ClickHouse) are not sampled."`
+	ClassifyWorkers    uint           `help:"Number of goroutines classifying the sampled tables concurrently. If zero, the number of CPUs is used." default:"0"`
+	SampleSize         uint           `help:"Number of rows to sample from the repository (per table)." default:"5"`
+	Offset             uint           `help:"Offset to start sampling each table from." default:"0"`
+	LabelYamlFile      string         `help:"Filename of the yaml file containing the custom set of data labels (e.g. /path/to/labels.yaml). If omitted, a set of predefined labels is used."`
+	CheckpointFile     string         `help:"File to record the progress of the scan in (e.g. /path/to/checkpoint.jsonl), so that it can be resumed with --resume if it is interrupted."`
+	Resume             bool           `help:"Resume an interrupted scan from the checkpoint file. Tables which were already scanned are skipped, and their results are merged with the new ones."`
+	IncrementalFrom    string         `help:"Checkpoint file of a previous scan (see --checkpoint-file). Tables which are unchanged since that scan are skipped, and their previous results are carried forward. May be the same file as --checkpoint-file."`
+	Silent             bool           `help:"Do not print the results to stdout." short:"s"`
 }
 
 func (cmd *RepoScanCmd) Validate() error {
+	if globals.Metrics == "prometheus" {
+		return fmt.Errorf("the prometheus metrics exporter is only supported by the serve command")
+	}
+	if cmd.Resume && cmd.CheckpointFile == "" {
+		return fmt.Errorf("resume requires checkpoint-file")
+	}
+	if cmd.IAMAuth {
+		switch cmd.Type {
+		case sql.RepoTypePostgres, sql.RepoTypeMysql, sql.RepoTypeRedshift:
+		default:
+			return fmt.Errorf("iam-auth is not supported by repository type %s", cmd.Type)
+		}
+		if cmd.Password != "" {
+			return fmt.Errorf("password and iam-auth are mutually exclusive")
+		}
+	} else if cmd.Password == "" && cmd.Type != sql.RepoTypeSnowflake && cmd.Type != sql.RepoTypeTrino {
+		// Snowflake and Trino users may authenticate with the advanced
+		// configuration instead, which is validated by the repository. Trino
+		// clusters may also not authenticate users at all.
+		return fmt.Errorf("password is required unless iam-auth is set")
+	}
+	if rateLimit := cmd.rateLimitConfig(); rateLimit != nil {
+		if err := rateLimit.Validate(); err != nil {
+			return fmt.Errorf("invalid rate limit config: %w", err)
+		}
+	}
+	if sshTunnel := cmd.sshTunnelConfig(); sshTunnel != nil {
+		if err := sshTunnel.Validate(); err != nil {
+			return fmt.Errorf("invalid ssh tunnel config: %w", err)
+		}
+	}
+	if err := cmd.tlsConfig().Validate(); err != nil {
+		return fmt.Errorf("invalid tls config: %w", err)
+	}
+	if _, err := parseObjectTypes(cmd.IncludeObjectTypes); err != nil {
+		return fmt.Errorf("invalid include-object-types: %w", err)
+	}
+	if _, err := parseObjectTypes(cmd.ExcludeObjectTypes); err != nil {
+		return fmt.Errorf("invalid exclude-object-types: %w", err)
+	}
 	if cmd.RepoID != "" {
 		if globals.ClientID == "" || globals.ClientSecret == "" {
 			return fmt.Errorf("repo-id was provided, but client-id and client-secret are also required to publish results to Dmap")
@@ -48,8 +130,10 @@ func (cmd *RepoScanCmd) Validate() error {
 // GlobFlag is a kong.MapperValue implementation that represents a glob pattern.
 type GlobFlag []glob.Glob
 
-// Decode parses the glob patterns and compiles them into glob.Glob objects. It
-// is an implementation of kong.MapperValue's Decode method.
+// Decode parses the glob patterns and compiles them into sql.PathGlob objects,
+// which retain their patterns so that they can be pushed down into the
+// introspection queries. It is an implementation of kong.MapperValue's Decode
+// method.
 func (g GlobFlag) Decode(ctx *kong.DecodeContext) error {
 	var patterns string
 	if err := ctx.Scan.PopValueInto("patterns", &patterns); err != nil {
@@ -57,7 +141,7 @@ func (g GlobFlag) Decode(ctx *kong.DecodeContext) error {
 	}
 	var parsedPatterns []glob.Glob
 	for _, pattern := range strings.Split(patterns, ";") {
-		parsedPattern, err := glob.Compile(pattern)
+		parsedPattern, err := sql.CompilePathGlob(pattern)
 		if err != nil {
 			return fmt.Errorf("cannot compile %s pattern: %w", pattern, err)
 		}
@@ -67,11 +151,108 @@ func (g GlobFlag) Decode(ctx *kong.DecodeContext) error {
 	return nil
 }
 
+// tlsConfig returns the TLS configuration of the connections to the repository.
+func (cmd *RepoScanCmd) tlsConfig() sql.TLSConfig {
+	return sql.TLSConfig{
+		Mode:       sql.TLSMode(cmd.TLSMode),
+		CAFile:     cmd.TLSCAFile,
+		CertFile:   cmd.TLSCertFile,
+		KeyFile:    cmd.TLSKeyFile,
+		ServerName: cmd.TLSServerName,
+	}
+}
+
+// iamAuthConfig returns the AWS IAM authentication configuration of the
+// repository, or nil if IAM authentication isn't enabled.
+func (cmd *RepoScanCmd) iamAuthConfig() *sql.IAMAuthConfig {
+	if !cmd.IAMAuth {
+		return nil
+	}
+	cfg := &sql.IAMAuthConfig{
+		Region:            cmd.AWSRegion,
+		ClusterIdentifier: cmd.RedshiftClusterID,
+	}
+	if cmd.IAMRoleARN != "" {
+		cfg.AssumeRole = &aws.AssumeRoleConfig{
+			IAMRoleARN: cmd.IAMRoleARN,
+			ExternalID: cmd.IAMExternalID,
+		}
+	}
+	return cfg
+}
+
+// rateLimitConfig returns the configuration of the query rate limit of the
+// scan, or nil if the query rate is not limited.
+func (cmd *RepoScanCmd) rateLimitConfig() *sql.RateLimitConfig {
+	if cmd.MaxQPS == 0 && cmd.QPSBurst == 0 && !cmd.AdaptiveQPS && cmd.TargetLatency == 0 && cmd.MaxLoad == 0 {
+		return nil
+	}
+	return &sql.RateLimitConfig{
+		QueriesPerSecond: cmd.MaxQPS,
+		Burst:            cmd.QPSBurst,
+		Adaptive:         cmd.AdaptiveQPS,
+		TargetLatency:    cmd.TargetLatency,
+		MaxLoad:          cmd.MaxLoad,
+	}
+}
+
+// retryConfig returns the configuration of the retries of the repository
+// calls, or nil if they are not retried.
+func (cmd *RepoScanCmd) retryConfig() *sql.RetryConfig {
+	if cmd.RetryAttempts <= 1 {
+		return nil
+	}
+	return &sql.RetryConfig{
+		MaxAttempts:    cmd.RetryAttempts,
+		InitialBackoff: cmd.RetryBackoff,
+		MaxBackoff:     cmd.RetryMaxBackoff,
+	}
+}
+
+// sshTunnelConfig returns the configuration of the SSH tunnel to the
+// repository, or nil if the repository is connected to directly.
+func (cmd *RepoScanCmd) sshTunnelConfig() *sql.SSHTunnelConfig {
+	if cmd.SSHHost == "" {
+		return nil
+	}
+	return &sql.SSHTunnelConfig{
+		Host:                 cmd.SSHHost,
+		Port:                 cmd.SSHPort,
+		User:                 cmd.SSHUser,
+		PrivateKeyFile:       cmd.SSHKeyFile,
+		PrivateKeyPassphrase: cmd.SSHKeyPassphrase,
+		UseAgent:             cmd.SSHAgent,
+		KnownHostsFile:       cmd.SSHKnownHostsFile,
+	}
+}
+
+// parseObjectTypes parses the given object type names.
+func parseObjectTypes(names []string) ([]sql.ObjectType, error) {
+	var types []sql.ObjectType
+	for _, name := range names {
+		t, err := sql.ParseObjectType(name)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
 func (cmd *RepoScanCmd) Run(globals *Globals) error {
 	ctx := context.Background()
+	tp, err := setupTelemetry(ctx, globals)
+	if err != nil {
+		return err
+	}
+	defer shutdownTelemetry(tp)
+	// The object types were already validated by Validate.
+	includeObjectTypes, _ := parseObjectTypes(cmd.IncludeObjectTypes)
+	excludeObjectTypes, _ := parseObjectTypes(cmd.ExcludeObjectTypes)
 	// Configure and instantiate the scanner.
 	cfg := sql.ScannerConfig{
 		RepoType: cmd.Type,
+		RepoID:   cmd.RepoID,
 		RepoConfig: sql.RepoConfig{
 			Host:           cmd.Host,
 			Port:           cmd.Port,
@@ -82,13 +263,30 @@ func (cmd *RepoScanCmd) Run(globals *Globals) error {
 			MaxParallelDbs: cmd.MaxParallelDbs,
 			MaxConcurrency: cmd.MaxConcurrency,
 			QueryTimeout:   cmd.QueryTimeout,
+			RateLimit:      cmd.rateLimitConfig(),
+			TLS:            cmd.tlsConfig(),
+			IAMAuth:        cmd.iamAuthConfig(),
+			SSHTunnel:      cmd.sshTunnelConfig(),
 			Advanced:       cmd.Advanced,
 		},
-		IncludePaths:       cmd.IncludePaths,
-		ExcludePaths:       cmd.ExcludePaths,
-		SampleSize:         cmd.SampleSize,
-		Offset:             cmd.Offset,
-		LabelsYamlFilename: cmd.LabelYamlFile,
+		IncludePaths:         cmd.IncludePaths,
+		ExcludePaths:         cmd.ExcludePaths,
+		IncludeObjectTypes:   includeObjectTypes,
+		ExcludeObjectTypes:   excludeObjectTypes,
+		IncludeColumns:       cmd.IncludeColumns,
+		ExcludeColumns:       cmd.ExcludeColumns,
+		ExcludeDataTypes:     cmd.ExcludeDataTypes,
+		MaxValueLength:       cmd.MaxValueLength,
+		SampleSize:           cmd.SampleSize,
+		Offset:               cmd.Offset,
+		LabelsYamlFilename:   cmd.LabelYamlFile,
+		ClassifyWorkers:      cmd.ClassifyWorkers,
+		CollectTableStats:    cmd.TableStats,
+		CollectRelationships: cmd.Relationships || cmd.RelationshipGraph != "",
+		CheckpointFilename:   cmd.CheckpointFile,
+		Resume:               cmd.Resume,
+		IncrementalFrom:      cmd.IncrementalFrom,
+		Retry:                cmd.retryConfig(),
 	}
 	scanner, err := sql.NewScanner(ctx, cfg)
 	if err != nil {
@@ -107,6 +305,11 @@ func (cmd *RepoScanCmd) Run(globals *Globals) error {
 		}
 		fmt.Println(string(jsonResults))
 	}
+	if cmd.RelationshipGraph != "" {
+		if err := writeRelationshipGraph(cmd.RelationshipGraph, results); err != nil {
+			return err
+		}
+	}
 	// Publish the results to the Dmap API.
 	if cmd.RepoID != "" {
 		client := api.NewDmapClient(globals.ApiBaseUrl, globals.ClientID, globals.ClientSecret)
@@ -117,3 +320,23 @@ func (cmd *RepoScanCmd) Run(globals *Globals) error {
 	}
 	return nil
 }
+
+// writeRelationshipGraph writes the relationship graph of the scan results to
+// the given file, in the format indicated by its extension.
+func writeRelationshipGraph(fname string, results *scan.RepoScanResults) (err error) {
+	format := sql.GraphFormatJSON
+	switch filepath.Ext(fname) {
+	case ".dot", ".gv":
+		format = sql.GraphFormatDOT
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return fmt.Errorf("error creating relationship graph file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing relationship graph file: %w", closeErr)
+		}
+	}()
+	return sql.WriteRelationshipGraph(f, results, format)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cyralinc/dmap/internal/server"
+)
+
+type ServeCmd struct {
+	ListenAddr      string        `help:"Address for the HTTP API server to listen on." default:":8080"`
+	Workers         uint          `help:"Maximum number of scan jobs which run concurrently." default:"4"`
+	QueueSize       uint          `help:"Maximum number of scan jobs waiting for a free worker. Further submissions are rejected." default:"100"`
+	MaxFinishedJobs uint          `help:"Maximum number of finished scan jobs kept with their results and events. Once exceeded, the oldest ones are evicted." default:"1000"`
+	JobRetention    time.Duration `help:"How long finished scan jobs are kept with their results and events before they are evicted. Zero keeps them until --max-finished-jobs is exceeded." default:"24h"`
+	CredentialsFile string        `help:"YAML file mapping credentials references to repository credentials (e.g. /path/to/credentials.yaml). Required to submit repository scans."`
+	ShutdownTimeout time.Duration `help:"Maximum time to wait for running jobs and requests to finish when shutting down." default:"30s"`
+}
+
+func (cmd *ServeCmd) Run(globals *Globals) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	tp, err := setupTelemetry(ctx, globals)
+	if err != nil {
+		return err
+	}
+	defer shutdownTelemetry(tp)
+	cfg := server.Config{
+		Workers:         cmd.Workers,
+		QueueSize:       cmd.QueueSize,
+		MaxFinishedJobs: cmd.MaxFinishedJobs,
+		JobRetention:    cmd.JobRetention,
+	}
+	if cmd.CredentialsFile != "" {
+		creds, err := server.NewFileCredentialResolver(cmd.CredentialsFile)
+		if err != nil {
+			return fmt.Errorf("error loading credentials: %w", err)
+		}
+		cfg.Credentials = creds
+	}
+	srv := server.New(cfg)
+	mux := http.NewServeMux()
+	mux.Handle("/", srv)
+	if h := tp.MetricsHandler(); h != nil {
+		mux.Handle("GET /metrics", h)
+	}
+	httpSrv := &http.Server{
+		Addr:              cmd.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		log.Infof("API server listening on %s", cmd.ListenAddr)
+		errCh <- httpSrv.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		_ = srv.Close(context.Background())
+		return fmt.Errorf("error running API server: %w", err)
+	case <-ctx.Done():
+	}
+	log.Info("shutting down API server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cmd.ShutdownTimeout)
+	defer cancel()
+	// Stop the jobs first so that any open event streams terminate, and then
+	// wait for the in-flight requests.
+	errs := srv.Close(shutdownCtx)
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = errors.Join(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Credentials holds the secrets needed to connect to a data repository. They
+// are never accepted inline in a job request; instead, a request references a
+// set of credentials by name, which is resolved server-side by a
+// CredentialResolver.
+type Credentials struct {
+	// User is the username to connect to the repository.
+	User string `yaml:"user"`
+	// Password is the password to connect to the repository.
+	Password string `yaml:"password"`
+}
+
+// CredentialResolver resolves a credentials reference, as provided in a job
+// request, to the actual repository credentials.
+type CredentialResolver interface {
+	// ResolveCredentials returns the credentials referenced by ref. An error is
+	// returned if the reference is unknown or cannot be resolved.
+	ResolveCredentials(ctx context.Context, ref string) (Credentials, error)
+}
+
+// StaticCredentials is a CredentialResolver backed by a fixed map of
+// credentials, where the key is the credentials reference.
+type StaticCredentials map[string]Credentials
+
+// StaticCredentials implements CredentialResolver
+var _ CredentialResolver = StaticCredentials(nil)
+
+// ResolveCredentials returns the credentials stored under ref. See
+// CredentialResolver.ResolveCredentials for more details.
+func (c StaticCredentials) ResolveCredentials(_ context.Context, ref string) (Credentials, error) {
+	creds, ok := c[ref]
+	if !ok {
+		return Credentials{}, fmt.Errorf("unknown credentials reference %q", ref)
+	}
+	return creds, nil
+}
+
+// NewFileCredentialResolver reads the given YAML file and returns a
+// StaticCredentials resolver with its contents. The file is expected to be a
+// map of credentials references to their user and password, e.g.:
+//
+//	prod-postgres:
+//	  user: dmap
+//	  password: secret
+func NewFileCredentialResolver(fname string) (StaticCredentials, error) {
+	b, err := os.ReadFile(fname) // #nosec G304 -- path is provided by the operator
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials file %s: %w", fname, err)
+	}
+	creds := make(StaticCredentials)
+	if err := yaml.Unmarshal(b, &creds); err != nil {
+		return nil, fmt.Errorf("error unmarshalling credentials file %s: %w", fname, err)
+	}
+	return creds, nil
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFileCredentialResolver(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "credentials.yaml")
+	contents := `
+prod-postgres:
+  user: dmap
+  password: "p@ss:w/rd"
+`
+	require.NoError(t, os.WriteFile(fname, []byte(contents), 0600))
+	creds, err := NewFileCredentialResolver(fname)
+	require.NoError(t, err)
+	got, err := creds.ResolveCredentials(context.Background(), "prod-postgres")
+	require.NoError(t, err)
+	require.Equal(t, Credentials{User: "dmap", Password: "p@ss:w/rd"}, got)
+	_, err = creds.ResolveCredentials(context.Background(), "unknown")
+	require.Error(t, err)
+}
+
+func TestNewFileCredentialResolver_MissingFile(t *testing.T) {
+	_, err := NewFileCredentialResolver(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
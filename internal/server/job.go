@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cyralinc/dmap/scan"
+)
+
+// JobKind is the kind of scan performed by a job.
+type JobKind string
+
+const (
+	// JobKindRepoScan is a data repository scan, performed by sql.Scanner.
+	JobKindRepoScan JobKind = "repo-scan"
+	// JobKindCloudScan is a cloud environment scan, performed by
+	// aws.AWSScanner.
+	JobKindCloudScan JobKind = "cloud-scan"
+)
+
+// JobStatus is the lifecycle status of a job.
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// Done returns true if the status is terminal, i.e. the job will not change
+// status anymore.
+func (s JobStatus) Done() bool {
+	return s == JobStatusSucceeded || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+var (
+	// errQueueFull is returned when a job is submitted but the job queue is at
+	// capacity.
+	errQueueFull = errors.New("job queue is full")
+	// errPoolClosed is returned when a job is submitted after the pool was
+	// closed.
+	errPoolClosed = errors.New("job pool is closed")
+)
+
+// JobInfo is a point-in-time snapshot of a job's state, as returned by the
+// API.
+type JobInfo struct {
+	ID         string     `json:"id"`
+	Kind       JobKind    `json:"kind"`
+	Status     JobStatus  `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// JobEvent is a progress event emitted by a job. Events are numbered
+// sequentially per job, starting at zero.
+type JobEvent struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	Status  JobStatus `json:"status"`
+	Message string    `json:"message,omitempty"`
+	// TablePath is the path of the table which was classified, for the
+	// table events of repository scans.
+	TablePath []string `json:"tablePath,omitempty"`
+	// Labels are the names of the labels found in the classified table, for
+	// the table events of repository scans.
+	Labels []string `json:"labels,omitempty"`
+	// Failure is the failure which occurred, for the failure events of
+	// repository scans.
+	Failure *scan.Failure `json:"failure,omitempty"`
+}
+
+// jobFunc is the function executed by a job. The returned value is stored as
+// the job's results. If both results and an error are returned, the job is
+// still considered successful and the error is reported alongside the results.
+type jobFunc func(ctx context.Context, j *job) (any, error)
+
+// job is a single scan job managed by a jobPool. All fields following mu are
+// guarded by it.
+type job struct {
+	id        string
+	kind      JobKind
+	createdAt time.Time
+	run       jobFunc
+
+	mu         sync.Mutex
+	status     JobStatus
+	startedAt  time.Time
+	finishedAt time.Time
+	err        error
+	results    any
+	events     []JobEvent
+	// changed is closed and replaced every time a new event is appended, so
+	// that subscribers can wait for new events without polling.
+	changed chan struct{}
+	cancel  context.CancelFunc
+}
+
+func newJob(kind JobKind, run jobFunc) (*job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	j := &job{
+		id:        id,
+		kind:      kind,
+		createdAt: time.Now().UTC(),
+		run:       run,
+		changed:   make(chan struct{}),
+	}
+	j.setStatus(JobStatusQueued, "")
+	return j, nil
+}
+
+// Info returns a snapshot of the job's current state.
+func (j *job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := JobInfo{
+		ID:        j.id,
+		Kind:      j.kind,
+		Status:    j.status,
+		CreatedAt: j.createdAt,
+	}
+	if !j.startedAt.IsZero() {
+		t := j.startedAt
+		info.StartedAt = &t
+	}
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		info.FinishedAt = &t
+	}
+	if j.err != nil {
+		info.Error = j.err.Error()
+	}
+	return info
+}
+
+// Results returns the job's results and status. The results are nil unless the
+// job has succeeded.
+func (j *job) Results() (any, JobStatus) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.results, j.status
+}
+
+// Progress records a progress message for the job without changing its
+// status. It is intended to be called by the job's function while running.
+func (j *job) Progress(msg string) {
+	j.Report(JobEvent{Message: msg})
+}
+
+// Report records the given event for the job without changing its status. Its
+// sequence number, time and status are set by the job. It is intended to be
+// called by the job's function while running.
+func (j *job) Report(evt JobEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.appendEventLocked(evt)
+}
+
+// finishedBefore returns true if the job has finished before t.
+func (j *job) finishedBefore(t time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status.Done() && j.finishedAt.Before(t)
+}
+
+// EventsSince returns all the job events with a sequence number greater than or
+// equal to seq, along with a channel which is closed once further events are
+// available.
+func (j *job) EventsSince(seq int) ([]JobEvent, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if seq < 0 {
+		seq = 0
+	}
+	var evts []JobEvent
+	if seq < len(j.events) {
+		evts = make([]JobEvent, len(j.events)-seq)
+		copy(evts, j.events[seq:])
+	}
+	return evts, j.changed
+}
+
+// Cancel cancels the job. A queued job is marked as cancelled immediately and
+// will never run, while a running job has its context cancelled and is marked
+// as cancelled once its function returns. It returns false if the job had
+// already finished.
+func (j *job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case j.status.Done():
+		return false
+	case j.status == JobStatusQueued:
+		j.finishedAt = time.Now().UTC()
+		j.status = JobStatusCancelled
+		j.appendEventLocked(JobEvent{Message: "cancelled before start"})
+	case j.cancel != nil:
+		j.cancel()
+	}
+	return true
+}
+
+// execute runs the job's function, recording its status, results and events.
+// It is a no-op if the job was cancelled while queued.
+func (j *job) execute(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	j.mu.Lock()
+	if j.status != JobStatusQueued {
+		j.mu.Unlock()
+		return
+	}
+	j.cancel = cancel
+	j.startedAt = time.Now().UTC()
+	j.status = JobStatusRunning
+	j.appendEventLocked(JobEvent{})
+	j.mu.Unlock()
+
+	results, err := j.run(ctx, j)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cancel = nil
+	j.finishedAt = time.Now().UTC()
+	j.err = err
+	switch {
+	case ctx.Err() != nil && results == nil:
+		j.status = JobStatusCancelled
+	case results == nil:
+		j.status = JobStatusFailed
+	default:
+		j.results = results
+		j.status = JobStatusSucceeded
+	}
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	j.appendEventLocked(JobEvent{Message: msg})
+}
+
+func (j *job) setStatus(status JobStatus, msg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+	j.appendEventLocked(JobEvent{Message: msg})
+}
+
+// appendEventLocked appends the given event with the next sequence number, the
+// current time and the job's current status, and wakes up any subscribers. The
+// caller must hold j.mu.
+func (j *job) appendEventLocked(evt JobEvent) {
+	evt.Seq = len(j.events)
+	evt.Time = time.Now().UTC()
+	evt.Status = j.status
+	j.events = append(j.events, evt)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// jobPool runs jobs on a fixed number of worker goroutines. Submitted jobs are
+// buffered in a bounded queue; once the queue is full, further submissions are
+// rejected until a worker frees up a slot. Finished jobs are kept, along with
+// their results and events, until they are evicted: either once they have been
+// finished for longer than the retention period, or once there are more than
+// maxFinished finished jobs, oldest first.
+type jobPool struct {
+	queue       chan *job
+	retention   time.Duration
+	maxFinished int
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+
+	mu     sync.RWMutex
+	jobs   map[string]*job
+	closed bool
+}
+
+// newJobPool creates a new jobPool and starts its workers. At least one worker,
+// a queue size of one and a single finished job are always used. If retention
+// is zero, finished jobs are only evicted once there are more than maxFinished.
+func newJobPool(workers, queueSize, maxFinished uint, retention time.Duration) *jobPool {
+	workers = max(workers, 1)
+	queueSize = max(queueSize, 1)
+	maxFinished = max(maxFinished, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &jobPool{
+		queue:       make(chan *job, queueSize),
+		retention:   retention,
+		maxFinished: int(maxFinished), // #nosec G115 -- maxFinished is bounded by the caller
+		ctx:         ctx,
+		cancel:      cancel,
+		jobs:        make(map[string]*job),
+	}
+	p.wg.Add(int(workers)) // #nosec G115 -- workers is bounded by the caller
+	for i := uint(0); i < workers; i++ {
+		go p.work()
+	}
+	if retention > 0 {
+		go p.expire(retention)
+	}
+	return p
+}
+
+// Submit creates a new job and enqueues it for execution.
+func (p *jobPool) Submit(kind JobKind, run jobFunc) (*job, error) {
+	j, err := newJob(kind, run)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, errPoolClosed
+	}
+	select {
+	case p.queue <- j:
+	default:
+		return nil, errQueueFull
+	}
+	p.jobs[j.id] = j
+	log.Infof("submitted %s job %s", kind, j.id)
+	return j, nil
+}
+
+// Get returns the job with the given ID, if it exists and hasn't been evicted.
+func (p *jobPool) Get(id string) (*job, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	j, ok := p.jobs[id]
+	// The job may have expired since the last eviction.
+	if ok && p.retention > 0 && j.finishedBefore(time.Now().UTC().Add(-p.retention)) {
+		return nil, false
+	}
+	return j, ok
+}
+
+// evict removes the finished jobs which have been finished for longer than the
+// retention period, if any, and then the oldest finished jobs in excess of
+// maxFinished.
+func (p *jobPool) evict() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var cutoff time.Time
+	if p.retention > 0 {
+		cutoff = time.Now().UTC().Add(-p.retention)
+	}
+	var finished []JobInfo
+	for id, j := range p.jobs {
+		info := j.Info()
+		if !info.Status.Done() {
+			continue
+		}
+		if info.FinishedAt.Before(cutoff) {
+			delete(p.jobs, id)
+			log.Debugf("evicted expired %s job %s", info.Kind, id)
+			continue
+		}
+		finished = append(finished, info)
+	}
+	if len(finished) <= p.maxFinished {
+		return
+	}
+	slices.SortFunc(
+		finished,
+		func(a, b JobInfo) int { return a.FinishedAt.Compare(*b.FinishedAt) },
+	)
+	for _, info := range finished[:len(finished)-p.maxFinished] {
+		delete(p.jobs, info.ID)
+		log.Debugf("evicted %s job %s", info.Kind, info.ID)
+	}
+}
+
+// expire periodically evicts the expired jobs, until the pool is closed.
+func (p *jobPool) expire(retention time.Duration) {
+	ticker := time.NewTicker(min(retention, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.evict()
+		}
+	}
+}
+
+// Close stops accepting new jobs, cancels all queued and running jobs, and
+// waits for the workers to exit, or for ctx to be done, whichever happens
+// first.
+func (p *jobPool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+		for _, j := range p.jobs {
+			j.Cancel()
+		}
+	}
+	p.mu.Unlock()
+	p.cancel()
+	done := make(chan struct{})
+	go func() { p.wg.Wait(); close(done) }()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *jobPool) work() {
+	defer p.wg.Done()
+	for j := range p.queue {
+		log.Infof("running %s job %s", j.kind, j.id)
+		j.execute(p.ctx)
+		log.Infof("%s job %s finished with status %s", j.kind, j.id, j.Info().Status)
+		p.evict()
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
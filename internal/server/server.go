@@ -0,0 +1,539 @@
+// Package server provides an HTTP API to run Dmap scans as asynchronous jobs.
+// Repository scans (see sql.Scanner) and cloud environment scans (see
+// aws.AWSScanner) are submitted as jobs, which run on a bounded pool of
+// workers. Clients can then poll a job's status, stream its progress, cancel it
+// and fetch its results.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gobwas/glob"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cyralinc/dmap/aws"
+	"github.com/cyralinc/dmap/scan"
+	"github.com/cyralinc/dmap/sql"
+)
+
+const (
+	jobIdKey        = "jobId"
+	repoScansPath   = "/v1/repo-scans"
+	cloudScansPath  = "/v1/cloud-scans"
+	jobsPath        = "/v1/jobs"
+	jobIdPath       = jobsPath + "/{" + jobIdKey + "}"
+	jobEventsPath   = jobIdPath + "/events"
+	jobResultsPath  = jobIdPath + "/results"
+	jobCancelPath   = jobIdPath + "/cancel"
+	maxRequestBytes = 1 << 20
+)
+
+// RepoScanner is a repository scanner whose scan is streamed, so that the
+// progress of repository scan jobs can be reported table by table. It is
+// implemented by sql.Scanner.
+type RepoScanner interface {
+	// ScanStream performs the scan, streaming its events. See
+	// sql.Scanner.ScanStream for more details.
+	ScanStream(ctx context.Context) <-chan sql.Event
+	// CollectResults collects the events emitted by ScanStream into the scan
+	// results. See sql.Scanner.CollectResults for more details.
+	CollectResults(ctx context.Context, events <-chan sql.Event) (*scan.RepoScanResults, error)
+}
+
+// sql.Scanner implements RepoScanner
+var _ RepoScanner = (*sql.Scanner)(nil)
+
+// RepoScannerConstructor creates the RepoScanner used to run a repository scan
+// job.
+type RepoScannerConstructor func(ctx context.Context, cfg sql.ScannerConfig) (RepoScanner, error)
+
+// CloudScannerConstructor creates the scan.Scanner used to run a cloud scan
+// job.
+type CloudScannerConstructor func(ctx context.Context, cfg aws.ScannerConfig) (scan.Scanner, error)
+
+// Config is the configuration for a Server.
+type Config struct {
+	// Workers is the maximum number of jobs that run concurrently. Defaults to
+	// one if zero.
+	Workers uint
+	// QueueSize is the maximum number of jobs waiting for a free worker.
+	// Submissions beyond this limit are rejected. Defaults to one if zero.
+	QueueSize uint
+	// MaxFinishedJobs is the maximum number of finished jobs which are kept,
+	// along with their results and events. Once exceeded, the oldest finished
+	// jobs are evicted. Defaults to one if zero.
+	MaxFinishedJobs uint
+	// JobRetention is how long finished jobs are kept, along with their results
+	// and events, before they are evicted. If zero, finished jobs are only
+	// evicted once there are more than MaxFinishedJobs.
+	JobRetention time.Duration
+	// Credentials resolves the credentials references of repository scan
+	// requests. If nil, repository scan requests are rejected.
+	Credentials CredentialResolver
+	// NewRepoScanner creates repository scanners. Defaults to
+	// sql.NewScanner.
+	NewRepoScanner RepoScannerConstructor
+	// NewCloudScanner creates cloud scanners. Defaults to aws.NewAWSScanner.
+	NewCloudScanner CloudScannerConstructor
+}
+
+// Server is an http.Handler which exposes the scan job API.
+type Server struct {
+	config Config
+	pool   *jobPool
+	mux    *http.ServeMux
+}
+
+// Server implements http.Handler
+var _ http.Handler = (*Server)(nil)
+
+// New creates a new Server and starts its worker pool. Server.Close should be
+// called to release its resources once it is no longer used.
+func New(cfg Config) *Server {
+	if cfg.NewRepoScanner == nil {
+		cfg.NewRepoScanner = func(ctx context.Context, cfg sql.ScannerConfig) (RepoScanner, error) {
+			return sql.NewScanner(ctx, cfg)
+		}
+	}
+	if cfg.NewCloudScanner == nil {
+		cfg.NewCloudScanner = func(ctx context.Context, cfg aws.ScannerConfig) (scan.Scanner, error) {
+			return aws.NewAWSScanner(ctx, cfg)
+		}
+	}
+	s := &Server{
+		config: cfg,
+		pool:   newJobPool(cfg.Workers, cfg.QueueSize, cfg.MaxFinishedJobs, cfg.JobRetention),
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST "+repoScansPath, s.handleSubmitRepoScan)
+	s.mux.HandleFunc("POST "+cloudScansPath, s.handleSubmitCloudScan)
+	s.mux.HandleFunc("GET "+jobIdPath, s.handleGetJob)
+	s.mux.HandleFunc("GET "+jobEventsPath, s.handleJobEvents)
+	s.mux.HandleFunc("GET "+jobResultsPath, s.handleJobResults)
+	s.mux.HandleFunc("POST "+jobCancelPath, s.handleCancelJob)
+	return s
+}
+
+// ServeHTTP dispatches the request to the matching API handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops accepting jobs, cancels the queued and running ones and waits
+// for them to finish, or for ctx to be done.
+func (s *Server) Close(ctx context.Context) error {
+	return s.pool.Close(ctx)
+}
+
+// RepoScanRequest is the body of a repository scan job submission. It mirrors
+// sql.ScannerConfig, except that credentials are referenced by name via
+// CredentialsRef and resolved server-side.
+type RepoScanRequest struct {
+	Type           string            `json:"type"`
+	Host           string            `json:"host"`
+	Port           uint16            `json:"port"`
+	Database       string            `json:"database,omitempty"`
+	CredentialsRef string            `json:"credentialsRef"`
+	Advanced       map[string]any    `json:"advanced,omitempty"`
+	IncludePaths   []string          `json:"includePaths,omitempty"`
+	ExcludePaths   []string          `json:"excludePaths,omitempty"`
+	MaxOpenConns   uint              `json:"maxOpenConns,omitempty"`
+	MaxParallelDbs uint              `json:"maxParallelDbs,omitempty"`
+	MaxConcurrency uint              `json:"maxConcurrency,omitempty"`
+	QueryTimeout   Duration          `json:"queryTimeout,omitempty"`
+	RateLimit      *RateLimitRequest `json:"rateLimit,omitempty"`
+	Retry          *RetryRequest     `json:"retry,omitempty"`
+	SampleSize     uint              `json:"sampleSize,omitempty"`
+	Offset         uint              `json:"offset,omitempty"`
+}
+
+// scannerConfig builds the sql.ScannerConfig for the request, using the given
+// resolved credentials.
+func (r RepoScanRequest) scannerConfig(creds Credentials) (sql.ScannerConfig, error) {
+	if r.Type == "" {
+		return sql.ScannerConfig{}, errors.New("type is required")
+	}
+	include, err := compileGlobs(r.IncludePaths)
+	if err != nil {
+		return sql.ScannerConfig{}, fmt.Errorf("invalid includePaths: %w", err)
+	}
+	// Mirror the CLI default of including everything.
+	if len(include) == 0 {
+		include = []glob.Glob{glob.MustCompile("*")}
+	}
+	exclude, err := compileGlobs(r.ExcludePaths)
+	if err != nil {
+		return sql.ScannerConfig{}, fmt.Errorf("invalid excludePaths: %w", err)
+	}
+	sampleSize := r.SampleSize
+	if sampleSize == 0 {
+		sampleSize = 5
+	}
+	return sql.ScannerConfig{
+		RepoType: r.Type,
+		RepoConfig: sql.RepoConfig{
+			Host:           r.Host,
+			Port:           r.Port,
+			User:           creds.User,
+			Password:       creds.Password,
+			Database:       r.Database,
+			MaxOpenConns:   r.MaxOpenConns,
+			MaxParallelDbs: r.MaxParallelDbs,
+			MaxConcurrency: r.MaxConcurrency,
+			QueryTimeout:   time.Duration(r.QueryTimeout),
+			RateLimit:      r.RateLimit.rateLimitConfig(),
+			Advanced:       r.Advanced,
+		},
+		IncludePaths: include,
+		ExcludePaths: exclude,
+		SampleSize:   sampleSize,
+		Offset:       r.Offset,
+		Retry:        r.Retry.retryConfig(),
+	}, nil
+}
+
+// RateLimitRequest mirrors sql.RateLimitConfig.
+type RateLimitRequest struct {
+	QueriesPerSecond float64  `json:"queriesPerSecond"`
+	Burst            uint     `json:"burst,omitempty"`
+	Adaptive         bool     `json:"adaptive,omitempty"`
+	TargetLatency    Duration `json:"targetLatency,omitempty"`
+	MaxLoad          float64  `json:"maxLoad,omitempty"`
+	LoadInterval     Duration `json:"loadInterval,omitempty"`
+}
+
+// rateLimitConfig returns the sql.RateLimitConfig of the request, or nil if
+// the request is nil.
+func (r *RateLimitRequest) rateLimitConfig() *sql.RateLimitConfig {
+	if r == nil {
+		return nil
+	}
+	return &sql.RateLimitConfig{
+		QueriesPerSecond: r.QueriesPerSecond,
+		Burst:            r.Burst,
+		Adaptive:         r.Adaptive,
+		TargetLatency:    time.Duration(r.TargetLatency),
+		MaxLoad:          r.MaxLoad,
+		LoadInterval:     time.Duration(r.LoadInterval),
+	}
+}
+
+// RetryRequest mirrors sql.RetryConfig.
+type RetryRequest struct {
+	MaxAttempts    uint     `json:"maxAttempts"`
+	InitialBackoff Duration `json:"initialBackoff,omitempty"`
+	MaxBackoff     Duration `json:"maxBackoff,omitempty"`
+}
+
+// retryConfig returns the sql.RetryConfig of the request, or nil if the
+// request is nil.
+func (r *RetryRequest) retryConfig() *sql.RetryConfig {
+	if r == nil {
+		return nil
+	}
+	return &sql.RetryConfig{
+		MaxAttempts:    r.MaxAttempts,
+		InitialBackoff: time.Duration(r.InitialBackoff),
+		MaxBackoff:     time.Duration(r.MaxBackoff),
+	}
+}
+
+// CloudScanRequest is the body of a cloud scan job submission. It mirrors
+// aws.ScannerConfig.
+type CloudScanRequest struct {
+	Regions    []string           `json:"regions"`
+	AssumeRole *AssumeRoleRequest `json:"assumeRole,omitempty"`
+}
+
+// AssumeRoleRequest mirrors aws.AssumeRoleConfig.
+type AssumeRoleRequest struct {
+	IAMRoleARN string `json:"iamRoleArn"`
+	ExternalID string `json:"externalId,omitempty"`
+}
+
+func (r CloudScanRequest) scannerConfig() aws.ScannerConfig {
+	cfg := aws.ScannerConfig{Regions: r.Regions}
+	if r.AssumeRole != nil {
+		cfg.AssumeRole = &aws.AssumeRoleConfig{
+			IAMRoleARN: r.AssumeRole.IAMRoleARN,
+			ExternalID: r.AssumeRole.ExternalID,
+		}
+	}
+	return cfg
+}
+
+// Duration is a time.Duration which is (un)marshalled from/to JSON as a
+// duration string, e.g. "30s".
+type Duration time.Duration
+
+// MarshalJSON marshals the duration as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON unmarshals the duration from a duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+func (s *Server) handleSubmitRepoScan(w http.ResponseWriter, r *http.Request) {
+	var req RepoScanRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if s.config.Credentials == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("no credential resolver is configured"))
+		return
+	}
+	creds, err := s.config.Credentials.ResolveCredentials(r.Context(), req.CredentialsRef)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error resolving credentials: %w", err))
+		return
+	}
+	cfg, err := req.scannerConfig(creds)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	run := func(ctx context.Context, j *job) (any, error) {
+		scanner, err := s.config.NewRepoScanner(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating new scanner: %w", err)
+		}
+		j.Progress("scanning repository")
+		// The events are reported as job events as they are streamed, and then
+		// forwarded to be collected into the scan results.
+		events := make(chan sql.Event)
+		go func() {
+			defer close(events)
+			for evt := range scanner.ScanStream(ctx) {
+				reportScanEvent(j, evt)
+				events <- evt
+			}
+		}()
+		results, err := scanner.CollectResults(ctx, events)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning repository: %w", err)
+		}
+		return results, nil
+	}
+	s.submit(w, JobKindRepoScan, run)
+}
+
+// reportScanEvent reports the table and failure events of a repository scan as
+// job events. The other events are ignored, since the outcome of the scan is
+// reported by the job's status.
+func reportScanEvent(j *job, evt sql.Event) {
+	switch evt.Type {
+	case sql.EventTableClassified:
+		var labels []string
+		for _, c := range evt.Classifications {
+			for lbl := range c.Labels {
+				if !slices.Contains(labels, lbl) {
+					labels = append(labels, lbl)
+				}
+			}
+		}
+		slices.Sort(labels)
+		msg := "classified table"
+		if evt.Resumed || evt.Unchanged {
+			msg = "loaded table from a previous scan"
+		}
+		j.Report(
+			JobEvent{
+				Message:   msg,
+				TablePath: evt.TablePath,
+				Labels:    labels,
+			},
+		)
+	case sql.EventFailure:
+		j.Report(JobEvent{Message: evt.Failure.Message, Failure: evt.Failure})
+	}
+}
+
+func (s *Server) handleSubmitCloudScan(w http.ResponseWriter, r *http.Request) {
+	var req CloudScanRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	cfg := req.scannerConfig()
+	if err := cfg.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	run := func(ctx context.Context, j *job) (any, error) {
+		scanner, err := s.config.NewCloudScanner(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating new scanner: %w", err)
+		}
+		j.Progress("scanning cloud environment")
+		results, err := scanner.Scan(ctx)
+		// The AWS scanner may return partial results along with an error, in
+		// which case the job still succeeds and reports the error.
+		if results == nil {
+			return nil, fmt.Errorf("error scanning cloud environment: %w", err)
+		}
+		return results, err
+	}
+	s.submit(w, JobKindCloudScan, run)
+}
+
+func (s *Server) submit(w http.ResponseWriter, kind JobKind, run jobFunc) {
+	j, err := s.pool.Submit(kind, run)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errQueueFull) || errors.Is(err, errPoolClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, err)
+		return
+	}
+	w.Header().Set("Location", jobsPath+"/"+j.id)
+	writeJSON(w, http.StatusAccepted, j.Info())
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, j.Info())
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if !j.Cancel() {
+		writeError(w, http.StatusConflict, errors.New("job has already finished"))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j.Info())
+}
+
+func (s *Server) handleJobResults(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	results, status := j.Results()
+	if status != JobStatusSucceeded {
+		writeError(w, http.StatusConflict, fmt.Errorf("job has no results, status is %s", status))
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleJobEvents streams the job's events to the client as server-sent
+// events, until the job is done or the client disconnects. Clients may resume
+// a stream by passing the last received event sequence number in the
+// Last-Event-ID header.
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	next := 0
+	if lastId := r.Header.Get("Last-Event-ID"); lastId != "" {
+		if n, err := strconv.Atoi(lastId); err == nil {
+			next = n + 1
+		}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for {
+		evts, changed := j.EventsSince(next)
+		for _, evt := range evts {
+			b, err := json.Marshal(evt)
+			if err != nil {
+				log.WithError(err).Error("error marshalling job event")
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", evt.Seq, b); err != nil {
+				return
+			}
+			next = evt.Seq + 1
+			if evt.Status.Done() {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+func (s *Server) lookupJob(w http.ResponseWriter, r *http.Request) (*job, bool) {
+	id := r.PathValue(jobIdKey)
+	j, ok := s.pool.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return nil, false
+	}
+	return j, true
+}
+
+// decodeRequest decodes the JSON request body into v. If decoding fails, an
+// error response is written and false is returned.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("error writing response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := sql.CompilePathGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile %s pattern: %w", pattern, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
@@ -0,0 +1,497 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cyralinc/dmap/aws"
+	"github.com/cyralinc/dmap/classification"
+	"github.com/cyralinc/dmap/scan"
+	"github.com/cyralinc/dmap/sql"
+)
+
+// fakeRepoScanner is a RepoScanner which streams no events, and whose results
+// are returned by the function.
+type fakeRepoScanner func(ctx context.Context) (*scan.RepoScanResults, error)
+
+func (f fakeRepoScanner) ScanStream(context.Context) <-chan sql.Event {
+	events := make(chan sql.Event)
+	close(events)
+	return events
+}
+
+func (f fakeRepoScanner) CollectResults(ctx context.Context, events <-chan sql.Event) (*scan.RepoScanResults, error) {
+	for range events {
+	}
+	return f(ctx)
+}
+
+// fakeStreamScanner is a RepoScanner which streams the given events, and then
+// returns empty results.
+type fakeStreamScanner []sql.Event
+
+func (f fakeStreamScanner) ScanStream(context.Context) <-chan sql.Event {
+	events := make(chan sql.Event, len(f))
+	for _, evt := range f {
+		events <- evt
+	}
+	close(events)
+	return events
+}
+
+func (f fakeStreamScanner) CollectResults(_ context.Context, events <-chan sql.Event) (*scan.RepoScanResults, error) {
+	for range events {
+	}
+	return &scan.RepoScanResults{}, nil
+}
+
+type fakeCloudScanner func(ctx context.Context) (*scan.ScanResults, error)
+
+func (f fakeCloudScanner) Scan(ctx context.Context) (*scan.ScanResults, error) {
+	return f(ctx)
+}
+
+var testCreds = StaticCredentials{
+	"test": {User: "user", Password: "password"},
+}
+
+func TestServer_RepoScan_Success(t *testing.T) {
+	wantResults := &scan.RepoScanResults{
+		Classifications: []classification.Classification{
+			{
+				AttributePath: []string{"db", "schema", "table", "ssn"},
+				Labels:        classification.LabelSet{"SSN": {}},
+			},
+		},
+	}
+	var gotCfg sql.ScannerConfig
+	svr := newTestServer(
+		t,
+		Config{
+			Credentials: testCreds,
+			NewRepoScanner: func(_ context.Context, cfg sql.ScannerConfig) (RepoScanner, error) {
+				gotCfg = cfg
+				return fakeRepoScanner(
+					func(context.Context) (*scan.RepoScanResults, error) {
+						return wantResults, nil
+					},
+				), nil
+			},
+		},
+	)
+	body := `{
+		"type": "postgres",
+		"host": "example.com",
+		"port": 5432,
+		"credentialsRef": "test",
+		"includePaths": ["db.*"],
+		"queryTimeout": "30s",
+		"rateLimit": {"queriesPerSecond": 20, "adaptive": true, "targetLatency": "2s"},
+		"retry": {"maxAttempts": 3, "initialBackoff": "1s"}
+	}`
+	info := submitJob(t, svr, repoScansPath, body)
+	require.Equal(t, JobKindRepoScan, info.Kind)
+	info = waitForJob(t, svr, info.ID)
+	require.Equal(t, JobStatusSucceeded, info.Status)
+	require.Equal(t, "postgres", gotCfg.RepoType)
+	require.Equal(t, "example.com", gotCfg.RepoConfig.Host)
+	require.Equal(t, "user", gotCfg.RepoConfig.User)
+	require.Equal(t, "password", gotCfg.RepoConfig.Password)
+	require.Equal(t, 30*time.Second, gotCfg.RepoConfig.QueryTimeout)
+	require.Equal(
+		t,
+		&sql.RateLimitConfig{QueriesPerSecond: 20, Adaptive: true, TargetLatency: 2 * time.Second},
+		gotCfg.RepoConfig.RateLimit,
+	)
+	require.Equal(t, &sql.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Second}, gotCfg.Retry)
+	require.Equal(t, uint(5), gotCfg.SampleSize)
+	require.Len(t, gotCfg.IncludePaths, 1)
+	require.True(t, gotCfg.IncludePaths[0].Match("db.schema.table"))
+
+	resp, err := http.Get(svr.URL + jobsPath + "/" + info.ID + "/results")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got struct {
+		Classifications []struct {
+			AttributePath []string `json:"attributePath"`
+			Labels        []string `json:"labels"`
+		} `json:"classifications"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Len(t, got.Classifications, 1)
+	require.Equal(t, []string{"db", "schema", "table", "ssn"}, got.Classifications[0].AttributePath)
+	require.Equal(t, []string{"SSN"}, got.Classifications[0].Labels)
+}
+
+func TestServer_RepoScan_UnknownCredentials(t *testing.T) {
+	svr := newTestServer(t, Config{Credentials: testCreds})
+	resp, err := http.Post(
+		svr.URL+repoScansPath,
+		"application/json",
+		strings.NewReader(`{"type": "postgres", "credentialsRef": "unknown"}`),
+	)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_RepoScan_InlinePasswordRejected(t *testing.T) {
+	svr := newTestServer(t, Config{Credentials: testCreds})
+	resp, err := http.Post(
+		svr.URL+repoScansPath,
+		"application/json",
+		strings.NewReader(`{"type": "postgres", "credentialsRef": "test", "password": "secret"}`),
+	)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_RepoScan_Failure(t *testing.T) {
+	scanErr := errors.New("connection refused")
+	svr := newTestServer(
+		t,
+		Config{
+			Credentials: testCreds,
+			NewRepoScanner: func(context.Context, sql.ScannerConfig) (RepoScanner, error) {
+				return fakeRepoScanner(
+					func(context.Context) (*scan.RepoScanResults, error) {
+						return nil, scanErr
+					},
+				), nil
+			},
+		},
+	)
+	info := submitJob(t, svr, repoScansPath, `{"type": "postgres", "credentialsRef": "test"}`)
+	info = waitForJob(t, svr, info.ID)
+	require.Equal(t, JobStatusFailed, info.Status)
+	require.Contains(t, info.Error, scanErr.Error())
+
+	resp, err := http.Get(svr.URL + jobsPath + "/" + info.ID + "/results")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestServer_CloudScan_Success(t *testing.T) {
+	var gotCfg aws.ScannerConfig
+	svr := newTestServer(
+		t,
+		Config{
+			NewCloudScanner: func(_ context.Context, cfg aws.ScannerConfig) (scan.Scanner, error) {
+				gotCfg = cfg
+				return fakeCloudScanner(
+					func(context.Context) (*scan.ScanResults, error) {
+						return &scan.ScanResults{
+							Repositories: map[string]scan.Repository{
+								"arn": {Id: "arn", Name: "repo", Type: scan.RepoTypeRDS},
+							},
+						}, nil
+					},
+				), nil
+			},
+		},
+	)
+	info := submitJob(t, svr, cloudScansPath, `{"regions": ["us-east-1"]}`)
+	require.Equal(t, JobKindCloudScan, info.Kind)
+	info = waitForJob(t, svr, info.ID)
+	require.Equal(t, JobStatusSucceeded, info.Status)
+	require.Equal(t, []string{"us-east-1"}, gotCfg.Regions)
+	require.Nil(t, gotCfg.AssumeRole)
+}
+
+func TestServer_CloudScan_InvalidConfig(t *testing.T) {
+	svr := newTestServer(t, Config{})
+	resp, err := http.Post(svr.URL+cloudScansPath, "application/json", strings.NewReader(`{"regions": []}`))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_CancelRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	svr := newTestServer(
+		t,
+		Config{
+			Credentials: testCreds,
+			NewRepoScanner: func(context.Context, sql.ScannerConfig) (RepoScanner, error) {
+				return fakeRepoScanner(
+					func(ctx context.Context) (*scan.RepoScanResults, error) {
+						close(started)
+						<-ctx.Done()
+						return nil, ctx.Err()
+					},
+				), nil
+			},
+		},
+	)
+	info := submitJob(t, svr, repoScansPath, `{"type": "postgres", "credentialsRef": "test"}`)
+	<-started
+	resp, err := http.Post(svr.URL+jobsPath+"/"+info.ID+"/cancel", "", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	info = waitForJob(t, svr, info.ID)
+	require.Equal(t, JobStatusCancelled, info.Status)
+
+	// Cancelling a finished job is a conflict.
+	resp, err = http.Post(svr.URL+jobsPath+"/"+info.ID+"/cancel", "", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestServer_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	svr := newTestServer(
+		t,
+		Config{
+			Workers:     1,
+			QueueSize:   1,
+			Credentials: testCreds,
+			NewRepoScanner: func(context.Context, sql.ScannerConfig) (RepoScanner, error) {
+				return fakeRepoScanner(
+					func(ctx context.Context) (*scan.RepoScanResults, error) {
+						<-release
+						return &scan.RepoScanResults{}, nil
+					},
+				), nil
+			},
+		},
+	)
+	body := `{"type": "postgres", "credentialsRef": "test"}`
+	// The first job occupies the only worker, the second one the only queue
+	// slot.
+	first := submitJob(t, svr, repoScansPath, body)
+	require.Eventually(
+		t,
+		func() bool { return getJob(t, svr, first.ID).Status == JobStatusRunning },
+		5*time.Second,
+		10*time.Millisecond,
+	)
+	submitJob(t, svr, repoScansPath, body)
+	resp, err := http.Post(svr.URL+repoScansPath, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestServer_JobEvents(t *testing.T) {
+	svr := newTestServer(
+		t,
+		Config{
+			Credentials: testCreds,
+			NewRepoScanner: func(context.Context, sql.ScannerConfig) (RepoScanner, error) {
+				return fakeRepoScanner(
+					func(context.Context) (*scan.RepoScanResults, error) {
+						return &scan.RepoScanResults{}, nil
+					},
+				), nil
+			},
+		},
+	)
+	info := submitJob(t, svr, repoScansPath, `{"type": "postgres", "credentialsRef": "test"}`)
+	evts := readEvents(t, svr, info.ID)
+	require.NotEmpty(t, evts)
+	require.Equal(t, JobStatusQueued, evts[0].Status)
+	require.Equal(t, JobStatusSucceeded, evts[len(evts)-1].Status)
+	for i, evt := range evts {
+		require.Equal(t, i, evt.Seq)
+	}
+}
+
+func TestServer_JobEvents_RepoScanTables(t *testing.T) {
+	failure := &scan.Failure{
+		Path:     []string{"db", "schema", "broken"},
+		Phase:    scan.PhaseSample,
+		Category: scan.ErrorCategoryPermission,
+		Message:  "permission denied",
+	}
+	svr := newTestServer(
+		t,
+		Config{
+			Credentials: testCreds,
+			NewRepoScanner: func(context.Context, sql.ScannerConfig) (RepoScanner, error) {
+				return fakeStreamScanner{
+					{
+						Type:      sql.EventTableClassified,
+						TablePath: []string{"db", "schema", "users"},
+						Classifications: []classification.Classification{
+							{
+								AttributePath: []string{"db", "schema", "users", "ssn"},
+								Labels:        classification.LabelSet{"SSN": {}},
+							},
+							{
+								AttributePath: []string{"db", "schema", "users", "email"},
+								Labels:        classification.LabelSet{"EMAIL": {}, "SSN": {}},
+							},
+						},
+					},
+					{Type: sql.EventFailure, Failure: failure},
+					{Type: sql.EventDone},
+				}, nil
+			},
+		},
+	)
+	info := submitJob(t, svr, repoScansPath, `{"type": "postgres", "credentialsRef": "test"}`)
+	info = waitForJob(t, svr, info.ID)
+	require.Equal(t, JobStatusSucceeded, info.Status)
+	evts := readEvents(t, svr, info.ID)
+	var tableEvts []JobEvent
+	for _, evt := range evts {
+		if evt.TablePath != nil || evt.Failure != nil {
+			tableEvts = append(tableEvts, evt)
+		}
+	}
+	require.Len(t, tableEvts, 2)
+	require.Equal(t, JobStatusRunning, tableEvts[0].Status)
+	require.Equal(t, []string{"db", "schema", "users"}, tableEvts[0].TablePath)
+	require.Equal(t, []string{"EMAIL", "SSN"}, tableEvts[0].Labels)
+	require.Equal(t, failure, tableEvts[1].Failure)
+	require.Equal(t, failure.Message, tableEvts[1].Message)
+}
+
+func TestServer_EvictFinishedJobs(t *testing.T) {
+	newScanner := func(context.Context, sql.ScannerConfig) (RepoScanner, error) {
+		return fakeRepoScanner(
+			func(context.Context) (*scan.RepoScanResults, error) {
+				return &scan.RepoScanResults{}, nil
+			},
+		), nil
+	}
+	body := `{"type": "postgres", "credentialsRef": "test"}`
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{
+			name: "max finished jobs",
+			cfg:  Config{MaxFinishedJobs: 1},
+		},
+		{
+			name: "retention",
+			cfg:  Config{MaxFinishedJobs: 10, JobRetention: 50 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				cfg := tt.cfg
+				cfg.Workers = 1
+				cfg.QueueSize = 10
+				cfg.Credentials = testCreds
+				cfg.NewRepoScanner = newScanner
+				svr := newTestServer(t, cfg)
+				first := submitJob(t, svr, repoScansPath, body)
+				require.Equal(t, JobStatusSucceeded, waitForJob(t, svr, first.ID).Status)
+				second := submitJob(t, svr, repoScansPath, body)
+				require.Equal(t, JobStatusSucceeded, waitForJob(t, svr, second.ID).Status)
+				require.Eventually(
+					t,
+					func() bool {
+						resp, err := http.Get(svr.URL + jobsPath + "/" + first.ID)
+						require.NoError(t, err)
+						_ = resp.Body.Close()
+						return resp.StatusCode == http.StatusNotFound
+					},
+					5*time.Second,
+					10*time.Millisecond,
+				)
+			},
+		)
+	}
+}
+
+func TestServer_JobNotFound(t *testing.T) {
+	svr := newTestServer(t, Config{})
+	for _, path := range []string{"", "/events", "/results"} {
+		resp, err := http.Get(svr.URL + jobsPath + "/unknown" + path)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func newTestServer(t *testing.T, cfg Config) *httptest.Server {
+	srv := New(cfg)
+	svr := httptest.NewServer(srv)
+	t.Cleanup(
+		func() {
+			svr.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			require.NoError(t, srv.Close(ctx))
+		},
+	)
+	return svr
+}
+
+func submitJob(t *testing.T, svr *httptest.Server, path, body string) JobInfo {
+	resp, err := http.Post(svr.URL+path, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var info JobInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	require.NotEmpty(t, info.ID)
+	require.Equal(t, jobsPath+"/"+info.ID, resp.Header.Get("Location"))
+	return info
+}
+
+func getJob(t *testing.T, svr *httptest.Server, id string) JobInfo {
+	resp, err := http.Get(svr.URL + jobsPath + "/" + id)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var info JobInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	return info
+}
+
+func waitForJob(t *testing.T, svr *httptest.Server, id string) JobInfo {
+	var info JobInfo
+	require.Eventually(
+		t,
+		func() bool {
+			info = getJob(t, svr, id)
+			return info.Status.Done()
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+	return info
+}
+
+// readEvents streams the events of a job until it is done.
+func readEvents(t *testing.T, svr *httptest.Server, id string) []JobEvent {
+	resp, err := http.Get(svr.URL + jobsPath + "/" + id + "/events")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	// The stream ends once the job is done, so we can read it until EOF.
+	var evts []JobEvent
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		data, ok := strings.CutPrefix(s.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var evt JobEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &evt))
+		evts = append(evts, evt)
+	}
+	require.NoError(t, s.Err())
+	return evts
+}
@@ -0,0 +1,137 @@
+// Package telemetry configures the OpenTelemetry trace and meter providers used
+// by the Dmap library packages. The library packages only use the global
+// providers, so this package is responsible for installing SDK providers with
+// the exporters selected by the application.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporter names supported by Config.
+const (
+	ExporterNone       = "none"
+	ExporterOTLP       = "otlp"
+	ExporterPrometheus = "prometheus"
+)
+
+// Config is the telemetry configuration. The OTLP exporters are configured
+// through the standard OpenTelemetry environment variables, e.g.
+// OTEL_EXPORTER_OTLP_ENDPOINT.
+type Config struct {
+	// ServiceName is the service name reported in the telemetry resource.
+	ServiceName string
+	// ServiceVersion is the service version reported in the telemetry
+	// resource.
+	ServiceVersion string
+	// TracesExporter is the traces exporter, either ExporterNone or
+	// ExporterOTLP. Tracing is disabled if empty.
+	TracesExporter string
+	// MetricsExporter is the metrics exporter, one of ExporterNone,
+	// ExporterOTLP or ExporterPrometheus. Metrics are disabled if empty.
+	MetricsExporter string
+}
+
+// Provider holds the configured telemetry providers.
+type Provider struct {
+	shutdownFuncs  []func(context.Context) error
+	metricsHandler http.Handler
+}
+
+// Setup creates the trace and meter providers selected by cfg and installs
+// them as the global OpenTelemetry providers. Provider.Shutdown must be called
+// before the application exits to flush any buffered telemetry.
+func Setup(ctx context.Context, cfg Config) (*Provider, error) {
+	p := &Provider{}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceVersion(cfg.ServiceVersion),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating telemetry resource: %w", err)
+	}
+
+	switch cfg.TracesExporter {
+	case "", ExporterNone:
+	case ExporterOTLP:
+		exp, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+		}
+		tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(
+			propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		)
+		p.shutdownFuncs = append(p.shutdownFuncs, tp.Shutdown)
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter: %s", cfg.TracesExporter)
+	}
+
+	var reader sdkmetric.Reader
+	switch cfg.MetricsExporter {
+	case "", ExporterNone:
+	case ExporterOTLP:
+		exp, err := otlpmetricgrpc.New(ctx)
+		if err != nil {
+			_ = p.Shutdown(ctx)
+			return nil, fmt.Errorf("error creating OTLP metric exporter: %w", err)
+		}
+		reader = sdkmetric.NewPeriodicReader(exp)
+	case ExporterPrometheus:
+		// Use a dedicated registry, so that only the Dmap metrics (and not
+		// e.g. the Go runtime metrics of the default registry) are exposed.
+		reg := prometheus.NewRegistry()
+		exp, err := otelprom.New(otelprom.WithRegisterer(reg))
+		if err != nil {
+			_ = p.Shutdown(ctx)
+			return nil, fmt.Errorf("error creating Prometheus exporter: %w", err)
+		}
+		reader = exp
+		p.metricsHandler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	default:
+		_ = p.Shutdown(ctx)
+		return nil, fmt.Errorf("unsupported metrics exporter: %s", cfg.MetricsExporter)
+	}
+	if reader != nil {
+		mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+		otel.SetMeterProvider(mp)
+		p.shutdownFuncs = append(p.shutdownFuncs, mp.Shutdown)
+	}
+	return p, nil
+}
+
+// MetricsHandler returns the HTTP handler which serves the metrics in the
+// Prometheus exposition format, or nil if the Prometheus exporter is not used.
+func (p *Provider) MetricsHandler() http.Handler {
+	return p.metricsHandler
+}
+
+// Shutdown flushes any buffered telemetry and shuts down the providers.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	var errs error
+	for _, fn := range p.shutdownFuncs {
+		errs = errors.Join(errs, fn(ctx))
+	}
+	p.shutdownFuncs = nil
+	return errs
+}
@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup_Prometheus(t *testing.T) {
+	ctx := context.Background()
+	p, err := Setup(ctx, Config{ServiceName: "dmap-test", MetricsExporter: ExporterPrometheus})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, p.Shutdown(ctx)) }()
+	require.NotNil(t, p.MetricsHandler())
+
+	counter, err := otel.Meter("test").Int64Counter("dmap.test.counter")
+	require.NoError(t, err)
+	counter.Add(ctx, 3)
+
+	svr := httptest.NewServer(p.MetricsHandler())
+	defer svr.Close()
+	resp, err := http.Get(svr.URL)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "dmap_test_counter_total")
+}
+
+func TestSetup_None(t *testing.T) {
+	ctx := context.Background()
+	p, err := Setup(ctx, Config{TracesExporter: ExporterNone, MetricsExporter: ExporterNone})
+	require.NoError(t, err)
+	require.Nil(t, p.MetricsHandler())
+	require.NoError(t, p.Shutdown(ctx))
+}
+
+func TestSetup_UnsupportedExporter(t *testing.T) {
+	ctx := context.Background()
+	_, err := Setup(ctx, Config{TracesExporter: "zipkin"})
+	require.Error(t, err)
+	_, err = Setup(ctx, Config{MetricsExporter: "statsd"})
+	require.Error(t, err)
+}
@@ -25,6 +25,167 @@ type RepoScanner interface {
 type RepoScanResults struct {
 	Labels          []classification.Label          `json:"labels"`
 	Classifications []classification.Classification `json:"classifications"`
+	// Failures lists the errors which prevented parts of the repository from
+	// being scanned. A scan with failures still returns the results for the
+	// parts of the repository that could be scanned.
+	Failures []Failure `json:"failures,omitempty"`
+	// Retries lists the repository operations which were retried because
+	// they failed with transient errors, whether they eventually succeeded
+	// or not.
+	Retries []Retry `json:"retries,omitempty"`
+	// Coverage summarizes how much of the repository was scanned.
+	Coverage Coverage `json:"coverage"`
+	// TableStats are the estimated statistics of the scanned tables, if they
+	// were collected.
+	TableStats []TableStats `json:"tableStats,omitempty"`
+	// Relationships are the foreign key relationships between the tables of
+	// the repository, if they were collected.
+	Relationships []Relationship `json:"relationships,omitempty"`
+	// LinkedColumns are the columns which reference tables containing
+	// sensitive data, and which are therefore linked to its labels.
+	LinkedColumns []LinkedColumn `json:"linkedColumns,omitempty"`
+}
+
+// Relationship is a foreign key relationship between two tables of a
+// repository.
+type Relationship struct {
+	// Name is the name of the foreign key constraint.
+	Name string `json:"name"`
+	// TablePath is the full path of the referencing table (e.g. [database,
+	// schema, table]).
+	TablePath []string `json:"tablePath"`
+	// Columns are the referencing columns.
+	Columns []string `json:"columns"`
+	// ReferencedTablePath is the full path of the referenced table.
+	ReferencedTablePath []string `json:"referencedTablePath"`
+	// ReferencedColumns are the referenced columns, in the same order as
+	// Columns.
+	ReferencedColumns []string `json:"referencedColumns"`
+	// LinkedLabels are the labels of the sensitive data of the referenced
+	// table. It is empty if the referenced table doesn't contain sensitive
+	// data.
+	LinkedLabels classification.LabelSet `json:"linkedLabels,omitempty"`
+}
+
+// LinkedColumn is a column which references a table containing sensitive data
+// through a foreign key. Such a column effectively identifies the sensitive
+// data, even though it may not be sensitive itself.
+type LinkedColumn struct {
+	// AttributePath is the full path of the column (e.g. [database, schema,
+	// table, column]).
+	AttributePath []string `json:"attributePath"`
+	// ReferencedTablePath is the full path of the referenced table.
+	ReferencedTablePath []string `json:"referencedTablePath"`
+	// LinkedLabels are the labels of the sensitive data of the referenced
+	// table.
+	LinkedLabels classification.LabelSet `json:"linkedLabels"`
+}
+
+// TableStats are the estimated statistics of a table, as reported by the
+// repository's catalog.
+type TableStats struct {
+	// Path is the full path of the table (e.g. [database, schema, table]).
+	Path []string `json:"path"`
+	// RowCount is the estimated number of rows in the table.
+	RowCount int64 `json:"rowCount"`
+	// SizeBytes is the estimated on-disk size of the table in bytes, or zero if
+	// it is unknown.
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+// Phase is the phase of a repository scan during which a failure occurred.
+type Phase string
+
+const (
+	// PhaseConnect is the phase where a connection to the repository is
+	// established.
+	PhaseConnect Phase = "connect"
+	// PhaseList is the phase where the databases of the repository are listed.
+	PhaseList Phase = "list"
+	// PhaseIntrospect is the phase where a database is introspected to discover
+	// its schemas, tables and columns.
+	PhaseIntrospect Phase = "introspect"
+	// PhaseSample is the phase where a table is sampled.
+	PhaseSample Phase = "sample"
+	// PhaseClassify is the phase where the sampled data is classified.
+	PhaseClassify Phase = "classify"
+)
+
+// ErrorCategory is a coarse category of the cause of a failure.
+type ErrorCategory string
+
+const (
+	// ErrorCategoryPermission means that the scanner's credentials are not
+	// authorized to access the object, or could not be authenticated.
+	ErrorCategoryPermission ErrorCategory = "permission"
+	// ErrorCategoryTimeout means that the operation timed out or was
+	// cancelled.
+	ErrorCategoryTimeout ErrorCategory = "timeout"
+	// ErrorCategorySyntax means that the repository rejected a query as
+	// invalid.
+	ErrorCategorySyntax ErrorCategory = "syntax"
+	// ErrorCategoryNetwork means that the repository could not be reached, or
+	// the connection was lost.
+	ErrorCategoryNetwork ErrorCategory = "network"
+	// ErrorCategoryUnknown is used for any other failure.
+	ErrorCategoryUnknown ErrorCategory = "unknown"
+)
+
+// Failure describes an error which prevented a part of a repository from being
+// scanned.
+type Failure struct {
+	// Path is the path of the repository object that failed. Each element
+	// corresponds to a component, in increasing order of granularity (e.g.
+	// [database, schema, table]). It is empty if the failure applies to the
+	// whole repository.
+	Path []string `json:"path"`
+	// Phase is the scan phase during which the failure occurred.
+	Phase Phase `json:"phase"`
+	// Category is the category of the error which caused the failure.
+	Category ErrorCategory `json:"category"`
+	// Message is the error message.
+	Message string `json:"message"`
+}
+
+// Retry is a repository operation which was retried during a scan, because it
+// failed with a transient error.
+type Retry struct {
+	// Path is the path of the repository object of the operation (e.g.
+	// [database, schema, table]). It is empty if the operation applies to the
+	// whole repository.
+	Path []string `json:"path"`
+	// Phase is the scan phase of the operation.
+	Phase Phase `json:"phase"`
+	// Attempts is the number of attempts of the operation, including the first
+	// one.
+	Attempts uint `json:"attempts"`
+	// Succeeded is true if the last attempt succeeded.
+	Succeeded bool `json:"succeeded"`
+	// Message is the error message of the last failed attempt.
+	Message string `json:"message"`
+}
+
+// Coverage holds counters which summarize how much of a repository was
+// scanned.
+type Coverage struct {
+	// TablesDiscovered is the number of tables found by introspection.
+	TablesDiscovered uint `json:"tablesDiscovered"`
+	// TablesSampled is the number of tables which were sampled and returned
+	// at least one row.
+	TablesSampled uint `json:"tablesSampled"`
+	// TablesEmpty is the number of tables which were sampled but returned no
+	// rows, or which were not sampled because their statistics reported no
+	// rows.
+	TablesEmpty uint `json:"tablesEmpty"`
+	// TablesFailed is the number of tables which could not be sampled.
+	TablesFailed uint `json:"tablesFailed"`
+	// TablesResumed is the number of tables which were not scanned again,
+	// because their results were carried over from the checkpoint of a
+	// previous scan.
+	TablesResumed uint `json:"tablesResumed,omitempty"`
+	// TablesUnchanged is the number of tables which were not sampled again in
+	// an incremental scan, because they were unchanged since the previous scan.
+	TablesUnchanged uint `json:"tablesUnchanged,omitempty"`
 }
 
 // RepoType defines the AWS data repository types supported (e.g. RDS, Redshift,
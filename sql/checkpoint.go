@@ -0,0 +1,338 @@
+package sql
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/glob"
+
+	"github.com/cyralinc/dmap/classification"
+)
+
+// checkpointHeader is the first line of a checkpoint file. It identifies the
+// scan which wrote the checkpoint.
+type checkpointHeader struct {
+	Identity *checkpointIdentity `json:"identity"`
+}
+
+// checkpointIdentity identifies the repository and the configuration of a
+// scan. A scan is only resumed from a checkpoint written by a scan with the
+// same identity, since the classifications recorded by the scan of another
+// repository, or with other filters or sampling parameters, aren't valid for
+// it.
+type checkpointIdentity struct {
+	RepoType           string       `json:"repoType"`
+	Host               string       `json:"host"`
+	Port               uint16       `json:"port"`
+	RepoID             string       `json:"repoId,omitempty"`
+	Database           string       `json:"database,omitempty"`
+	IncludePaths       []string     `json:"includePaths,omitempty"`
+	ExcludePaths       []string     `json:"excludePaths,omitempty"`
+	IncludeObjectTypes []ObjectType `json:"includeObjectTypes,omitempty"`
+	ExcludeObjectTypes []ObjectType `json:"excludeObjectTypes,omitempty"`
+	IncludeColumns     []string     `json:"includeColumns,omitempty"`
+	ExcludeColumns     []string     `json:"excludeColumns,omitempty"`
+	ExcludeDataTypes   []string     `json:"excludeDataTypes,omitempty"`
+	MaxValueLength     uint         `json:"maxValueLength,omitempty"`
+	SampleSize         uint         `json:"sampleSize,omitempty"`
+	Offset             uint         `json:"offset,omitempty"`
+	LabelsYamlFilename string       `json:"labelsYamlFilename,omitempty"`
+}
+
+// newCheckpointIdentity returns the identity of the scans with the given
+// configuration.
+func newCheckpointIdentity(cfg ScannerConfig) checkpointIdentity {
+	return checkpointIdentity{
+		RepoType:           cfg.RepoType,
+		Host:               cfg.RepoConfig.Host,
+		Port:               cfg.RepoConfig.Port,
+		RepoID:             cfg.RepoID,
+		Database:           cfg.RepoConfig.Database,
+		IncludePaths:       globPatterns(cfg.IncludePaths),
+		ExcludePaths:       globPatterns(cfg.ExcludePaths),
+		IncludeObjectTypes: cfg.IncludeObjectTypes,
+		ExcludeObjectTypes: cfg.ExcludeObjectTypes,
+		IncludeColumns:     globPatterns(cfg.IncludeColumns),
+		ExcludeColumns:     globPatterns(cfg.ExcludeColumns),
+		ExcludeDataTypes:   cfg.ExcludeDataTypes,
+		MaxValueLength:     cfg.MaxValueLength,
+		SampleSize:         cfg.SampleSize,
+		Offset:             cfg.Offset,
+		LabelsYamlFilename: cfg.LabelsYamlFilename,
+	}
+}
+
+// globPatterns returns the patterns of the given globs. The globs which don't
+// retain their pattern (see PathGlob) are represented by their compiled form,
+// which is deterministic.
+func globPatterns(globs []glob.Glob) []string {
+	if len(globs) == 0 {
+		return nil
+	}
+	patterns := make([]string, 0, len(globs))
+	for _, g := range globs {
+		if pathGlob, ok := g.(PathGlob); ok {
+			patterns = append(patterns, pathGlob.Pattern)
+		} else {
+			patterns = append(patterns, fmt.Sprint(g))
+		}
+	}
+	return patterns
+}
+
+// diff returns the sorted JSON names of the fields of the identity which
+// differ from the other identity.
+func (i checkpointIdentity) diff(other checkpointIdentity) ([]string, error) {
+	fields, err := identityFields(i)
+	if err != nil {
+		return nil, err
+	}
+	otherFields, err := identityFields(other)
+	if err != nil {
+		return nil, err
+	}
+	var diff []string
+	for name, val := range fields {
+		if otherVal, ok := otherFields[name]; !ok || string(val) != string(otherVal) {
+			diff = append(diff, name)
+		}
+	}
+	for name := range otherFields {
+		if _, ok := fields[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff, nil
+}
+
+// identityFields returns the JSON-encoded fields of the given identity, by
+// their JSON name. The fields with zero values are omitted.
+func identityFields(identity checkpointIdentity) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(identity)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// checkpointRecord is a single line of a checkpoint file. It records a table
+// which has been sampled and classified, along with its classifications and
+// its state at the time it was sampled.
+type checkpointRecord struct {
+	TablePath       []string                        `json:"tablePath"`
+	Classifications []classification.Classification `json:"classifications"`
+	Stats           *TableStats                     `json:"stats,omitempty"`
+	tableState
+}
+
+// tableState is the state of a table which is compared between scans to detect
+// unchanged tables in incremental scans.
+type tableState struct {
+	// Fingerprint is a hash of the table's metadata (see tableFingerprint).
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// ChangeIndicator is the table's change indicator, if any (see
+	// ChangeTracker).
+	ChangeIndicator string `json:"changeIndicator,omitempty"`
+}
+
+// tableSample is a table sample passed from the sampling goroutines to the
+// classification workers, along with the state of the table. For incremental
+// scans, the sample is empty if the table is unchanged since the previous
+// scan, in which case previous is its record from the previous scan.
+type tableSample struct {
+	Sample
+	// meta is the metadata of the table, which is also classified if it has
+	// comments (see Scanner.classifySample).
+	meta     *TableMetadata
+	stats    *TableStats
+	state    tableState
+	previous *checkpointRecord
+}
+
+// tableFingerprint returns a fingerprint of the given table metadata, which
+// changes whenever its object type, its columns, their data types or the
+// comments of the table and its columns change, since the comments are also
+// classified. The object type is included so that a table replaced by a view
+// with the same columns, for example, is scanned again.
+func tableFingerprint(meta *TableMetadata) string {
+	h := sha256.New()
+	// The object type is only included if it is set, like the comments.
+	if meta.ObjectType != "" {
+		_, _ = fmt.Fprintf(h, "\x03%s\x00", meta.ObjectType)
+	}
+	for _, attr := range meta.Attributes {
+		// Null bytes can't appear in identifiers, so they are used to
+		// unambiguously separate the names and types.
+		_, _ = fmt.Fprintf(h, "%s\x00%s\x00", attr.Name, attr.DataType)
+		// The comments are only included if they are set, so that the
+		// fingerprints of tables without comments are unaffected by them.
+		if attr.Comment != "" {
+			_, _ = fmt.Fprintf(h, "\x01%s\x00", attr.Comment)
+		}
+	}
+	if meta.Comment != "" {
+		_, _ = fmt.Fprintf(h, "\x02%s\x00", meta.Comment)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkpoint is an append-only checkpoint file, with a JSON-encoded
+// checkpointHeader on the first line, followed by one JSON-encoded
+// checkpointRecord per line. Since records are only ever appended, a scan which
+// is killed while writing leaves at most a truncated last line behind, which is
+// discarded when the checkpoint is resumed. It is safe for concurrent use.
+type checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openCheckpoint opens the checkpoint file with the given name for the scan
+// with the given identity, creating it if it does not exist. If resume is
+// true, the records of an existing checkpoint file are returned and new records
+// are appended to it, provided that it was written by a scan with the same
+// identity. Otherwise, any existing checkpoint file is truncated.
+func openCheckpoint(
+	fname string,
+	identity checkpointIdentity,
+	resume bool,
+) (*checkpoint, []checkpointRecord, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	var (
+		records []checkpointRecord
+		// The header is written unless the checkpoint is resumed.
+		writeHeader = true
+	)
+	if resume {
+		var (
+			header *checkpointIdentity
+			size   int64
+			err    error
+		)
+		header, records, size, err = readCheckpoint(fname)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("error reading checkpoint file: %w", err)
+		}
+		if header != nil {
+			diff, err := header.diff(identity)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error comparing checkpoint identity: %w", err)
+			}
+			if len(diff) > 0 {
+				return nil, nil, fmt.Errorf(
+					"checkpoint file %s was written by a scan of another repository or with another "+
+						"configuration (%s differ), and can't be resumed",
+					fname,
+					strings.Join(diff, ", "),
+				)
+			}
+			writeHeader = false
+		}
+		if err == nil {
+			// Discard any truncated record at the end of the file, so that new
+			// records are appended after the last complete one.
+			if err := os.Truncate(fname, size); err != nil {
+				return nil, nil, fmt.Errorf("error truncating checkpoint file: %w", err)
+			}
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(fname, flags, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening checkpoint file: %w", err)
+	}
+	cp := &checkpoint{file: f}
+	if writeHeader {
+		if err := cp.writeLine(checkpointHeader{Identity: &identity}); err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+	}
+	return cp, records, nil
+}
+
+// readCheckpoint reads the header and the records of the checkpoint file with
+// the given name. The header is nil if the file is empty, i.e. if the scan
+// which wrote it was killed before writing its header. It also returns the size
+// in bytes of the header and the complete records in the file, which excludes a
+// truncated last record, if any.
+func readCheckpoint(fname string) (*checkpointIdentity, []checkpointRecord, int64, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+	var (
+		identity *checkpointIdentity
+		records  []checkpointRecord
+		size     int64
+	)
+	r := bufio.NewReader(f)
+	for lineNum := 1; ; lineNum++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// The last line is only complete if it is terminated by a newline,
+			// so anything left over was truncated and is discarded.
+			return identity, records, size, nil
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if lineNum == 1 {
+			var header checkpointHeader
+			if err := json.Unmarshal(line, &header); err != nil || header.Identity == nil {
+				return nil, nil, 0, fmt.Errorf("invalid checkpoint header on line 1")
+			}
+			identity = header.Identity
+			size += int64(len(line))
+			continue
+		}
+		var record checkpointRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid record on line %d: %w", lineNum, err)
+		}
+		records = append(records, record)
+		size += int64(len(line))
+	}
+}
+
+// write appends a record to the checkpoint file.
+func (c *checkpoint) write(record checkpointRecord) error {
+	return c.writeLine(record)
+}
+
+// writeLine appends the given header or record to the checkpoint file, as a
+// line of JSON.
+func (c *checkpoint) writeLine(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshalling checkpoint record: %w", err)
+	}
+	b = append(b, '\n')
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(b); err != nil {
+		return fmt.Errorf("error writing checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the checkpoint file.
+func (c *checkpoint) Close() error {
+	return c.file.Close()
+}
@@ -0,0 +1,182 @@
+package sql
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cyralinc/dmap/classification"
+)
+
+// testIdentity is the identity of the scans of the checkpoint tests.
+var testIdentity = checkpointIdentity{RepoType: "postgres", Host: "db.example.com", Port: 5432, SampleSize: 5}
+
+func TestCheckpoint_Resume(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	records := []checkpointRecord{
+		{
+			TablePath: []string{"db", "schema", "table1"},
+			Classifications: []classification.Classification{
+				{
+					AttributePath: []string{"db", "schema", "table1", "ssn"},
+					Labels:        lblSet("SSN"),
+				},
+			},
+		},
+		{
+			TablePath:       []string{"db", "schema", "table2"},
+			Classifications: []classification.Classification{},
+		},
+	}
+	cp, loaded, err := openCheckpoint(fname, testIdentity, false)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+	for _, record := range records {
+		require.NoError(t, cp.write(record))
+	}
+	require.NoError(t, cp.Close())
+
+	// Simulate a scan which was killed while writing a record.
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"tablePath":["db","sch`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	cp, loaded, err = openCheckpoint(fname, testIdentity, true)
+	require.NoError(t, err)
+	require.Equal(t, records, loaded)
+	// New records are appended after the last complete record.
+	record := checkpointRecord{
+		TablePath:       []string{"db", "schema", "table3"},
+		Classifications: []classification.Classification{},
+	}
+	require.NoError(t, cp.write(record))
+	require.NoError(t, cp.Close())
+	identity, loaded, _, err := readCheckpoint(fname)
+	require.NoError(t, err)
+	require.Equal(t, &testIdentity, identity)
+	require.Equal(t, append(records, record), loaded)
+}
+
+func TestCheckpoint_ResumeMissingFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	cp, loaded, err := openCheckpoint(fname, testIdentity, true)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+	require.NoError(t, cp.Close())
+	require.FileExists(t, fname)
+}
+
+func TestCheckpoint_Truncate(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	require.NoError(t, os.WriteFile(fname, []byte(`{"tablePath":["db","schema","table"]}`+"\n"), 0o600))
+	cp, loaded, err := openCheckpoint(fname, testIdentity, false)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+	require.NoError(t, cp.Close())
+	identity, loaded, _, err := readCheckpoint(fname)
+	require.NoError(t, err)
+	require.Equal(t, &testIdentity, identity)
+	require.Empty(t, loaded)
+}
+
+func TestCheckpoint_InvalidRecord(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	cp, _, err := openCheckpoint(fname, testIdentity, false)
+	require.NoError(t, err)
+	require.NoError(t, cp.Close())
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("not json\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, _, err = openCheckpoint(fname, testIdentity, true)
+	require.ErrorContains(t, err, "line 2")
+}
+
+func TestCheckpoint_MissingHeader(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	require.NoError(t, os.WriteFile(fname, []byte(`{"tablePath":["db","schema","table"]}`+"\n"), 0o600))
+	_, _, err := openCheckpoint(fname, testIdentity, true)
+	require.ErrorContains(t, err, "invalid checkpoint header")
+}
+
+func TestCheckpoint_ResumeIdentityMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity func(identity checkpointIdentity) checkpointIdentity
+		wantDiff string
+	}{
+		{
+			name: "other repository",
+			identity: func(identity checkpointIdentity) checkpointIdentity {
+				identity.Host = "other.example.com"
+				identity.RepoID = "repo-2"
+				return identity
+			},
+			wantDiff: "(host, repoId differ)",
+		},
+		{
+			name: "other filters",
+			identity: func(identity checkpointIdentity) checkpointIdentity {
+				identity.ExcludePaths = []string{"db.audit.*"}
+				return identity
+			},
+			wantDiff: "(excludePaths differ)",
+		},
+		{
+			name: "other sample size",
+			identity: func(identity checkpointIdentity) checkpointIdentity {
+				identity.SampleSize = 10
+				return identity
+			},
+			wantDiff: "(sampleSize differ)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+			cp, _, err := openCheckpoint(fname, testIdentity, false)
+			require.NoError(t, err)
+			require.NoError(t, cp.write(checkpointRecord{TablePath: []string{"db", "schema", "table"}}))
+			require.NoError(t, cp.Close())
+			_, _, err = openCheckpoint(fname, tt.identity(testIdentity), true)
+			require.ErrorContains(t, err, tt.wantDiff)
+			// The checkpoint is left untouched.
+			_, records, _, err := readCheckpoint(fname)
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+		})
+	}
+}
+
+func TestNewCheckpointIdentity(t *testing.T) {
+	include, err := CompilePathGlob("db.*")
+	require.NoError(t, err)
+	identity := newCheckpointIdentity(
+		ScannerConfig{
+			RepoType:     "postgres",
+			RepoID:       "repo-1",
+			RepoConfig:   RepoConfig{Host: "db.example.com", Port: 5432, Database: "db"},
+			IncludePaths: []glob.Glob{include},
+			SampleSize:   5,
+		},
+	)
+	require.Equal(
+		t,
+		checkpointIdentity{
+			RepoType:     "postgres",
+			Host:         "db.example.com",
+			Port:         5432,
+			RepoID:       "repo-1",
+			Database:     "db",
+			IncludePaths: []string{"db.*"},
+			SampleSize:   5,
+		},
+		identity,
+	)
+}
@@ -0,0 +1,388 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	// ClickHouse DB driver
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+const (
+	RepoTypeClickHouse = "clickhouse"
+	// clickHouseDatabaseQuery lists the databases of the server, except the
+	// system databases.
+	clickHouseDatabaseQuery = `
+SELECT
+	name
+FROM
+	system.databases
+WHERE
+	name NOT IN ('system', 'INFORMATION_SCHEMA', 'information_schema')
+`
+	// clickHouseIntrospectQuery reads the columns of the tables of the current
+	// database from system.columns, with their ClickHouse data types, e.g.
+	// Array(String) or LowCardinality(Nullable(String)). The tables of the
+	// streaming engines are excluded, since selecting from them consumes their
+	// messages (and is forbidden by default).
+	clickHouseIntrospectQuery = `
+SELECT
+	c.database AS table_schema,
+	c.table AS table_name,
+	c.name AS column_name,
+	c.type AS data_type,
+	CASE
+		WHEN t.engine = 'View' THEN 'view'
+		WHEN t.engine = 'MaterializedView' THEN 'materialized_view'
+		WHEN t.engine IN ('MySQL', 'PostgreSQL', 'MongoDB', 'ODBC', 'JDBC') THEN 'foreign_table'
+		WHEN t.engine IN ('S3', 'URL', 'HDFS', 'File', 'AzureBlobStorage') THEN 'external_table'
+		ELSE 'table'
+	END AS object_type,
+	c.comment AS column_comment,
+	t.comment AS table_comment
+FROM
+	system.columns c
+	JOIN system.tables t ON t.database = c.database AND t.name = c.table
+WHERE
+	c.database = currentDatabase()
+	AND t.engine NOT IN ('Kafka', 'RabbitMQ', 'NATS', 'FileLog', 'S3Queue')
+ORDER BY
+	c.database,
+	c.table,
+	c.position
+`
+	// total_rows and total_bytes are exact for MergeTree tables, and NULL for
+	// the engines which don't track them.
+	clickHouseStatsQuery = `
+SELECT
+	database,
+	name,
+	total_rows,
+	total_bytes
+FROM
+	system.tables
+WHERE
+	database = currentDatabase()
+`
+	// clickHouseSampledTablesQuery lists the tables of the current database
+	// which have a sampling key, i.e. the MergeTree tables which support the
+	// SAMPLE clause.
+	clickHouseSampledTablesQuery = `
+SELECT
+	database,
+	name
+FROM
+	system.tables
+WHERE
+	database = currentDatabase()
+	AND sampling_key <> ''
+`
+	// clickHouseLoadQuery reads the number of queries which are running.
+	clickHouseLoadQuery = `
+SELECT
+	value
+FROM
+	system.metrics
+WHERE
+	metric = 'Query'
+`
+	// The active parts of a MergeTree table are replaced whenever rows are
+	// inserted, mutated or merged, so their last modification time and row
+	// count change with the table data. Only the MergeTree tables have parts.
+	clickHouseChangeIndicatorQuery = `
+SELECT
+	database,
+	table,
+	concat(toString(max(modification_time)), '/', toString(sum(rows)))
+FROM
+	system.parts
+WHERE
+	active AND database = currentDatabase()
+GROUP BY
+	database,
+	table
+`
+)
+
+// ClickHouseRepository is a Repository implementation for ClickHouse
+// databases. ClickHouse has no schemas, so like for MySQL, the database is also
+// the schema of its tables.
+type ClickHouseRepository struct {
+	// The majority of the Repository functionality is delegated to
+	// a generic SQL repository instance.
+	generic *GenericRepository
+
+	mu sync.Mutex
+	// sampledTables is the set of the tables which support the SAMPLE clause,
+	// keyed by their schema and name. It is loaded when the first table is
+	// sampled.
+	sampledTables map[[2]string]bool
+}
+
+// ClickHouseRepository implements Repository, ChangeTracker and LoadReporter
+var (
+	_ Repository    = (*ClickHouseRepository)(nil)
+	_ ChangeTracker = (*ClickHouseRepository)(nil)
+	_ LoadReporter  = (*ClickHouseRepository)(nil)
+)
+
+// NewClickHouseRepository creates a new ClickHouseRepository, which connects
+// to the server with the native protocol.
+func NewClickHouseRepository(cfg RepoConfig) (*ClickHouseRepository, error) {
+	database := cfg.Database
+	// Connect to the default database, if unspecified.
+	if database == "" {
+		database = "default"
+	}
+	generic, err := withSSHTunnel(
+		cfg,
+		func(tunnel *sshTunnel) (*GenericRepository, error) {
+			// The connections are made to the local port of the tunnel, if any.
+			opts, err := clickHouseOptions(tunnel.repoConfig(cfg), database)
+			if err != nil {
+				return nil, err
+			}
+			db := openSessionDB(clickhouse.Connector(opts), nil, cfg.MaxOpenConns)
+			return NewGenericRepositoryFromDB(RepoTypeClickHouse, cfg.Database, db), nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ClickHouseRepository{generic: generic}, nil
+}
+
+// ListDatabases returns a list of the names of all databases on the server by
+// using a ClickHouse-specific database query. It delegates the actual work to
+// GenericRepository.ListDatabasesWithQuery - see that method for more details.
+func (r *ClickHouseRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	return r.generic.ListDatabasesWithQuery(ctx, clickHouseDatabaseQuery)
+}
+
+// Introspect delegates introspection to GenericRepository, using
+// ClickHouse-specific introspection and table statistics queries based on the
+// system tables. ClickHouse has no key constraints, and its LIKE operator has
+// no escape clause, so neither the keys nor the path filters are supported. See
+// Repository.Introspect and GenericRepository.IntrospectWithQueries for more
+// details.
+func (r *ClickHouseRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
+	queries := IntrospectQueries{
+		Introspect: clickHouseIntrospectQuery,
+		Stats:      clickHouseStatsQuery,
+		// ClickHouse maintains the row counts of the MergeTree and Memory
+		// tables, and reports NULL for the other engines.
+		ExactStats: true,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
+}
+
+// SampleTable delegates sampling to GenericRepository, using a
+// ClickHouse-specific table sample query. The tables which have a sampling key
+// are sampled with the SAMPLE clause, so that the rows are spread over the
+// whole table rather than read from its first parts. The composite values of
+// the sample, e.g. arrays and maps, are flattened into their elements (see
+// flattenClickHouseResults). See Repository.SampleTable and
+// GenericRepository.SampleTableWithQuery for more details.
+func (r *ClickHouseRepository) SampleTable(
+	ctx context.Context,
+	params SampleParameters,
+) (Sample, error) {
+	sampled, err := r.isSampledTable(ctx, params.Metadata.Schema, params.Metadata.Name)
+	if err != nil {
+		return Sample{}, err
+	}
+	// ClickHouse uses backticks to quote identifiers. The values are only
+	// truncated once they are flattened, since the composite values would
+	// otherwise be truncated as a whole.
+	attrStr := params.SelectList(r.generic.database, "`", nil)
+	var sampleClause string
+	if sampled {
+		// SAMPLE n reads a sample of at least n rows, which are then paged.
+		sampleClause = fmt.Sprintf(" SAMPLE %d", params.Offset+params.SampleSize)
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s.%s%s LIMIT ? OFFSET ?",
+		attrStr,
+		params.Metadata.Schema,
+		params.Metadata.Name,
+		sampleClause,
+	)
+	maxValueLength := params.MaxValueLength
+	params.MaxValueLength = 0
+	sample, err := r.generic.SampleTableWithQuery(ctx, query, params)
+	if err != nil {
+		return Sample{}, err
+	}
+	sample.Results = flattenClickHouseResults(sample.Results, params.SampleSize, maxValueLength)
+	return sample, nil
+}
+
+// isSampledTable returns true if the given table supports the SAMPLE clause.
+// The tables which do are queried once, when the first table is sampled.
+func (r *ClickHouseRepository) isSampledTable(ctx context.Context, schema, table string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sampledTables == nil {
+		rows, err := r.generic.GetDb().QueryContext(ctx, clickHouseSampledTablesQuery)
+		if err != nil {
+			return false, fmt.Errorf("error querying sampled tables: %w", err)
+		}
+		defer func() { _ = rows.Close() }()
+		tables := make(map[[2]string]bool)
+		for rows.Next() {
+			var key [2]string
+			if err := rows.Scan(&key[0], &key[1]); err != nil {
+				return false, fmt.Errorf("error scanning sampled tables query result row: %w", err)
+			}
+			tables[key] = true
+		}
+		if err := rows.Err(); err != nil {
+			return false, fmt.Errorf("error iterating sampled tables query rows: %w", err)
+		}
+		r.sampledTables = tables
+	}
+	return r.sampledTables[[2]string{schema, table}], nil
+}
+
+// Load returns the current load of the database, i.e. the number of queries
+// which are running. See LoadReporter and GenericRepository.LoadWithQuery for
+// more details.
+func (r *ClickHouseRepository) Load(ctx context.Context) (float64, error) {
+	return r.generic.LoadWithQuery(ctx, clickHouseLoadQuery)
+}
+
+// ChangeIndicators returns the change indicators of the MergeTree tables of the
+// database, derived from their active parts. See ChangeTracker and
+// GenericRepository.ChangeIndicatorsWithQuery for more details.
+func (r *ClickHouseRepository) ChangeIndicators(ctx context.Context) (map[string]map[string]string, error) {
+	return r.generic.ChangeIndicatorsWithQuery(ctx, clickHouseChangeIndicatorQuery)
+}
+
+// Ping delegates the ping to GenericRepository. See Repository.Ping and
+// GenericRepository.Ping for more details.
+func (r *ClickHouseRepository) Ping(ctx context.Context) error {
+	return r.generic.Ping(ctx)
+}
+
+// Close delegates the close to GenericRepository. See Repository.Close and
+// GenericRepository.Close for more details.
+func (r *ClickHouseRepository) Close() error {
+	return r.generic.Close()
+}
+
+// clickHouseOptions returns the ClickHouse driver options of the given
+// configuration, connecting to the given database. The queries time out on the
+// server after the query timeout, if any, which only has a precision of
+// seconds. Note that users whose profile is readonly=1 can't change any
+// setting, so they must not set a query timeout.
+func clickHouseOptions(cfg RepoConfig, database string) (*clickhouse.Options, error) {
+	tlsCfg, err := cfg.TLS.clientConfig(cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls config: %w", err)
+	}
+	settings := clickhouse.Settings{}
+	if cfg.QueryTimeout > 0 {
+		settings["max_execution_time"] = timeoutSeconds(cfg.QueryTimeout)
+	}
+	return &clickhouse.Options{
+		Protocol: clickhouse.Native,
+		Addr:     []string{net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))},
+		Auth: clickhouse.Auth{
+			Database: database,
+			Username: cfg.User,
+			Password: cfg.Password,
+		},
+		TLS:      tlsCfg,
+		Settings: settings,
+	}, nil
+}
+
+// flattenClickHouseResults flattens the composite values of the given sample
+// results, i.e. the Array, Map and Tuple values, into their scalar elements,
+// since the classifiers only classify scalar values. Each row is expanded into
+// as many rows as the number of elements of its largest composite value, at
+// most maxElements, where the n-th row holds the n-th element of each
+// composite value. The Nullable and LowCardinality values are already scalars,
+// since the driver dereferences the former and decodes the latter. If
+// maxValueLength is positive, the elements are truncated to that length (see
+// truncateValue).
+func flattenClickHouseResults(results []SampleResult, maxElements, maxValueLength uint) []SampleResult {
+	if maxElements == 0 {
+		maxElements = 1
+	}
+	var flattened []SampleResult
+	for _, row := range results {
+		elements := make(map[string][]any, len(row))
+		n := 1
+		for col, v := range row {
+			vals := clickHouseScalars(v)
+			if uint(len(vals)) > maxElements {
+				vals = vals[:maxElements]
+			}
+			elements[col] = vals
+			n = max(n, len(vals))
+		}
+		for i := range n {
+			res := make(SampleResult, len(row))
+			for col, vals := range elements {
+				switch {
+				case i < len(vals):
+					res[col] = vals[i]
+					if maxValueLength > 0 {
+						res[col] = truncateValue(vals[i], maxValueLength)
+					}
+				case i == 0:
+					// Empty composite values are kept as NULLs.
+					res[col] = nil
+				}
+			}
+			flattened = append(flattened, res)
+		}
+	}
+	return flattened
+}
+
+// clickHouseScalars returns the scalar elements of the given value, which is
+// returned as is if it is a scalar. The elements of the maps are their values,
+// in the order of their keys. Byte slices and arrays, e.g. IP addresses and
+// UUIDs, are scalars.
+func clickHouseScalars(v any) []any {
+	if v == nil {
+		return []any{nil}
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return []any{nil}
+		}
+		return clickHouseScalars(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return []any{v}
+		}
+		vals := make([]any, 0, rv.Len())
+		for i := range rv.Len() {
+			vals = append(vals, clickHouseScalars(rv.Index(i).Interface())...)
+		}
+		return vals
+	case reflect.Map:
+		keys := rv.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		vals := make([]any, 0, len(keys))
+		for _, key := range keys {
+			vals = append(vals, clickHouseScalars(rv.MapIndex(key).Interface())...)
+		}
+		return vals
+	default:
+		return []any{v}
+	}
+}
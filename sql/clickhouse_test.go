@@ -0,0 +1,203 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClickHouseRepository_ListDatabases(t *testing.T) {
+	ctx, db, mock, r := initClickHouseRepoTest(t)
+	defer func() { _ = db.Close() }()
+	dbRows := sqlmock.NewRows([]string{"name"}).AddRow("default").AddRow("events")
+	mock.ExpectQuery(regexp.QuoteMeta(clickHouseDatabaseQuery)).WillReturnRows(dbRows)
+	dbs, err := r.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"default", "events"}, dbs)
+}
+
+func TestClickHouseRepository_Introspect(t *testing.T) {
+	ctx, db, mock, r := initClickHouseRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows(
+		[]string{"table_schema", "table_name", "column_name", "data_type", "object_type", "column_comment", "table_comment"},
+	).
+		AddRow("events", "raw", "emails", "Array(String)", "table", "", "").
+		AddRow("events", "raw", "country", "LowCardinality(String)", "table", "", "")
+	mock.ExpectQuery(regexp.QuoteMeta(clickHouseIntrospectQuery)).WillReturnRows(rows)
+	meta, err := r.Introspect(ctx, IntrospectParameters{IncludePaths: []glob.Glob{glob.MustCompile("*")}})
+	require.NoError(t, err)
+	require.Len(t, meta.Schemas["events"].Tables["raw"].Attributes, 2)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClickHouseRepository_SampleTable(t *testing.T) {
+	ctx, db, mock, r := initClickHouseRepoTest(t)
+	defer func() { _ = db.Close() }()
+	params := func(table string) SampleParameters {
+		return SampleParameters{
+			Metadata: &TableMetadata{
+				Schema: "events",
+				Name:   table,
+				Attributes: []*AttributeMetadata{
+					{Name: "emails", DataType: "Array(String)"},
+				},
+			},
+			SampleSize:     5,
+			Offset:         10,
+			MaxValueLength: 4,
+		}
+	}
+	// The sampled tables are only queried once.
+	mock.ExpectQuery(regexp.QuoteMeta(clickHouseSampledTablesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"database", "name"}).AddRow("events", "raw"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `emails` FROM events.raw SAMPLE 15 LIMIT ? OFFSET ?")).
+		WithArgs(5, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"emails"}).AddRow("jane@example.com"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `emails` FROM events.log LIMIT ? OFFSET ?")).
+		WithArgs(5, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"emails"}).AddRow("john@example.com"))
+
+	sample, err := r.SampleTable(ctx, params("raw"))
+	require.NoError(t, err)
+	require.Equal(t, []SampleResult{{"emails": "jane"}}, sample.Results)
+	sample, err = r.SampleTable(ctx, params("log"))
+	require.NoError(t, err)
+	require.Equal(t, []SampleResult{{"emails": "john"}}, sample.Results)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFlattenClickHouseResults(t *testing.T) {
+	str := "jane@example.com"
+	tests := []struct {
+		name           string
+		results        []SampleResult
+		maxElements    uint
+		maxValueLength uint
+		want           []SampleResult
+	}{
+		{
+			name:    "scalars",
+			results: []SampleResult{{"id": int64(1), "email": str}},
+			want:    []SampleResult{{"id": int64(1), "email": str}},
+		},
+		{
+			name: "array",
+			results: []SampleResult{
+				{"id": int64(1), "emails": []string{"a@example.com", "b@example.com"}},
+			},
+			want: []SampleResult{
+				{"id": int64(1), "emails": "a@example.com"},
+				{"emails": "b@example.com"},
+			},
+		},
+		{
+			name: "array of nullables",
+			results: []SampleResult{
+				{"emails": []*string{&str, nil}},
+			},
+			want: []SampleResult{{"emails": str}, {"emails": nil}},
+		},
+		{
+			name:    "empty array",
+			results: []SampleResult{{"id": int64(1), "emails": []string{}}},
+			want:    []SampleResult{{"id": int64(1), "emails": nil}},
+		},
+		{
+			name: "map",
+			results: []SampleResult{
+				{"attrs": map[string]string{"b": "555-0100", "a": str}},
+			},
+			want: []SampleResult{{"attrs": str}, {"attrs": "555-0100"}},
+		},
+		{
+			name: "nested",
+			results: []SampleResult{
+				{"tuples": [][]any{{"a", int64(1)}, {"b", int64(2)}}},
+			},
+			want: []SampleResult{
+				{"tuples": "a"},
+				{"tuples": int64(1)},
+				{"tuples": "b"},
+				{"tuples": int64(2)},
+			},
+		},
+		{
+			name: "byte slices are scalars",
+			results: []SampleResult{
+				{"ip": net.IPv4(10, 0, 0, 1), "raw": []byte("abc")},
+			},
+			want: []SampleResult{{"ip": net.IPv4(10, 0, 0, 1), "raw": []byte("abc")}},
+		},
+		{
+			name: "max elements",
+			results: []SampleResult{
+				{"emails": []string{"a", "b", "c"}},
+			},
+			maxElements: 2,
+			want:        []SampleResult{{"emails": "a"}, {"emails": "b"}},
+		},
+		{
+			name: "max value length",
+			results: []SampleResult{
+				{"emails": []string{"abcdef", "gh"}},
+			},
+			maxValueLength: 3,
+			want:           []SampleResult{{"emails": "abc"}, {"emails": "gh"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				maxElements := tt.maxElements
+				if maxElements == 0 {
+					maxElements = 10
+				}
+				got := flattenClickHouseResults(tt.results, maxElements, tt.maxValueLength)
+				require.Equal(t, tt.want, got)
+			},
+		)
+	}
+}
+
+func TestClickHouseOptions(t *testing.T) {
+	cfg := RepoConfig{
+		Host:         "ch.example.com",
+		Port:         9440,
+		User:         "dmap",
+		Password:     "secret",
+		QueryTimeout: 1500 * time.Millisecond,
+		TLS:          TLSConfig{Mode: TLSModeRequire},
+	}
+	opts, err := clickHouseOptions(cfg, "events")
+	require.NoError(t, err)
+	require.Equal(t, []string{"ch.example.com:9440"}, opts.Addr)
+	require.Equal(t, "events", opts.Auth.Database)
+	require.Equal(t, "dmap", opts.Auth.Username)
+	require.Equal(t, "secret", opts.Auth.Password)
+	require.Equal(t, int64(2), opts.Settings["max_execution_time"])
+	require.NotNil(t, opts.TLS)
+
+	cfg.QueryTimeout = 0
+	cfg.TLS = TLSConfig{}
+	opts, err = clickHouseOptions(cfg, "events")
+	require.NoError(t, err)
+	require.Empty(t, opts.Settings)
+	require.Nil(t, opts.TLS)
+}
+
+func initClickHouseRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *ClickHouseRepository) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return ctx, db, mock, &ClickHouseRepository{
+		generic: NewGenericRepositoryFromDB(RepoTypeClickHouse, "events", db),
+	}
+}
@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	// Use PostgreSQL DB driver for CockroachDB
+	_ "github.com/lib/pq"
+)
+
+const (
+	RepoTypeCockroachDB = "cockroachdb"
+	// cockroachDbDatabaseQuery lists the databases of the cluster, except the
+	// system database.
+	cockroachDbDatabaseQuery = `
+SELECT
+	datname
+FROM
+	pg_database
+WHERE
+	datname <> 'system'
+`
+	// cockroachDbIntrospectQuery is the generic introspection query, excluding
+	// the CockroachDB virtual schemas, which are present in every database.
+	cockroachDbIntrospectQuery = "SELECT " +
+		genericIntrospectColumns +
+		genericIntrospectFrom +
+		" WHERE c.table_schema NOT IN " +
+		"('crdb_internal', 'information_schema', 'pg_catalog', 'pg_extension')"
+)
+
+// CockroachDbRepository is a Repository implementation for CockroachDB
+// databases. CockroachDB is compatible with the Postgres protocol, but its
+// Postgres system catalogs are only partially implemented, so the databases are
+// introspected through INFORMATION_SCHEMA instead.
+type CockroachDbRepository struct {
+	// The majority of the Repository functionality is delegated to
+	// a generic SQL repository instance.
+	generic *GenericRepository
+}
+
+// CockroachDbRepository implements Repository
+var _ Repository = (*CockroachDbRepository)(nil)
+
+// NewCockroachDbRepository creates a new CockroachDbRepository.
+func NewCockroachDbRepository(cfg RepoConfig) (*CockroachDbRepository, error) {
+	database := cfg.Database
+	// Connect to the default database, if unspecified.
+	if database == "" {
+		database = "defaultdb"
+	}
+	// CockroachDB supports the Postgres session settings.
+	generic, err := newPostgresGenericRepository(
+		RepoTypeCockroachDB,
+		cfg,
+		database,
+		postgresSessionStatements(cfg.QueryTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &CockroachDbRepository{generic: generic}, nil
+}
+
+// ListDatabases returns a list of the names of all databases on the cluster by
+// using a CockroachDB-specific database query. It delegates the actual work to
+// GenericRepository.ListDatabasesWithQuery - see that method for more details.
+func (r *CockroachDbRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	return r.generic.ListDatabasesWithQuery(ctx, cockroachDbDatabaseQuery)
+}
+
+// Introspect delegates introspection to GenericRepository, using a
+// CockroachDB-specific introspection query, and the generic key constraints
+// query. The table statistics aren't collected, since CockroachDB only exposes
+// them per table ID. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
+func (r *CockroachDbRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
+	queries := IntrospectQueries{
+		Introspect: cockroachDbIntrospectQuery,
+		Keys:       genericKeysQuery,
+		PathFilter: postgresPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
+}
+
+// SampleTable delegates sampling to GenericRepository, using the Postgres table
+// sample query. See Repository.SampleTable and
+// GenericRepository.SampleTableWithQuery for more details.
+func (r *CockroachDbRepository) SampleTable(
+	ctx context.Context,
+	params SampleParameters,
+) (Sample, error) {
+	// CockroachDB uses double-quotes to quote identifiers
+	attrStr := params.SelectList(r.generic.database, "\"", postgresTruncate)
+	// CockroachDB uses $x for placeholders
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s.%s LIMIT $1 OFFSET $2",
+		attrStr,
+		params.Metadata.Schema,
+		params.Metadata.Name,
+	)
+	return r.generic.SampleTableWithQuery(ctx, query, params)
+}
+
+// Ping delegates the ping to GenericRepository. See Repository.Ping and
+// GenericRepository.Ping for more details.
+func (r *CockroachDbRepository) Ping(ctx context.Context) error {
+	return r.generic.Ping(ctx)
+}
+
+// Close delegates the close to GenericRepository. See Repository.Close and
+// GenericRepository.Close for more details.
+func (r *CockroachDbRepository) Close() error {
+	return r.generic.Close()
+}
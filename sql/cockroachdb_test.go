@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCockroachDbRepository_ListDatabases(t *testing.T) {
+	ctx, db, mock, r := initCockroachDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	dbRows := sqlmock.NewRows([]string{"name"}).AddRow("defaultdb").AddRow("db1")
+	mock.ExpectQuery(regexp.QuoteMeta(cockroachDbDatabaseQuery)).WillReturnRows(dbRows)
+	dbs, err := r.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"defaultdb", "db1"}, dbs)
+}
+
+func TestCockroachDbRepository_Introspect(t *testing.T) {
+	ctx, db, mock, r := initCockroachDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "data_type", "object_type"}).
+		AddRow("public", "users", "email", "text", "table")
+	mock.ExpectQuery(regexp.QuoteMeta(cockroachDbIntrospectQuery)).WillReturnRows(rows)
+	meta, err := r.Introspect(ctx, IntrospectParameters{IncludePaths: []glob.Glob{glob.MustCompile("*")}})
+	require.NoError(t, err)
+	require.Contains(t, meta.Schemas["public"].Tables, "users")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCockroachDbRepository_SampleTable(t *testing.T) {
+	ctx, db, mock, r := initCockroachDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	params := SampleParameters{
+		Metadata: &TableMetadata{
+			Schema:     "public",
+			Name:       "users",
+			Attributes: []*AttributeMetadata{{Name: "email", DataType: "text"}},
+		},
+		SampleSize: 5,
+	}
+	rows := sqlmock.NewRows([]string{"email"}).AddRow("jane@example.com")
+	query := `SELECT "email" FROM public.users LIMIT $1 OFFSET $2`
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(5, 0).WillReturnRows(rows)
+	sample, err := r.SampleTable(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []SampleResult{{"email": "jane@example.com"}}, sample.Results)
+}
+
+func initCockroachDbRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *CockroachDbRepository) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return ctx, db, mock, &CockroachDbRepository{
+		generic: NewGenericRepositoryFromDB(RepoTypeCockroachDB, "dbName", db),
+	}
+}
@@ -2,6 +2,9 @@ package sql
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -22,10 +25,25 @@ type RepoConfig struct {
 	// MaxParallelDbs is the maximum number of parallel databases scanned at
 	// once.
 	MaxParallelDbs uint
-	// MaxConcurrency is the maximum number of concurrent query goroutines.
+	// MaxConcurrency is the maximum number of concurrent query goroutines,
+	// i.e. the number of tables of a database which are sampled concurrently.
+	// If zero, MaxOpenConns is used, or the number of classification workers
+	// if it is zero too.
 	MaxConcurrency uint
 	// QueryTimeout is the maximum time a query can run before being cancelled.
 	QueryTimeout time.Duration
+	// TLS is the TLS configuration of the connections to the database.
+	TLS TLSConfig
+	// IAMAuth is the AWS IAM authentication configuration of the database. If
+	// nil, the database is authenticated with the user and password.
+	IAMAuth *IAMAuthConfig
+	// RateLimit is the configuration of the query rate limit of the scans of
+	// the database. If nil, the query rate is not limited.
+	RateLimit *RateLimitConfig
+	// SSHTunnel is the configuration of the SSH tunnel the connections to the
+	// database are made through. If nil, the database is connected to
+	// directly.
+	SSHTunnel *SSHTunnelConfig
 	// Advanced is a map of advanced configuration options.
 	Advanced map[string]any
 }
@@ -44,3 +62,39 @@ func keyAsString(cfg map[string]any, key string) (string, error) {
 	}
 	return valStr, nil
 }
+
+// optionalKeyAsString returns the value of the given key as a string from the
+// given configuration map, or an empty string if the key does not exist. It
+// returns an error if the value is not a string.
+func optionalKeyAsString(cfg map[string]any, key string) (string, error) {
+	if _, ok := cfg[key]; !ok {
+		return "", nil
+	}
+	return keyAsString(cfg, key)
+}
+
+// urlConnStr builds a URL connection string with the given scheme, for the
+// host, port and credentials of the given configuration, with the given path
+// (if any) and query parameters. Every part of the URL is escaped, so that
+// credentials or names containing URL delimiters, e.g. @, /, :, ? or #, can't
+// change the meaning of the connection string.
+func urlConnStr(scheme string, cfg RepoConfig, path string, params map[string]string) string {
+	u := url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))),
+	}
+	if path != "" {
+		u.Path = "/" + path
+	}
+	if len(params) > 0 {
+		values := make(url.Values, len(params))
+		for key, val := range params {
+			values.Set(key, val)
+		}
+		// The values are encoded in key order, so that the connection string is
+		// deterministic.
+		u.RawQuery = values.Encode()
+	}
+	return u.String()
+}
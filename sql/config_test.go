@@ -0,0 +1,197 @@
+package sql
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sijms/go-ora/v2/configurations"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+// parsedConnStr are the settings of a connection string, as parsed by the
+// driver it was built for.
+type parsedConnStr struct {
+	user     string
+	password string
+	host     string
+	port     uint16
+	database string
+}
+
+func TestConnStr_AdversarialCredentials(t *testing.T) {
+	credentials := []struct {
+		name     string
+		user     string
+		password string
+		database string
+	}{
+		{name: "plain", user: "dmap", password: "secret", database: "db"},
+		{name: "url delimiters", user: "dmap", password: "p@ss:w/rd?x=1#frag", database: "db"},
+		{name: "fake host", user: "dmap", password: "x@evil.example.com:1/other", database: "db"},
+		{name: "parameter injection", user: "dmap", password: "x&sslmode=disable&tls=false", database: "db"},
+		{name: "percent escapes", user: "dmap", password: "%41%zz%", database: "db"},
+		{name: "quotes and spaces", user: "dmap", password: `a 'b' "c" \d`, database: "db"},
+		{name: "unicode", user: "dmäp", password: "pässwörd€", database: "db"},
+		{name: "at sign in user", user: "dmap@corp.example.com", password: "secret", database: "db"},
+		{name: "adversarial database", user: "dmap", password: "secret", database: "my db/x?y#z"},
+	}
+	repoTypes := []struct {
+		name     string
+		connStr  func(cfg RepoConfig) (string, error)
+		parse    func(t *testing.T, connStr string) parsedConnStr
+		skipHost bool
+	}{
+		{
+			name:    RepoTypePostgres,
+			connStr: func(cfg RepoConfig) (string, error) { return postgresConnStr(cfg, cfg.Database) },
+			parse:   parsePostgresConnStr,
+		},
+		{
+			name:    RepoTypeRedshift,
+			connStr: func(cfg RepoConfig) (string, error) { return postgresConnStr(cfg, cfg.Database) },
+			parse:   parsePostgresConnStr,
+		},
+		{
+			name:    RepoTypeDenodo,
+			connStr: func(cfg RepoConfig) (string, error) { return postgresConnStr(cfg, cfg.Database) },
+			parse:   parsePostgresConnStr,
+		},
+		{
+			name:    RepoTypeMysql,
+			connStr: mySqlConnStr,
+			parse: func(t *testing.T, connStr string) parsedConnStr {
+				cfg, err := mysql.ParseDSN(connStr)
+				require.NoError(t, err)
+				host, port := splitHostPort(t, cfg.Addr)
+				return parsedConnStr{
+					user:     cfg.User,
+					password: cfg.Passwd,
+					host:     host,
+					port:     port,
+					database: cfg.DBName,
+				}
+			},
+		},
+		{
+			name:    RepoTypeSqlServer,
+			connStr: sqlServerConnStr,
+			parse: func(t *testing.T, connStr string) parsedConnStr {
+				cfg, _, err := msdsn.Parse(connStr)
+				require.NoError(t, err)
+				return parsedConnStr{
+					user:     cfg.User,
+					password: cfg.Password,
+					host:     cfg.Host,
+					port:     uint16(cfg.Port),
+					database: cfg.Database,
+				}
+			},
+		},
+		{
+			name: RepoTypeOracle,
+			// The database is the service name for Oracle.
+			connStr: func(cfg RepoConfig) (string, error) {
+				return oracleConnStr(cfg, cfg.Database, nil), nil
+			},
+			parse: func(t *testing.T, connStr string) parsedConnStr {
+				cfg, err := configurations.ParseConfig(connStr)
+				require.NoError(t, err)
+				require.Len(t, cfg.Servers, 1)
+				return parsedConnStr{
+					user:     cfg.UserID,
+					password: cfg.Password,
+					host:     cfg.Servers[0].Addr,
+					port:     uint16(cfg.Servers[0].Port),
+					database: cfg.ServiceName,
+				}
+			},
+		},
+		{
+			name: RepoTypeSnowflake,
+			connStr: func(cfg RepoConfig) (string, error) {
+				driverCfg, err := snowflakeDriverConfig(cfg, SnowflakeConfig{Account: "account", Role: "role", Warehouse: "wh"})
+				if err != nil {
+					return "", err
+				}
+				return gosnowflake.DSN(driverCfg)
+			},
+			parse: func(t *testing.T, connStr string) parsedConnStr {
+				cfg, err := gosnowflake.ParseDSN(connStr)
+				require.NoError(t, err)
+				require.Equal(t, "account", cfg.Account)
+				require.Equal(t, "role", cfg.Role)
+				require.Equal(t, "wh", cfg.Warehouse)
+				return parsedConnStr{
+					user:     cfg.User,
+					password: cfg.Password,
+					database: cfg.Database,
+				}
+			},
+			// Snowflake connects to the account host.
+			skipHost: true,
+		},
+	}
+	for _, repoType := range repoTypes {
+		for _, creds := range credentials {
+			t.Run(repoType.name+"/"+creds.name, func(t *testing.T) {
+				cfg := RepoConfig{
+					Host:     "db.example.com",
+					Port:     5432,
+					User:     creds.user,
+					Password: creds.password,
+					Database: creds.database,
+				}
+				connStr, err := repoType.connStr(cfg)
+				require.NoError(t, err)
+				want := parsedConnStr{
+					user:     creds.user,
+					password: creds.password,
+					host:     cfg.Host,
+					port:     cfg.Port,
+					database: creds.database,
+				}
+				if repoType.skipHost {
+					want.host, want.port = "", 0
+				}
+				require.Equal(t, want, repoType.parse(t, connStr))
+			})
+		}
+	}
+}
+
+func TestMySqlConnStr_UserWithColon(t *testing.T) {
+	_, err := mySqlConnStr(RepoConfig{Host: "db.example.com", Port: 3306, User: "a:b", Password: "c"})
+	require.Error(t, err)
+}
+
+// parsePostgresConnStr parses a lib/pq URL connection string. The URL is parsed
+// the same way lib/pq parses it, after checking that lib/pq accepts it.
+func parsePostgresConnStr(t *testing.T, connStr string) parsedConnStr {
+	_, err := pq.ParseURL(connStr)
+	require.NoError(t, err)
+	u, err := url.Parse(connStr)
+	require.NoError(t, err)
+	password, _ := u.User.Password()
+	host, port := splitHostPort(t, u.Host)
+	return parsedConnStr{
+		user:     u.User.Username(),
+		password: password,
+		host:     host,
+		port:     port,
+		database: u.Path[1:],
+	}
+}
+
+func splitHostPort(t *testing.T, addr string) (string, uint16) {
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	require.NoError(t, err)
+	return host, uint16(port)
+}
@@ -2,8 +2,8 @@ package sql
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"strings"
 
 	// Use PostgreSQL driver for Denodo
 	_ "github.com/lib/pq"
@@ -11,10 +11,19 @@ import (
 
 const (
 	RepoTypeDenodo = "denodo"
+	// denodoDefaultDatabase is the virtual database which is connected to in
+	// order to list the databases of the server, when no database is
+	// configured. It is created when Denodo is installed, and every user can
+	// connect to it.
+	denodoDefaultDatabase = "admin"
+	// denodoDatabaseQuery is the SQL query used to list the virtual databases
+	// of the server which the user can connect to.
+	denodoDatabaseQuery = "SELECT db_name FROM GET_DATABASES()"
 	// denodoIntrospectQuery is the SQL query used to introspect the database.
 	// For Denodo, the object hierarchy is (database > views). When querying
 	// Denodo, the database corresponds to a schema, and the view corresponds to
-	// a table.
+	// a table. The catalog procedure returns the views of all the databases, so
+	// the query is filtered by the database (see denodoIntrospectQueryFor).
 	denodoIntrospectQuery = "SELECT " +
 		"database_name AS table_schema, " +
 		"view_name AS table_name, " +
@@ -34,37 +43,35 @@ type DenodoRepository struct {
 // DenodoRepository implements sql.Repository
 var _ Repository = (*DenodoRepository)(nil)
 
-// NewDenodoRepository is the constructor for sql.
+// NewDenodoRepository is the constructor for sql. If the configuration has no
+// database, the repository is connected to the admin database, which can only
+// be used to list the databases of the server.
 func NewDenodoRepository(cfg RepoConfig) (*DenodoRepository, error) {
-	if cfg.Database == "" {
-		return nil, errors.New("database name is mandatory for Denodo repositories")
+	database := cfg.Database
+	if database == "" {
+		database = denodoDefaultDatabase
 	}
-	connStr := fmt.Sprintf(
-		"postgresql://%s:%s@%s:%d/%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.Database,
-	)
-	generic, err := NewGenericRepository(RepoTypePostgres, cfg.Database, connStr, cfg.MaxOpenConns)
+	// Denodo doesn't support the Postgres session settings, and its sessions are
+	// read-only unless the user has write privileges on the views.
+	generic, err := newPostgresGenericRepository(RepoTypeDenodo, cfg, database, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
 	return &DenodoRepository{generic: generic}, nil
 }
 
-// ListDatabases is left unimplemented for Denodo, because Denodo doesn't have
-// the concept of databases.
-func (r *DenodoRepository) ListDatabases(_ context.Context) ([]string, error) {
-	return nil, errors.New("ListDatabases is not implemented for Denodo repositories")
+// ListDatabases returns the virtual databases of the Denodo server, using the
+// GET_DATABASES catalog procedure. See Repository.ListDatabases and
+// GenericRepository.ListDatabasesWithQuery for more details.
+func (r *DenodoRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	return r.generic.ListDatabasesWithQuery(ctx, denodoDatabaseQuery)
 }
 
-// Introspect delegates introspection to GenericRepository. See
-// Repository.Introspect and GenericRepository.IntrospectWithQuery for more
-// details.
+// Introspect delegates introspection to GenericRepository, restricted to the
+// views of the repository's database. See Repository.Introspect and
+// GenericRepository.IntrospectWithQuery for more details.
 func (r *DenodoRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.IntrospectWithQuery(ctx, denodoIntrospectQuery, params)
+	return r.generic.IntrospectWithQuery(ctx, denodoIntrospectQueryFor(r.generic.database), params)
 }
 
 // SampleTable delegates sampling to GenericRepository, using a Denodo-specific
@@ -74,17 +81,23 @@ func (r *DenodoRepository) SampleTable(
 	ctx context.Context,
 	params SampleParameters,
 ) (Sample, error) {
-	// Denodo uses double-quotes to quote identifiers
-	attrStr := params.Metadata.QuotedAttributeNamesString("\"")
+	// Denodo uses double-quotes to quote identifiers. The values are only
+	// truncated after they are fetched (see SampleParameters.MaxValueLength).
+	attrStr := params.SelectList(r.generic.database, "\"", nil)
 	// The postgres driver is currently unable to properly send the
 	// parameters of a prepared statement to Denodo. Therefore, instead of
 	// building a prepared statement, we populate the query string before
-	// sending it to the driver.
+	// sending it to the driver, without any parameters. Denodo pages the rows
+	// of a view with the OFFSET and LIMIT clauses of VQL.
 	query := fmt.Sprintf(
 		"SELECT %s FROM %s.%s OFFSET %d ROWS LIMIT %d",
-		attrStr, params.Metadata.Schema, params.Metadata.Name, params.Offset, params.SampleSize,
+		attrStr,
+		denodoQuoteIdentifier(params.Metadata.Schema),
+		denodoQuoteIdentifier(params.Metadata.Name),
+		params.Offset,
+		params.SampleSize,
 	)
-	return r.generic.SampleTableWithQuery(ctx, query, params)
+	return r.generic.sampleTableWithQuery(ctx, query, nil, params)
 }
 
 // Ping delegates the ping to GenericRepository. See Repository.Ping and
@@ -98,3 +111,27 @@ func (r *DenodoRepository) Ping(ctx context.Context) error {
 func (r *DenodoRepository) Close() error {
 	return r.generic.Close()
 }
+
+// denodoIntrospectQueryFor returns the introspection query of the views of the
+// given database. As for the sample queries, the database name is inlined in
+// the query as a string literal, rather than sent as a parameter.
+func denodoIntrospectQueryFor(database string) string {
+	if database == "" {
+		return denodoIntrospectQuery
+	}
+	return denodoIntrospectQuery + " WHERE database_name = " + denodoQuoteLiteral(database)
+}
+
+// denodoQuoteIdentifier quotes the given database or view name with
+// double-quotes, so that names which are reserved words, mixed-case, or which
+// contain special characters are preserved. Double-quotes in the name are
+// escaped by doubling them.
+func denodoQuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// denodoQuoteLiteral quotes the given value as a VQL string literal, escaping
+// the single-quotes in the value by doubling them.
+func denodoQuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,100 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenodoRepository_ListDatabases(t *testing.T) {
+	ctx, db, mock, r := initDenodoRepoTest(t, "")
+	defer func() { _ = db.Close() }()
+	dbRows := sqlmock.NewRows([]string{"db_name"}).AddRow("admin").AddRow("sales")
+	mock.ExpectQuery(regexp.QuoteMeta(denodoDatabaseQuery)).WillReturnRows(dbRows)
+	dbs, err := r.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin", "sales"}, dbs)
+}
+
+func TestDenodoRepository_Introspect(t *testing.T) {
+	ctx, db, mock, r := initDenodoRepoTest(t, "sales")
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "data_type"}).
+		AddRow("sales", "customer", "email", "text")
+	mock.ExpectQuery(regexp.QuoteMeta(denodoIntrospectQuery + " WHERE database_name = 'sales'")).
+		WillReturnRows(rows)
+	meta, err := r.Introspect(ctx, IntrospectParameters{IncludePaths: []glob.Glob{glob.MustCompile("*")}})
+	require.NoError(t, err)
+	require.Contains(t, meta.Schemas, "sales")
+	require.Contains(t, meta.Schemas["sales"].Tables, "customer")
+}
+
+func TestDenodoRepository_SampleTable(t *testing.T) {
+	ctx, db, mock, r := initDenodoRepoTest(t, "sales")
+	defer func() { _ = db.Close() }()
+	params := SampleParameters{
+		Metadata: &TableMetadata{
+			Schema: "sales",
+			Name:   `Customer "VIP"`,
+			Attributes: []*AttributeMetadata{
+				{Name: "email", DataType: "text"},
+			},
+		},
+		SampleSize: 5,
+		Offset:     10,
+	}
+	rows := sqlmock.NewRows([]string{"email"}).AddRow("jane@example.com")
+	query := `SELECT "email" FROM "sales"."Customer ""VIP""" OFFSET 10 ROWS LIMIT 5`
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithoutArgs().WillReturnRows(rows)
+	sample, err := r.SampleTable(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []SampleResult{{"email": "jane@example.com"}}, sample.Results)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDenodoIntrospectQueryFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		want     string
+	}{
+		{
+			name: "no database",
+			want: denodoIntrospectQuery,
+		},
+		{
+			name:     "database",
+			database: "sales",
+			want:     denodoIntrospectQuery + " WHERE database_name = 'sales'",
+		},
+		{
+			name:     "quote in database",
+			database: "o'brien",
+			want:     denodoIntrospectQuery + " WHERE database_name = 'o''brien'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				require.Equal(t, tt.want, denodoIntrospectQueryFor(tt.database))
+			},
+		)
+	}
+}
+
+func initDenodoRepoTest(
+	t *testing.T,
+	database string,
+) (context.Context, *sql.DB, sqlmock.Sqlmock, *DenodoRepository) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return ctx, db, mock, &DenodoRepository{
+		generic: NewGenericRepositoryFromDB(RepoTypeDenodo, database, db),
+	}
+}
@@ -0,0 +1,231 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sijms/go-ora/v2/network"
+	"github.com/snowflakedb/gosnowflake"
+
+	"github.com/cyralinc/dmap/scan"
+)
+
+// categorizeError returns the category of the given error, as reported in
+// scan.Failure. The category is determined from the error codes of the
+// supported database drivers whenever possible, and otherwise from common
+// error types and messages.
+func categorizeError(err error) scan.ErrorCategory {
+	if err == nil {
+		return scan.ErrorCategoryUnknown
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return scan.ErrorCategoryTimeout
+	}
+	if category, ok := categorizeDriverError(err); ok {
+		return category
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return scan.ErrorCategoryTimeout
+		}
+		return scan.ErrorCategoryNetwork
+	}
+	return categorizeErrorMessage(err.Error())
+}
+
+// categorizeDriverError categorizes err based on the error codes of the
+// database drivers used by the out-of-the-box repositories. The boolean return
+// value is false if err is not a driver error, or its code is not known.
+func categorizeDriverError(err error) (scan.ErrorCategory, bool) {
+	var (
+		pqErr    *pq.Error
+		myErr    *mysql.MySQLError
+		msErr    mssql.Error
+		sfErr    *gosnowflake.SnowflakeError
+		oraErr   *network.OracleError
+		category scan.ErrorCategory
+	)
+	switch {
+	case errors.As(err, &pqErr):
+		// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+		switch {
+		case pqErr.Code == "42501" || pqErr.Code.Class() == "28":
+			category = scan.ErrorCategoryPermission
+		case pqErr.Code == "57014":
+			category = scan.ErrorCategoryTimeout
+		case pqErr.Code.Class() == "42":
+			category = scan.ErrorCategorySyntax
+		case pqErr.Code.Class() == "08":
+			category = scan.ErrorCategoryNetwork
+		}
+	case errors.As(err, &myErr):
+		// See https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+		switch myErr.Number {
+		case 1044, 1045, 1142, 1143, 1227:
+			category = scan.ErrorCategoryPermission
+		case 1205, 3024:
+			category = scan.ErrorCategoryTimeout
+		case 1064, 1054, 1146:
+			category = scan.ErrorCategorySyntax
+		}
+	case errors.As(err, &msErr):
+		// See https://learn.microsoft.com/en-us/sql/relational-databases/errors-events/database-engine-events-and-errors
+		switch msErr.Number {
+		case 229, 230, 262, 297, 916, 18456:
+			category = scan.ErrorCategoryPermission
+		case 1222:
+			category = scan.ErrorCategoryTimeout
+		case 102, 156, 207, 208:
+			category = scan.ErrorCategorySyntax
+		}
+	case errors.As(err, &sfErr):
+		switch sfErr.Number {
+		case 2003, 390100, 390144:
+			// 2003 is "object does not exist or not authorized".
+			category = scan.ErrorCategoryPermission
+		case 604, 630:
+			category = scan.ErrorCategoryTimeout
+		case 1003, 904:
+			category = scan.ErrorCategorySyntax
+		}
+	case errors.As(err, &oraErr):
+		switch oraErr.ErrCode {
+		case 1031, 1017, 942:
+			// ORA-00942 (table or view does not exist) is also returned when
+			// the user lacks privileges on an existing table.
+			category = scan.ErrorCategoryPermission
+		case 1013:
+			category = scan.ErrorCategoryTimeout
+		case 900, 904, 923, 933, 936:
+			category = scan.ErrorCategorySyntax
+		case 3113, 3114, 3135, 12170, 12541, 12543:
+			category = scan.ErrorCategoryNetwork
+		}
+	}
+	return category, category != ""
+}
+
+// isTransientError returns true if the given error is likely transient, i.e.
+// if the failed operation may succeed if it is retried, e.g. a dropped
+// connection, a deadlock or a server which is temporarily out of connections.
+// Timeouts aren't considered transient, since the query timeout is enforced by
+// cancelling the context, and retrying slow queries would only add load to the
+// database.
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if transient, ok := isTransientDriverError(err); ok {
+		return transient
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && !netErr.Timeout() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return containsAny(
+		msg,
+		"connection reset",
+		"connection refused",
+		"broken pipe",
+		"bad connection",
+		"unexpected eof",
+		"too many connections",
+		"deadlock",
+	)
+}
+
+// isTransientDriverError determines whether err is transient based on the
+// error codes of the database drivers used by the out-of-the-box repositories.
+// The boolean return value is false if err is not a driver error.
+func isTransientDriverError(err error) (transient bool, ok bool) {
+	var (
+		pqErr  *pq.Error
+		myErr  *mysql.MySQLError
+		msErr  mssql.Error
+		sfErr  *gosnowflake.SnowflakeError
+		oraErr *network.OracleError
+	)
+	switch {
+	case errors.As(err, &pqErr):
+		// Connection exceptions, serialization failures, deadlocks, too many
+		// connections and server shutdowns or restarts.
+		switch pqErr.Code {
+		case "40001", "40P01", "53300", "57P01", "57P02", "57P03":
+			return true, true
+		}
+		return pqErr.Code.Class() == "08", true
+	case errors.As(err, &myErr):
+		switch myErr.Number {
+		// Too many connections, deadlocks, and the server going away.
+		case 1040, 1203, 1213, 1053, 2006, 2013:
+			return true, true
+		}
+		return false, true
+	case errors.As(err, &msErr):
+		switch msErr.Number {
+		// Deadlock victims, and the transient errors of Azure SQL Database,
+		// e.g. a database which is being moved or a busy service.
+		case 1205, 233, 4060, 40197, 40501, 40613, 49918, 49919, 49920, 10053, 10054, 10060, 10928, 10929:
+			return true, true
+		}
+		return false, true
+	case errors.As(err, &sfErr):
+		switch sfErr.Number {
+		case gosnowflake.ErrCodeServiceUnavailable, gosnowflake.ErrCodeFailedToConnect:
+			return true, true
+		}
+		return false, true
+	case errors.As(err, &oraErr):
+		switch oraErr.ErrCode {
+		// Deadlocks, exceeded sessions or processes, lost connections and
+		// listeners which are out of handlers.
+		case 60, 18, 20, 3113, 3114, 3135, 12170, 12516, 12519, 12520, 12528, 12537, 12541, 12543:
+			return true, true
+		}
+		return false, true
+	}
+	return false, false
+}
+
+// categorizeErrorMessage categorizes an error based on its message. It is used
+// as a fallback for errors without a known error code, e.g. for drivers which
+// only return formatted error strings.
+func categorizeErrorMessage(msg string) scan.ErrorCategory {
+	msg = strings.ToLower(msg)
+	switch {
+	case containsAny(msg, "permission denied", "access denied", "not authorized", "insufficient privilege", "authentication failed", "login failed"):
+		return scan.ErrorCategoryPermission
+	case containsAny(msg, "timeout", "timed out", "canceling statement", "deadline exceeded"):
+		return scan.ErrorCategoryTimeout
+	case containsAny(msg, "syntax error", "incorrect syntax", "invalid sql"):
+		return scan.ErrorCategorySyntax
+	case containsAny(msg, "connection refused", "connection reset", "no such host", "broken pipe", "bad connection", "unexpected eof"):
+		return scan.ErrorCategoryNetwork
+	default:
+		return scan.ErrorCategoryUnknown
+	}
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
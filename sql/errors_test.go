@@ -0,0 +1,169 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sijms/go-ora/v2/network"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cyralinc/dmap/scan"
+)
+
+func TestCategorizeError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want scan.ErrorCategory
+	}{
+		{
+			name: "Context deadline exceeded",
+			err:  fmt.Errorf("error sampling table: %w", context.DeadlineExceeded),
+			want: scan.ErrorCategoryTimeout,
+		},
+		{
+			name: "Postgres insufficient privilege",
+			err:  fmt.Errorf("error sampling table: %w", &pq.Error{Code: "42501"}),
+			want: scan.ErrorCategoryPermission,
+		},
+		{
+			name: "Postgres syntax error",
+			err:  &pq.Error{Code: "42601"},
+			want: scan.ErrorCategorySyntax,
+		},
+		{
+			name: "Postgres statement timeout",
+			err:  &pq.Error{Code: "57014"},
+			want: scan.ErrorCategoryTimeout,
+		},
+		{
+			name: "MySQL table access denied",
+			err:  &mysql.MySQLError{Number: 1142},
+			want: scan.ErrorCategoryPermission,
+		},
+		{
+			name: "SQL Server permission denied",
+			err:  mssql.Error{Number: 229},
+			want: scan.ErrorCategoryPermission,
+		},
+		{
+			name: "Snowflake object not authorized",
+			err:  &gosnowflake.SnowflakeError{Number: 2003},
+			want: scan.ErrorCategoryPermission,
+		},
+		{
+			name: "Oracle syntax error",
+			err:  &network.OracleError{ErrCode: 933},
+			want: scan.ErrorCategorySyntax,
+		},
+		{
+			name: "Network error",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			want: scan.ErrorCategoryNetwork,
+		},
+		{
+			name: "Message fallback",
+			err:  errors.New("pq: permission denied for table users"),
+			want: scan.ErrorCategoryPermission,
+		},
+		{
+			name: "Unknown error",
+			err:  errors.New("something went wrong"),
+			want: scan.ErrorCategoryUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				require.Equal(t, tt.want, categorizeError(tt.err))
+			},
+		)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Nil",
+		},
+		{
+			name: "Context deadline exceeded",
+			err:  fmt.Errorf("error sampling table: %w", context.DeadlineExceeded),
+		},
+		{
+			name: "Postgres too many connections",
+			err:  fmt.Errorf("error sampling table: %w", &pq.Error{Code: "53300"}),
+			want: true,
+		},
+		{
+			name: "Postgres connection failure",
+			err:  &pq.Error{Code: "08006"},
+			want: true,
+		},
+		{
+			name: "Postgres insufficient privilege",
+			err:  &pq.Error{Code: "42501"},
+		},
+		{
+			name: "MySQL deadlock",
+			err:  &mysql.MySQLError{Number: 1213},
+			want: true,
+		},
+		{
+			name: "MySQL invalid connection",
+			err:  mysql.ErrInvalidConn,
+			want: true,
+		},
+		{
+			name: "SQL Server deadlock victim",
+			err:  mssql.Error{Number: 1205},
+			want: true,
+		},
+		{
+			name: "SQL Server syntax error",
+			err:  mssql.Error{Number: 102},
+		},
+		{
+			name: "Snowflake service unavailable",
+			err:  &gosnowflake.SnowflakeError{Number: gosnowflake.ErrCodeServiceUnavailable},
+			want: true,
+		},
+		{
+			name: "Oracle end of file on communication channel",
+			err:  &network.OracleError{ErrCode: 3113},
+			want: true,
+		},
+		{
+			name: "Network error",
+			err:  &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+			want: true,
+		},
+		{
+			name: "Message fallback",
+			err:  errors.New("Error 1040: Too many connections"),
+			want: true,
+		},
+		{
+			name: "Unknown error",
+			err:  errors.New("something went wrong"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				require.Equal(t, tt.want, isTransientError(tt.err))
+			},
+		)
+	}
+}
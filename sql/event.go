@@ -0,0 +1,58 @@
+package sql
+
+import (
+	"github.com/cyralinc/dmap/classification"
+	"github.com/cyralinc/dmap/scan"
+)
+
+// EventType is the type of an Event emitted by Scanner.ScanStream.
+type EventType string
+
+const (
+	// EventTableClassified is emitted once the sample of a table has been
+	// classified.
+	EventTableClassified EventType = "tableClassified"
+	// EventFailure is emitted for each failure which occurs during the scan.
+	EventFailure EventType = "failure"
+	// EventDone is the last event of a scan.
+	EventDone EventType = "done"
+)
+
+// Event is an incremental result of a repository scan, as emitted by
+// Scanner.ScanStream. The fields which are set depend on the event type.
+type Event struct {
+	Type EventType
+	// TablePath is the path of the classified table (EventTableClassified).
+	TablePath []string
+	// Classifications are the unique classifications of the attributes of the
+	// classified table (EventTableClassified). It is empty if the table was
+	// empty, or none of its attributes were classified.
+	Classifications []classification.Classification
+	// Stats are the estimated statistics of the table, if they were collected
+	// (EventTableClassified).
+	Stats *TableStats
+	// Resumed is true if the classifications of the table were loaded from the
+	// checkpoint of a previous scan rather than scanned (EventTableClassified).
+	Resumed bool
+	// Unchanged is true if the table is unchanged since the previous scan of an
+	// incremental scan, and its classifications were carried forward rather
+	// than scanned (EventTableClassified).
+	Unchanged bool
+	// Failure is the failure which occurred (EventFailure).
+	Failure *scan.Failure
+	// Failures are all the failures which occurred during the scan
+	// (EventDone).
+	Failures []scan.Failure
+	// Retries are all the repository operations which were retried during
+	// the scan (EventDone).
+	Retries []scan.Retry
+	// Coverage is the coverage of the scan (EventDone).
+	Coverage scan.Coverage
+	// Relationships are the foreign key relationships of the scanned
+	// databases, if they were collected (EventDone). Their linked labels are
+	// not set, since they depend on the classifications of all the tables
+	// (see Scanner.Scan).
+	Relationships []scan.Relationship
+	// Err is the error which caused the scan to fail, if any (EventDone).
+	Err error
+}
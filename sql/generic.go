@@ -13,15 +13,36 @@ import (
 )
 
 const (
+	// genericIntrospectQuery joins the INFORMATION_SCHEMA tables view to
+	// determine the object type of each table. Its TABLE_TYPE values are
+	// mostly standard, with some database-specific additions, e.g. Snowflake's
+	// materialized views and external tables. It is made of the select list,
+	// the from clause and the where clause below, so that repositories can
+	// extend it, e.g. with comment columns.
 	genericIntrospectQuery = "SELECT " +
-		"table_schema, " +
-		"table_name, " +
-		"column_name, " +
-		"data_type " +
-		"FROM " +
-		"INFORMATION_SCHEMA.COLUMNS " +
-		"WHERE " +
-		"table_schema NOT IN " +
+		genericIntrospectColumns +
+		genericIntrospectFrom +
+		genericIntrospectWhere
+	genericIntrospectColumns = "c.table_schema, " +
+		"c.table_name, " +
+		"c.column_name, " +
+		"c.data_type, " +
+		"CASE t.table_type " +
+		"WHEN 'BASE TABLE' THEN 'table' " +
+		"WHEN 'VIEW' THEN 'view' " +
+		"WHEN 'SYSTEM VIEW' THEN 'view' " +
+		"WHEN 'MATERIALIZED VIEW' THEN 'materialized_view' " +
+		"WHEN 'EXTERNAL TABLE' THEN 'external_table' " +
+		"WHEN 'FOREIGN' THEN 'foreign_table' " +
+		"END AS object_type"
+	genericIntrospectFrom = " FROM " +
+		"INFORMATION_SCHEMA.COLUMNS c " +
+		"LEFT JOIN INFORMATION_SCHEMA.TABLES t ON " +
+		"t.table_catalog = c.table_catalog AND " +
+		"t.table_schema = c.table_schema AND " +
+		"t.table_name = c.table_name"
+	genericIntrospectWhere = " WHERE " +
+		"c.table_schema NOT IN " +
 		"(" +
 		"'INFORMATION_SCHEMA', " +
 		"'information_schema', " +
@@ -30,6 +51,43 @@ const (
 		"'performance_schema', " +
 		"'pg_catalog'" +
 		")"
+	// genericKeysQuery returns the columns of the primary and foreign keys of
+	// the tables, using the standard INFORMATION_SCHEMA views. The referenced
+	// columns of a foreign key are the columns of the unique constraint it
+	// references, at the same position.
+	genericKeysQuery = "SELECT " +
+		"tc.table_schema, " +
+		"tc.table_name, " +
+		"tc.constraint_name, " +
+		"tc.constraint_type, " +
+		"kcu.column_name, " +
+		"rkcu.table_schema, " +
+		"rkcu.table_name, " +
+		"rkcu.column_name " +
+		"FROM " +
+		"INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc " +
+		"JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu ON " +
+		"kcu.constraint_catalog = tc.constraint_catalog AND " +
+		"kcu.constraint_schema = tc.constraint_schema AND " +
+		"kcu.constraint_name = tc.constraint_name AND " +
+		"kcu.table_schema = tc.table_schema AND " +
+		"kcu.table_name = tc.table_name " +
+		"LEFT JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS rc ON " +
+		"rc.constraint_catalog = tc.constraint_catalog AND " +
+		"rc.constraint_schema = tc.constraint_schema AND " +
+		"rc.constraint_name = tc.constraint_name " +
+		"LEFT JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE rkcu ON " +
+		"rkcu.constraint_catalog = rc.unique_constraint_catalog AND " +
+		"rkcu.constraint_schema = rc.unique_constraint_schema AND " +
+		"rkcu.constraint_name = rc.unique_constraint_name AND " +
+		"rkcu.ordinal_position = kcu.position_in_unique_constraint " +
+		"WHERE " +
+		"tc.constraint_type IN ('PRIMARY KEY', 'FOREIGN KEY') " +
+		"ORDER BY " +
+		"tc.table_schema, " +
+		"tc.table_name, " +
+		"tc.constraint_name, " +
+		"kcu.ordinal_position"
 	genericPingQuery           = "SELECT 1"
 	genericSampleQueryTemplate = "SELECT %s FROM %s.%s LIMIT ? OFFSET ?"
 )
@@ -50,6 +108,9 @@ type GenericRepository struct {
 	repoType string
 	database string
 	db       *sql.DB
+	// tunnel is the SSH tunnel of the connections, if any, which is closed
+	// with the repository.
+	tunnel *sshTunnel
 }
 
 var _ Repository = (*GenericRepository)(nil)
@@ -124,12 +185,66 @@ func (r *GenericRepository) ListDatabasesWithQuery(
 	return dbs, nil
 }
 
-// Introspect calls IntrospectWithQuery with a default query string
+// ChangeIndicatorsWithQuery returns the change indicators of the tables of the
+// database, as determined by the given query (see ChangeTracker). The query is
+// expected to return a row set containing three columns, corresponding to the
+// schema name, the table name and the change indicator of each table. Tables
+// with a NULL change indicator are omitted.
+func (r *GenericRepository) ChangeIndicatorsWithQuery(
+	ctx context.Context,
+	query string,
+	params ...any,
+) (map[string]map[string]string, error) {
+	log.Tracef("Query: %s", query)
+	rows, err := r.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying change indicators: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	indicators := make(map[string]map[string]string)
+	for rows.Next() {
+		var (
+			schema, table string
+			indicator     sql.NullString
+		)
+		if err := rows.Scan(&schema, &table, &indicator); err != nil {
+			return nil, fmt.Errorf("error scanning change indicator query result row: %w", err)
+		}
+		if !indicator.Valid {
+			continue
+		}
+		if indicators[schema] == nil {
+			indicators[schema] = make(map[string]string)
+		}
+		indicators[schema][table] = indicator.String
+	}
+	// Something broke while iterating the row set
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating change indicator query rows: %w", err)
+	}
+	return indicators, nil
+}
+
+// LoadWithQuery returns the current load of the database, as determined by the
+// given query (see LoadReporter). The query is expected to return a single row
+// with a single numeric column.
+func (r *GenericRepository) LoadWithQuery(ctx context.Context, query string, params ...any) (float64, error) {
+	log.Tracef("Query: %s", query)
+	var load float64
+	if err := r.db.QueryRowContext(ctx, query, params...).Scan(&load); err != nil {
+		return 0, fmt.Errorf("error querying database load: %w", err)
+	}
+	return load, nil
+}
+
+// Introspect calls IntrospectWithQueries with the default introspection and
+// key constraint queries.
 func (r *GenericRepository) Introspect(
 	ctx context.Context,
 	params IntrospectParameters,
 ) (*Metadata, error) {
-	return r.IntrospectWithQuery(ctx, genericIntrospectQuery, params)
+	queries := IntrospectQueries{Introspect: genericIntrospectQuery, Keys: genericKeysQuery}
+	return r.IntrospectWithQueries(ctx, queries, params)
 }
 
 // IntrospectWithQuery executes a query against the information_schema table in
@@ -138,6 +253,14 @@ func (r *GenericRepository) Introspect(
 //
 // table_schema, table_name, column_name, data_type
 //
+// The query may optionally return the following additional columns, which are
+// identified by name, and any of which may be NULL:
+//
+//   - object_type: the ObjectType of each table, which is used to filter the
+//     tables by the object type filters of params.
+//   - column_comment: the comment describing each column.
+//   - table_comment: the comment describing each table.
+//
 // This row set represents all the columns of all the tables in the repository.
 // The row set is then parsed into an instance of Metadata and
 // returned. Additionally, any errors which occur during the query execution or
@@ -146,39 +269,256 @@ func (r *GenericRepository) IntrospectWithQuery(
 	ctx context.Context,
 	query string,
 	params IntrospectParameters,
+) (*Metadata, error) {
+	return r.introspectWithQuery(ctx, query, nil, params)
+}
+
+// introspectWithQuery is IntrospectWithQuery, with the given query parameters.
+func (r *GenericRepository) introspectWithQuery(
+	ctx context.Context,
+	query string,
+	args []any,
+	params IntrospectParameters,
 ) (*Metadata, error) {
 	log.Tracef("Query: %s", query)
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error performing introspect query: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
-	return newMetadataFromQueryResult(r.database, params.IncludePaths, params.ExcludePaths, rows)
+	return newMetadataFromQueryResult(r.database, params, rows)
+}
+
+// IntrospectQueries are the queries used by IntrospectWithQueries.
+type IntrospectQueries struct {
+	// Introspect is the introspection query (see IntrospectWithQuery).
+	Introspect string
+	// Stats is the optional table statistics query (see
+	// CollectStatsWithQuery).
+	Stats string
+	// ExactStats is true if the row counts returned by the Stats query are
+	// exact, e.g. maintained by the storage engine, rather than estimates
+	// which may be stale, or zero for tables which were never analyzed.
+	ExactStats bool
+	// Keys is the optional key constraints query (see CollectKeysWithQuery).
+	Keys string
+	// PathFilter is the optional dialect used to push the path filters down
+	// into the introspection query. The query must then name its schema and
+	// table name columns table_schema and table_name.
+	PathFilter *PathFilterDialect
+}
+
+// IntrospectWithQueries calls IntrospectWithQuery with the introspection query,
+// whose rows are first filtered by the path filters of params if the queries
+// have a PathFilter dialect. Then, if requested by params.CollectStats and
+// params.CollectKeys, it collects the statistics and the key constraints of the
+// introspected tables with the corresponding queries, unless they are empty,
+// i.e. unsupported by the repository. Since the statistics and key constraints
+// are optional, an error collecting them is only logged.
+func (r *GenericRepository) IntrospectWithQueries(
+	ctx context.Context,
+	queries IntrospectQueries,
+	params IntrospectParameters,
+) (*Metadata, error) {
+	query, args := queries.Introspect, []any(nil)
+	if queries.PathFilter != nil {
+		query, args = queries.PathFilter.apply(query, r.database, params)
+	}
+	meta, err := r.introspectWithQuery(ctx, query, args, params)
+	if err != nil {
+		return nil, err
+	}
+	if params.CollectStats && queries.Stats != "" {
+		if err := r.collectStatsWithQuery(ctx, meta, queries.Stats, queries.ExactStats); err != nil {
+			log.WithError(err).Warnf("error collecting table statistics for database %s", r.database)
+		}
+	}
+	if params.CollectKeys && queries.Keys != "" {
+		if err := r.CollectKeysWithQuery(ctx, meta, queries.Keys); err != nil {
+			log.WithError(err).Warnf("error collecting key constraints for database %s", r.database)
+		}
+	}
+	return meta, nil
+}
+
+// CollectStatsWithQuery sets the statistics of the tables in meta, as
+// determined by the given query. The query is expected to return a row set
+// containing four columns, corresponding to the schema name, the table name,
+// the estimated row count and the estimated size in bytes of each table. A
+// NULL row count means the statistics of the table are unknown, and a NULL
+// size means only the size is unknown. Tables which aren't in meta are
+// ignored.
+func (r *GenericRepository) CollectStatsWithQuery(
+	ctx context.Context,
+	meta *Metadata,
+	query string,
+	params ...any,
+) error {
+	return r.collectStatsWithQuery(ctx, meta, query, false, params...)
+}
+
+// collectStatsWithQuery is CollectStatsWithQuery, which marks the statistics
+// as exact if the row counts of the query are (see TableStats.Exact).
+func (r *GenericRepository) collectStatsWithQuery(
+	ctx context.Context,
+	meta *Metadata,
+	query string,
+	exact bool,
+	params ...any,
+) error {
+	log.Tracef("Query: %s", query)
+	rows, err := r.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("error querying table statistics: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			schema, table       string
+			rowCount, sizeBytes sql.NullInt64
+		)
+		if err := rows.Scan(&schema, &table, &rowCount, &sizeBytes); err != nil {
+			return fmt.Errorf("error scanning table statistics query result row: %w", err)
+		}
+		schemaMeta, ok := meta.Schemas[schema]
+		if !ok {
+			continue
+		}
+		tableMeta, ok := schemaMeta.Tables[table]
+		if !ok || !rowCount.Valid {
+			continue
+		}
+		tableMeta.Stats = &TableStats{RowCount: rowCount.Int64, SizeBytes: sizeBytes.Int64, Exact: exact}
+	}
+	// Something broke while iterating the row set
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating table statistics query rows: %w", err)
+	}
+	return nil
+}
+
+// CollectKeysWithQuery sets the primary and foreign keys of the tables in meta,
+// as determined by the given query. The query is expected to return a row set
+// containing eight columns, with one row per column of each key constraint:
+//
+// table_schema, table_name, constraint_name, constraint_type, column_name,
+// referenced_schema, referenced_table, referenced_column
+//
+// The constraint type is either 'PRIMARY KEY' or 'FOREIGN KEY', and the
+// referenced columns are NULL for primary keys. The rows of each constraint
+// must be ordered by the position of the columns in the constraint. Tables
+// which aren't in meta are ignored.
+func (r *GenericRepository) CollectKeysWithQuery(
+	ctx context.Context,
+	meta *Metadata,
+	query string,
+	params ...any,
+) error {
+	log.Tracef("Query: %s", query)
+	rows, err := r.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("error querying key constraints: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	// The foreign keys are indexed by their table and constraint name, since
+	// constraint names are not necessarily unique within a schema.
+	type fkKey struct{ schema, table, name string }
+	foreignKeys := make(map[fkKey]*ForeignKey)
+	var fkOrder []fkKey
+	for rows.Next() {
+		var (
+			schema, table, name, constraintType, column string
+			refSchema, refTable, refColumn              sql.NullString
+		)
+		err := rows.Scan(&schema, &table, &name, &constraintType, &column, &refSchema, &refTable, &refColumn)
+		if err != nil {
+			return fmt.Errorf("error scanning key constraints query result row: %w", err)
+		}
+		schemaMeta, ok := meta.Schemas[schema]
+		if !ok {
+			continue
+		}
+		tableMeta, ok := schemaMeta.Tables[table]
+		if !ok {
+			continue
+		}
+		switch constraintType {
+		case "PRIMARY KEY":
+			tableMeta.PrimaryKey = append(tableMeta.PrimaryKey, column)
+		case "FOREIGN KEY":
+			if !refTable.Valid {
+				// The referenced table isn't visible to the user.
+				continue
+			}
+			key := fkKey{schema: schema, table: table, name: name}
+			fk, ok := foreignKeys[key]
+			if !ok {
+				fk = &ForeignKey{Name: name, ReferencedSchema: refSchema.String, ReferencedTable: refTable.String}
+				foreignKeys[key] = fk
+				fkOrder = append(fkOrder, key)
+			}
+			fk.Columns = append(fk.Columns, column)
+			fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn.String)
+		}
+	}
+	// Something broke while iterating the row set
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating key constraints query rows: %w", err)
+	}
+	for _, key := range fkOrder {
+		tableMeta := meta.Schemas[key.schema].Tables[key.table]
+		tableMeta.ForeignKeys = append(tableMeta.ForeignKeys, *foreignKeys[key])
+	}
+	return nil
 }
 
 // SampleTable samples the table referenced by the TableMetadata meta parameter
-// by issuing a standard, ANSI-compatible SELECT query to the database. All
-// attributes of the table are selected, and are quoted using double quotes. See
+// by issuing a standard, ANSI-compatible SELECT query to the database. The
+// attributes of the table which pass the filters of params are selected, and
+// are quoted using double quotes (see SampleParameters.SelectList). See
 // Repository.SampleTable for more details.
 func (r *GenericRepository) SampleTable(
 	ctx context.Context,
 	params SampleParameters,
 ) (Sample, error) {
 	// ANSI SQL uses double-quotes to quote identifiers
-	attrStr := params.Metadata.QuotedAttributeNamesString("\"")
+	attrStr := params.SelectList(r.database, "\"", genericTruncate)
 	query := fmt.Sprintf(genericSampleQueryTemplate, attrStr, params.Metadata.Schema, params.Metadata.Name)
 	return r.SampleTableWithQuery(ctx, query, params)
 }
 
 // SampleTableWithQuery calls SampleTable with a custom SQL query. Any
-// placeholder parameters in the query should be passed via params.
+// placeholder parameters in the query should be passed via params. The query
+// isn't executed if none of the attributes of the table pass the filters of
+// params, in which case an empty sample is returned. The sampled values are
+// truncated to params.MaxValueLength, if set, in case the query doesn't
+// truncate them.
 func (r *GenericRepository) SampleTableWithQuery(
 	ctx context.Context,
 	query string,
 	params SampleParameters,
 ) (Sample, error) {
+	return r.sampleTableWithQuery(ctx, query, []any{params.SampleSize, params.Offset}, params)
+}
+
+// sampleTableWithQuery is SampleTableWithQuery, with the given query
+// parameters instead of the sample size and offset, for the queries which
+// inline them.
+func (r *GenericRepository) sampleTableWithQuery(
+	ctx context.Context,
+	query string,
+	args []any,
+	params SampleParameters,
+) (Sample, error) {
+	if len(params.sampledAttributes(r.database)) == 0 {
+		log.Debugf(
+			"all the columns of table %s.%s.%s are excluded, skipping sampling",
+			r.database, params.Metadata.Schema, params.Metadata.Name,
+		)
+		return Sample{}, nil
+	}
 	log.Tracef("Query: %s", query)
-	rows, err := r.db.QueryContext(ctx, query, params.SampleSize, params.Offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return Sample{},
 			fmt.Errorf(
@@ -199,6 +539,11 @@ func (r *GenericRepository) SampleTableWithQuery(
 		if err != nil {
 			return Sample{}, err
 		}
+		if params.MaxValueLength > 0 {
+			for k, v := range data {
+				data[k] = truncateValue(v, params.MaxValueLength)
+			}
+		}
 		sample.Results = append(sample.Results, data)
 	}
 	if err := rows.Err(); err != nil {
@@ -228,9 +573,14 @@ func (r *GenericRepository) GetDb() *sql.DB {
 	return r.db
 }
 
-// Close closes the database connection used by the repository.
+// Close closes the database connection used by the repository, and its SSH
+// tunnel, if any.
 func (r *GenericRepository) Close() error {
-	return r.db.Close()
+	err := r.db.Close()
+	if tunnelErr := r.tunnel.Close(); tunnelErr != nil {
+		err = errors.Join(err, fmt.Errorf("error closing ssh tunnel: %w", tunnelErr))
+	}
+	return err
 }
 
 // newDbHandle opens a new database sql.DB handle for the given repoType and
@@ -279,8 +629,14 @@ func getCurrentRowAsMap(rows *sql.Rows) (map[string]any, error) {
 // of the given glob patterns. It returns true if the database, schema, and
 // table match any of the patterns, and false otherwise.
 func matchPathPatterns(database, schema, table string, patterns []glob.Glob) bool {
+	return matchPatterns(fmt.Sprintf("%s.%s.%s", database, schema, table), patterns)
+}
+
+// matchPatterns returns true if the given string matches any of the given glob
+// patterns.
+func matchPatterns(s string, patterns []glob.Glob) bool {
 	for _, pattern := range patterns {
-		if pattern.Match(fmt.Sprintf("%s.%s.%s", database, schema, table)) {
+		if pattern.Match(s) {
 			return true
 		}
 	}
@@ -37,7 +37,7 @@ func Test_Introspect_IsSuccessful(t *testing.T) {
 		AddRow("schema1", "table2", "column1", "integer").
 		AddRow("schema2", "table1", "column1", "date")
 
-	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS WHERE (.+)").
+	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS (.+)").
 		WillReturnRows(rows)
 
 	ctx := context.Background()
@@ -125,7 +125,7 @@ func Test_Introspect_QueryError(t *testing.T) {
 
 	expectedErr := errors.New("dummy error")
 
-	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS WHERE (.+)").
+	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS (.+)").
 		WillReturnError(expectedErr)
 
 	ctx := context.Background()
@@ -163,7 +163,7 @@ func Test_Introspect_RowError(t *testing.T) {
 		AddRow("schema1", "table1", "column1", "varchar").
 		RowError(0, expectedErr)
 
-	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS WHERE (.+)").
+	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS (.+)").
 		WillReturnRows(rows)
 
 	ctx := context.Background()
@@ -205,7 +205,7 @@ func Test_Introspect_Filtered(t *testing.T) {
 		AddRow("schema3", "table1", "column2", "decimal").
 		AddRow("schema3", "table2", "column1", "integer")
 
-	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS WHERE (.+)").
+	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS (.+)").
 		WillReturnRows(rows)
 
 	ctx := context.Background()
@@ -288,3 +288,188 @@ func Test_Introspect_Filtered(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, &expectedMetadata, meta)
 }
+
+func Test_IntrospectWithQueries_Stats(t *testing.T) {
+	tests := []struct {
+		name         string
+		collectStats bool
+		exactStats   bool
+		statsRows    *sqlmock.Rows
+		statsErr     error
+		want         map[string]*TableStats
+	}{
+		{
+			name:         "stats collected",
+			collectStats: true,
+			statsRows: sqlmock.NewRows([]string{"schema", "table", "row_count", "size_bytes"}).
+				AddRow("schema1", "table1", 200000000, 4096).
+				AddRow("schema1", "table2", 0, nil).
+				AddRow("schema1", "table3", nil, 1024).
+				AddRow("schema2", "unknown", 10, 10),
+			want: map[string]*TableStats{
+				"table1": {RowCount: 200000000, SizeBytes: 4096},
+				"table2": {RowCount: 0},
+				"table3": nil,
+			},
+		},
+		{
+			name:         "exact stats collected",
+			collectStats: true,
+			exactStats:   true,
+			statsRows: sqlmock.NewRows([]string{"schema", "table", "row_count", "size_bytes"}).
+				AddRow("schema1", "table1", 42, 4096).
+				AddRow("schema1", "table2", 0, nil),
+			want: map[string]*TableStats{
+				"table1": {RowCount: 42, SizeBytes: 4096, Exact: true},
+				"table2": {RowCount: 0, Exact: true},
+				"table3": nil,
+			},
+		},
+		{
+			name:         "stats error",
+			collectStats: true,
+			statsErr:     errors.New("permission denied"),
+			want:         map[string]*TableStats{"table1": nil, "table2": nil, "table3": nil},
+		},
+		{
+			name: "stats not requested",
+			want: map[string]*TableStats{"table1": nil, "table2": nil, "table3": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func() { _ = db.Close() }()
+			repo := NewGenericRepositoryFromDB("genericSql", "exampleDb", db)
+			rows := sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "data_type"}).
+				AddRow("schema1", "table1", "column1", "varchar").
+				AddRow("schema1", "table2", "column1", "varchar").
+				AddRow("schema1", "table3", "column1", "varchar")
+			mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS").WillReturnRows(rows)
+			statsQuery := "SELECT (.+) FROM stats"
+			if tt.statsRows != nil {
+				mock.ExpectQuery(statsQuery).WillReturnRows(tt.statsRows)
+			} else if tt.statsErr != nil {
+				mock.ExpectQuery(statsQuery).WillReturnError(tt.statsErr)
+			}
+
+			meta, err := repo.IntrospectWithQueries(
+				context.Background(),
+				IntrospectQueries{
+					Introspect: genericIntrospectQuery,
+					Stats:      "SELECT schema, table, row_count, size_bytes FROM stats",
+					ExactStats: tt.exactStats,
+				},
+				IntrospectParameters{
+					IncludePaths: []glob.Glob{glob.MustCompile("*")},
+					CollectStats: tt.collectStats,
+				},
+			)
+			require.NoError(t, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+			stats := make(map[string]*TableStats)
+			for name, table := range meta.Schemas["schema1"].Tables {
+				stats[name] = table.Stats
+			}
+			require.Equal(t, tt.want, stats)
+		})
+	}
+}
+
+func Test_IntrospectWithQueries_Keys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	repo := NewGenericRepositoryFromDB("genericSql", "exampleDb", db)
+	rows := sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "data_type"}).
+		AddRow("schema1", "users", "id", "integer").
+		AddRow("schema1", "users", "ssn", "varchar").
+		AddRow("schema1", "orders", "id", "integer").
+		AddRow("schema1", "orders", "tenant_id", "integer").
+		AddRow("schema1", "orders", "user_id", "integer")
+	mock.ExpectQuery("SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS").WillReturnRows(rows)
+	keyRows := sqlmock.NewRows(
+		[]string{"schema", "table", "name", "type", "column", "ref_schema", "ref_table", "ref_column"},
+	).
+		AddRow("schema1", "orders", "orders_pkey", "PRIMARY KEY", "id", nil, nil, nil).
+		AddRow("schema1", "orders", "orders_user_fkey", "FOREIGN KEY", "tenant_id", "schema1", "users", "tenant_id").
+		AddRow("schema1", "orders", "orders_user_fkey", "FOREIGN KEY", "user_id", "schema1", "users", "id").
+		AddRow("schema1", "orders", "orders_hidden_fkey", "FOREIGN KEY", "user_id", nil, nil, nil).
+		AddRow("schema1", "users", "users_pkey", "PRIMARY KEY", "id", nil, nil, nil).
+		AddRow("schema2", "unknown", "unknown_pkey", "PRIMARY KEY", "id", nil, nil, nil)
+	mock.ExpectQuery("SELECT (.+) FROM keys").WillReturnRows(keyRows)
+
+	meta, err := repo.IntrospectWithQueries(
+		context.Background(),
+		IntrospectQueries{
+			Introspect: genericIntrospectQuery,
+			Keys:       "SELECT * FROM keys",
+		},
+		IntrospectParameters{
+			IncludePaths: []glob.Glob{glob.MustCompile("*")},
+			CollectKeys:  true,
+		},
+	)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	users := meta.Schemas["schema1"].Tables["users"]
+	require.Equal(t, []string{"id"}, users.PrimaryKey)
+	require.Empty(t, users.ForeignKeys)
+	orders := meta.Schemas["schema1"].Tables["orders"]
+	require.Equal(t, []string{"id"}, orders.PrimaryKey)
+	require.Equal(
+		t,
+		[]ForeignKey{
+			{
+				Name:              "orders_user_fkey",
+				Columns:           []string{"tenant_id", "user_id"},
+				ReferencedSchema:  "schema1",
+				ReferencedTable:   "users",
+				ReferencedColumns: []string{"tenant_id", "id"},
+			},
+		},
+		orders.ForeignKeys,
+	)
+}
+
+func Test_Introspect_Comments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	repo := NewGenericRepositoryFromDB("genericSql", "exampleDb", db)
+	// The optional columns are identified by name, regardless of their case.
+	cols := []string{"table_schema", "table_name", "column_name", "data_type", "TABLE_COMMENT", "COLUMN_COMMENT"}
+	rows := sqlmock.NewRows(cols).
+		AddRow("schema1", "table1", "column1", "varchar", "Customers", "Customer tax id").
+		AddRow("schema1", "table1", "column2", "varchar", "Customers", nil).
+		AddRow("schema1", "table2", "column1", "varchar", nil, nil)
+	mock.ExpectQuery("SELECT (.+) FROM comments").WillReturnRows(rows)
+	meta, err := repo.IntrospectWithQuery(
+		context.Background(),
+		"SELECT * FROM comments",
+		IntrospectParameters{IncludePaths: []glob.Glob{glob.MustCompile("*")}},
+	)
+	require.NoError(t, err)
+	table1 := meta.Schemas["schema1"].Tables["table1"]
+	require.Equal(t, "Customers", table1.Comment)
+	require.Equal(t, "Customer tax id", table1.Attributes[0].Comment)
+	require.Empty(t, table1.Attributes[1].Comment)
+	require.Empty(t, meta.Schemas["schema1"].Tables["table2"].Comment)
+}
+
+func Test_Introspect_UnexpectedColumn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	repo := NewGenericRepositoryFromDB("genericSql", "exampleDb", db)
+	cols := []string{"table_schema", "table_name", "column_name", "data_type", "unknown"}
+	rows := sqlmock.NewRows(cols).AddRow("schema1", "table1", "column1", "varchar", "foo")
+	mock.ExpectQuery("SELECT (.+) FROM unknown").WillReturnRows(rows)
+	_, err = repo.IntrospectWithQuery(
+		context.Background(),
+		"SELECT * FROM unknown",
+		IntrospectParameters{IncludePaths: []glob.Glob{glob.MustCompile("*")}},
+	)
+	require.ErrorContains(t, err, "unexpected metadata query result column unknown")
+}
@@ -0,0 +1,332 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+
+	"github.com/cyralinc/dmap/aws"
+)
+
+const (
+	// rdsAuthTokenLifetime is the lifetime of the RDS authentication tokens.
+	// RDS doesn't accept tokens which are valid for longer than 15 minutes.
+	rdsAuthTokenLifetime = 15 * time.Minute
+	// redshiftCredentialsLifetime is the lifetime requested for the temporary
+	// Redshift credentials.
+	redshiftCredentialsLifetime = 15 * time.Minute
+	// iamCredentialsRefreshMargin is how long before their expiration the IAM
+	// credentials are refreshed, so that new connections are never opened with
+	// credentials which are about to expire.
+	iamCredentialsRefreshMargin = 5 * time.Minute
+	// emptyPayloadHash is the SHA-256 hash of an empty payload, which is the
+	// payload of the presigned RDS connect requests.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// IAMAuthConfig is the configuration of the AWS IAM database authentication of
+// a repository. It is supported by the Postgres and MySQL repositories, for RDS
+// and Aurora instances, which are authenticated with RDS authentication tokens,
+// and by the Redshift repository, which is authenticated with the temporary
+// credentials of the cluster. The password of the repository configuration is
+// ignored.
+type IAMAuthConfig struct {
+	// Region is the AWS region of the database. If empty, the region of the
+	// default AWS configuration is used.
+	Region string
+	// AssumeRole is the IAM role to assume to authenticate to the database. If
+	// nil, the credentials of the default AWS configuration are used.
+	AssumeRole *aws.AssumeRoleConfig
+	// ClusterIdentifier is the identifier of the Redshift cluster. If empty, it
+	// is derived from the host of the repository, i.e. the first label of the
+	// cluster endpoint.
+	ClusterIdentifier string
+}
+
+// iamCredentials are temporary database credentials obtained with AWS IAM.
+type iamCredentials struct {
+	user       string
+	password   string
+	expiration time.Time
+}
+
+// iamCredentialsFunc obtains new temporary database credentials.
+type iamCredentialsFunc func(ctx context.Context) (iamCredentials, error)
+
+// iamCredentialsCache caches temporary database credentials, and obtains new
+// ones when they are about to expire. It is safe for concurrent use.
+type iamCredentialsCache struct {
+	fetch iamCredentialsFunc
+	now   func() time.Time
+
+	mu    sync.Mutex
+	creds iamCredentials
+}
+
+// newIAMCredentialsCache returns a new cache of the credentials obtained by
+// the given function.
+func newIAMCredentialsCache(fetch iamCredentialsFunc) *iamCredentialsCache {
+	return &iamCredentialsCache{fetch: fetch, now: time.Now}
+}
+
+// get returns the cached credentials, or new ones if the cached credentials
+// expire within iamCredentialsRefreshMargin.
+func (c *iamCredentialsCache) get(ctx context.Context) (iamCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.creds.password != "" && c.now().Add(iamCredentialsRefreshMargin).Before(c.creds.expiration) {
+		return c.creds, nil
+	}
+	creds, err := c.fetch(ctx)
+	if err != nil {
+		return iamCredentials{}, err
+	}
+	c.creds = creds
+	return creds, nil
+}
+
+// iamConnector is a driver.Connector which opens each connection with the
+// current IAM credentials of the repository, so that a long scan keeps opening
+// connections after the credentials it started with expired.
+type iamConnector struct {
+	driver  driver.Driver
+	cfg     RepoConfig
+	connStr func(cfg RepoConfig) (string, error)
+	creds   *iamCredentialsCache
+}
+
+var _ driver.Connector = (*iamConnector)(nil)
+
+// Connect opens a new connection with the current IAM credentials. See
+// driver.Connector for more details.
+func (c *iamConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	creds, err := c.creds.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error obtaining iam database credentials: %w", err)
+	}
+	cfg := c.cfg
+	cfg.User = creds.user
+	cfg.Password = creds.password
+	connStr, err := c.connStr(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if driverCtx, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := driverCtx.OpenConnector(connStr)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(connStr)
+}
+
+// Driver returns the underlying driver of the connector. See driver.Connector
+// for more details.
+func (c *iamConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// newIAMAuthRepository returns a GenericRepository which authenticates to the
+// database with AWS IAM, as configured by cfg.IAMAuth. The connections are
+// opened with the given driver and with the connection strings built by
+// connStr, and are initialized with the given session statements. The AWS
+// configuration is only loaded when the first connection is opened, since the
+// repository constructors don't have a context.
+func newIAMAuthRepository(
+	repoType string,
+	cfg RepoConfig,
+	drv driver.Driver,
+	connStr func(cfg RepoConfig) (string, error),
+	statements []string,
+) (*GenericRepository, error) {
+	var fetch iamCredentialsFunc
+	switch repoType {
+	case RepoTypePostgres, RepoTypeMysql:
+		fetch = rdsCredentials(cfg)
+	case RepoTypeRedshift:
+		fetch = redshiftCredentials(cfg)
+	default:
+		return nil, fmt.Errorf("iam authentication is not supported by repo type %s", repoType)
+	}
+	db := openSessionDB(
+		&iamConnector{
+			driver:  drv,
+			cfg:     cfg,
+			connStr: connStr,
+			creds:   newIAMCredentialsCache(fetch),
+		},
+		statements,
+		cfg.MaxOpenConns,
+	)
+	return NewGenericRepositoryFromDB(repoType, cfg.Database, db), nil
+}
+
+// loadIAMAuthConfig loads the AWS configuration of the given IAM
+// authentication configuration, and returns it with its region.
+func loadIAMAuthConfig(ctx context.Context, iamCfg *IAMAuthConfig) (awssdk.Config, string, error) {
+	awsCfg, err := aws.LoadConfig(ctx, iamCfg.AssumeRole)
+	if err != nil {
+		return awssdk.Config{}, "", err
+	}
+	region := iamCfg.Region
+	if region == "" {
+		region = awsCfg.Region
+	}
+	if region == "" {
+		return awssdk.Config{}, "", errors.New("aws region is required for iam authentication")
+	}
+	awsCfg.Region = region
+	return awsCfg, region, nil
+}
+
+// rdsCredentials returns a function which obtains RDS authentication tokens for
+// the host, port and user of the given configuration.
+func rdsCredentials(cfg RepoConfig) iamCredentialsFunc {
+	var (
+		awsCfg awssdk.Config
+		region string
+		loaded bool
+	)
+	// The function is only called by iamCredentialsCache.get, which
+	// serializes the calls, so the lazily loaded configuration isn't guarded.
+	return func(ctx context.Context) (iamCredentials, error) {
+		if !loaded {
+			var err error
+			if awsCfg, region, err = loadIAMAuthConfig(ctx, cfg.IAMAuth); err != nil {
+				return iamCredentials{}, err
+			}
+			loaded = true
+		}
+		now := time.Now()
+		endpoint := net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
+		token, err := rdsAuthToken(ctx, awsCfg.Credentials, region, endpoint, cfg.User, now)
+		if err != nil {
+			return iamCredentials{}, err
+		}
+		return iamCredentials{
+			user:       cfg.User,
+			password:   token,
+			expiration: now.Add(rdsAuthTokenLifetime),
+		}, nil
+	}
+}
+
+// rdsAuthToken returns an RDS authentication token of the given user for the
+// database at the given endpoint (host:port), signed at the given time with the
+// given AWS credentials. The token is the presigned URL of an RDS connect
+// request, without its scheme, and it is used as the password of the user.
+func rdsAuthToken(
+	ctx context.Context,
+	credsProvider awssdk.CredentialsProvider,
+	region, endpoint, user string,
+	signingTime time.Time,
+) (string, error) {
+	if credsProvider == nil {
+		return "", errors.New("no aws credentials to sign the rds authentication token with")
+	}
+	creds, err := credsProvider.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving aws credentials: %w", err)
+	}
+	query := url.Values{
+		"Action":        {"connect"},
+		"DBUser":        {user},
+		"X-Amz-Expires": {strconv.Itoa(int(rdsAuthTokenLifetime.Seconds()))},
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://"+endpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error building rds connect request: %w", err)
+	}
+	signedURL, _, err := v4.NewSigner().PresignHTTP(
+		ctx,
+		creds,
+		req,
+		emptyPayloadHash,
+		"rds-db",
+		region,
+		signingTime,
+	)
+	if err != nil {
+		return "", fmt.Errorf("error signing rds authentication token: %w", err)
+	}
+	return strings.TrimPrefix(signedURL, "https://"), nil
+}
+
+// redshiftCredentialsClient is the subset of the Redshift API client used to
+// obtain temporary cluster credentials.
+type redshiftCredentialsClient interface {
+	GetClusterCredentials(
+		ctx context.Context,
+		params *redshift.GetClusterCredentialsInput,
+		optFns ...func(*redshift.Options),
+	) (*redshift.GetClusterCredentialsOutput, error)
+}
+
+// redshiftCredentials returns a function which obtains temporary Redshift
+// credentials for the user and database of the given configuration.
+func redshiftCredentials(cfg RepoConfig) iamCredentialsFunc {
+	clusterID := cfg.IAMAuth.ClusterIdentifier
+	if clusterID == "" {
+		// Cluster endpoints are <cluster>.<id>.<region>.redshift.amazonaws.com.
+		clusterID, _, _ = strings.Cut(cfg.Host, ".")
+	}
+	database := cfg.Database
+	// Connect to the default database, if unspecified.
+	if database == "" {
+		database = "dev"
+	}
+	var client redshiftCredentialsClient
+	// See rdsCredentials for why the client isn't guarded.
+	return func(ctx context.Context) (iamCredentials, error) {
+		if client == nil {
+			awsCfg, _, err := loadIAMAuthConfig(ctx, cfg.IAMAuth)
+			if err != nil {
+				return iamCredentials{}, err
+			}
+			client = redshift.NewFromConfig(awsCfg)
+		}
+		return getRedshiftClusterCredentials(ctx, client, clusterID, cfg.User, database)
+	}
+}
+
+// getRedshiftClusterCredentials obtains temporary credentials of the given
+// user and database of the given Redshift cluster.
+func getRedshiftClusterCredentials(
+	ctx context.Context,
+	client redshiftCredentialsClient,
+	clusterID, user, database string,
+) (iamCredentials, error) {
+	out, err := client.GetClusterCredentials(
+		ctx,
+		&redshift.GetClusterCredentialsInput{
+			ClusterIdentifier: awssdk.String(clusterID),
+			DbUser:            awssdk.String(user),
+			DbName:            awssdk.String(database),
+			DurationSeconds:   awssdk.Int32(int32(redshiftCredentialsLifetime.Seconds())),
+		},
+	)
+	if err != nil {
+		return iamCredentials{}, fmt.Errorf("error getting redshift cluster credentials: %w", err)
+	}
+	creds := iamCredentials{
+		user:     awssdk.ToString(out.DbUser),
+		password: awssdk.ToString(out.DbPassword),
+	}
+	if out.Expiration != nil {
+		creds.expiration = *out.Expiration
+	}
+	return creds, nil
+}
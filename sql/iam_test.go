@@ -0,0 +1,177 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRdsAuthToken(t *testing.T) {
+	ctx := context.Background()
+	creds := credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "")
+	signingTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	token, err := rdsAuthToken(ctx, creds, "us-east-1", "db.example.com:5432", "dmap", signingTime)
+	require.NoError(t, err)
+
+	u, err := url.Parse("https://" + token)
+	require.NoError(t, err)
+	require.Equal(t, "db.example.com:5432", u.Host)
+	require.Equal(t, "/", u.Path)
+	query := u.Query()
+	require.Equal(t, "connect", query.Get("Action"))
+	require.Equal(t, "dmap", query.Get("DBUser"))
+	require.Equal(t, "900", query.Get("X-Amz-Expires"))
+	require.Equal(t, "20240102T030405Z", query.Get("X-Amz-Date"))
+	require.Equal(t, "AKIDEXAMPLE/20240102/us-east-1/rds-db/aws4_request", query.Get("X-Amz-Credential"))
+	require.NotEmpty(t, query.Get("X-Amz-Signature"))
+
+	// The token is deterministic for the same inputs.
+	again, err := rdsAuthToken(ctx, creds, "us-east-1", "db.example.com:5432", "dmap", signingTime)
+	require.NoError(t, err)
+	require.Equal(t, token, again)
+
+	_, err = rdsAuthToken(ctx, nil, "us-east-1", "db.example.com:5432", "dmap", signingTime)
+	require.Error(t, err)
+}
+
+func TestIAMCredentialsCache_get(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var fetches int
+	cache := newIAMCredentialsCache(
+		func(_ context.Context) (iamCredentials, error) {
+			fetches++
+			return iamCredentials{
+				user:       "dmap",
+				password:   fmt.Sprintf("token-%d", fetches),
+				expiration: now.Add(15 * time.Minute),
+			}, nil
+		},
+	)
+	cache.now = func() time.Time { return now }
+
+	creds, err := cache.get(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "token-1", creds.password)
+
+	// The credentials are reused until they are about to expire.
+	now = now.Add(9 * time.Minute)
+	creds, err = cache.get(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "token-1", creds.password)
+
+	now = now.Add(2 * time.Minute)
+	creds, err = cache.get(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "token-2", creds.password)
+	require.Equal(t, 2, fetches)
+}
+
+func TestIAMCredentialsCache_get_Error(t *testing.T) {
+	cache := newIAMCredentialsCache(
+		func(_ context.Context) (iamCredentials, error) {
+			return iamCredentials{}, errors.New("dummy error")
+		},
+	)
+	_, err := cache.get(context.Background())
+	require.Error(t, err)
+}
+
+func TestIAMConnector_Connect(t *testing.T) {
+	drv := &fakeDriver{}
+	connector := &iamConnector{
+		driver: drv,
+		cfg:    RepoConfig{Host: "db.example.com", Port: 5432, User: "dmap", Password: "ignored"},
+		connStr: func(cfg RepoConfig) (string, error) {
+			return postgresConnStr(cfg, "db")
+		},
+		creds: newIAMCredentialsCache(
+			func(_ context.Context) (iamCredentials, error) {
+				return iamCredentials{user: "dmap", password: "token?x=1&y", expiration: time.Now().Add(time.Hour)}, nil
+			},
+		),
+	}
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	got := parsePostgresConnStr(t, drv.connStr)
+	require.Equal(t, "dmap", got.user)
+	require.Equal(t, "token?x=1&y", got.password)
+	require.Equal(t, drv, connector.Driver())
+}
+
+func TestGetRedshiftClusterCredentials(t *testing.T) {
+	expiration := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := &fakeRedshiftCredentialsClient{
+		out: &redshift.GetClusterCredentialsOutput{
+			DbUser:     awssdk.String("IAM:dmap"),
+			DbPassword: awssdk.String("password"),
+			Expiration: &expiration,
+		},
+	}
+	creds, err := getRedshiftClusterCredentials(context.Background(), client, "cluster", "dmap", "dev")
+	require.NoError(t, err)
+	require.Equal(t, iamCredentials{user: "IAM:dmap", password: "password", expiration: expiration}, creds)
+	require.Equal(t, "cluster", awssdk.ToString(client.in.ClusterIdentifier))
+	require.Equal(t, "dmap", awssdk.ToString(client.in.DbUser))
+	require.Equal(t, "dev", awssdk.ToString(client.in.DbName))
+	require.Equal(t, int32(900), awssdk.ToInt32(client.in.DurationSeconds))
+
+	client.err = errors.New("dummy error")
+	_, err = getRedshiftClusterCredentials(context.Background(), client, "cluster", "dmap", "dev")
+	require.Error(t, err)
+}
+
+func TestNewMySqlRepository_IAMAuth(t *testing.T) {
+	cfg := RepoConfig{Host: "db.example.com", Port: 3306, User: "dmap", IAMAuth: &IAMAuthConfig{Region: "us-east-1"}}
+	_, err := NewMySqlRepository(cfg)
+	require.Error(t, err)
+
+	cfg.TLS = TLSConfig{Mode: TLSModeRequire}
+	repo, err := NewMySqlRepository(cfg)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	connStr, err := mySqlConnStr(cfg)
+	require.NoError(t, err)
+	mysqlCfg, err := mysql.ParseDSN(connStr)
+	require.NoError(t, err)
+	require.True(t, mysqlCfg.AllowCleartextPasswords)
+}
+
+// fakeDriver is a driver.Driver which records the connection string it was
+// opened with.
+type fakeDriver struct {
+	connStr string
+}
+
+func (d *fakeDriver) Open(connStr string) (driver.Conn, error) {
+	d.connStr = connStr
+	return nil, nil
+}
+
+// fakeRedshiftCredentialsClient is a redshiftCredentialsClient which records
+// its input and returns the configured output.
+type fakeRedshiftCredentialsClient struct {
+	in  *redshift.GetClusterCredentialsInput
+	out *redshift.GetClusterCredentialsOutput
+	err error
+}
+
+func (c *fakeRedshiftCredentialsClient) GetClusterCredentials(
+	_ context.Context,
+	params *redshift.GetClusterCredentialsInput,
+	_ ...func(*redshift.Options),
+) (*redshift.GetClusterCredentialsOutput, error) {
+	c.in = params
+	return c.out, c.err
+}
@@ -0,0 +1,137 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	RepoTypeMariaDB = "mariadb"
+	// mariaDbDatabaseQuery lists the databases of the server, except the system
+	// databases. Unlike MySQL, the mysql system database is excluded too, since
+	// it is always present in MariaDB.
+	mariaDbDatabaseQuery = `
+SELECT
+    schema_name
+FROM
+    information_schema.schemata
+WHERE
+    schema_name NOT IN ('information_schema', 'mysql', 'performance_schema', 'sys')
+`
+	// mariaDbLoadQuery reads the number of threads which are running a query.
+	// The Performance Schema is disabled by default in MariaDB, so the status
+	// variable is read from information_schema instead.
+	mariaDbLoadQuery = `
+SELECT
+    VARIABLE_VALUE
+FROM
+    information_schema.global_status
+WHERE
+    VARIABLE_NAME = 'THREADS_RUNNING'
+`
+)
+
+// MariaDbRepository is a Repository implementation for MariaDB databases. The
+// MariaDB catalog is compatible with MySQL's, so the introspection, sampling
+// and change tracking are the same as MySqlRepository's, but the server
+// settings of the sessions and the database listing differ.
+type MariaDbRepository struct {
+	// The majority of the Repository functionality is delegated to
+	// a generic SQL repository instance.
+	generic *GenericRepository
+}
+
+// MariaDbRepository implements Repository, ChangeTracker and LoadReporter
+var (
+	_ Repository    = (*MariaDbRepository)(nil)
+	_ ChangeTracker = (*MariaDbRepository)(nil)
+	_ LoadReporter  = (*MariaDbRepository)(nil)
+)
+
+// NewMariaDbRepository creates a new MariaDbRepository.
+func NewMariaDbRepository(cfg RepoConfig) (*MariaDbRepository, error) {
+	generic, err := newMySqlGenericRepository(RepoTypeMariaDB, cfg, mariaDbSessionStatements(cfg.QueryTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return &MariaDbRepository{generic: generic}, nil
+}
+
+// ListDatabases returns a list of the names of all databases on the server by
+// using a MariaDB-specific database query. It delegates the actual work to
+// GenericRepository.ListDatabasesWithQuery - see that method for more details.
+func (r *MariaDbRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	return r.generic.ListDatabasesWithQuery(ctx, mariaDbDatabaseQuery)
+}
+
+// Introspect delegates introspection to GenericRepository, using the MySQL
+// introspection, table statistics and key constraints queries. See
+// Repository.Introspect and GenericRepository.IntrospectWithQueries for more
+// details.
+func (r *MariaDbRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
+	queries := IntrospectQueries{
+		Introspect: mySqlIntrospectQuery,
+		Stats:      mySqlStatsQuery,
+		Keys:       mySqlKeysQuery,
+		PathFilter: mySqlPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
+}
+
+// SampleTable delegates sampling to GenericRepository, using the MySQL table
+// sample query. See Repository.SampleTable and
+// GenericRepository.SampleTableWithQuery for more details.
+func (r *MariaDbRepository) SampleTable(
+	ctx context.Context,
+	params SampleParameters,
+) (Sample, error) {
+	// MariaDB uses backticks to quote identifiers.
+	attrStr := params.SelectList(r.generic.database, "`", mySqlTruncate)
+	query := fmt.Sprintf(genericSampleQueryTemplate, attrStr, params.Metadata.Schema, params.Metadata.Name)
+	return r.generic.SampleTableWithQuery(ctx, query, params)
+}
+
+// Load returns the current load of the database, i.e. the number of threads
+// which are running a query. See LoadReporter and
+// GenericRepository.LoadWithQuery for more details.
+func (r *MariaDbRepository) Load(ctx context.Context) (float64, error) {
+	return r.generic.LoadWithQuery(ctx, mariaDbLoadQuery)
+}
+
+// ChangeIndicators returns the change indicators of the tables of the database,
+// derived from their last update time. See ChangeTracker and
+// GenericRepository.ChangeIndicatorsWithQuery for more details.
+func (r *MariaDbRepository) ChangeIndicators(ctx context.Context) (map[string]map[string]string, error) {
+	return r.generic.ChangeIndicatorsWithQuery(ctx, mySqlChangeIndicatorQuery)
+}
+
+// Ping delegates the ping to GenericRepository. See Repository.Ping and
+// GenericRepository.Ping for more details.
+func (r *MariaDbRepository) Ping(ctx context.Context) error {
+	return r.generic.Ping(ctx)
+}
+
+// Close delegates the close to GenericRepository. See Repository.Close and
+// GenericRepository.Close for more details.
+func (r *MariaDbRepository) Close() error {
+	return r.generic.Close()
+}
+
+// mariaDbSessionStatements returns the statements initializing the sessions
+// of the MariaDB repositories: the transactions of the sessions are read-only,
+// and the queries and lock waits time out on the server after the given query
+// timeout, if any. Unlike MySQL's max_execution_time, MariaDB's
+// max_statement_time is in seconds, with a precision of microseconds.
+func mariaDbSessionStatements(queryTimeout time.Duration) []string {
+	statements := []string{"SET SESSION TRANSACTION READ ONLY"}
+	if queryTimeout > 0 {
+		statements = append(
+			statements,
+			fmt.Sprintf("SET SESSION max_statement_time = %.3f", float64(timeoutMillis(queryTimeout))/1000),
+			fmt.Sprintf("SET SESSION lock_wait_timeout = %d", timeoutSeconds(queryTimeout)),
+			fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", timeoutSeconds(queryTimeout)),
+		)
+	}
+	return statements
+}
@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMariaDbRepository_ListDatabases(t *testing.T) {
+	ctx, db, mock, r := initMariaDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	dbRows := sqlmock.NewRows([]string{"name"}).AddRow("db1").AddRow("db2")
+	mock.ExpectQuery(regexp.QuoteMeta(mariaDbDatabaseQuery)).WillReturnRows(dbRows)
+	dbs, err := r.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"db1", "db2"}, dbs)
+}
+
+func TestMariaDbRepository_Load(t *testing.T) {
+	ctx, db, mock, r := initMariaDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows([]string{"VARIABLE_VALUE"}).AddRow("12")
+	mock.ExpectQuery(regexp.QuoteMeta(mariaDbLoadQuery)).WillReturnRows(rows)
+	load, err := r.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, float64(12), load)
+}
+
+func TestMariaDbRepository_SampleTable(t *testing.T) {
+	ctx, db, mock, r := initMariaDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	params := SampleParameters{
+		Metadata: &TableMetadata{
+			Schema:     "schema",
+			Name:       "table",
+			Attributes: []*AttributeMetadata{{Name: "name", DataType: "varchar"}},
+		},
+		SampleSize:     5,
+		MaxValueLength: 3,
+	}
+	rows := sqlmock.NewRows([]string{"name"}).AddRow("abc")
+	query := "SELECT LEFT(`name`, 3) AS `name` FROM schema.table LIMIT ? OFFSET ?"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(5, 0).WillReturnRows(rows)
+	sample, err := r.SampleTable(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []SampleResult{{"name": "abc"}}, sample.Results)
+}
+
+func TestMariaDbSessionStatements(t *testing.T) {
+	require.Equal(t, []string{"SET SESSION TRANSACTION READ ONLY"}, mariaDbSessionStatements(0))
+	require.Equal(
+		t,
+		[]string{
+			"SET SESSION TRANSACTION READ ONLY",
+			"SET SESSION max_statement_time = 1.500",
+			"SET SESSION lock_wait_timeout = 2",
+			"SET SESSION innodb_lock_wait_timeout = 2",
+		},
+		mariaDbSessionStatements(1500*time.Millisecond),
+	)
+}
+
+func initMariaDbRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *MariaDbRepository) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return ctx, db, mock, &MariaDbRepository{
+		generic: NewGenericRepositoryFromDB(RepoTypeMariaDB, "dbName", db),
+	}
+}
@@ -3,9 +3,9 @@ package sql
 import (
 	"database/sql"
 	"fmt"
+	"slices"
 	"strings"
 
-	"github.com/gobwas/glob"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -31,9 +31,85 @@ type SchemaMetadata struct {
 // TableMetadata represents the structure of a database table. It contains a
 // slice of attributes (i.e. columns) that belong to the table.
 type TableMetadata struct {
-	Schema     string
-	Name       string
+	Schema string
+	Name   string
+	// ObjectType is the type of the table, e.g. a view. It is empty if the
+	// repository doesn't report object types.
+	ObjectType ObjectType
+	// Comment is the comment describing the table, if any.
+	Comment    string
 	Attributes []*AttributeMetadata
+	// Stats are the estimated statistics of the table. They are only set if
+	// they were requested (see IntrospectParameters.CollectStats) and are
+	// available for the table.
+	Stats *TableStats
+	// PrimaryKey are the names of the columns of the primary key of the table,
+	// in order. Like ForeignKeys, it is only set if key constraints were
+	// requested (see IntrospectParameters.CollectKeys).
+	PrimaryKey []string
+	// ForeignKeys are the foreign keys of the table.
+	ForeignKeys []ForeignKey
+}
+
+// ForeignKey is a foreign key constraint of a table, which references a table
+// of the same database.
+type ForeignKey struct {
+	// Name is the name of the constraint.
+	Name string
+	// Columns are the names of the referencing columns of the table.
+	Columns []string
+	// ReferencedSchema and ReferencedTable are the schema and name of the
+	// referenced table.
+	ReferencedSchema, ReferencedTable string
+	// ReferencedColumns are the names of the referenced columns, in the same
+	// order as Columns.
+	ReferencedColumns []string
+}
+
+// ObjectType is the type of a database object which is introspected and
+// sampled as a table, e.g. a view.
+type ObjectType string
+
+const (
+	ObjectTypeTable            ObjectType = "table"
+	ObjectTypeView             ObjectType = "view"
+	ObjectTypeMaterializedView ObjectType = "materialized_view"
+	ObjectTypeExternalTable    ObjectType = "external_table"
+	ObjectTypeForeignTable     ObjectType = "foreign_table"
+	// ObjectTypePartition is a partition of a partitioned table. The data of
+	// partitions can also be sampled through their parent table.
+	ObjectTypePartition ObjectType = "partition"
+)
+
+// ParseObjectType parses the given object type name, returning an error if it
+// isn't one of the known object types.
+func ParseObjectType(s string) (ObjectType, error) {
+	switch t := ObjectType(s); t {
+	case ObjectTypeTable,
+		ObjectTypeView,
+		ObjectTypeMaterializedView,
+		ObjectTypeExternalTable,
+		ObjectTypeForeignTable,
+		ObjectTypePartition:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown object type %q", s)
+	}
+}
+
+// TableStats are the estimated statistics of a table, as maintained by the
+// database in its catalog. They are cheap to collect, but may be out of date,
+// e.g. if the table hasn't been analyzed recently.
+type TableStats struct {
+	// RowCount is the estimated number of rows in the table.
+	RowCount int64 `json:"rowCount"`
+	// SizeBytes is the estimated on-disk size of the table in bytes, or zero if
+	// it is unknown.
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+	// Exact is true if RowCount is maintained exactly by the database, rather
+	// than estimated when the table is analyzed (see
+	// IntrospectQueries.ExactStats).
+	Exact bool `json:"exact,omitempty"`
 }
 
 // AttributeNames returns a slice of attribute names for the table.
@@ -60,6 +136,8 @@ type AttributeMetadata struct {
 	Table    string `field:"table_name"`
 	Name     string `field:"column_name"`
 	DataType string `field:"data_type"`
+	// Comment is the comment describing the column, if any.
+	Comment string `field:"column_comment"`
 }
 
 // NewMetadata creates a new Metadata object with the given repository type,
@@ -72,21 +150,58 @@ func NewMetadata(database string) *Metadata {
 }
 
 // newMetadataFromQueryResult builds the repository metadata from the results
-// of a query to the INFORMATION_SCHEMA columns view.
+// of a query to the INFORMATION_SCHEMA columns view. The first four columns of
+// the rows are the schema, table, column name and data type of each column.
+// They may be followed by the optional object_type, column_comment and
+// table_comment columns, identified by name, any of which may be NULL. The
+// tables are filtered by the path and object type filters of the given
+// parameters.
 func newMetadataFromQueryResult(
 	db string,
-	includePaths, excludePaths []glob.Glob,
+	params IntrospectParameters,
 	rows *sql.Rows,
 ) (
 	*Metadata,
 	error,
 ) {
+	includePaths, excludePaths := params.IncludePaths, params.ExcludePaths
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata query result columns: %w", err)
+	}
+	if len(cols) < 4 {
+		return nil, fmt.Errorf("expected at least 4 metadata query result columns, got %d", len(cols))
+	}
+	var (
+		objectType, columnComment, tableComment sql.NullString
+		row                                     AttributeMetadata
+	)
+	dest := []any{&row.Schema, &row.Table, &row.Name, &row.DataType}
+	for _, col := range cols[4:] {
+		switch strings.ToLower(col) {
+		case "object_type":
+			dest = append(dest, &objectType)
+		case "column_comment":
+			dest = append(dest, &columnComment)
+		case "table_comment":
+			dest = append(dest, &tableComment)
+		default:
+			return nil, fmt.Errorf("unexpected metadata query result column %s", col)
+		}
+	}
 	repo := NewMetadata(db)
 	for rows.Next() {
-		var attr AttributeMetadata
-		if err := rows.Scan(&attr.Schema, &attr.Table, &attr.Name, &attr.DataType); err != nil {
+		objectType, columnComment, tableComment = sql.NullString{}, sql.NullString{}, sql.NullString{}
+		if err := rows.Scan(dest...); err != nil {
 			return nil, fmt.Errorf("error scanning metadata query result row: %w", err)
 		}
+		// The row is scanned into the same destinations every time, so it is
+		// copied into a new attribute.
+		attr := row
+		attr.Comment = columnComment.String
+		if !matchObjectType(ObjectType(objectType.String), params.IncludeObjectTypes, params.ExcludeObjectTypes) {
+			continue
+		}
 		// Skip tables that match excludePaths or does not match includePaths.
 		log.Tracef("checking if %s.%s.%s matches excludePaths %s\n", db, attr.Schema, attr.Table, excludePaths)
 		if matchPathPatterns(db, attr.Schema, attr.Table, excludePaths) {
@@ -103,11 +218,15 @@ func newMetadataFromQueryResult(
 				table.Attributes = append(table.Attributes, &attr)
 			} else { // First time seeing this table.
 				table := NewTableMetadata(attr.Schema, attr.Table)
+				table.ObjectType = ObjectType(objectType.String)
+				table.Comment = tableComment.String
 				table.Attributes = append(table.Attributes, &attr)
 				schema.Tables[attr.Table] = table
 			}
 		} else { // SchemaMetadata doesn't exist - create it.
 			table := NewTableMetadata(attr.Schema, attr.Table)
+			table.ObjectType = ObjectType(objectType.String)
+			table.Comment = tableComment.String
 			table.Attributes = append(table.Attributes, &attr)
 			schema := NewSchemaMetadata(attr.Schema)
 			schema.Tables[attr.Table] = table
@@ -121,6 +240,19 @@ func newMetadataFromQueryResult(
 	return repo, nil
 }
 
+// matchObjectType returns true if a table of the given object type passes the
+// include and exclude object type filters. An empty include list includes all
+// object types. Tables of unknown object type are never filtered out.
+func matchObjectType(objectType ObjectType, include, exclude []ObjectType) bool {
+	if objectType == "" {
+		return true
+	}
+	if slices.Contains(exclude, objectType) {
+		return false
+	}
+	return len(include) == 0 || slices.Contains(include, objectType)
+}
+
 // NewSchemaMetadata creates a new SchemaMetadata object with the given schema
 // name and an empty map of tables.
 func NewSchemaMetadata(schemaName string) *SchemaMetadata {
@@ -69,3 +69,61 @@ func TestQuotedAttributeNamesString(t *testing.T) {
 
 	require.Equal(t, expected, namesStr)
 }
+
+func TestParseObjectType(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    ObjectType
+		wantErr bool
+	}{
+		{name: "table", want: ObjectTypeTable},
+		{name: "materialized_view", want: ObjectTypeMaterializedView},
+		{name: "partition", want: ObjectTypePartition},
+		{name: "", wantErr: true},
+		{name: "VIEW", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseObjectType(tt.name)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchObjectType(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectType ObjectType
+		include    []ObjectType
+		exclude    []ObjectType
+		want       bool
+	}{
+		{name: "no filters", objectType: ObjectTypeView, want: true},
+		{name: "included", objectType: ObjectTypeView, include: []ObjectType{ObjectTypeView}, want: true},
+		{name: "not included", objectType: ObjectTypeTable, include: []ObjectType{ObjectTypeView}, want: false},
+		{name: "excluded", objectType: ObjectTypeView, exclude: []ObjectType{ObjectTypeView}, want: false},
+		{
+			name:       "included and excluded",
+			objectType: ObjectTypeView,
+			include:    []ObjectType{ObjectTypeView},
+			exclude:    []ObjectType{ObjectTypeView},
+			want:       false,
+		},
+		{
+			name:    "unknown",
+			include: []ObjectType{ObjectTypeTable},
+			exclude: []ObjectType{ObjectTypeView},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, matchObjectType(tt.objectType, tt.include, tt.exclude))
+		})
+	}
+}
@@ -2,10 +2,16 @@ package sql
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	// MySQL DB driver
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 const (
@@ -19,9 +25,86 @@ WHERE
     schema_name <> 'information_schema'
     AND schema_name <> 'performance_schema'
     AND schema_name <> 'sys'
+`
+	// mySqlIntrospectQuery extends the generic introspection query with the
+	// column and table comments. The table comment of views is always 'VIEW',
+	// so it is ignored.
+	mySqlIntrospectQuery = "SELECT " +
+		genericIntrospectColumns + ", " +
+		"c.column_comment AS column_comment, " +
+		"CASE WHEN t.table_type = 'VIEW' THEN NULL ELSE t.table_comment END AS table_comment" +
+		genericIntrospectFrom +
+		genericIntrospectWhere
+	// TABLE_ROWS is only an estimate for InnoDB tables.
+	mySqlStatsQuery = `
+SELECT
+    table_schema,
+    table_name,
+    table_rows,
+    data_length + index_length
+FROM
+    information_schema.tables
+WHERE
+    table_type = 'BASE TABLE'
+`
+	// mySqlLoadQuery reads the number of threads which are running a query.
+	mySqlLoadQuery = `
+SELECT
+    VARIABLE_VALUE
+FROM
+    performance_schema.global_status
+WHERE
+    VARIABLE_NAME = 'Threads_running'
+`
+	// UPDATE_TIME is NULL for tables whose storage engine doesn't track it,
+	// and for InnoDB tables which haven't been updated since the server
+	// started (prior to MySQL 8.0).
+	mySqlChangeIndicatorQuery = `
+SELECT
+    table_schema,
+    table_name,
+    CAST(update_time AS CHAR)
+FROM
+    information_schema.tables
+WHERE
+    table_schema NOT IN ('information_schema', 'mysql', 'performance_schema', 'sys')
+`
+	// MySQL has no REFERENTIAL_CONSTRAINTS.UNIQUE_CONSTRAINT_SCHEMA, instead
+	// KEY_COLUMN_USAGE includes the referenced columns of foreign keys.
+	mySqlKeysQuery = `
+SELECT
+    kcu.table_schema,
+    kcu.table_name,
+    kcu.constraint_name,
+    tc.constraint_type,
+    kcu.column_name,
+    kcu.referenced_table_schema,
+    kcu.referenced_table_name,
+    kcu.referenced_column_name
+FROM
+    information_schema.key_column_usage kcu
+    JOIN information_schema.table_constraints tc ON
+        tc.constraint_schema = kcu.constraint_schema AND
+        tc.constraint_name = kcu.constraint_name AND
+        tc.table_name = kcu.table_name
+WHERE
+    tc.constraint_type IN ('PRIMARY KEY', 'FOREIGN KEY')
+ORDER BY
+    kcu.table_schema,
+    kcu.table_name,
+    kcu.constraint_name,
+    kcu.ordinal_position
 `
 )
 
+// mySqlPathFilter pushes the path filters down into the introspection query.
+// LIKE is case-insensitive with the default collations, so only the include
+// paths are pushed down.
+var mySqlPathFilter = &PathFilterDialect{
+	PathExpr:    concatPathExpr,
+	Placeholder: questionPlaceholder,
+}
+
 // MySqlRepository is a Repository implementation for MySQL databases.
 type MySqlRepository struct {
 	// The majority of the Repository functionality is delegated to
@@ -29,24 +112,23 @@ type MySqlRepository struct {
 	generic *GenericRepository
 }
 
-// MySqlRepository implements Repository
-var _ Repository = (*MySqlRepository)(nil)
+// MySqlRepository implements Repository, ChangeTracker and LoadReporter
+var (
+	_ Repository    = (*MySqlRepository)(nil)
+	_ ChangeTracker = (*MySqlRepository)(nil)
+	_ LoadReporter  = (*MySqlRepository)(nil)
+)
 
 // NewMySqlRepository creates a new MySQL sql.
 func NewMySqlRepository(cfg RepoConfig) (*MySqlRepository, error) {
-	connStr := fmt.Sprintf(
-		"%s:%s@tcp(%s:%d)/%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		// This can be an empty string. See:
-		// https://github.com/go-sql-driver/mysql#dsn-data-source-name
-		cfg.Database,
-	)
-	generic, err := NewGenericRepository(RepoTypeMysql, cfg.Database, connStr, cfg.MaxOpenConns)
+	// RDS authentication tokens are sent in cleartext, which RDS only accepts
+	// over TLS.
+	if cfg.IAMAuth != nil && !cfg.TLS.enabled() {
+		return nil, errors.New("iam authentication requires tls for mysql")
+	}
+	generic, err := newMySqlGenericRepository(RepoTypeMysql, cfg, mySqlSessionStatements(cfg.QueryTimeout))
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
 	return &MySqlRepository{generic: generic}, nil
 }
@@ -58,11 +140,18 @@ func (r *MySqlRepository) ListDatabases(ctx context.Context) ([]string, error) {
 	return r.generic.ListDatabasesWithQuery(ctx, mySqlDatabaseQuery)
 }
 
-// Introspect delegates introspection to GenericRepository. See
-// Repository.Introspect and GenericRepository.IntrospectWithQuery for more
-// details.
+// Introspect delegates introspection to GenericRepository, using
+// MySQL-specific introspection, table statistics and key constraints queries
+// based on information_schema. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
 func (r *MySqlRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.Introspect(ctx, params)
+	queries := IntrospectQueries{
+		Introspect: mySqlIntrospectQuery,
+		Stats:      mySqlStatsQuery,
+		Keys:       mySqlKeysQuery,
+		PathFilter: mySqlPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
 }
 
 // SampleTable delegates sampling to GenericRepository, using a MySQL-specific
@@ -73,13 +162,32 @@ func (r *MySqlRepository) SampleTable(
 	params SampleParameters,
 ) (Sample, error) {
 	// MySQL uses backticks to quote identifiers.
-	attrStr := params.Metadata.QuotedAttributeNamesString("`")
+	attrStr := params.SelectList(r.generic.database, "`", mySqlTruncate)
 	// The generic select/limit/offset query and ? placeholders work fine with
 	// MySQL.
 	query := fmt.Sprintf(genericSampleQueryTemplate, attrStr, params.Metadata.Schema, params.Metadata.Name)
 	return r.generic.SampleTableWithQuery(ctx, query, params)
 }
 
+// mySqlTruncate truncates textual values with LEFT, which also accepts json.
+func mySqlTruncate(quotedColumn string, n uint) string {
+	return fmt.Sprintf("LEFT(%s, %d)", quotedColumn, n)
+}
+
+// Load returns the current load of the database, i.e. the number of threads
+// which are running a query. See LoadReporter and
+// GenericRepository.LoadWithQuery for more details.
+func (r *MySqlRepository) Load(ctx context.Context) (float64, error) {
+	return r.generic.LoadWithQuery(ctx, mySqlLoadQuery)
+}
+
+// ChangeIndicators returns the change indicators of the tables of the database,
+// derived from their last update time. See ChangeTracker and
+// GenericRepository.ChangeIndicatorsWithQuery for more details.
+func (r *MySqlRepository) ChangeIndicators(ctx context.Context) (map[string]map[string]string, error) {
+	return r.generic.ChangeIndicatorsWithQuery(ctx, mySqlChangeIndicatorQuery)
+}
+
 // Ping delegates the ping to GenericRepository. See Repository.Ping and
 // GenericRepository.Ping for more details.
 func (r *MySqlRepository) Ping(ctx context.Context) error {
@@ -91,3 +199,93 @@ func (r *MySqlRepository) Ping(ctx context.Context) error {
 func (r *MySqlRepository) Close() error {
 	return r.generic.Close()
 }
+
+// newMySqlGenericRepository instantiates the GenericRepository of the MySQL,
+// MariaDB and TiDB repositories, which connect with the MySQL driver, and
+// initialize their sessions with the given statements. The connections are
+// authenticated with AWS IAM if configured (see newIAMAuthRepository), and made
+// through the SSH tunnel if configured.
+func newMySqlGenericRepository(repoType string, cfg RepoConfig, statements []string) (*GenericRepository, error) {
+	return withSSHTunnel(
+		cfg,
+		func(tunnel *sshTunnel) (*GenericRepository, error) {
+			// The connections are made to the local port of the tunnel, if any.
+			connStr := func(cfg RepoConfig) (string, error) { return mySqlConnStr(tunnel.repoConfig(cfg)) }
+			if cfg.IAMAuth != nil {
+				return newIAMAuthRepository(repoType, cfg, &mysql.MySQLDriver{}, connStr, statements)
+			}
+			dsn, err := connStr(cfg)
+			if err != nil {
+				return nil, err
+			}
+			db := openSessionDB(dsnConnector{driver: &mysql.MySQLDriver{}, dsn: dsn}, statements, cfg.MaxOpenConns)
+			return NewGenericRepositoryFromDB(repoType, cfg.Database, db), nil
+		},
+	)
+}
+
+// mySqlConnStr returns the MySQL driver DSN of the given configuration. The
+// driver splits the user name from the password at the first colon of the DSN,
+// so user names containing a colon are rejected.
+func mySqlConnStr(cfg RepoConfig) (string, error) {
+	if strings.Contains(cfg.User, ":") {
+		return "", errors.New("mysql user name must not contain a colon")
+	}
+	tlsParam, err := mySqlTLSParam(cfg.Host, cfg.TLS)
+	if err != nil {
+		return "", fmt.Errorf("invalid tls config: %w", err)
+	}
+	mysqlCfg := mysql.NewConfig()
+	mysqlCfg.User = cfg.User
+	mysqlCfg.Passwd = cfg.Password
+	mysqlCfg.Net = "tcp"
+	mysqlCfg.Addr = net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
+	// This can be an empty string. See:
+	// https://github.com/go-sql-driver/mysql#dsn-data-source-name
+	mysqlCfg.DBName = cfg.Database
+	mysqlCfg.TLSConfig = tlsParam
+	// RDS authentication tokens are sent with the cleartext authentication
+	// plugin.
+	mysqlCfg.AllowCleartextPasswords = cfg.IAMAuth != nil
+	return mysqlCfg.FormatDSN(), nil
+}
+
+// mySqlTLSParam returns the value of the tls connection parameter of the MySQL
+// driver for the given configuration, or an empty string to use the driver
+// default. Since the driver only accepts custom TLS configurations by name, the
+// configuration is registered under a name derived from its settings, so that
+// the repositories with the same settings share it.
+func mySqlTLSParam(host string, c TLSConfig) (string, error) {
+	switch c.Mode {
+	case "":
+		return "", c.Validate()
+	case TLSModeDisable:
+		return "false", nil
+	}
+	tlsCfg, err := c.clientConfig(host)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("dmap-%x", sha256.Sum256([]byte(fmt.Sprintf("%s\x00%+v", host, c))))
+	if err := mysql.RegisterTLSConfig(name, tlsCfg); err != nil {
+		return "", fmt.Errorf("error registering tls config: %w", err)
+	}
+	return name, nil
+}
+
+// mySqlSessionStatements returns the statements initializing the sessions of
+// the MySQL repositories: the transactions of the sessions are read-only, and
+// the queries and lock waits time out on the server after the given query
+// timeout, if any. The lock wait timeouts only have a precision of seconds.
+func mySqlSessionStatements(queryTimeout time.Duration) []string {
+	statements := []string{"SET SESSION TRANSACTION READ ONLY"}
+	if queryTimeout > 0 {
+		statements = append(
+			statements,
+			fmt.Sprintf("SET SESSION max_execution_time = %d", timeoutMillis(queryTimeout)),
+			fmt.Sprintf("SET SESSION lock_wait_timeout = %d", timeoutSeconds(queryTimeout)),
+			fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", timeoutSeconds(queryTimeout)),
+		)
+	}
+	return statements
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -19,6 +20,26 @@ func TestMySqlRepository_ListDatabases(t *testing.T) {
 	require.ElementsMatch(t, []string{"db1", "db2"}, dbs)
 }
 
+func TestMySqlRepository_ChangeIndicators(t *testing.T) {
+	ctx, db, mock, r := initMySqlRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows([]string{"schema", "table", "indicator"}).
+		AddRow("schema1", "table1", "a").
+		AddRow("schema1", "table2", nil).
+		AddRow("schema2", "table1", "b")
+	mock.ExpectQuery(regexp.QuoteMeta(mySqlChangeIndicatorQuery)).WillReturnRows(rows)
+	indicators, err := r.ChangeIndicators(ctx)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		map[string]map[string]string{
+			"schema1": {"table1": "a"},
+			"schema2": {"table1": "b"},
+		},
+		indicators,
+	)
+}
+
 func initMySqlRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *MySqlRepository) {
 	ctx := context.Background()
 	db, mock, err := sqlmock.New()
@@ -27,3 +48,28 @@ func initMySqlRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock,
 		generic: NewGenericRepositoryFromDB(RepoTypeMysql, "dbName", db),
 	}
 }
+
+func TestMySqlTLSParam(t *testing.T) {
+	got, err := mySqlTLSParam("db.example.com", TLSConfig{})
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	got, err = mySqlTLSParam("db.example.com", TLSConfig{Mode: TLSModeDisable})
+	require.NoError(t, err)
+	require.Equal(t, "false", got)
+
+	cfg := TLSConfig{Mode: TLSModeVerifyFull, ServerName: "mysql.example.com"}
+	got, err = mySqlTLSParam("db.example.com", cfg)
+	require.NoError(t, err)
+	require.Regexp(t, "^dmap-[0-9a-f]{64}$", got)
+	// The configurations with the same settings share their name.
+	again, err := mySqlTLSParam("db.example.com", cfg)
+	require.NoError(t, err)
+	require.Equal(t, got, again)
+	other, err := mySqlTLSParam("db.example.com", TLSConfig{Mode: TLSModeRequire})
+	require.NoError(t, err)
+	require.NotEqual(t, got, other)
+
+	_, err = mySqlTLSParam("db.example.com", TLSConfig{Mode: TLSModeVerifyCA, CAFile: "missing.pem"})
+	require.Error(t, err)
+}
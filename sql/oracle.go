@@ -2,11 +2,16 @@ package sql
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
 	"errors"
 	"fmt"
 
+	log "github.com/sirupsen/logrus"
+
 	// Oracle DB driver
 	"github.com/sijms/go-ora/v2"
+	"github.com/sijms/go-ora/v2/network"
 )
 
 const (
@@ -22,56 +27,219 @@ WITH users AS (
     username <> 'RDSADMIN'
 )
 SELECT
-  owner AS table_schema,
-  table_name,
-  column_name,
-  data_type
+  c.owner AS table_schema,
+  c.table_name,
+  c.column_name,
+  c.data_type,
+  CASE
+    WHEN mv.mview_name IS NOT NULL THEN 'materialized_view'
+    WHEN v.view_name IS NOT NULL THEN 'view'
+    WHEN et.table_name IS NOT NULL THEN 'external_table'
+    ELSE 'table'
+  END AS object_type,
+  ccm.comments AS column_comment,
+  tcm.comments AS table_comment
 FROM
-  sys.all_tab_columns
+  sys.all_tab_columns c
 INNER JOIN
   users
 ON
-  owner = users.username
+  c.owner = users.username
+LEFT JOIN
+  sys.all_mviews mv
+ON
+  mv.owner = c.owner AND mv.mview_name = c.table_name
+LEFT JOIN
+  sys.all_views v
+ON
+  v.owner = c.owner AND v.view_name = c.table_name
+LEFT JOIN
+  sys.all_external_tables et
+ON
+  et.owner = c.owner AND et.table_name = c.table_name
+LEFT JOIN
+  sys.all_col_comments ccm
+ON
+  ccm.owner = c.owner AND ccm.table_name = c.table_name AND ccm.column_name = c.column_name
+LEFT JOIN
+  sys.all_tab_comments tcm
+ON
+  tcm.owner = c.owner AND tcm.table_name = c.table_name
+`
+	// NUM_ROWS and AVG_ROW_LEN are NULL if the table has never been analyzed.
+	oracleStatsQuery = `
+SELECT
+  owner,
+  table_name,
+  num_rows,
+  num_rows * avg_row_len
+FROM
+  sys.all_tables
+`
+	// Foreign key constraints ('R') reference a primary or unique constraint,
+	// whose columns are matched by position.
+	oracleKeysQuery = `
+SELECT
+  c.owner,
+  c.table_name,
+  c.constraint_name,
+  CASE c.constraint_type WHEN 'P' THEN 'PRIMARY KEY' ELSE 'FOREIGN KEY' END,
+  cc.column_name,
+  rcc.owner,
+  rcc.table_name,
+  rcc.column_name
+FROM
+  sys.all_constraints c
+INNER JOIN
+  sys.all_cons_columns cc
+ON
+  cc.owner = c.owner AND cc.constraint_name = c.constraint_name
+LEFT JOIN
+  sys.all_cons_columns rcc
+ON
+  rcc.owner = c.r_owner AND rcc.constraint_name = c.r_constraint_name AND rcc.position = cc.position
+WHERE
+  c.constraint_type IN ('P', 'R')
+ORDER BY
+  c.owner,
+  c.table_name,
+  c.constraint_name,
+  cc.position
+`
+	// oracleContainerQuery returns the name of the current container, which
+	// is CDB$ROOT for the root of a multitenant container database (CDB).
+	oracleContainerQuery = `SELECT SYS_CONTEXT('USERENV', 'CON_NAME') FROM dual`
+	// oraclePDBsQuery lists the open pluggable databases (PDBs) of a CDB,
+	// except for the seed, which is only a template.
+	oraclePDBsQuery = `
+SELECT
+  name
+FROM
+  v$pdbs
+WHERE
+  open_mode IN ('READ WRITE', 'READ ONLY') AND
+  name <> 'PDB$SEED'
+ORDER BY
+  name
 `
-	configServiceName = "service-name"
+	// oracleRootContainer is the name of the root container of a CDB.
+	oracleRootContainer = "CDB$ROOT"
+	// oracleInvalidUserenvParameter is the code of the error returned for
+	// unknown USERENV parameters (ORA-02003), e.g. CON_NAME before 12c.
+	oracleInvalidUserenvParameter = 2003
+	configServiceName             = "service-name"
+	configPDBServiceDomain        = "pdb-service-domain"
 )
 
+// oraclePathFilter pushes the path filters down into the introspection query.
+var oraclePathFilter = &PathFilterDialect{
+	PathExpr: pipesPathExpr,
+	Placeholder: func(n int) string {
+		return fmt.Sprintf(":%d", n)
+	},
+	CaseSensitive: true,
+}
+
 // OracleRepository is a Repository implementation for Oracle databases.
 type OracleRepository struct {
 	// The majority of the OracleRepository functionality is delegated to
 	// a generic SQL repository instance.
 	generic *GenericRepository
+	// serviceName is the configured service name of the repository (see
+	// OracleConfig.ServiceName).
+	serviceName string
 }
 
 // OracleRepository implements Repository
 var _ Repository = (*OracleRepository)(nil)
 
-// NewOracleRepository creates a new Oracle repository.
+// NewOracleRepository creates a new Oracle repository. If cfg.Database is set,
+// it is the name of a pluggable database (PDB), e.g. as listed by
+// ListDatabases, which is connected to through its default service (see
+// OracleConfig.PDBServiceName). Otherwise, the configured service is connected
+// to, which may be the root of a multitenant container database (CDB), a PDB,
+// or a non-CDB. Unlike the other repositories, its sessions are neither
+// read-only nor have server-side timeouts: Oracle only supports read-only
+// transactions (SET TRANSACTION READ ONLY), which would have to be started
+// explicitly and could fail long scans with "snapshot too old" errors, and
+// statements can only be limited with resource manager plans. The queries are
+// still cancelled on the server when the query timeout expires, and the
+// repository user should only have read privileges.
 func NewOracleRepository(cfg RepoConfig) (*OracleRepository, error) {
 	oracleCfg, err := NewOracleConfigFromMap(cfg.Advanced)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse oracle config: %w", err)
 	}
-	connStr := go_ora.BuildUrl(cfg.Host, int(cfg.Port), oracleCfg.ServiceName, cfg.User, cfg.Password, nil)
-	generic, err := NewGenericRepository(RepoTypeOracle, cfg.Database, connStr, cfg.MaxOpenConns)
+	generic, err := withSSHTunnel(
+		cfg,
+		func(tunnel *sshTunnel) (*GenericRepository, error) {
+			// The connections are made to the local port of the tunnel, if any.
+			connCfg := tunnel.repoConfig(cfg)
+			tlsCfg, err := connCfg.TLS.clientConfig(connCfg.Host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tls config: %w", err)
+			}
+			connStr := oracleConnStr(connCfg, oracleCfg.PDBServiceName(cfg.Database), tlsCfg)
+			if tlsCfg == nil {
+				generic, err := NewGenericRepository(RepoTypeOracle, cfg.Database, connStr, cfg.MaxOpenConns)
+				if err != nil {
+					return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+				}
+				return generic, nil
+			}
+			// The driver only accepts a custom TLS configuration through a
+			// connector.
+			connector := go_ora.NewConnector(connStr).(*go_ora.OracleConnector)
+			connector.WithTLSConfig(tlsCfg)
+			db := sql.OpenDB(connector)
+			db.SetMaxOpenConns(intFromUint(cfg.MaxOpenConns))
+			return NewGenericRepositoryFromDB(RepoTypeOracle, cfg.Database, db), nil
+		},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
-	return &OracleRepository{generic: generic}, nil
+	return &OracleRepository{generic: generic, serviceName: oracleCfg.ServiceName}, nil
 }
 
-// ListDatabases is left unimplemented for Oracle, because Oracle doesn't have
-// the traditional concept of "databases". Note that Introspect already
-// identifies all the accessible objects on the server.
-func (r *OracleRepository) ListDatabases(_ context.Context) ([]string, error) {
-	return nil, errors.New("ListDatabases is not implemented for Oracle repos")
+// ListDatabases returns the names of the open pluggable databases (PDBs) of
+// the container database (CDB), if the repository is connected to its root,
+// which can each be scanned through their own service. Otherwise, i.e. if the
+// repository is connected to a PDB or to a non-CDB, it only returns the
+// configured service name, since all the accessible objects of the database
+// are already identified by Introspect. Listing the PDBs requires the SELECT
+// privilege on V$PDBS, and scanning them requires a common user.
+func (r *OracleRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	var container string
+	if err := r.generic.GetDb().QueryRowContext(ctx, oracleContainerQuery).Scan(&container); err != nil {
+		// Versions before 12c don't support multitenant databases, and
+		// reject the CON_NAME parameter as an invalid USERENV parameter. Any
+		// other error is returned, since the PDBs of a CDB would otherwise be
+		// silently left out of the scan.
+		var oraErr *network.OracleError
+		if !errors.As(err, &oraErr) || oraErr.ErrCode != oracleInvalidUserenvParameter {
+			return nil, fmt.Errorf("error querying current container: %w", err)
+		}
+		log.WithError(err).Debug("CON_NAME is not supported, assuming a pre-12c non-CDB")
+	}
+	if container != oracleRootContainer {
+		return []string{r.serviceName}, nil
+	}
+	return r.generic.ListDatabasesWithQuery(ctx, oraclePDBsQuery)
 }
 
-// Introspect delegates introspection to GenericRepository, using an
-// Oracle-specific introspection query. See Repository.Introspect and
-// GenericRepository.IntrospectWithQuery for more details.
+// Introspect delegates introspection to GenericRepository, using
+// Oracle-specific introspection, table statistics and key constraints queries.
+// See Repository.Introspect and GenericRepository.IntrospectWithQueries for
+// more details.
 func (r *OracleRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.IntrospectWithQuery(ctx, oracleIntrospectQuery, params)
+	queries := IntrospectQueries{
+		Introspect: oracleIntrospectQuery,
+		Stats:      oracleStatsQuery,
+		Keys:       oracleKeysQuery,
+		PathFilter: oraclePathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
 }
 
 // SampleTable delegates sampling to GenericRepository, using an Oracle-specific
@@ -82,7 +250,7 @@ func (r *OracleRepository) SampleTable(
 	params SampleParameters,
 ) (Sample, error) {
 	// Oracle uses double-quotes to quote identifiers.
-	attrStr := params.Metadata.QuotedAttributeNamesString("\"")
+	attrStr := params.SelectList(r.generic.database, "\"", oracleTruncate)
 	// Oracle uses :x for placeholders.
 	query := fmt.Sprintf(
 		"SELECT %s FROM %s.%s OFFSET :1 ROWS FETCH NEXT :2 ROWS ONLY",
@@ -91,6 +259,12 @@ func (r *OracleRepository) SampleTable(
 	return r.generic.SampleTableWithQuery(ctx, query, params)
 }
 
+// oracleTruncate truncates textual values with SUBSTR, which also accepts
+// CLOBs.
+func oracleTruncate(quotedColumn string, n uint) string {
+	return fmt.Sprintf("SUBSTR(%s, 1, %d)", quotedColumn, n)
+}
+
 // Ping verifies the connection to Oracle database used by this Oracle
 // Normally we would just delegate to GenericRepository.Ping, however, that
 // implementation executes a 'SELECT 1' query to test for connectivity, and
@@ -110,6 +284,25 @@ func (r *OracleRepository) Close() error {
 type OracleConfig struct {
 	// ServiceName is the Oracle service name.
 	ServiceName string
+	// PDBServiceDomain is the domain of the default services of the pluggable
+	// databases (PDBs), i.e. the DB_DOMAIN parameter of the container
+	// database, if it is set.
+	PDBServiceDomain string
+}
+
+// PDBServiceName returns the name of the service to connect to the given
+// pluggable database (PDB) through, which is its default service: the PDB name,
+// qualified with the PDB service domain, if any. If the database is empty, or
+// is the configured service name itself (see OracleRepository.ListDatabases),
+// the configured service name is returned.
+func (c OracleConfig) PDBServiceName(database string) string {
+	if database == "" || database == c.ServiceName {
+		return c.ServiceName
+	}
+	if c.PDBServiceDomain == "" {
+		return database
+	}
+	return database + "." + c.PDBServiceDomain
 }
 
 // NewOracleConfigFromMap creates a new OracleConfig from the given map. This is
@@ -120,5 +313,27 @@ func NewOracleConfigFromMap(cfg map[string]any) (OracleConfig, error) {
 	if err != nil {
 		return OracleConfig{}, err
 	}
-	return OracleConfig{ServiceName: serviceName}, nil
+	pdbServiceDomain, err := optionalKeyAsString(cfg, configPDBServiceDomain)
+	if err != nil {
+		return OracleConfig{}, err
+	}
+	return OracleConfig{ServiceName: serviceName, PDBServiceDomain: pdbServiceDomain}, nil
+}
+
+// oracleConnStr returns the Oracle driver connection string of the given
+// configuration, connecting to the given service. It isn't built with
+// go_ora.BuildUrl, which doesn't escape colons in the user name.
+func oracleConnStr(cfg RepoConfig, serviceName string, tlsCfg *tls.Config) string {
+	return urlConnStr("oracle", cfg, serviceName, oracleTLSOptions(tlsCfg))
+}
+
+// oracleTLSOptions returns the connection options of the Oracle driver which
+// enable TLS, if the given TLS configuration isn't nil. The driver verification
+// is disabled, since the server certificate is verified by the configuration
+// itself (see TLSConfig.clientConfig).
+func oracleTLSOptions(tlsCfg *tls.Config) map[string]string {
+	if tlsCfg == nil {
+		return nil
+	}
+	return map[string]string{"SSL": "true", "SSL VERIFY": "false"}
 }
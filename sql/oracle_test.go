@@ -1,8 +1,15 @@
 package sql
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"regexp"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sijms/go-ora/v2/network"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,6 +29,17 @@ func TestNewOracleConfigFromMap(t *testing.T) {
 				ServiceName: "testServiceName",
 			},
 		},
+		{
+			name: "Returns config with PDBServiceDomain",
+			cfg: map[string]any{
+				configServiceName:      "testServiceName",
+				configPDBServiceDomain: "example.com",
+			},
+			want: OracleConfig{
+				ServiceName:      "testServiceName",
+				PDBServiceDomain: "example.com",
+			},
+		},
 		{
 			name:    "Returns error when ServiceName key is missing",
 			cfg:     map[string]any{},
@@ -42,3 +60,113 @@ func TestNewOracleConfigFromMap(t *testing.T) {
 		)
 	}
 }
+
+func TestNewOracleRepository_TLS(t *testing.T) {
+	caFile, _ := newTestCertificates(t, "db.example.com")
+	cfg := RepoConfig{
+		Host:     "db.example.com",
+		Port:     2484,
+		User:     "user",
+		Password: "password",
+		Advanced: map[string]any{configServiceName: "service"},
+		TLS:      TLSConfig{Mode: TLSModeVerifyFull, CAFile: caFile},
+	}
+	repo, err := NewOracleRepository(cfg)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	cfg.TLS.CAFile = "missing.pem"
+	_, err = NewOracleRepository(cfg)
+	require.Error(t, err)
+
+	require.Nil(t, oracleTLSOptions(nil))
+	require.Equal(t, map[string]string{"SSL": "true", "SSL VERIFY": "false"}, oracleTLSOptions(&tls.Config{}))
+}
+
+func TestOracleConfig_PDBServiceName(t *testing.T) {
+	cfg := OracleConfig{ServiceName: "ORCLCDB"}
+	require.Equal(t, "ORCLCDB", cfg.PDBServiceName(""))
+	require.Equal(t, "ORCLCDB", cfg.PDBServiceName("ORCLCDB"))
+	require.Equal(t, "SALES", cfg.PDBServiceName("SALES"))
+	cfg.PDBServiceDomain = "example.com"
+	require.Equal(t, "ORCLCDB", cfg.PDBServiceName("ORCLCDB"))
+	require.Equal(t, "SALES.example.com", cfg.PDBServiceName("SALES"))
+}
+
+func TestOracleRepository_ListDatabases(t *testing.T) {
+	ctx, db, mock, r := initOracleRepoTest(t)
+	defer func() { _ = db.Close() }()
+	mock.ExpectQuery(regexp.QuoteMeta(oracleContainerQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"con_name"}).AddRow(oracleRootContainer))
+	mock.ExpectQuery(regexp.QuoteMeta(oraclePDBsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("HR").AddRow("SALES"))
+	dbs, err := r.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"HR", "SALES"}, dbs)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOracleRepository_ListDatabases_NotRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "PDB",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(oracleContainerQuery)).
+					WillReturnRows(sqlmock.NewRows([]string{"con_name"}).AddRow("SALES"))
+			},
+		},
+		{
+			name: "Before 12c",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(oracleContainerQuery)).
+					WillReturnError(&network.OracleError{ErrCode: 2003})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				ctx, db, mock, r := initOracleRepoTest(t)
+				defer func() { _ = db.Close() }()
+				tt.expect(mock)
+				dbs, err := r.ListDatabases(ctx)
+				require.NoError(t, err)
+				require.Equal(t, []string{"service"}, dbs)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		)
+	}
+}
+
+func TestOracleRepository_ListDatabases_Error(t *testing.T) {
+	ctx, db, mock, r := initOracleRepoTest(t)
+	defer func() { _ = db.Close() }()
+	mock.ExpectQuery(regexp.QuoteMeta(oracleContainerQuery)).WillReturnError(errors.New("dummy error"))
+	_, err := r.ListDatabases(ctx)
+	require.Error(t, err)
+}
+
+func TestOracleRepository_ListDatabases_OracleError(t *testing.T) {
+	ctx, db, mock, r := initOracleRepoTest(t)
+	defer func() { _ = db.Close() }()
+	// ORA-03113: end-of-file on communication channel, e.g. a dropped
+	// session, doesn't mean that the database is a pre-12c non-CDB.
+	mock.ExpectQuery(regexp.QuoteMeta(oracleContainerQuery)).
+		WillReturnError(&network.OracleError{ErrCode: 3113})
+	_, err := r.ListDatabases(ctx)
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func initOracleRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *OracleRepository) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return ctx, db, mock, &OracleRepository{
+		generic:     NewGenericRepositoryFromDB(RepoTypeOracle, "", db),
+		serviceName: "service",
+	}
+}
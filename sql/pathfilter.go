@@ -0,0 +1,170 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// likeEscape is the escape character of the LIKE patterns built by
+// globToLike. It is not a backslash, since backslashes have a special meaning in
+// the string literals of some databases, e.g. MySQL.
+const likeEscape = '!'
+
+// PathGlob is a glob pattern which retains the pattern it was compiled from.
+// It can be used wherever a glob.Glob is expected, e.g. in the include and
+// exclude paths of IntrospectParameters, where it additionally allows the
+// repositories to push the pattern down into their introspection queries (see
+// PathFilterDialect).
+type PathGlob struct {
+	glob.Glob
+	// Pattern is the pattern the glob was compiled from.
+	Pattern string
+}
+
+// CompilePathGlob compiles the given glob pattern into a PathGlob.
+func CompilePathGlob(pattern string) (PathGlob, error) {
+	g, err := glob.Compile(pattern)
+	if err != nil {
+		return PathGlob{}, err
+	}
+	return PathGlob{Glob: g, Pattern: pattern}, nil
+}
+
+// PathFilterDialect describes how the include and exclude path filters of
+// IntrospectParameters are pushed down into the introspection query of a
+// repository, in its SQL dialect (see IntrospectQueries.PathFilter). The
+// pushed down filters only reduce the number of rows returned by the query;
+// the exact glob semantics are still applied to the returned rows.
+type PathFilterDialect struct {
+	// PathExpr returns the expression of the full path of a table, i.e.
+	// database.schema.table, given the placeholder of the database name
+	// parameter and the schema and table name columns.
+	PathExpr func(database, schema, table string) string
+	// Placeholder returns the placeholder of the n-th query parameter,
+	// starting at 1.
+	Placeholder func(n int) string
+	// CaseSensitive must be true if LIKE is case-sensitive in the repository,
+	// since the glob patterns are. Otherwise, only the include paths are pushed
+	// down, because excluding the tables matching a pattern case-insensitively
+	// would also exclude tables which don't match the glob pattern.
+	CaseSensitive bool
+}
+
+// apply returns the given introspection query, filtered by the include and
+// exclude paths of params which can be translated into LIKE predicates (see
+// globToLike), along with the parameters of the filtered query. The query is
+// returned as is if no filter can be pushed down.
+//
+// The include paths are only pushed down if all of them can be translated,
+// since the tables matching any of them must be returned. The exclude paths
+// which can't be translated are simply not pushed down.
+func (d *PathFilterDialect) apply(query, database string, params IntrospectParameters) (string, []any) {
+	args := []any{database}
+	pathExpr := d.PathExpr(d.Placeholder(1), "introspected.table_schema", "introspected.table_name")
+	like := func(pattern string) string {
+		args = append(args, pattern)
+		return fmt.Sprintf("%s LIKE %s ESCAPE '%c'", pathExpr, d.Placeholder(len(args)), likeEscape)
+	}
+	var predicates []string
+	if includes, ok := likePatterns(params.IncludePaths); ok && len(includes) > 0 {
+		var matchesAll bool
+		for _, pattern := range includes {
+			matchesAll = matchesAll || pattern == "%"
+		}
+		// Filtering on a pattern matching every table would be pointless.
+		if !matchesAll {
+			or := make([]string, 0, len(includes))
+			for _, pattern := range includes {
+				or = append(or, like(pattern))
+			}
+			predicates = append(predicates, "("+strings.Join(or, " OR ")+")")
+		}
+	}
+	if d.CaseSensitive {
+		for _, g := range params.ExcludePaths {
+			if pattern, ok := likePattern(g); ok {
+				predicates = append(predicates, "NOT ("+like(pattern)+")")
+			}
+		}
+	}
+	if len(predicates) == 0 {
+		return query, nil
+	}
+	query = "SELECT * FROM (" + query + ") introspected WHERE " + strings.Join(predicates, " AND ")
+	return query, args
+}
+
+// likePatterns translates all the given globs into LIKE patterns. It returns
+// false if any of them can't be translated (see likePattern).
+func likePatterns(globs []glob.Glob) ([]string, bool) {
+	patterns := make([]string, 0, len(globs))
+	for _, g := range globs {
+		pattern, ok := likePattern(g)
+		if !ok {
+			return nil, false
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, true
+}
+
+// likePattern translates the given glob into a LIKE pattern, if it is a
+// PathGlob whose pattern can be translated (see globToLike).
+func likePattern(g glob.Glob) (string, bool) {
+	pg, ok := g.(PathGlob)
+	if !ok {
+		return "", false
+	}
+	return globToLike(pg.Pattern)
+}
+
+// globToLike translates the given glob pattern into an equivalent LIKE
+// pattern, escaped with likeEscape. Only simple patterns, made of literal
+// characters and the * and ? wildcards, are translated. It returns false for
+// the patterns using character classes, alternatives or escapes, which have no
+// LIKE equivalent.
+func globToLike(pattern string) (string, bool) {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteRune('%')
+		case '?':
+			b.WriteRune('_')
+		case '[', ']', '{', '}', '\\':
+			return "", false
+		case '%', '_', likeEscape:
+			b.WriteRune(likeEscape)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), true
+}
+
+// dollarPlaceholder returns the $n placeholder of the n-th query parameter, as
+// used by Postgres and Redshift.
+func dollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// questionPlaceholder returns the ? placeholder of a query parameter, as used by
+// MySQL and Snowflake.
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+// concatPathExpr joins the database, schema and table expressions with the
+// CONCAT function.
+func concatPathExpr(database, schema, table string) string {
+	return fmt.Sprintf("CONCAT(%s, '.', %s, '.', %s)", database, schema, table)
+}
+
+// pipesPathExpr joins the database, schema and table expressions with the
+// standard || operator.
+func pipesPathExpr(database, schema, table string) string {
+	return fmt.Sprintf("%s || '.' || %s || '.' || %s", database, schema, table)
+}
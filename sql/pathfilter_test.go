@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobToLike(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{pattern: "*", want: "%", ok: true},
+		{pattern: "db.public.*", want: "db.public.%", ok: true},
+		{pattern: "db.?chema.users", want: "db._chema.users", ok: true},
+		{pattern: "db.my_schema.100%!", want: "db.my!_schema.100!%!!", ok: true},
+		{pattern: "db.public.user[s]", ok: false},
+		{pattern: "db.{public,private}.*", ok: false},
+		{pattern: `db.public.\*`, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, ok := globToLike(tt.pattern)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPathFilterDialect_apply(t *testing.T) {
+	dialect := &PathFilterDialect{
+		PathExpr:      pipesPathExpr,
+		Placeholder:   dollarPlaceholder,
+		CaseSensitive: true,
+	}
+	path := "$1 || '.' || introspected.table_schema || '.' || introspected.table_name"
+	tests := []struct {
+		name      string
+		dialect   *PathFilterDialect
+		params    IntrospectParameters
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "include everything",
+			dialect:   dialect,
+			params:    IntrospectParameters{IncludePaths: []glob.Glob{mustCompilePathGlob(t, "*")}},
+			wantQuery: "query",
+		},
+		{
+			name:    "include and exclude",
+			dialect: dialect,
+			params: IntrospectParameters{
+				IncludePaths: []glob.Glob{mustCompilePathGlob(t, "db.public.*"), mustCompilePathGlob(t, "db.sales.*")},
+				ExcludePaths: []glob.Glob{mustCompilePathGlob(t, "*.tmp_*"), mustCompilePathGlob(t, "*.[ab]")},
+			},
+			wantQuery: "SELECT * FROM (query) introspected WHERE (" +
+				path + " LIKE $2 ESCAPE '!' OR " + path + " LIKE $3 ESCAPE '!') AND " +
+				"NOT (" + path + " LIKE $4 ESCAPE '!')",
+			wantArgs: []any{"db", "db.public.%", "db.sales.%", "%.tmp!_%"},
+		},
+		{
+			name:    "untranslatable include",
+			dialect: dialect,
+			params: IntrospectParameters{
+				IncludePaths: []glob.Glob{mustCompilePathGlob(t, "db.public.*"), mustCompilePathGlob(t, "db.{a,b}.*")},
+			},
+			wantQuery: "query",
+		},
+		{
+			name:    "glob without pattern",
+			dialect: dialect,
+			params: IntrospectParameters{
+				IncludePaths: []glob.Glob{glob.MustCompile("db.public.*")},
+			},
+			wantQuery: "query",
+		},
+		{
+			name:    "case-insensitive LIKE",
+			dialect: &PathFilterDialect{PathExpr: concatPathExpr, Placeholder: questionPlaceholder},
+			params: IntrospectParameters{
+				IncludePaths: []glob.Glob{mustCompilePathGlob(t, "db.public.*")},
+				ExcludePaths: []glob.Glob{mustCompilePathGlob(t, "*.tmp")},
+			},
+			wantQuery: "SELECT * FROM (query) introspected WHERE (" +
+				"CONCAT(?, '.', introspected.table_schema, '.', introspected.table_name) LIKE ? ESCAPE '!')",
+			wantArgs: []any{"db", "db.public.%"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := tt.dialect.apply("query", "db", tt.params)
+			require.Equal(t, tt.wantQuery, query)
+			require.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestPostgresRepository_Introspect_PathFilter(t *testing.T) {
+	ctx, db, mock, r := initPostgresRepoTest(t)
+	defer func() { _ = db.Close() }()
+	cols := []string{"table_schema", "table_name", "column_name", "data_type"}
+	// The returned rows are still matched against the glob patterns.
+	rows := sqlmock.NewRows(cols).
+		AddRow("public", "users", "id", "integer").
+		AddRow("publicX", "users", "id", "integer")
+	mock.ExpectQuery("SELECT \\* FROM \\("+regexp.QuoteMeta(postgresIntrospectQuery)+"\\) introspected WHERE (.+)").
+		WithArgs("dbName", "dbName.public.%").
+		WillReturnRows(rows)
+	meta, err := r.Introspect(
+		ctx,
+		IntrospectParameters{IncludePaths: []glob.Glob{mustCompilePathGlob(t, "dbName.public.*")}},
+	)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Len(t, meta.Schemas, 1)
+	require.Contains(t, meta.Schemas["public"].Tables, "users")
+}
+
+func mustCompilePathGlob(t *testing.T, pattern string) PathGlob {
+	g, err := CompilePathGlob(pattern)
+	require.NoError(t, err)
+	return g
+}
@@ -2,7 +2,10 @@ package sql
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+
 	// Postgresql DB driver
 	_ "github.com/lib/pq"
 )
@@ -18,9 +21,117 @@ WHERE
 	datistemplate = false
 	AND datallowconn = true
 	AND datname <> 'rdsadmin'
+`
+	// postgresIntrospectQuery reads the system catalogs rather than the
+	// INFORMATION_SCHEMA columns view, which doesn't include materialized
+	// views. Only the tables which the user is allowed to select from are
+	// included, similarly to INFORMATION_SCHEMA.
+	postgresIntrospectQuery = `
+SELECT
+	n.nspname AS table_schema,
+	c.relname AS table_name,
+	a.attname AS column_name,
+	format_type(a.atttypid, NULL) AS data_type,
+	CASE
+		WHEN c.relispartition THEN 'partition'
+		WHEN c.relkind IN ('r', 'p') THEN 'table'
+		WHEN c.relkind = 'v' THEN 'view'
+		WHEN c.relkind = 'm' THEN 'materialized_view'
+		WHEN c.relkind = 'f' THEN 'foreign_table'
+	END AS object_type,
+	col_description(c.oid, a.attnum) AS column_comment,
+	obj_description(c.oid, 'pg_class') AS table_comment
+FROM
+	pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE
+	c.relkind IN ('r', 'p', 'v', 'm', 'f')
+	AND a.attnum > 0
+	AND NOT a.attisdropped
+	AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+	AND n.nspname NOT LIKE 'pg_toast%'
+	AND has_table_privilege(c.oid, 'SELECT')
+ORDER BY
+	a.attnum
+`
+	// reltuples is -1 if the table has never been analyzed, and isn't
+	// maintained for partitioned tables, so their row count is unknown.
+	postgresStatsQuery = `
+SELECT
+	n.nspname,
+	c.relname,
+	CASE WHEN c.relkind = 'p' OR c.reltuples < 0 THEN NULL ELSE c.reltuples::bigint END,
+	pg_total_relation_size(c.oid)
+FROM
+	pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE
+	c.relkind IN ('r', 'p', 'm')
+`
+	// postgresLoadQuery counts the other sessions which are running a query.
+	postgresLoadQuery = `
+SELECT
+	count(*)
+FROM
+	pg_stat_activity
+WHERE
+	state = 'active' AND pid <> pg_backend_pid()
+`
+	// The cumulative row counters only reset with the statistics, unlike
+	// n_mod_since_analyze which resets whenever the table is analyzed, so
+	// both are combined into the change indicator.
+	postgresChangeIndicatorQuery = `
+SELECT
+	schemaname,
+	relname,
+	concat_ws('/', n_tup_ins, n_tup_upd, n_tup_del, n_mod_since_analyze)
+FROM
+	pg_stat_user_tables
+`
+	// postgresKeysQuery reads the key constraints from pg_constraint, since
+	// constraint names are only unique per table in Postgres, which makes
+	// joining the INFORMATION_SCHEMA views by constraint name ambiguous.
+	postgresKeysQuery = `
+SELECT
+	n.nspname,
+	c.relname,
+	con.conname,
+	CASE con.contype WHEN 'p' THEN 'PRIMARY KEY' ELSE 'FOREIGN KEY' END,
+	a.attname,
+	rn.nspname,
+	rc.relname,
+	ra.attname
+FROM
+	pg_constraint con
+	JOIN pg_class c ON c.oid = con.conrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	CROSS JOIN LATERAL unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+	JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+	LEFT JOIN pg_class rc ON rc.oid = con.confrelid
+	LEFT JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+	LEFT JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = con.confkey[k.ord]
+WHERE
+	con.contype IN ('p', 'f')
+ORDER BY
+	n.nspname,
+	c.relname,
+	con.conname,
+	k.ord
 `
 )
 
+// postgresPathFilter pushes the path filters down into the introspection
+// query. The database name parameter must be cast, since its type can't be
+// inferred from the || operator.
+var postgresPathFilter = &PathFilterDialect{
+	PathExpr: func(database, schema, table string) string {
+		return pipesPathExpr("CAST("+database+" AS text)", schema, table)
+	},
+	Placeholder:   dollarPlaceholder,
+	CaseSensitive: true,
+}
+
 // PostgresRepository is a Repository implementation for Postgres databases.
 type PostgresRepository struct {
 	// The majority of the Repository functionality is delegated to
@@ -28,8 +139,12 @@ type PostgresRepository struct {
 	generic *GenericRepository
 }
 
-// PostgresRepository implements Repository
-var _ Repository = (*PostgresRepository)(nil)
+// PostgresRepository implements Repository, ChangeTracker and LoadReporter
+var (
+	_ Repository    = (*PostgresRepository)(nil)
+	_ ChangeTracker = (*PostgresRepository)(nil)
+	_ LoadReporter  = (*PostgresRepository)(nil)
+)
 
 // NewPostgresRepository creates a new PostgresRepository.
 func NewPostgresRepository(cfg RepoConfig) (*PostgresRepository, error) {
@@ -38,17 +153,14 @@ func NewPostgresRepository(cfg RepoConfig) (*PostgresRepository, error) {
 	if database == "" {
 		database = "postgres"
 	}
-	connStr := fmt.Sprintf(
-		"postgresql://%s:%s@%s:%d/%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
+	generic, err := newPostgresGenericRepository(
+		RepoTypePostgres,
+		cfg,
 		database,
+		postgresSessionStatements(cfg.QueryTimeout),
 	)
-	generic, err := NewGenericRepository(RepoTypePostgres, cfg.Database, connStr, cfg.MaxOpenConns)
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
 	return &PostgresRepository{generic: generic}, nil
 }
@@ -60,11 +172,18 @@ func (r *PostgresRepository) ListDatabases(ctx context.Context) ([]string, error
 	return r.generic.ListDatabasesWithQuery(ctx, postgresDatabaseQuery)
 }
 
-// Introspect delegates introspection to GenericRepository. See
-// Repository.Introspect and GenericRepository.IntrospectWithQuery for more
-// details.
+// Introspect delegates introspection to GenericRepository, using
+// Postgres-specific introspection, table statistics and key constraints queries
+// based on the system catalogs. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
 func (r *PostgresRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.Introspect(ctx, params)
+	queries := IntrospectQueries{
+		Introspect: postgresIntrospectQuery,
+		Stats:      postgresStatsQuery,
+		Keys:       postgresKeysQuery,
+		PathFilter: postgresPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
 }
 
 // SampleTable delegates sampling to GenericRepository, using a
@@ -75,7 +194,7 @@ func (r *PostgresRepository) SampleTable(
 	params SampleParameters,
 ) (Sample, error) {
 	// Postgres uses double-quotes to quote identifiers
-	attrStr := params.Metadata.QuotedAttributeNamesString("\"")
+	attrStr := params.SelectList(r.generic.database, "\"", postgresTruncate)
 	// Postgres uses $x for placeholders
 	query := fmt.Sprintf(
 		"SELECT %s FROM %s.%s LIMIT $1 OFFSET $2",
@@ -86,6 +205,27 @@ func (r *PostgresRepository) SampleTable(
 	return r.generic.SampleTableWithQuery(ctx, query, params)
 }
 
+// postgresTruncate truncates textual values, which are cast to text first since
+// LEFT doesn't accept types such as json.
+func postgresTruncate(quotedColumn string, n uint) string {
+	return fmt.Sprintf("LEFT(CAST(%s AS text), %d)", quotedColumn, n)
+}
+
+// Load returns the current load of the database, i.e. the number of other
+// sessions which are running a query. See LoadReporter and
+// GenericRepository.LoadWithQuery for more details.
+func (r *PostgresRepository) Load(ctx context.Context) (float64, error) {
+	return r.generic.LoadWithQuery(ctx, postgresLoadQuery)
+}
+
+// ChangeIndicators returns the change indicators of the tables of the database,
+// derived from the row modification counters of pg_stat_user_tables. See
+// ChangeTracker and GenericRepository.ChangeIndicatorsWithQuery for more
+// details.
+func (r *PostgresRepository) ChangeIndicators(ctx context.Context) (map[string]map[string]string, error) {
+	return r.generic.ChangeIndicatorsWithQuery(ctx, postgresChangeIndicatorQuery)
+}
+
 // Ping delegates the ping to GenericRepository. See Repository.Ping and
 // GenericRepository.Ping for more details.
 func (r *PostgresRepository) Ping(ctx context.Context) error {
@@ -97,3 +237,86 @@ func (r *PostgresRepository) Ping(ctx context.Context) error {
 func (r *PostgresRepository) Close() error {
 	return r.generic.Close()
 }
+
+// newPostgresGenericRepository instantiates the GenericRepository of the
+// Postgres, Redshift, CockroachDB and Denodo repositories, which connect to the
+// given database with lib/pq, and initialize their sessions with the given
+// statements. The connections are authenticated with AWS IAM if configured (see
+// newIAMAuthRepository), and made through the SSH tunnel if configured. The
+// tunnel dials the connections of lib/pq rather than forwarding a local port,
+// since lib/pq verifies the server certificate against the host of the
+// connection string.
+func newPostgresGenericRepository(
+	repoType string,
+	cfg RepoConfig,
+	database string,
+	statements []string,
+) (*GenericRepository, error) {
+	connStr := func(cfg RepoConfig) (string, error) { return postgresConnStr(cfg, database) }
+	return withSSHTunnel(
+		cfg,
+		func(tunnel *sshTunnel) (*GenericRepository, error) {
+			if cfg.IAMAuth != nil {
+				return newIAMAuthRepository(repoType, cfg, tunnel.pqDriver(), connStr, statements)
+			}
+			dsn, err := connStr(cfg)
+			if err != nil {
+				return nil, err
+			}
+			db := openSessionDB(dsnConnector{driver: tunnel.pqDriver(), dsn: dsn}, statements, cfg.MaxOpenConns)
+			return NewGenericRepositoryFromDB(repoType, cfg.Database, db), nil
+		},
+	)
+}
+
+// postgresSessionStatements returns the statements initializing the sessions
+// of the Postgres repositories: the transactions of the sessions are read-only,
+// and the statements and lock waits time out on the server after the given
+// query timeout, if any.
+func postgresSessionStatements(queryTimeout time.Duration) []string {
+	statements := []string{"SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY"}
+	if queryTimeout > 0 {
+		statements = append(
+			statements,
+			fmt.Sprintf("SET statement_timeout = %d", timeoutMillis(queryTimeout)),
+			fmt.Sprintf("SET lock_timeout = %d", timeoutMillis(queryTimeout)),
+		)
+	}
+	return statements
+}
+
+// postgresConnStr returns the lib/pq connection string of the given
+// configuration, connecting to the given database. It is shared by the
+// Postgres, Redshift, CockroachDB and Denodo repositories.
+func postgresConnStr(cfg RepoConfig, database string) (string, error) {
+	tlsParams, err := postgresTLSParams(cfg.TLS)
+	if err != nil {
+		return "", fmt.Errorf("invalid tls config: %w", err)
+	}
+	return urlConnStr("postgresql", cfg, database, tlsParams), nil
+}
+
+// postgresTLSParams returns the lib/pq connection parameters of the given
+// configuration, which are shared by the Postgres, Redshift, CockroachDB and
+// Denodo repositories. The lib/pq driver always verifies the server certificate
+// against the host it connects to, so a server name isn't supported.
+func postgresTLSParams(c TLSConfig) (map[string]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.Mode == "" {
+		return nil, nil
+	}
+	if c.ServerName != "" {
+		return nil, errors.New("tls server name is not supported by the postgres driver")
+	}
+	params := map[string]string{"sslmode": string(c.Mode)}
+	if c.CAFile != "" {
+		params["sslrootcert"] = c.CAFile
+	}
+	if c.CertFile != "" {
+		params["sslcert"] = c.CertFile
+		params["sslkey"] = c.KeyFile
+	}
+	return params, nil
+}
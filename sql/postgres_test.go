@@ -3,9 +3,11 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,6 +21,59 @@ func TestPostgresRepository_ListDatabases(t *testing.T) {
 	require.ElementsMatch(t, []string{"db1", "db2"}, dbs)
 }
 
+func TestPostgresRepository_ChangeIndicators(t *testing.T) {
+	ctx, db, mock, r := initPostgresRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows([]string{"schema", "table", "indicator"}).
+		AddRow("schema1", "table1", "a").
+		AddRow("schema1", "table2", nil).
+		AddRow("schema2", "table1", "b")
+	mock.ExpectQuery(regexp.QuoteMeta(postgresChangeIndicatorQuery)).WillReturnRows(rows)
+	indicators, err := r.ChangeIndicators(ctx)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		map[string]map[string]string{
+			"schema1": {"table1": "a"},
+			"schema2": {"table1": "b"},
+		},
+		indicators,
+	)
+}
+
+func TestPostgresRepository_Load(t *testing.T) {
+	ctx, db, mock, r := initPostgresRepoTest(t)
+	defer func() { _ = db.Close() }()
+	mock.ExpectQuery(regexp.QuoteMeta(postgresLoadQuery)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	load, err := r.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 7.0, load)
+}
+
+func TestPostgresRepository_Introspect_ObjectTypes(t *testing.T) {
+	ctx, db, mock, r := initPostgresRepoTest(t)
+	defer func() { _ = db.Close() }()
+	cols := []string{"table_schema", "table_name", "column_name", "data_type", "object_type"}
+	rows := sqlmock.NewRows(cols).
+		AddRow("schema1", "table1", "column1", "integer", "table").
+		AddRow("schema1", "view1", "column1", "integer", "view").
+		AddRow("schema1", "mview1", "column1", "integer", "materialized_view").
+		AddRow("schema1", "table1_p1", "column1", "integer", "partition")
+	mock.ExpectQuery(regexp.QuoteMeta(postgresIntrospectQuery)).WillReturnRows(rows)
+	meta, err := r.Introspect(
+		ctx,
+		IntrospectParameters{
+			IncludePaths:       []glob.Glob{glob.MustCompile("*")},
+			ExcludeObjectTypes: []ObjectType{ObjectTypeView, ObjectTypePartition},
+		},
+	)
+	require.NoError(t, err)
+	tables := meta.Schemas["schema1"].Tables
+	require.Len(t, tables, 2)
+	require.Equal(t, ObjectTypeTable, tables["table1"].ObjectType)
+	require.Equal(t, ObjectTypeMaterializedView, tables["mview1"].ObjectType)
+}
+
 func initPostgresRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *PostgresRepository) {
 	ctx := context.Background()
 	db, mock, err := sqlmock.New()
@@ -27,3 +82,67 @@ func initPostgresRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmo
 		generic: NewGenericRepositoryFromDB(RepoTypePostgres, "dbName", db),
 	}
 }
+
+func TestPostgresTLSParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		want    map[string]string
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name:    "driver default",
+			cfg:     TLSConfig{},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "disable",
+			cfg:     TLSConfig{Mode: TLSModeDisable},
+			want:    map[string]string{"sslmode": "disable"},
+			wantErr: require.NoError,
+		},
+		{
+			name: "verify-full with client certificate",
+			cfg: TLSConfig{
+				Mode:     TLSModeVerifyFull,
+				CAFile:   "/etc/ca.pem",
+				CertFile: "/etc/client.pem",
+				KeyFile:  "/etc/client.key",
+			},
+			want: map[string]string{
+				"sslmode":     "verify-full",
+				"sslrootcert": "/etc/ca.pem",
+				"sslcert":     "/etc/client.pem",
+				"sslkey":      "/etc/client.key",
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "server name",
+			cfg:     TLSConfig{Mode: TLSModeVerifyFull, ServerName: "db.example.com"},
+			wantErr: require.Error,
+		},
+		{
+			name:    "unknown mode",
+			cfg:     TLSConfig{Mode: "prefer"},
+			wantErr: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := postgresTLSParams(tt.cfg)
+			tt.wantErr(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewPostgresGenericRepository_RepoType(t *testing.T) {
+	cfg := RepoConfig{Host: "localhost", Port: 5432, User: "dmap", Password: "secret"}
+	for _, repoType := range []string{RepoTypePostgres, RepoTypeRedshift, RepoTypeCockroachDB, RepoTypeDenodo} {
+		generic, err := newPostgresGenericRepository(repoType, cfg, "db", nil)
+		require.NoError(t, err)
+		require.Equal(t, repoType, generic.repoType)
+		require.NoError(t, generic.Close())
+	}
+}
@@ -0,0 +1,219 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultTargetLatency is the default query latency above which the
+	// adaptive rate limiter lowers the query rate.
+	defaultTargetLatency = time.Second
+	// defaultLoadInterval is the default interval at which the adaptive rate
+	// limiter polls the load of the database.
+	defaultLoadInterval = 10 * time.Second
+	// rateAdjustInterval is the minimum interval between two adjustments of the
+	// query rate, so that a burst of slow queries, which were all issued before
+	// the rate was lowered, only lowers it once.
+	rateAdjustInterval = time.Second
+	// minRateFraction is the fraction of the configured query rate below which
+	// the adaptive rate limiter never lowers it, so that a scan always makes
+	// progress.
+	minRateFraction = 0.05
+	// rateIncreaseFraction is the fraction of the configured query rate by
+	// which the adaptive rate limiter raises the rate once the queries are fast
+	// again.
+	rateIncreaseFraction = 0.1
+)
+
+// RateLimitConfig is the configuration of the query rate limit of a scan. The
+// limit is shared by all the queries of a Scanner, across all the databases it
+// scans. Each repository call, e.g. introspecting a database or sampling a
+// table, counts as a single query.
+type RateLimitConfig struct {
+	// QueriesPerSecond is the maximum rate of the queries. If zero, the queries
+	// are not rate limited.
+	QueriesPerSecond float64
+	// Burst is the maximum number of queries which can be issued at once, after
+	// the scanner has been idle. If zero, the queries are never issued in
+	// bursts.
+	Burst uint
+	// Adaptive lowers the query rate when the queries get slower than
+	// TargetLatency, or when the database reports a load higher than MaxLoad,
+	// and raises it back up to QueriesPerSecond once the queries are fast
+	// again.
+	Adaptive bool
+	// TargetLatency is the query latency above which the adaptive rate limiter
+	// lowers the query rate. If zero, one second is used.
+	TargetLatency time.Duration
+	// MaxLoad is the database load (see LoadReporter) above which the adaptive
+	// rate limiter lowers the query rate. If zero, the load of the database is
+	// not polled. It is ignored for repositories which can't report their load.
+	MaxLoad float64
+	// LoadInterval is the interval at which the load of the database is
+	// polled. If zero, ten seconds is used.
+	LoadInterval time.Duration
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *RateLimitConfig) Validate() error {
+	if c.QueriesPerSecond < 0 || math.IsInf(c.QueriesPerSecond, 0) || math.IsNaN(c.QueriesPerSecond) {
+		return errors.New("queries per second must be a positive number")
+	}
+	if c.QueriesPerSecond == 0 && (c.Adaptive || c.Burst > 0) {
+		return errors.New("queries per second is required for rate limiting")
+	}
+	if c.TargetLatency < 0 || c.LoadInterval < 0 {
+		return errors.New("rate limit durations must not be negative")
+	}
+	if c.MaxLoad < 0 {
+		return errors.New("max load must not be negative")
+	}
+	if !c.Adaptive && (c.TargetLatency > 0 || c.MaxLoad > 0 || c.LoadInterval > 0) {
+		return errors.New("target latency and max load require adaptive rate limiting")
+	}
+	return nil
+}
+
+// queryLimiter limits the rate of the queries of a scan, and optionally adapts
+// the rate to the latency of the queries and to the load of the database (see
+// RateLimitConfig). It is safe for concurrent use.
+//
+// The methods of a nil *queryLimiter are no-ops, so that the scanner doesn't
+// have to distinguish whether its queries are rate limited.
+type queryLimiter struct {
+	cfg     RateLimitConfig
+	limiter *rate.Limiter
+	now     func() time.Time
+
+	mu         sync.Mutex
+	lastAdjust time.Time
+}
+
+// newQueryLimiter returns a limiter of the given configuration, or nil if the
+// configuration is nil or doesn't limit the query rate.
+func newQueryLimiter(cfg *RateLimitConfig) *queryLimiter {
+	if cfg == nil || cfg.QueriesPerSecond == 0 {
+		return nil
+	}
+	c := *cfg
+	if c.Burst == 0 {
+		c.Burst = 1
+	}
+	if c.TargetLatency == 0 {
+		c.TargetLatency = defaultTargetLatency
+	}
+	if c.LoadInterval == 0 {
+		c.LoadInterval = defaultLoadInterval
+	}
+	return &queryLimiter{
+		cfg:     c,
+		limiter: rate.NewLimiter(rate.Limit(c.QueriesPerSecond), intFromUint(c.Burst)),
+		now:     time.Now,
+	}
+}
+
+// wait blocks until the next query can be issued, or until ctx is done, in
+// which case it returns the context error.
+func (l *queryLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	if err := l.limiter.Wait(ctx); err != nil {
+		// The wait only fails if the context is done, or would be done before
+		// the query could be issued.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// observe adapts the query rate to the latency of a query which returned the
+// given error. Queries which timed out are considered slow, whereas queries
+// which failed for other reasons are ignored.
+func (l *queryLimiter) observe(latency time.Duration, err error) {
+	if l == nil || !l.cfg.Adaptive {
+		return
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), err == nil && latency > l.cfg.TargetLatency:
+		l.adjust(false, "query latency is too high")
+	case err == nil:
+		l.adjust(true, "")
+	}
+}
+
+// observeLoad adapts the query rate to the given load of the database.
+func (l *queryLimiter) observeLoad(load float64) {
+	if l == nil || !l.cfg.Adaptive || l.cfg.MaxLoad == 0 {
+		return
+	}
+	if load > l.cfg.MaxLoad {
+		l.adjust(false, "database load is too high")
+	}
+}
+
+// adjust raises the query rate additively, or lowers it multiplicatively,
+// within the bounds of the configured rate. The rate is adjusted at most once
+// per rateAdjustInterval.
+func (l *queryLimiter) adjust(increase bool, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastAdjust) < rateAdjustInterval {
+		return
+	}
+	current := float64(l.limiter.Limit())
+	var limit float64
+	if increase {
+		limit = math.Min(current+l.cfg.QueriesPerSecond*rateIncreaseFraction, l.cfg.QueriesPerSecond)
+	} else {
+		limit = math.Max(current/2, l.cfg.QueriesPerSecond*minRateFraction)
+	}
+	if limit == current {
+		return
+	}
+	l.lastAdjust = now
+	l.limiter.SetLimitAt(now, rate.Limit(limit))
+	if !increase {
+		log.Infof("%s, lowering the query rate to %.2f queries per second", reason, limit)
+	} else {
+		log.Debugf("raising the query rate to %.2f queries per second", limit)
+	}
+}
+
+// pollLoad polls the load of the database with the given reporter, and adapts
+// the query rate to it, until ctx is done. The queries of the reporter aren't
+// rate limited.
+func (l *queryLimiter) pollLoad(ctx context.Context, reporter LoadReporter) {
+	if l == nil || !l.cfg.Adaptive || l.cfg.MaxLoad == 0 {
+		return
+	}
+	ticker := time.NewTicker(l.cfg.LoadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		loadCtx, cancel := context.WithTimeout(ctx, l.cfg.LoadInterval)
+		load, err := reporter.Load(loadCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Warn("error getting database load")
+			}
+			continue
+		}
+		l.observeLoad(load)
+	}
+}
@@ -0,0 +1,163 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RateLimitConfig
+		wantErr bool
+	}{
+		{
+			name: "no limit",
+		},
+		{
+			name: "fixed",
+			cfg:  RateLimitConfig{QueriesPerSecond: 10, Burst: 5},
+		},
+		{
+			name: "adaptive",
+			cfg:  RateLimitConfig{QueriesPerSecond: 10, Adaptive: true, TargetLatency: time.Second, MaxLoad: 20},
+		},
+		{
+			name:    "negative rate",
+			cfg:     RateLimitConfig{QueriesPerSecond: -1},
+			wantErr: true,
+		},
+		{
+			name:    "burst without rate",
+			cfg:     RateLimitConfig{Burst: 5},
+			wantErr: true,
+		},
+		{
+			name:    "adaptive without rate",
+			cfg:     RateLimitConfig{Adaptive: true},
+			wantErr: true,
+		},
+		{
+			name:    "max load without adaptive",
+			cfg:     RateLimitConfig{QueriesPerSecond: 10, MaxLoad: 20},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := tt.cfg.Validate()
+				if tt.wantErr {
+					require.Error(t, err)
+				} else {
+					require.NoError(t, err)
+				}
+			},
+		)
+	}
+}
+
+func TestNewQueryLimiter(t *testing.T) {
+	require.Nil(t, newQueryLimiter(nil))
+	require.Nil(t, newQueryLimiter(&RateLimitConfig{}))
+	l := newQueryLimiter(&RateLimitConfig{QueriesPerSecond: 10})
+	require.Equal(t, rate.Limit(10), l.limiter.Limit())
+	require.Equal(t, 1, l.limiter.Burst())
+}
+
+func TestQueryLimiter_wait(t *testing.T) {
+	var nilLimiter *queryLimiter
+	require.NoError(t, nilLimiter.wait(context.Background()))
+
+	l := newQueryLimiter(&RateLimitConfig{QueriesPerSecond: 0.001})
+	require.NoError(t, l.wait(context.Background()))
+	// The next query can only be issued after 1000 seconds.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.ErrorIs(t, l.wait(ctx), context.DeadlineExceeded)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, l.wait(ctx), context.Canceled)
+}
+
+func TestQueryLimiter_observe(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := newQueryLimiter(&RateLimitConfig{QueriesPerSecond: 100, Adaptive: true, TargetLatency: time.Second})
+	l.now = func() time.Time { return now }
+
+	// A slow query halves the rate.
+	l.observe(2*time.Second, nil)
+	require.Equal(t, rate.Limit(50), l.limiter.Limit())
+	// The rate is adjusted at most once per interval.
+	l.observe(2*time.Second, nil)
+	require.Equal(t, rate.Limit(50), l.limiter.Limit())
+	// A timed out query is slow.
+	now = now.Add(rateAdjustInterval)
+	l.observe(0, context.DeadlineExceeded)
+	require.Equal(t, rate.Limit(25), l.limiter.Limit())
+	// Other errors are ignored.
+	now = now.Add(rateAdjustInterval)
+	l.observe(0, errors.New("dummy error"))
+	require.Equal(t, rate.Limit(25), l.limiter.Limit())
+	// A fast query raises the rate additively.
+	l.observe(time.Millisecond, nil)
+	require.Equal(t, rate.Limit(35), l.limiter.Limit())
+	// The rate is never lowered below its minimum, nor raised above the
+	// configured rate.
+	for range 10 {
+		now = now.Add(rateAdjustInterval)
+		l.observe(2*time.Second, nil)
+	}
+	require.Equal(t, rate.Limit(5), l.limiter.Limit())
+	for range 20 {
+		now = now.Add(rateAdjustInterval)
+		l.observe(time.Millisecond, nil)
+	}
+	require.Equal(t, rate.Limit(100), l.limiter.Limit())
+}
+
+func TestQueryLimiter_observe_NotAdaptive(t *testing.T) {
+	l := newQueryLimiter(&RateLimitConfig{QueriesPerSecond: 100})
+	l.observe(time.Hour, nil)
+	l.observeLoad(1000)
+	require.Equal(t, rate.Limit(100), l.limiter.Limit())
+}
+
+func TestQueryLimiter_pollLoad(t *testing.T) {
+	l := newQueryLimiter(
+		&RateLimitConfig{QueriesPerSecond: 100, Adaptive: true, MaxLoad: 10, LoadInterval: time.Millisecond},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reporter := &fakeLoadReporter{load: 20, polled: make(chan struct{})}
+	go l.pollLoad(ctx, reporter)
+	<-reporter.polled
+	require.Eventually(
+		t,
+		func() bool { return l.limiter.Limit() < 100 },
+		time.Second,
+		time.Millisecond,
+	)
+}
+
+// fakeLoadReporter is a LoadReporter which reports a constant load, and closes
+// the polled channel once it is first polled.
+type fakeLoadReporter struct {
+	load   float64
+	polled chan struct{}
+	closed bool
+}
+
+func (r *fakeLoadReporter) Load(_ context.Context) (float64, error) {
+	if !r.closed {
+		r.closed = true
+		close(r.polled)
+	}
+	return r.load, nil
+}
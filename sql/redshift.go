@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"fmt"
+	"time"
 
 	// Use PostgreSQL DB driver for Redshift
 	_ "github.com/lib/pq"
@@ -10,8 +11,42 @@ import (
 
 const (
 	RepoTypeRedshift = "redshift"
+	// redshiftIntrospectQuery extends the generic introspection query with the
+	// columns of the external (Spectrum) tables, which are not included in
+	// INFORMATION_SCHEMA.
+	redshiftIntrospectQuery = genericIntrospectQuery + `
+UNION ALL
+SELECT
+	schemaname,
+	tablename,
+	columnname,
+	external_type,
+	'external_table'
+FROM
+	svv_external_columns
+`
+	// The size in svv_table_info is the number of 1 MB blocks.
+	redshiftStatsQuery = `
+SELECT
+	"schema",
+	"table",
+	tbl_rows::bigint,
+	size::bigint * 1024 * 1024
+FROM
+	svv_table_info
+`
 )
 
+// redshiftPathFilter pushes the path filters down into the introspection
+// query, including the external tables.
+var redshiftPathFilter = &PathFilterDialect{
+	PathExpr: func(database, schema, table string) string {
+		return pipesPathExpr("CAST("+database+" AS varchar)", schema, table)
+	},
+	Placeholder:   dollarPlaceholder,
+	CaseSensitive: true,
+}
+
 // RedshiftRepository is a Repository implementation for Redshift databases.
 type RedshiftRepository struct {
 	// The majority of the RedshiftRepository functionality is delegated to
@@ -29,17 +64,14 @@ func NewRedshiftRepository(cfg RepoConfig) (*RedshiftRepository, error) {
 	if database == "" {
 		database = "dev"
 	}
-	connStr := fmt.Sprintf(
-		"postgresql://%s:%s@%s:%d/%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
+	generic, err := newPostgresGenericRepository(
+		RepoTypeRedshift,
+		cfg,
 		database,
+		redshiftSessionStatements(cfg.QueryTimeout),
 	)
-	generic, err := NewGenericRepository(RepoTypePostgres, cfg.Database, connStr, cfg.MaxOpenConns)
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
 	return &RedshiftRepository{generic: generic}, nil
 }
@@ -52,11 +84,20 @@ func (r *RedshiftRepository) ListDatabases(ctx context.Context) ([]string, error
 	return r.generic.ListDatabasesWithQuery(ctx, postgresDatabaseQuery)
 }
 
-// Introspect delegates introspection to GenericRepository. See
-// Repository.Introspect and GenericRepository.IntrospectWithQuery for more
-// details.
+// Introspect delegates introspection to GenericRepository, using
+// Redshift-specific introspection and table statistics queries, which include
+// external tables, and the generic key constraints query. Note that Redshift
+// doesn't enforce key constraints, so they are only as accurate as their
+// declarations. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
 func (r *RedshiftRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.Introspect(ctx, params)
+	queries := IntrospectQueries{
+		Introspect: redshiftIntrospectQuery,
+		Stats:      redshiftStatsQuery,
+		Keys:       genericKeysQuery,
+		PathFilter: redshiftPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
 }
 
 // SampleTable delegates sampling to GenericRepository, using a
@@ -67,12 +108,17 @@ func (r *RedshiftRepository) SampleTable(
 	params SampleParameters,
 ) (Sample, error) {
 	// Redshift uses double-quotes to quote identifiers
-	attrStr := params.Metadata.QuotedAttributeNamesString("\"")
+	attrStr := params.SelectList(r.generic.database, "\"", redshiftTruncate)
 	// Redshift uses $x for placeholders
 	query := fmt.Sprintf("SELECT %s FROM %s.%s LIMIT $1 OFFSET $2", attrStr, params.Metadata.Schema, params.Metadata.Name)
 	return r.generic.SampleTableWithQuery(ctx, query, params)
 }
 
+// redshiftTruncate truncates textual values with LEFT.
+func redshiftTruncate(quotedColumn string, n uint) string {
+	return fmt.Sprintf("LEFT(%s, %d)", quotedColumn, n)
+}
+
 // Ping delegates the ping to GenericRepository. See Repository.Ping and
 // GenericRepository.Ping for more details.
 func (r *RedshiftRepository) Ping(ctx context.Context) error {
@@ -84,3 +130,14 @@ func (r *RedshiftRepository) Ping(ctx context.Context) error {
 func (r *RedshiftRepository) Close() error {
 	return r.generic.Close()
 }
+
+// redshiftSessionStatements returns the statements initializing the sessions
+// of the Redshift repositories: the statements time out on the server after the
+// given query timeout, if any. Redshift supports neither read-only sessions nor
+// lock timeouts, so the sessions are only initialized if there is a timeout.
+func redshiftSessionStatements(queryTimeout time.Duration) []string {
+	if queryTimeout <= 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("SET statement_timeout = %d", timeoutMillis(queryTimeout))}
+}
@@ -109,12 +109,30 @@ func NewRepository(ctx context.Context, repoType string, cfg RepoConfig) (Reposi
 // init registers all out-of-the-box repository types and their respective
 // constructors with the DefaultRegistry.
 func init() {
+	MustRegister(
+		RepoTypeClickHouse,
+		func(_ context.Context, cfg RepoConfig) (Repository, error) {
+			return NewClickHouseRepository(cfg)
+		},
+	)
+	MustRegister(
+		RepoTypeCockroachDB,
+		func(_ context.Context, cfg RepoConfig) (Repository, error) {
+			return NewCockroachDbRepository(cfg)
+		},
+	)
 	MustRegister(
 		RepoTypeDenodo,
 		func(_ context.Context, cfg RepoConfig) (Repository, error) {
 			return NewDenodoRepository(cfg)
 		},
 	)
+	MustRegister(
+		RepoTypeMariaDB,
+		func(_ context.Context, cfg RepoConfig) (Repository, error) {
+			return NewMariaDbRepository(cfg)
+		},
+	)
 	MustRegister(
 		RepoTypeMysql,
 		func(_ context.Context, cfg RepoConfig) (Repository, error) {
@@ -151,4 +169,16 @@ func init() {
 			return NewSqlServerRepository(cfg)
 		},
 	)
+	MustRegister(
+		RepoTypeTiDB,
+		func(_ context.Context, cfg RepoConfig) (Repository, error) {
+			return NewTiDbRepository(cfg)
+		},
+	)
+	MustRegister(
+		RepoTypeTrino,
+		func(_ context.Context, cfg RepoConfig) (Repository, error) {
+			return NewTrinoRepository(cfg)
+		},
+	)
 }
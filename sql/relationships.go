@@ -0,0 +1,236 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/cyralinc/dmap/classification"
+	"github.com/cyralinc/dmap/scan"
+)
+
+// GraphFormat is the format of a relationship graph written by
+// WriteRelationshipGraph.
+type GraphFormat string
+
+const (
+	// GraphFormatJSON is a JSON document with the tables and relationships of
+	// the graph.
+	GraphFormatJSON GraphFormat = "json"
+	// GraphFormatDOT is a Graphviz DOT digraph.
+	GraphFormatDOT GraphFormat = "dot"
+)
+
+// relationshipGraph is the graph of the foreign key relationships of a
+// repository. Its nodes are the tables which are part of a relationship, and
+// its edges are the relationships.
+type relationshipGraph struct {
+	Tables        []graphTable        `json:"tables"`
+	Relationships []scan.Relationship `json:"relationships"`
+}
+
+// graphTable is a node of a relationshipGraph.
+type graphTable struct {
+	// Path is the full path of the table.
+	Path []string `json:"path"`
+	// Labels are the labels of the classified columns of the table.
+	Labels classification.LabelSet `json:"labels,omitempty"`
+}
+
+// tableRelationships returns the foreign key relationships of the tables of the
+// given database metadata.
+func tableRelationships(db string, meta *Metadata) []scan.Relationship {
+	var relationships []scan.Relationship
+	for _, schemaMeta := range meta.Schemas {
+		for _, tableMeta := range schemaMeta.Tables {
+			for _, fk := range tableMeta.ForeignKeys {
+				relationships = append(
+					relationships,
+					scan.Relationship{
+						Name:                fk.Name,
+						TablePath:           []string{db, tableMeta.Schema, tableMeta.Name},
+						Columns:             fk.Columns,
+						ReferencedTablePath: []string{db, fk.ReferencedSchema, fk.ReferencedTable},
+						ReferencedColumns:   fk.ReferencedColumns,
+					},
+				)
+			}
+		}
+	}
+	return relationships
+}
+
+// linkRelationships propagates the labels of the classified columns of each
+// referenced table to the relationships which reference it, by setting their
+// linked labels. It returns the referencing columns of the relationships which
+// reference a table containing sensitive data. Only direct references are
+// linked, i.e. the labels are not propagated transitively.
+func linkRelationships(
+	relationships []scan.Relationship,
+	classifications []classification.Classification,
+) []scan.LinkedColumn {
+	tableLabels := labelsByTable(classifications)
+	var linked []scan.LinkedColumn
+	for i := range relationships {
+		rel := &relationships[i]
+		labels, ok := tableLabels[pathKey(rel.ReferencedTablePath)]
+		if !ok {
+			continue
+		}
+		rel.LinkedLabels = labels
+		for _, column := range rel.Columns {
+			linked = append(
+				linked,
+				scan.LinkedColumn{
+					AttributePath:       append(slices.Clone(rel.TablePath), column),
+					ReferencedTablePath: rel.ReferencedTablePath,
+					LinkedLabels:        maps.Clone(labels),
+				},
+			)
+		}
+	}
+	return linked
+}
+
+// labelsByTable returns the union of the labels of the classified columns of
+// each table, keyed by the table path key (see pathKey).
+func labelsByTable(classifications []classification.Classification) map[string]classification.LabelSet {
+	tableLabels := make(map[string]classification.LabelSet)
+	for _, c := range classifications {
+		if len(c.AttributePath) == 0 || len(c.Labels) == 0 {
+			continue
+		}
+		key := pathKey(c.AttributePath[:len(c.AttributePath)-1])
+		if tableLabels[key] == nil {
+			tableLabels[key] = make(classification.LabelSet)
+		}
+		maps.Copy(tableLabels[key], c.Labels)
+	}
+	return tableLabels
+}
+
+// WriteRelationshipGraph writes the graph of the foreign key relationships of
+// the given scan results to w, in the given format. The nodes of the graph are
+// the tables which are part of a relationship, along with the labels of their
+// classified columns, and its edges are the relationships, from the
+// referencing table to the referenced table. The relationships which are
+// linked to sensitive data are highlighted in the DOT format.
+func WriteRelationshipGraph(w io.Writer, results *scan.RepoScanResults, format GraphFormat) error {
+	graph := newRelationshipGraph(results)
+	switch format {
+	case GraphFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(graph); err != nil {
+			return fmt.Errorf("error encoding relationship graph: %w", err)
+		}
+		return nil
+	case GraphFormatDOT:
+		return writeDOT(w, graph)
+	default:
+		return fmt.Errorf("unsupported relationship graph format %q", format)
+	}
+}
+
+// newRelationshipGraph builds the relationship graph of the given scan results.
+// The tables and relationships are sorted by path, so that the graph is
+// deterministic.
+func newRelationshipGraph(results *scan.RepoScanResults) relationshipGraph {
+	tableLabels := labelsByTable(results.Classifications)
+	tables := make(map[string]graphTable)
+	addTable := func(path []string) {
+		key := pathKey(path)
+		if _, ok := tables[key]; !ok {
+			tables[key] = graphTable{Path: path, Labels: tableLabels[key]}
+		}
+	}
+	relationships := slices.Clone(results.Relationships)
+	for _, rel := range relationships {
+		addTable(rel.TablePath)
+		addTable(rel.ReferencedTablePath)
+	}
+	slices.SortFunc(
+		relationships,
+		func(a, b scan.Relationship) int {
+			if c := strings.Compare(pathKey(a.TablePath), pathKey(b.TablePath)); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Name, b.Name)
+		},
+	)
+	graph := relationshipGraph{Tables: make([]graphTable, 0, len(tables)), Relationships: relationships}
+	for _, table := range tables {
+		graph.Tables = append(graph.Tables, table)
+	}
+	slices.SortFunc(
+		graph.Tables,
+		func(a, b graphTable) int { return strings.Compare(pathKey(a.Path), pathKey(b.Path)) },
+	)
+	if graph.Relationships == nil {
+		graph.Relationships = []scan.Relationship{}
+	}
+	return graph
+}
+
+// writeDOT writes the relationship graph as a Graphviz DOT digraph.
+func writeDOT(w io.Writer, graph relationshipGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph relationships {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, table := range graph.Tables {
+		name := strings.Join(table.Path, ".")
+		label := name
+		attrs := ""
+		if len(table.Labels) > 0 {
+			label += "\n" + strings.Join(sortedLabels(table.Labels), ", ")
+			attrs = ", color=red"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s%s];\n", dotQuote(name), dotQuote(label), attrs)
+	}
+	for _, rel := range graph.Relationships {
+		label := fmt.Sprintf(
+			"%s\n(%s) -> (%s)",
+			rel.Name,
+			strings.Join(rel.Columns, ", "),
+			strings.Join(rel.ReferencedColumns, ", "),
+		)
+		attrs := ""
+		if len(rel.LinkedLabels) > 0 {
+			label += "\nlinked to: " + strings.Join(sortedLabels(rel.LinkedLabels), ", ")
+			attrs = ", color=red"
+		}
+		fmt.Fprintf(
+			&b,
+			"\t%s -> %s [label=%s%s];\n",
+			dotQuote(strings.Join(rel.TablePath, ".")),
+			dotQuote(strings.Join(rel.ReferencedTablePath, ".")),
+			dotQuote(label),
+			attrs,
+		)
+	}
+	b.WriteString("}\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("error writing relationship graph: %w", err)
+	}
+	return nil
+}
+
+// dotQuote quotes s as a DOT string. Newlines are escaped as DOT line breaks.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// sortedLabels returns the names of the labels in the set, sorted.
+func sortedLabels(labels classification.LabelSet) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,124 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cyralinc/dmap/classification"
+	"github.com/cyralinc/dmap/scan"
+)
+
+func TestLinkRelationships(t *testing.T) {
+	relationships := []scan.Relationship{
+		{
+			Name:                "orders_user_fkey",
+			TablePath:           []string{"db", "public", "orders"},
+			Columns:             []string{"tenant_id", "user_id"},
+			ReferencedTablePath: []string{"db", "public", "users"},
+			ReferencedColumns:   []string{"tenant_id", "id"},
+		},
+		{
+			Name:                "orders_product_fkey",
+			TablePath:           []string{"db", "public", "orders"},
+			Columns:             []string{"product_id"},
+			ReferencedTablePath: []string{"db", "public", "products"},
+			ReferencedColumns:   []string{"id"},
+		},
+	}
+	classifications := []classification.Classification{
+		{AttributePath: []string{"db", "public", "users", "ssn"}, Labels: lblSet("SSN")},
+		{AttributePath: []string{"db", "public", "users", "email"}, Labels: lblSet("EMAIL")},
+		{AttributePath: []string{"db", "public", "orders", "address"}, Labels: lblSet("ADDRESS")},
+	}
+	linked := linkRelationships(relationships, classifications)
+	require.Equal(t, lblSet("SSN", "EMAIL"), relationships[0].LinkedLabels)
+	require.Empty(t, relationships[1].LinkedLabels)
+	require.Equal(
+		t,
+		[]scan.LinkedColumn{
+			{
+				AttributePath:       []string{"db", "public", "orders", "tenant_id"},
+				ReferencedTablePath: []string{"db", "public", "users"},
+				LinkedLabels:        lblSet("SSN", "EMAIL"),
+			},
+			{
+				AttributePath:       []string{"db", "public", "orders", "user_id"},
+				ReferencedTablePath: []string{"db", "public", "users"},
+				LinkedLabels:        lblSet("SSN", "EMAIL"),
+			},
+		},
+		linked,
+	)
+}
+
+func TestWriteRelationshipGraph(t *testing.T) {
+	results := &scan.RepoScanResults{
+		Classifications: []classification.Classification{
+			{AttributePath: []string{"db", "public", "users", "ssn"}, Labels: lblSet("SSN")},
+		},
+		Relationships: []scan.Relationship{
+			{
+				Name:                "orders_product_fkey",
+				TablePath:           []string{"db", "public", "orders"},
+				Columns:             []string{"product_id"},
+				ReferencedTablePath: []string{"db", "public", "products"},
+				ReferencedColumns:   []string{"id"},
+			},
+			{
+				Name:                "orders_user_fkey",
+				TablePath:           []string{"db", "public", "orders"},
+				Columns:             []string{"user_id"},
+				ReferencedTablePath: []string{"db", "public", "users"},
+				ReferencedColumns:   []string{"id"},
+				LinkedLabels:        lblSet("SSN"),
+			},
+		},
+	}
+
+	t.Run("dot", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := WriteRelationshipGraph(&buf, results, GraphFormatDOT)
+		require.NoError(t, err)
+		want := `digraph relationships {
+	rankdir=LR;
+	node [shape=box];
+	"db.public.orders" [label="db.public.orders"];
+	"db.public.products" [label="db.public.products"];
+	"db.public.users" [label="db.public.users\nSSN", color=red];
+	"db.public.orders" -> "db.public.products" [label="orders_product_fkey\n(product_id) -> (id)"];
+	"db.public.orders" -> "db.public.users" [label="orders_user_fkey\n(user_id) -> (id)\nlinked to: SSN", color=red];
+}
+`
+		require.Equal(t, want, buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := WriteRelationshipGraph(&buf, results, GraphFormatJSON)
+		require.NoError(t, err)
+		var graph struct {
+			Tables []struct {
+				Path   []string `json:"path"`
+				Labels []string `json:"labels"`
+			} `json:"tables"`
+			Relationships []scan.Relationship `json:"relationships"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &graph))
+		require.Len(t, graph.Tables, 3)
+		require.Equal(t, []string{"db", "public", "users"}, graph.Tables[2].Path)
+		require.Equal(t, []string{"SSN"}, graph.Tables[2].Labels)
+		require.Equal(t, results.Relationships, graph.Relationships)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		err := WriteRelationshipGraph(&bytes.Buffer{}, results, "svg")
+		require.Error(t, err)
+	})
+}
+
+func TestDotQuote(t *testing.T) {
+	require.Equal(t, `"a \"b\" \\ c\nd"`, dotQuote("a \"b\" \\ c\nd"))
+}
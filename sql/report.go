@@ -0,0 +1,175 @@
+package sql
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/cyralinc/dmap/scan"
+)
+
+// scanReport collects the failures and coverage counters of a single scan. It
+// is safe for concurrent use by the sampling goroutines.
+type scanReport struct {
+	mu       sync.Mutex
+	failures []scan.Failure
+	retries  []scan.Retry
+	coverage scan.Coverage
+	// resumed is the set of table path keys (see pathKey) which were already
+	// scanned before the scan was resumed.
+	resumed map[string]struct{}
+	// previous are the records of the previous scan of an incremental scan,
+	// keyed by table path key.
+	previous map[string]checkpointRecord
+	// relationships are the foreign key relationships of the introspected
+	// databases.
+	relationships []scan.Relationship
+	// onFailure is optionally called with each failure as it is added.
+	onFailure func(scan.Failure)
+}
+
+func newScanReport() *scanReport {
+	return &scanReport{resumed: make(map[string]struct{})}
+}
+
+// addFailure records a failure for the object at the given path.
+func (r *scanReport) addFailure(path []string, phase scan.Phase, err error) {
+	failure := scan.Failure{
+		Path:     slices.Clone(path),
+		Phase:    phase,
+		Category: categorizeError(err),
+		Message:  err.Error(),
+	}
+	if failure.Path == nil {
+		failure.Path = []string{}
+	}
+	r.mu.Lock()
+	r.failures = append(r.failures, failure)
+	r.mu.Unlock()
+	if r.onFailure != nil {
+		r.onFailure(failure)
+	}
+}
+
+// addRetry records an operation on the object at the given path which was
+// retried, with its number of attempts, whether the last one succeeded, and the
+// error of the last failed attempt.
+func (r *scanReport) addRetry(path []string, phase scan.Phase, attempts uint, succeeded bool, lastErr error) {
+	retry := scan.Retry{
+		Path:      slices.Clone(path),
+		Phase:     phase,
+		Attempts:  attempts,
+		Succeeded: succeeded,
+		Message:   lastErr.Error(),
+	}
+	if retry.Path == nil {
+		retry.Path = []string{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries = append(r.retries, retry)
+}
+
+// addDiscovered records the number of tables found by introspecting a
+// database.
+func (r *scanReport) addDiscovered(meta *Metadata) {
+	var n uint
+	for _, schema := range meta.Schemas {
+		n += uint(len(schema.Tables))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.coverage.TablesDiscovered += n
+}
+
+// addSampled records a successfully sampled table, which may be empty.
+func (r *scanReport) addSampled(sample Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(sample.Results) == 0 {
+		r.coverage.TablesEmpty++
+	} else {
+		r.coverage.TablesSampled++
+	}
+}
+
+// addSampleFailure records a table which could not be sampled.
+func (r *scanReport) addSampleFailure(path []string, err error) {
+	r.addFailure(path, scan.PhaseSample, err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.coverage.TablesFailed++
+}
+
+// addResumed records a table which was already scanned before the scan was
+// resumed, and which should therefore be skipped.
+func (r *scanReport) addResumed(path []string) {
+	key := pathKey(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.resumed[key]; ok {
+		return
+	}
+	r.resumed[key] = struct{}{}
+	r.coverage.TablesResumed++
+}
+
+// isResumed returns true if the table with the given path was already scanned
+// before the scan was resumed.
+func (r *scanReport) isResumed(path []string) bool {
+	key := pathKey(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.resumed[key]
+	return ok
+}
+
+// setPrevious sets the records of the previous scan of an incremental scan.
+func (r *scanReport) setPrevious(records []checkpointRecord) {
+	previous := make(map[string]checkpointRecord, len(records))
+	for _, record := range records {
+		previous[pathKey(record.TablePath)] = record
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.previous = previous
+}
+
+// previousRecord returns the record of the table with the given path in the
+// previous scan of an incremental scan, if any.
+func (r *scanReport) previousRecord(path []string) (checkpointRecord, bool) {
+	key := pathKey(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.previous[key]
+	return record, ok
+}
+
+// addUnchanged records a table which is unchanged since the previous scan of
+// an incremental scan, and which therefore isn't sampled.
+func (r *scanReport) addUnchanged() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.coverage.TablesUnchanged++
+}
+
+// addRelationships records the foreign key relationships of an introspected
+// database.
+func (r *scanReport) addRelationships(relationships []scan.Relationship) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.relationships = append(r.relationships, relationships...)
+}
+
+// results returns the failures and coverage counters collected so far.
+func (r *scanReport) results() ([]scan.Failure, scan.Coverage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.failures), r.coverage
+}
+
+// retried returns the retried operations recorded so far.
+func (r *scanReport) retried() []scan.Retry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.retries)
+}
@@ -33,6 +33,30 @@ type Repository interface {
 	Close() error
 }
 
+// ChangeTracker is an optional interface which may be implemented by a
+// Repository that can cheaply tell whether the data of its tables has changed,
+// e.g. from table statistics or modification times maintained by the database.
+// It is used by incremental scans to detect the tables which are unchanged
+// since a previous scan (see ScannerConfig.IncrementalFrom).
+type ChangeTracker interface {
+	// ChangeIndicators returns an opaque change indicator for the tables of the
+	// repository's database, keyed by schema name and then by table name. The
+	// indicator of a table changes whenever its data (may have) changed. Tables
+	// without an indicator are only compared by their metadata.
+	ChangeIndicators(ctx context.Context) (map[string]map[string]string, error)
+}
+
+// LoadReporter is an optional interface which may be implemented by a
+// Repository that can report the current load of its database. It is used by
+// the adaptive rate limiting of scans to back off when the database is busy
+// (see RateLimitConfig.MaxLoad).
+type LoadReporter interface {
+	// Load returns the current load of the database, as the number of queries
+	// which are running or waiting to run on the database, e.g. the active
+	// connections of Postgres or the queued queries of Snowflake.
+	Load(ctx context.Context) (float64, error)
+}
+
 // IntrospectParameters is a struct that holds the parameters for the Introspect
 // method of the Repository interface.
 type IntrospectParameters struct {
@@ -46,6 +70,21 @@ type IntrospectParameters struct {
 	// the patterns in this list, it will be excluded from the repository
 	// metadata.
 	ExcludePaths []glob.Glob
+	// IncludeObjectTypes is a list of the object types of the tables that
+	// will be introspected. If empty, all object types are included.
+	IncludeObjectTypes []ObjectType
+	// ExcludeObjectTypes is a list of the object types of the tables that will
+	// be excluded from the repository metadata. Tables whose object type is
+	// unknown are never excluded.
+	ExcludeObjectTypes []ObjectType
+	// CollectStats requests the estimated statistics of each table (see
+	// TableStats) to be collected from the database catalog. Repositories
+	// which don't support it ignore it.
+	CollectStats bool
+	// CollectKeys requests the primary and foreign keys of each table to be
+	// collected (see TableMetadata.PrimaryKey and TableMetadata.ForeignKeys).
+	// Repositories which don't support it ignore it.
+	CollectKeys bool
 }
 
 // Sample represents a sample of data from a database table.
@@ -68,6 +107,22 @@ type SampleParameters struct {
 	SampleSize uint
 	// Offset is the number of rows to skip before starting the sample.
 	Offset uint
+	// IncludeColumns is a list of glob patterns matched against the full path
+	// of each column (e.g. db.schema.table.column). If it is not empty, only
+	// the columns which match any of the patterns are sampled.
+	IncludeColumns []glob.Glob
+	// ExcludeColumns is a list of glob patterns matched against the full path
+	// of each column. The columns which match any of the patterns are not
+	// sampled.
+	ExcludeColumns []glob.Glob
+	// ExcludeDataTypes is a list of data types (e.g. bytea) of the columns
+	// which are not sampled. They are compared case-insensitively with the
+	// data types of the table metadata.
+	ExcludeDataTypes []string
+	// MaxValueLength is the maximum length of the sampled values of textual
+	// columns. Longer values are truncated, in the sample query where
+	// supported. If zero, the values are not truncated.
+	MaxValueLength uint
 }
 
 // SampleResult stores the results from a single database sample. It is
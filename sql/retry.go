@@ -0,0 +1,118 @@
+package sql
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultInitialBackoff is the default backoff before the first retry.
+	defaultInitialBackoff = 500 * time.Millisecond
+	// defaultMaxBackoff is the default maximum backoff between two retries.
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// RetryConfig is the configuration of the retries of the repository calls of a
+// scan, i.e. connecting to the repository, listing its databases,
+// introspecting them and sampling their tables, when they fail with a
+// transient error. The backoff between two attempts grows exponentially, and is
+// randomized ("full jitter"), so that the retries of concurrent calls are
+// spread out.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts of each call, including the
+	// first one. If zero or one, the calls are not retried.
+	MaxAttempts uint
+	// InitialBackoff is the maximum backoff before the first retry, which is
+	// doubled for each subsequent retry. If zero, 500 milliseconds is used.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum backoff between two attempts. If zero, 30
+	// seconds is used.
+	MaxBackoff time.Duration
+	// IsRetryable returns true if a call which failed with the given error
+	// should be retried. If nil, the errors which are transient for the drivers
+	// of the out-of-the-box repositories are retried, e.g. dropped
+	// connections, deadlocks or servers which are out of connections.
+	IsRetryable func(err error) bool
+}
+
+// retryPolicy retries the calls which fail with a retryable error, according
+// to a RetryConfig.
+//
+// The methods of a nil *retryPolicy call the function once, so that the
+// scanner doesn't have to distinguish whether its calls are retried.
+type retryPolicy struct {
+	cfg RetryConfig
+	// sleep waits for the given duration, or until ctx is done. It is
+	// overridden by tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newRetryPolicy returns a retry policy of the given configuration, or nil if
+// the configuration is nil or doesn't retry the calls.
+func newRetryPolicy(cfg *RetryConfig) *retryPolicy {
+	if cfg == nil || cfg.MaxAttempts <= 1 {
+		return nil
+	}
+	c := *cfg
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultInitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.IsRetryable == nil {
+		c.IsRetryable = isTransientError
+	}
+	return &retryPolicy{cfg: c, sleep: sleepContext}
+}
+
+// do calls fn until it succeeds, fails with an error which isn't retryable, or
+// the maximum number of attempts is reached. It returns the number of attempts
+// and the error of the last one. The backoff between two attempts is
+// interrupted if ctx is done, in which case the last error is returned.
+func (p *retryPolicy) do(ctx context.Context, fn func(ctx context.Context) error) (uint, error) {
+	if p == nil {
+		return 1, fn(ctx)
+	}
+	var attempt uint
+	for {
+		attempt++
+		err := fn(ctx)
+		if err == nil || attempt >= p.cfg.MaxAttempts || !p.cfg.IsRetryable(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+		backoff := p.backoff(attempt)
+		log.WithError(err).Debugf("retrying after %s (attempt %d of %d)", backoff, attempt+1, p.cfg.MaxAttempts)
+		if p.sleep(ctx, backoff) != nil {
+			return attempt, err
+		}
+	}
+}
+
+// backoff returns a random backoff before the retry following the given
+// attempt, between zero and the exponentially growing maximum backoff of the
+// attempt.
+func (p *retryPolicy) backoff(attempt uint) time.Duration {
+	maxBackoff := p.cfg.InitialBackoff
+	for i := uint(1); i < attempt && maxBackoff < p.cfg.MaxBackoff; i++ {
+		maxBackoff *= 2
+	}
+	maxBackoff = min(maxBackoff, p.cfg.MaxBackoff)
+	return rand.N(maxBackoff + 1)
+}
+
+// sleepContext waits for the given duration, or until ctx is done, in which
+// case it returns the context error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_do(t *testing.T) {
+	transientErr := &pq.Error{Code: "40P01"}
+	permanentErr := errors.New("dummy error")
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts uint
+		wantErr      error
+	}{
+		{
+			name:         "success",
+			errs:         []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			name:         "success after retries",
+			errs:         []error{transientErr, transientErr, nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "permanent error",
+			errs:         []error{transientErr, permanentErr},
+			wantAttempts: 2,
+			wantErr:      permanentErr,
+		},
+		{
+			name:         "max attempts",
+			errs:         []error{transientErr, transientErr, transientErr, nil},
+			wantAttempts: 3,
+			wantErr:      transientErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				p := newRetryPolicy(&RetryConfig{MaxAttempts: 3})
+				var backoffs []time.Duration
+				p.sleep = func(_ context.Context, d time.Duration) error {
+					backoffs = append(backoffs, d)
+					return nil
+				}
+				var calls int
+				attempts, err := p.do(
+					context.Background(),
+					func(context.Context) error {
+						calls++
+						return tt.errs[calls-1]
+					},
+				)
+				require.Equal(t, tt.wantAttempts, attempts)
+				require.Equal(t, tt.wantErr, err)
+				require.Len(t, backoffs, int(attempts)-1)
+			},
+		)
+	}
+}
+
+func TestRetryPolicy_do_Nil(t *testing.T) {
+	var p *retryPolicy
+	require.Nil(t, newRetryPolicy(&RetryConfig{MaxAttempts: 1}))
+	wantErr := &pq.Error{Code: "40P01"}
+	attempts, err := p.do(context.Background(), func(context.Context) error { return wantErr })
+	require.Equal(t, uint(1), attempts)
+	require.Equal(t, wantErr, err)
+}
+
+func TestRetryPolicy_do_ContextDone(t *testing.T) {
+	p := newRetryPolicy(&RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	wantErr := &pq.Error{Code: "40P01"}
+	attempts, err := p.do(
+		ctx,
+		func(context.Context) error {
+			cancel()
+			return wantErr
+		},
+	)
+	require.Equal(t, uint(1), attempts)
+	require.Equal(t, wantErr, err)
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := newRetryPolicy(&RetryConfig{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for range 100 {
+		require.LessOrEqual(t, p.backoff(1), time.Second)
+		require.LessOrEqual(t, p.backoff(2), 2*time.Second)
+		require.LessOrEqual(t, p.backoff(9), 5*time.Second)
+		require.GreaterOrEqual(t, p.backoff(9), time.Duration(0))
+	}
+}
@@ -0,0 +1,108 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TruncateFunc returns the expression which truncates the values of the given
+// quoted column to at most n characters, in the SQL dialect of a repository.
+// It is only called for columns with a textual data type (see isTextual).
+type TruncateFunc func(quotedColumn string, n uint) string
+
+// genericTruncate truncates values with the widely supported three-argument
+// form of SUBSTRING.
+func genericTruncate(quotedColumn string, n uint) string {
+	return fmt.Sprintf("SUBSTRING(%s, 1, %d)", quotedColumn, n)
+}
+
+// sampledAttributes returns the attributes of the table which are sampled,
+// i.e. which pass the column and data type filters of the parameters. The
+// columns are matched by their full path in the given database, e.g.
+// db.schema.table.column.
+func (p SampleParameters) sampledAttributes(database string) []*AttributeMetadata {
+	attrs := make([]*AttributeMetadata, 0, len(p.Metadata.Attributes))
+	for _, attr := range p.Metadata.Attributes {
+		path := fmt.Sprintf("%s.%s.%s.%s", database, p.Metadata.Schema, p.Metadata.Name, attr.Name)
+		if matchPatterns(path, p.ExcludeColumns) {
+			continue
+		}
+		if len(p.IncludeColumns) > 0 && !matchPatterns(path, p.IncludeColumns) {
+			continue
+		}
+		if excludedDataType(attr.DataType, p.ExcludeDataTypes) {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+// SelectList returns the comma-separated select list of a query which samples
+// the table of the parameters, in the given database. Only the attributes which
+// pass the column and data type filters of the parameters are selected, and
+// are quoted using the given quote character. If MaxValueLength is set, the
+// values of the textual attributes are truncated with the given truncate
+// function, unless it is nil. An empty string is returned if no attribute
+// passes the filters, in which case the table must not be sampled.
+func (p SampleParameters) SelectList(database, quoteChar string, truncate TruncateFunc) string {
+	attrs := p.sampledAttributes(database)
+	cols := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		col := quoteChar + attr.Name + quoteChar
+		if p.MaxValueLength > 0 && truncate != nil && isTextual(attr.DataType) {
+			// The expression is aliased so that the sampled column keeps its
+			// name.
+			col = truncate(col, p.MaxValueLength) + " AS " + col
+		}
+		cols = append(cols, col)
+	}
+	return strings.Join(cols, ",")
+}
+
+// truncateValue truncates the given sampled value to at most n characters (or
+// bytes, for binary values), if it is a string or byte slice. Other values are
+// returned as is. It is used to enforce SampleParameters.MaxValueLength for
+// repositories which can't truncate the values in their sample queries.
+func truncateValue(v any, n uint) any {
+	switch val := v.(type) {
+	case string:
+		if uint(utf8.RuneCountInString(val)) > n {
+			return string([]rune(val)[:n])
+		}
+	case []byte:
+		if uint(len(val)) > n {
+			if utf8.Valid(val) {
+				// Textual values may also be returned as bytes, in which case
+				// they are truncated on a character boundary.
+				return []byte(truncateValue(string(val), n).(string))
+			}
+			return val[:n]
+		}
+	}
+	return v
+}
+
+// isTextual returns true if the given data type is a character type, whose
+// values can be truncated.
+func isTextual(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	for _, t := range []string{"char", "text", "clob", "string", "json"} {
+		if strings.Contains(dataType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedDataType returns true if the given data type is one of the excluded
+// data types, which are compared case-insensitively.
+func excludedDataType(dataType string, excluded []string) bool {
+	for _, t := range excluded {
+		if strings.EqualFold(dataType, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package sql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleParameters_SelectList(t *testing.T) {
+	meta := &TableMetadata{
+		Schema: "schema",
+		Name:   "table",
+		Attributes: []*AttributeMetadata{
+			{Name: "id", DataType: "integer"},
+			{Name: "email", DataType: "character varying"},
+			{Name: "raw_payload", DataType: "jsonb"},
+			{Name: "avatar", DataType: "bytea"},
+		},
+	}
+	tests := []struct {
+		name   string
+		params SampleParameters
+		want   string
+	}{
+		{
+			name:   "no filters",
+			params: SampleParameters{Metadata: meta},
+			want:   `"id","email","raw_payload","avatar"`,
+		},
+		{
+			name: "exclude columns",
+			params: SampleParameters{
+				Metadata:       meta,
+				ExcludeColumns: []glob.Glob{glob.MustCompile("db.*.raw_payload")},
+			},
+			want: `"id","email","avatar"`,
+		},
+		{
+			name: "include columns",
+			params: SampleParameters{
+				Metadata:       meta,
+				IncludeColumns: []glob.Glob{glob.MustCompile("*.e*"), glob.MustCompile("*.id")},
+				ExcludeColumns: []glob.Glob{glob.MustCompile("*.id")},
+			},
+			want: `"email"`,
+		},
+		{
+			name: "exclude data types",
+			params: SampleParameters{
+				Metadata:         meta,
+				ExcludeDataTypes: []string{"BYTEA", "jsonb"},
+			},
+			want: `"id","email"`,
+		},
+		{
+			name: "max value length",
+			params: SampleParameters{
+				Metadata:         meta,
+				ExcludeDataTypes: []string{"bytea"},
+				MaxValueLength:   100,
+			},
+			want: `"id",LEFT(CAST("email" AS text), 100) AS "email",LEFT(CAST("raw_payload" AS text), 100) AS "raw_payload"`,
+		},
+		{
+			name: "all excluded",
+			params: SampleParameters{
+				Metadata:       meta,
+				ExcludeColumns: []glob.Glob{glob.MustCompile("*")},
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.params.SelectList("db", `"`, postgresTruncate))
+		})
+	}
+}
+
+func TestTruncateValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "short string", value: "abc", want: "abc"},
+		{name: "long string", value: "abcdef", want: "abcd"},
+		{name: "multi-byte string", value: "äöüßéè", want: "äöüß"},
+		{name: "text bytes", value: []byte("äöüßéè"), want: []byte("äöüß")},
+		{name: "binary bytes", value: []byte{0xff, 0xfe, 0xfd, 0xfc, 0xfb}, want: []byte{0xff, 0xfe, 0xfd, 0xfc}},
+		{name: "number", value: int64(1234567), want: int64(1234567)},
+		{name: "nil", value: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, truncateValue(tt.value, 4))
+		})
+	}
+}
+
+func TestGenericRepository_SampleTable_Filters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	repo := NewGenericRepositoryFromDB("genericSql", "db", db)
+	meta := &TableMetadata{
+		Schema: "schema",
+		Name:   "table",
+		Attributes: []*AttributeMetadata{
+			{Name: "name", DataType: "varchar"},
+			{Name: "photo", DataType: "image"},
+		},
+	}
+	params := SampleParameters{
+		Metadata:         meta,
+		SampleSize:       5,
+		ExcludeDataTypes: []string{"image"},
+		MaxValueLength:   3,
+	}
+	rows := sqlmock.NewRows([]string{"name"}).AddRow("abcdef")
+	query := `SELECT SUBSTRING("name", 1, 3) AS "name" FROM schema.table LIMIT ? OFFSET ?`
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(5, 0).WillReturnRows(rows)
+	sample, err := repo.SampleTable(context.Background(), params)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	// The values are also truncated after they are fetched.
+	require.Equal(t, []SampleResult{{"name": "abc"}}, sample.Results)
+
+	// Tables whose columns are all excluded are not queried.
+	params.ExcludeDataTypes = append(params.ExcludeDataTypes, "varchar")
+	sample, err = repo.SampleTable(context.Background(), params)
+	require.NoError(t, err)
+	require.Empty(t, sample.Results)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
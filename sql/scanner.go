@@ -4,40 +4,82 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"maps"
 	"math"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gobwas/glob"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/sync/semaphore"
 
 	"github.com/cyralinc/dmap/classification"
 	"github.com/cyralinc/dmap/scan"
 )
 
-// Pair type intended to be passed to a channel (see sampleAllDbs).
-type samplesAndErr struct {
-	samples []Sample
-	err     error
-}
-
-// Pair type intended to be passed to a channel (see sampleDb).
-type sampleAndErr struct {
-	sample Sample
-	err    error
-}
-
 // ScannerConfig is the configuration for the Scanner.
 type ScannerConfig struct {
-	RepoType                   string
-	RepoConfig                 RepoConfig
+	RepoType   string
+	RepoConfig RepoConfig
+	// RepoID is the optional ID of the repository in the Dmap service. It is
+	// part of the identity of the scan recorded in the checkpoint file.
+	RepoID                     string
 	Registry                   *Registry
 	IncludePaths, ExcludePaths []glob.Glob
-	SampleSize                 uint
-	Offset                     uint
-	LabelsYamlFilename         string
+	// IncludeObjectTypes and ExcludeObjectTypes filter the introspected tables
+	// by their object type (see IntrospectParameters).
+	IncludeObjectTypes, ExcludeObjectTypes []ObjectType
+	// IncludeColumns, ExcludeColumns, ExcludeDataTypes and MaxValueLength
+	// filter the sampled columns and limit the length of their sampled values
+	// (see SampleParameters).
+	IncludeColumns, ExcludeColumns []glob.Glob
+	ExcludeDataTypes               []string
+	MaxValueLength                 uint
+	SampleSize                     uint
+	Offset                         uint
+	LabelsYamlFilename             string
+	// ClassifyWorkers is the number of goroutines which classify the sampled
+	// tables concurrently. If zero, runtime.GOMAXPROCS is used.
+	ClassifyWorkers uint
+	// CheckpointFilename is the name of an optional checkpoint file, which
+	// records each table that has been sampled and classified, along with its
+	// classifications, so that an interrupted scan can be resumed.
+	CheckpointFilename string
+	// Resume resumes a previous scan from the checkpoint file. The tables
+	// recorded in it are not scanned again, and their classifications are
+	// merged into the results. Requires CheckpointFilename. A checkpoint which
+	// was written by a scan of another repository, or with other filters or
+	// sampling parameters, is rejected.
+	Resume bool
+	// CollectTableStats collects the estimated statistics of each table, such
+	// as its row count, from the database catalog (see TableStats). They are
+	// included in the scan results, and tables whose exact row count is zero
+	// (see TableStats.Exact) are not sampled.
+	CollectTableStats bool
+	// CollectRelationships collects the primary and foreign keys of each table
+	// (see IntrospectParameters.CollectKeys). The foreign key relationships are
+	// included in the scan results, and the columns which reference a table
+	// containing sensitive data are reported as linked to its labels.
+	CollectRelationships bool
+	// Retry is the configuration of the retries of the repository calls which
+	// fail with transient errors. If nil, the calls are not retried. The
+	// retries are reported in the scan results.
+	Retry *RetryConfig
+	// IncrementalFrom is the name of the checkpoint file of a previous,
+	// completed scan. If set, the scan is incremental: tables whose metadata
+	// and change indicators (see ChangeTracker) are the same as in the
+	// previous scan are not sampled again, and their previous classifications
+	// are carried forward. It may be the same file as CheckpointFilename, in
+	// which case it is read before being overwritten. If the previous scan was
+	// of another repository or with another configuration (see
+	// ScannerConfig.Resume), all the tables are scanned.
+	IncrementalFrom string
 }
 
 // Scanner is a data discovery scanner that scans a data repository for
@@ -48,6 +90,12 @@ type Scanner struct {
 	config     ScannerConfig
 	labels     []classification.Label
 	classifier classification.Classifier
+	// limiter limits the rate of the queries of the scanner, if configured
+	// (see RepoConfig.RateLimit).
+	limiter *queryLimiter
+	// retry retries the repository calls which fail with transient errors, if
+	// configured (see ScannerConfig.Retry).
+	retry *retryPolicy
 }
 
 // RepoScanner implements the scan.RepoScanner interface.
@@ -58,6 +106,14 @@ func NewScanner(ctx context.Context, cfg ScannerConfig) (*Scanner, error) {
 	if cfg.RepoType == "" {
 		return nil, fmt.Errorf("repository type not specified")
 	}
+	if cfg.Resume && cfg.CheckpointFilename == "" {
+		return nil, fmt.Errorf("resuming a scan requires a checkpoint file")
+	}
+	if cfg.RepoConfig.RateLimit != nil {
+		if err := cfg.RepoConfig.RateLimit.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rate limit config: %w", err)
+		}
+	}
 	if cfg.Registry == nil {
 		cfg.Registry = DefaultRegistry
 	}
@@ -95,336 +151,883 @@ func NewScanner(ctx context.Context, cfg ScannerConfig) (*Scanner, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating new label classifier: %w", err)
 	}
-	return &Scanner{config: cfg, labels: lbls, classifier: c}, nil
+	return &Scanner{
+		config:     cfg,
+		labels:     lbls,
+		classifier: c,
+		limiter:    newQueryLimiter(cfg.RepoConfig.RateLimit),
+		retry:      newRetryPolicy(cfg.Retry),
+	}, nil
 }
 
 // Scan performs the data repository scan. It introspects and samples the
 // repository, classifies the sampled data, and publishes the results to the
-// configured classification publisher.
-func (s *Scanner) Scan(ctx context.Context) (*scan.RepoScanResults, error) {
-	// First introspect and sample the data repository.
+// configured classification publisher. It is a wrapper around ScanStream which
+// collects all the streamed classifications into a single result set (see
+// CollectResults).
+func (s *Scanner) Scan(ctx context.Context) (_ *scan.RepoScanResults, err error) {
+	ctx, span := startSpan(ctx, "Scanner.Scan", attrRepoType.String(s.config.RepoType))
+	defer func() { endSpan(span, err) }()
+	return s.CollectResults(ctx, s.ScanStream(ctx))
+}
+
+// CollectResults drains the given events, as emitted by ScanStream, and
+// collects them into a single result set, as returned by Scan. This allows
+// callers to observe the events of a scan, e.g. to report its progress, and
+// still get its results: the events can be forwarded to CollectResults once
+// observed. It returns an error if the scan failed, or if the channel was
+// closed without an EventDone event, which only happens if ctx was cancelled.
+func (s *Scanner) CollectResults(ctx context.Context, events <-chan Event) (*scan.RepoScanResults, error) {
+	uniqueClassifications := make(map[string]classification.Classification)
 	var (
-		samples []Sample
-		err     error
+		tableStats []scan.TableStats
+		done       *Event
 	)
-	// Check if the user specified a single database, or told us to scan an
-	// Oracle DB. In that case, therefore we only need to sample that single
-	// database. Note that Oracle doesn't really have the concept of
-	// "databases", therefore a single repository instance will always scan the
-	// entire database.
-	if s.config.RepoConfig.Database != "" || s.config.RepoType == RepoTypeOracle {
-		samples, err = s.sampleDb(ctx, s.config.RepoConfig.Database)
-	} else {
-		// The name of the database to connect to has been left unspecified by
-		// the user, so we try to connect and sample all databases instead.
-		samples, err = s.sampleAllDbs(ctx)
-	}
-	if err != nil {
-		msg := "error sampling repository"
-		// If we didn't get any samples, just return the error.
-		if len(samples) == 0 {
-			return nil, fmt.Errorf("%s: %w", msg, err)
+	for evt := range events {
+		switch evt.Type {
+		case EventTableClassified:
+			if evt.Stats != nil {
+				tableStats = append(
+					tableStats,
+					scan.TableStats{
+						Path:      evt.TablePath,
+						RowCount:  evt.Stats.RowCount,
+						SizeBytes: evt.Stats.SizeBytes,
+					},
+				)
+			}
+			for _, c := range evt.Classifications {
+				key := pathKey(c.AttributePath)
+				result, ok := uniqueClassifications[key]
+				if !ok {
+					uniqueClassifications[key] = c
+				} else {
+					// Merge the labels from the new result into the existing result.
+					maps.Copy(result.Labels, c.Labels)
+				}
+			}
+		case EventDone:
+			done = &evt
 		}
-		// There were error(s) during sampling, but we still got some samples.
-		// Just warn and continue.
-		log.WithError(err).Warn(msg)
 	}
-	// Classify the sampled data.
-	classifications, err := s.classifySamples(ctx, samples)
-	if err != nil {
-		return nil, fmt.Errorf("error classifying samples: %w", err)
+	if done == nil {
+		// The stream only ends without a final event if the context was
+		// cancelled.
+		return nil, fmt.Errorf("error scanning repository: %w", ctx.Err())
 	}
+	if done.Err != nil {
+		return nil, done.Err
+	}
+	// Convert the map of unique classifications to a slice.
+	classifications := make([]classification.Classification, 0, len(uniqueClassifications))
+	for _, result := range uniqueClassifications {
+		classifications = append(classifications, result)
+	}
+	// Now that all the tables are classified, link the columns which reference
+	// tables containing sensitive data to their labels.
+	linkedColumns := linkRelationships(done.Relationships, classifications)
 	return &scan.RepoScanResults{
 		Labels:          s.labels,
 		Classifications: classifications,
+		Failures:        done.Failures,
+		Retries:         done.Retries,
+		Coverage:        done.Coverage,
+		TableStats:      tableStats,
+		Relationships:   done.Relationships,
+		LinkedColumns:   linkedColumns,
 	}, nil
 }
 
-// sampleDb is samples every table in a given database and returns the samples.
-// The repository instance is created with the provided database name by
-// newRepository. The database is then introspected by calling
+// ScanStream performs the data repository scan, streaming the classifications
+// of each table as soon as they are available rather than collecting them. The
+// tables are sampled concurrently, and each sample is handed over to a bounded
+// pool of classification workers (see ScannerConfig.ClassifyWorkers). A sample
+// is released as soon as it is classified, so the number of samples held in
+// memory is bounded by the number of tables sampled concurrently per database
+// (RepoConfig.MaxConcurrency, or RepoConfig.MaxOpenConns or the number of
+// workers if it isn't set), times the number of databases sampled concurrently
+// (see RepoConfig.MaxParallelDbs), plus twice the number of workers, regardless
+// of the number of tables in the repository.
+//
+// An EventTableClassified event is emitted for each sampled table, and an
+// EventFailure event for each failure as it happens. If the scan is resumed
+// from a checkpoint (see ScannerConfig.Resume), an EventTableClassified event
+// is first emitted for each table recorded in the checkpoint. The last event is
+// always an EventDone event with the outcome of the scan, after which the
+// channel is closed. The caller must either drain the channel or cancel the
+// context, otherwise the scan blocks. If the context is cancelled, the
+// EventDone event may not be delivered.
+func (s *Scanner) ScanStream(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		ctx, span := startSpan(ctx, "Scanner.ScanStream", attrRepoType.String(s.config.RepoType))
+		done := s.scanPipeline(ctx, events)
+		endSpan(span, done.Err)
+		select {
+		case <-ctx.Done():
+		case events <- done:
+		}
+	}()
+	return events
+}
+
+// scanPipeline runs the sampling and classification pipeline of ScanStream. It
+// sends the intermediate events to the events channel, and returns the final
+// EventDone event once the pipeline has finished.
+func (s *Scanner) scanPipeline(ctx context.Context, events chan<- Event) Event {
+	// The pipeline context is cancelled to abort the scan if a sample cannot be
+	// classified at all.
+	pipelineCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	emit := func(evt Event) {
+		select {
+		case <-pipelineCtx.Done():
+		case events <- evt:
+		}
+	}
+	// The report collects the failures and coverage counters of the scan.
+	report := newScanReport()
+	report.onFailure = func(failure scan.Failure) {
+		emit(Event{Type: EventFailure, Failure: &failure})
+	}
+	// For incremental scans, load the state of the tables in the previous scan.
+	// This happens before the checkpoint is opened, since it may be the same
+	// file.
+	if s.config.IncrementalFrom != "" {
+		previous, records, _, err := readCheckpoint(s.config.IncrementalFrom)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// This is the first scan, so there are no previous results.
+			log.Warnf("previous scan state %s not found, scanning all tables", s.config.IncrementalFrom)
+		case err != nil:
+			return Event{Type: EventDone, Err: fmt.Errorf("error reading previous scan state: %w", err)}
+		default:
+			// The previous classifications are only valid for the same
+			// repository and configuration, e.g. they are stale if the labels
+			// have changed since.
+			diff, err := previous.diff(newCheckpointIdentity(s.config))
+			if err != nil {
+				return Event{Type: EventDone, Err: fmt.Errorf("error comparing previous scan identity: %w", err)}
+			}
+			if len(diff) > 0 {
+				log.Warnf(
+					"previous scan state %s was written by a scan of another repository or with another "+
+						"configuration (%s differ), scanning all tables",
+					s.config.IncrementalFrom,
+					strings.Join(diff, ", "),
+				)
+			} else {
+				report.setPrevious(records)
+			}
+		}
+	}
+	// Optionally record the classified tables in a checkpoint file. When
+	// resuming, the tables recorded in the checkpoint are skipped, and their
+	// classifications are emitted as is.
+	var cp *checkpoint
+	if s.config.CheckpointFilename != "" {
+		var (
+			records []checkpointRecord
+			err     error
+		)
+		cp, records, err = openCheckpoint(
+			s.config.CheckpointFilename,
+			newCheckpointIdentity(s.config),
+			s.config.Resume,
+		)
+		if err != nil {
+			return Event{Type: EventDone, Err: fmt.Errorf("error opening checkpoint: %w", err)}
+		}
+		defer func() { _ = cp.Close() }()
+		for _, record := range records {
+			report.addResumed(record.TablePath)
+			emit(
+				Event{
+					Type:            EventTableClassified,
+					TablePath:       record.TablePath,
+					Classifications: record.Classifications,
+					Stats:           record.Stats,
+					Resumed:         true,
+				},
+			)
+		}
+	}
+	// Adapt the query rate to the load of the database while sampling, if
+	// configured.
+	var loadWg sync.WaitGroup
+	loadWg.Add(1)
+	go func() {
+		defer loadWg.Done()
+		s.pollLoad(pipelineCtx)
+	}()
+	defer func() {
+		cancel()
+		loadWg.Wait()
+	}()
+	workers := s.classifyWorkers()
+	// Introspect and sample the data repository on a dedicated goroutine, which
+	// sends the samples to the classification workers.
+	samples := make(chan tableSample, workers)
+	var sampleErr error
+	go func() {
+		defer close(samples)
+		// Check if the user specified a single database. In that case,
+		// therefore we only need to sample that single database.
+		if s.config.RepoConfig.Database != "" {
+			sampleErr = s.sampleDb(pipelineCtx, s.config.RepoConfig.Database, report, samples)
+		} else {
+			// The name of the database to connect to has been left unspecified
+			// by the user, so we try to connect and sample all databases
+			// instead.
+			sampleErr = s.sampleAllDbs(pipelineCtx, report, samples)
+		}
+	}()
+	// Classify the samples as they arrive.
+	var (
+		wg          sync.WaitGroup
+		once        sync.Once
+		classifyErr error
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sample := range samples {
+				if pipelineCtx.Err() != nil {
+					// The scan was aborted, just drain the remaining samples.
+					continue
+				}
+				var classifications []classification.Classification
+				if sample.previous != nil {
+					// The table is unchanged since the previous scan, so its
+					// classifications are carried forward.
+					classifications = sample.previous.Classifications
+				} else {
+					var err error
+					classifications, err = s.classifySample(pipelineCtx, sample.Sample, sample.meta, report)
+					if err != nil {
+						once.Do(func() { classifyErr = err; cancel() })
+						continue
+					}
+				}
+				if cp != nil {
+					record := checkpointRecord{
+						TablePath:       sample.TablePath,
+						Classifications: classifications,
+						Stats:           sample.stats,
+						tableState:      sample.state,
+					}
+					if err := cp.write(record); err != nil {
+						log.WithError(err).Warn("error writing checkpoint")
+					}
+				}
+				emit(
+					Event{
+						Type:            EventTableClassified,
+						TablePath:       sample.TablePath,
+						Classifications: classifications,
+						Stats:           sample.stats,
+						Unchanged:       sample.previous != nil,
+					},
+				)
+			}
+		}()
+	}
+	// The workers finish once the samples channel is closed, i.e. once the
+	// sampling goroutine has returned.
+	wg.Wait()
+	failures, coverage := report.results()
+	done := Event{
+		Type:          EventDone,
+		Failures:      failures,
+		Retries:       report.retried(),
+		Coverage:      coverage,
+		Relationships: report.relationships,
+	}
+	switch {
+	case classifyErr != nil:
+		done.Err = fmt.Errorf("error classifying samples: %w", classifyErr)
+	case ctx.Err() != nil:
+		done.Err = fmt.Errorf("error scanning repository: %w", ctx.Err())
+	case sampleErr != nil:
+		msg := "error sampling repository"
+		// If we didn't get any samples, just return the error.
+		if coverage.TablesSampled+coverage.TablesEmpty+coverage.TablesResumed+coverage.TablesUnchanged == 0 {
+			done.Err = fmt.Errorf("%s: %w", msg, sampleErr)
+		} else {
+			// There were error(s) during sampling, but we still got some
+			// samples. Just warn and continue.
+			log.WithError(sampleErr).Warn(msg)
+		}
+	}
+	return done
+}
+
+// sampleDb is samples every table in a given database and sends the samples to
+// the out channel. The repository instance is created with the provided
+// database name by newRepository. The database is then introspected by calling
 // Repository.Introspect to return the repository metadata (Metadata). Then, for
 // each schema and table in the metadata, it calls Repository.SampleTable in a
 // new goroutine to sample all tables concurrently. Note however that the level
 // of concurrency should be limited by the max number of open connections
 // specified for the scanner, since the underlying repository should respect
 // this across goroutines. This of course depends on the implementation, however
-// for all the out-of-the-box Repository implementations, this applies. Once all
-// the sampling goroutines are finished, their results are collected and
-// returned as a slice of Sample.
-func (s *Scanner) sampleDb(ctx context.Context, db string) ([]Sample, error) {
+// for all the out-of-the-box Repository implementations, this applies. Each
+// sample is sent to the out channel as soon as it is available, and sampleDb
+// returns once all the sampling goroutines are finished. The out channel is not
+// closed. For incremental scans, the tables which are unchanged since the
+// previous scan are not sampled, and are sent to the out channel along with
+// their previous state instead. Any failures, along with the coverage counters,
+// are recorded in the given report.
+func (s *Scanner) sampleDb(ctx context.Context, db string, report *scanReport, out chan<- tableSample) (err error) {
+	ctx, span := startSpan(ctx, "Scanner.sampleDb", attrRepoType.String(s.config.RepoType), attrDatabase.String(db))
+	defer func() { endSpan(span, err) }()
 	// Create the repository instance that will be used to sample the database.
 	cfg := s.config.RepoConfig
 	cfg.Database = db
-	repo, err := s.newRepository(ctx, cfg)
+	repo, err := s.connectRepo(ctx, cfg, report, []string{db})
 	if err != nil {
-		return nil, fmt.Errorf("error creating repository instance: %w", err)
+		report.addFailure([]string{db}, scan.PhaseConnect, err)
+		return fmt.Errorf("error creating repository instance: %w", err)
 	}
 	defer func() { _ = repo.Close() }()
 	// Introspect the repository to get the metadata.
-	introspectCtx := ctx
-	if s.config.RepoConfig.QueryTimeout > 0 {
-		var cancel context.CancelFunc
-		introspectCtx, cancel = context.WithTimeout(ctx, s.config.RepoConfig.QueryTimeout)
-		defer cancel()
-	}
 	introspectParams := IntrospectParameters{
-		IncludePaths: s.config.IncludePaths,
-		ExcludePaths: s.config.ExcludePaths,
+		IncludePaths:       s.config.IncludePaths,
+		ExcludePaths:       s.config.ExcludePaths,
+		IncludeObjectTypes: s.config.IncludeObjectTypes,
+		ExcludeObjectTypes: s.config.ExcludeObjectTypes,
+		CollectStats:       s.config.CollectTableStats,
+		CollectKeys:        s.config.CollectRelationships,
 	}
-	meta, err := repo.Introspect(introspectCtx, introspectParams)
+	var meta *Metadata
+	err = s.queryRepo(
+		ctx,
+		report,
+		[]string{db},
+		opIntrospect,
+		func(ctx context.Context) error {
+			var err error
+			meta, err = repo.Introspect(ctx, introspectParams)
+			return err
+		},
+		attrDatabase.String(db),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error introspecting repository: %w", err)
-	}
-	// This goroutine launches additional goroutines, one for each table, which
-	// sample the respective tables and send the results to the out channel. A
-	// semaphore is optionally used to limit the number of tables that are
-	// sampled concurrently. We do this on a dedicated goroutine so we can
-	// immediately read from the out channel on this goroutine, and avoid
-	// possible deadlocks due to the semaphore.
-	out := make(chan sampleAndErr)
-	go func() {
-		// Before we return, wait for all the goroutines we launch below to
-		// complete, and then close the out channel once they're all done so the
-		// main goroutine can aggregate the results and return them.
-		var wg sync.WaitGroup
-		defer func() { wg.Wait(); close(out) }()
-		// Optionally use a semaphore to limit the number of tables sampled
-		// concurrently.
-		var sema *semaphore.Weighted
-		if s.config.RepoConfig.MaxConcurrency > 0 {
-			sema = semaphore.NewWeighted(int64FromUint(s.config.RepoConfig.MaxConcurrency))
-		}
-		for _, schemaMeta := range meta.Schemas {
-			for _, tableMeta := range schemaMeta.Tables {
-				if sema != nil {
-					// Acquire a semaphore slot before launching a goroutine to
-					// sample the table. This will block if the semaphore is
-					// full, and will unblock once a slot is available. An error
-					// means the context was cancelled.
-					if err := sema.Acquire(ctx, 1); err != nil {
-						log.WithError(err).Error("error acquiring semaphore")
-						return
-					}
+		report.addFailure([]string{db}, scan.PhaseIntrospect, err)
+		return fmt.Errorf("error introspecting repository: %w", err)
+	}
+	report.addDiscovered(meta)
+	if s.config.CollectRelationships {
+		report.addRelationships(tableRelationships(db, meta))
+	}
+	// The state of each table is only needed to record it in the checkpoint, or
+	// to compare it with the previous scan.
+	trackChanges := s.config.CheckpointFilename != "" || s.config.IncrementalFrom != ""
+	var indicators map[string]map[string]string
+	if trackChanges {
+		indicators = s.changeIndicators(ctx, repo, db)
+	}
+	// Launch a goroutine for each table, which samples the table and sends the
+	// sample to the out channel. A semaphore limits the number of tables that
+	// are sampled concurrently (see samplingConcurrency). A slot is only
+	// released once the sample has been handed over, which also bounds the
+	// number of samples held in memory.
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs error
+	)
+	sema := semaphore.NewWeighted(int64FromUint(s.samplingConcurrency()))
+tables:
+	for _, schemaMeta := range meta.Schemas {
+		for _, tableMeta := range schemaMeta.Tables {
+			tablePath := []string{db, tableMeta.Schema, tableMeta.Name}
+			if report.isResumed(tablePath) {
+				// The table was already scanned before the scan was resumed.
+				continue
+			}
+			var state tableState
+			if trackChanges {
+				state = tableState{
+					Fingerprint:     tableFingerprint(tableMeta),
+					ChangeIndicator: indicators[tableMeta.Schema][tableMeta.Name],
 				}
-				wg.Add(1)
-				// Launch a goroutine to sample the table.
-				go func(ctx context.Context, meta *TableMetadata) {
-					defer func() {
-						if sema != nil {
-							// Release the slot once the goroutine is done.
-							sema.Release(1)
-						}
-						wg.Done()
-					}()
-					sampleCtx := ctx
-					if s.config.RepoConfig.QueryTimeout > 0 {
-						var cancel context.CancelFunc
-						sampleCtx, cancel = context.WithTimeout(ctx, s.config.RepoConfig.QueryTimeout)
-						defer cancel()
-					}
-					params := SampleParameters{
-						Metadata:   meta,
-						SampleSize: s.config.SampleSize,
-						Offset:     s.config.Offset,
-					}
-					sample, err := repo.SampleTable(sampleCtx, params)
-					select {
-					case <-ctx.Done():
-					case out <- sampleAndErr{sample: sample, err: err}:
-					}
-				}(ctx, tableMeta)
 			}
-		}
-	}()
-
-	// Aggregate and return the results.
-	var samples []Sample
-	var errs error
-	for {
-		select {
-		case <-ctx.Done():
-			errs = errors.Join(errs, ctx.Err())
-			return samples, fmt.Errorf("error(s) sampling repository: %w", errs)
-		case res, ok := <-out:
-			if !ok {
-				// The out channel has been closed, so we're done.
-				if errs != nil {
-					return samples, fmt.Errorf("error(s) sampling repository: %w", errs)
+			if previous, ok := report.previousRecord(tablePath); ok && previous.tableState == state {
+				// The table is unchanged since the previous scan, so it
+				// doesn't need to be sampled again.
+				report.addUnchanged()
+				unchanged := tableSample{
+					Sample:   Sample{TablePath: tablePath},
+					stats:    tableMeta.Stats,
+					state:    state,
+					previous: &previous,
 				}
-				return samples, nil
+				select {
+				case <-ctx.Done():
+					break tables
+				case out <- unchanged:
+				}
+				continue
 			}
-			if res.err != nil {
-				errs = errors.Join(errs, res.err)
-			} else {
-				samples = append(samples, res.sample)
+			if tableMeta.Stats != nil && tableMeta.Stats.Exact && tableMeta.Stats.RowCount == 0 {
+				// The table is known to be empty, so there is no point in
+				// sampling it. Estimated row counts may be zero for populated
+				// tables, e.g. if they were never analyzed, so those tables
+				// are still sampled.
+				empty := Sample{TablePath: tablePath}
+				report.addSampled(empty)
+				select {
+				case <-ctx.Done():
+					break tables
+				case out <- tableSample{Sample: empty, meta: tableMeta, stats: tableMeta.Stats, state: state}:
+				}
+				continue
+			}
+			// Acquire a semaphore slot before launching a goroutine to sample
+			// the table. This will block if the semaphore is full, and will
+			// unblock once a slot is available. An error means the context was
+			// cancelled.
+			if err := sema.Acquire(ctx, 1); err != nil {
+				break tables
 			}
+			wg.Add(1)
+			// Launch a goroutine to sample the table.
+			go func(ctx context.Context, meta *TableMetadata, tablePath []string, state tableState) {
+				defer func() {
+					// Release the slot once the goroutine is done.
+					sema.Release(1)
+					wg.Done()
+				}()
+				params := SampleParameters{
+					Metadata:         meta,
+					SampleSize:       s.config.SampleSize,
+					Offset:           s.config.Offset,
+					IncludeColumns:   s.config.IncludeColumns,
+					ExcludeColumns:   s.config.ExcludeColumns,
+					ExcludeDataTypes: s.config.ExcludeDataTypes,
+					MaxValueLength:   s.config.MaxValueLength,
+				}
+				var sample Sample
+				err := s.queryRepo(
+					ctx,
+					report,
+					tablePath,
+					opSampleTable,
+					func(ctx context.Context) error {
+						var err error
+						sample, err = repo.SampleTable(ctx, params)
+						return err
+					},
+					attrTablePath.StringSlice(tablePath),
+				)
+				if err != nil {
+					report.addSampleFailure(tablePath, err)
+					mu.Lock()
+					errs = errors.Join(errs, err)
+					mu.Unlock()
+					return
+				}
+				if sample.TablePath == nil {
+					// Repositories return an empty sample for empty tables.
+					sample.TablePath = tablePath
+				}
+				report.addSampled(sample)
+				tablesSampledCounter.Add(ctx, 1, metric.WithAttributes(attrRepoType.String(s.config.RepoType)))
+				select {
+				case <-ctx.Done():
+				case out <- tableSample{Sample: sample, meta: meta, stats: meta.Stats, state: state}:
+				}
+			}(ctx, tableMeta, tablePath, state)
 		}
 	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		errs = errors.Join(errs, ctx.Err())
+	}
+	if errs != nil {
+		return fmt.Errorf("error(s) sampling repository: %w", errs)
+	}
+	return nil
 }
 
 // sampleAllDbs samples all the databases on the server. It samples each
 // database concurrently by calling sampleDb for each database on a new
-// goroutine. It first creates a new Repository instance by calling
-// newRepository. This repository is intended to be configured to connect to the
-// default database on the server, or at least some database which can be used
-// to enumerate the full set of databases on the server. An error will be
-// returned if the set of databases cannot be listed. If there is an error
-// connecting to or sampling a database, the error will be logged and no samples
-// will be returned for that database. Therefore, the returned slice of samples
-// contains samples for only the databases which could be discovered and
-// successfully sampled, and could potentially be empty if no databases were
-// sampled.
-func (s *Scanner) sampleAllDbs(ctx context.Context) ([]Sample, error) {
+// goroutine, which sends the samples to the out channel. It first creates a new
+// Repository instance by calling newRepository. This repository is intended to
+// be configured to connect to the default database on the server, or at least
+// some database which can be used to enumerate the full set of databases on the
+// server. An error will be returned if the set of databases cannot be listed.
+// If there is an error connecting to or sampling a database, the error will be
+// logged and only the samples which could be taken are sent for that database.
+// Therefore, the samples sent to the out channel are for only the databases
+// which could be discovered and successfully sampled, and could potentially be
+// none if no databases were sampled. The out channel is not closed. Any
+// failures, along with the coverage counters, are recorded in the given report.
+func (s *Scanner) sampleAllDbs(ctx context.Context, report *scanReport, out chan<- tableSample) (err error) {
+	ctx, span := startSpan(ctx, "Scanner.sampleAllDbs", attrRepoType.String(s.config.RepoType))
+	defer func() { endSpan(span, err) }()
 	// Create a repository instance that will be used to list all the databases
 	// on the server.
-	repo, err := s.newRepository(ctx, s.config.RepoConfig)
+	repo, err := s.connectRepo(ctx, s.config.RepoConfig, report, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error creating repository instance: %w", err)
+		report.addFailure(nil, scan.PhaseConnect, err)
+		return fmt.Errorf("error creating repository instance: %w", err)
 	}
 	defer func() { _ = repo.Close() }()
 
 	// We assume that this repository will be connected to the default database
 	// (or at least some database that can discover all the other databases).
 	// Use it to discover all the other databases on the server.
-	listDbCtx := ctx
-	if s.config.RepoConfig.QueryTimeout > 0 {
-		var cancel context.CancelFunc
-		listDbCtx, cancel = context.WithTimeout(ctx, s.config.RepoConfig.QueryTimeout)
-		defer cancel()
-	}
-	dbs, err := repo.ListDatabases(listDbCtx)
+	var dbs []string
+	err = s.queryRepo(
+		ctx,
+		report,
+		nil,
+		opListDatabases,
+		func(ctx context.Context) error {
+			var err error
+			dbs, err = repo.ListDatabases(ctx)
+			return err
+		},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error listing databases: %w", err)
+		report.addFailure(nil, scan.PhaseList, err)
+		return fmt.Errorf("error listing databases: %w", err)
 	}
 
-	// This goroutine launches additional goroutines, one for each database,
-	// which sample the respective databases and send the results to the out
-	// channel. A semaphore is optionally used to limit the number of databases
-	// sampled concurrently. We do this on a dedicated goroutine so we can
-	// immediately read from the out channel on this goroutine, and avoid
-	// possible deadlocks due to the semaphore.
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithCancel(ctx)
-	defer cancel()
-	out := make(chan samplesAndErr)
-	go func() {
-		// Before we return, wait for all the goroutines we launch below to
-		// complete, and then close the out channel once they're all done so the
-		// main goroutine can aggregate the results and return them.
-		var wg sync.WaitGroup
-		defer func() { wg.Wait(); close(out) }()
-		// Optionally use a semaphore to limit the number of databases sampled
-		// concurrently.
-		var sema *semaphore.Weighted
-		if s.config.RepoConfig.MaxParallelDbs > 0 {
-			sema = semaphore.NewWeighted(int64FromUint(s.config.RepoConfig.MaxParallelDbs))
+	// Launch a goroutine for each database, which samples the respective
+	// database. A semaphore is optionally used to limit the number of databases
+	// sampled concurrently.
+	var wg sync.WaitGroup
+	var sema *semaphore.Weighted
+	if s.config.RepoConfig.MaxParallelDbs > 0 {
+		sema = semaphore.NewWeighted(int64FromUint(s.config.RepoConfig.MaxParallelDbs))
+	}
+	for _, db := range dbs {
+		if sema != nil {
+			// Acquire a semaphore slot before launching a goroutine to sample
+			// the database. This will block if the semaphore is full, and will
+			// unblock once a slot is available. An error means the context was
+			// cancelled.
+			if err := sema.Acquire(ctx, 1); err != nil {
+				break
+			}
 		}
-		for _, db := range dbs {
-			if sema != nil {
-				// Acquire a semaphore slot before launching a goroutine to
-				// sample the database. This will block if the semaphore is
-				// full, and will unblock once a slot is available. An error
-				// means the context was cancelled.
-				if err := sema.Acquire(ctx, 1); err != nil {
-					log.WithError(err).Error("error acquiring semaphore")
-					return
+		// Launch a goroutine to sample the database.
+		wg.Add(1)
+		go func(db string) {
+			defer func() {
+				if sema != nil {
+					// Release the slot once the goroutine is done.
+					sema.Release(1)
 				}
+				wg.Done()
+			}()
+			// Sample this specific database.
+			if err := s.sampleDb(ctx, db, report, out); err != nil {
+				log.WithError(err).Errorf("error gathering repository data samples for database %s", db)
 			}
-			// Launch a goroutine to sample the database.
-			wg.Add(1)
-			go func(db string, cfg RepoConfig) {
-				defer func() {
-					if sema != nil {
-						// Release the slot once the goroutine is done.
-						sema.Release(1)
-					}
-					wg.Done()
-				}()
-				// Sample this specific database.
-				samples, err := s.sampleDb(ctx, db)
-				if err != nil && len(samples) == 0 {
-					log.WithError(err).Errorf("error gathering repository data samples for database %s", db)
-					return
-				}
-				// Send the samples for this database to the 'out' channel. The
-				// samples for each database will be aggregated into a single
-				// slice on the main goroutine and returned.
-				select {
-				case <-ctx.Done():
-				case out <- samplesAndErr{samples: samples, err: err}:
-				}
-			}(db, s.config.RepoConfig)
-		}
-	}()
+		}(db)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
 
-	// Aggregate and return the results.
-	var ret []Sample
-	var errs error
-	for {
-		select {
-		case <-ctx.Done():
-			return ret, errors.Join(errs, ctx.Err())
-		case res, ok := <-out:
+// classifyWorkers returns the number of classification workers (see
+// ScannerConfig.ClassifyWorkers).
+func (s *Scanner) classifyWorkers() uint {
+	if s.config.ClassifyWorkers > 0 {
+		return s.config.ClassifyWorkers
+	}
+	return uint(runtime.GOMAXPROCS(0))
+}
+
+// samplingConcurrency returns the maximum number of tables of a database which
+// are sampled concurrently: RepoConfig.MaxConcurrency if set, and otherwise
+// RepoConfig.MaxOpenConns, since the sampling queries can't run on more
+// connections anyway, or the number of classification workers if neither is
+// set. The sampling is always bounded, since each sampling goroutine holds its
+// sample until a classification worker takes it.
+func (s *Scanner) samplingConcurrency() uint {
+	switch {
+	case s.config.RepoConfig.MaxConcurrency > 0:
+		return s.config.RepoConfig.MaxConcurrency
+	case s.config.RepoConfig.MaxOpenConns > 0:
+		return s.config.RepoConfig.MaxOpenConns
+	default:
+		return s.classifyWorkers()
+	}
+}
+
+// classifySample uses the scanner's classifier to classify the provided sample
+// of a single table. Each sampled row is individually classified. If the
+// classifier is a classification.MetadataClassifier, and the given table
+// metadata has comments, the metadata is also classified, even if the sample is
+// empty. The returned slice of classifications represents all the UNIQUE
+// classifications for the sampled table. Rows which are only partially
+// classified due to errors, as well as metadata classification errors, are
+// recorded as failures in the given report.
+func (s *Scanner) classifySample(
+	ctx context.Context,
+	sample Sample,
+	meta *TableMetadata,
+	report *scanReport,
+) ([]classification.Classification, error) {
+	attrLabels := make(map[string]classification.LabelSet)
+	// Classify each sampled row and combine the classifications.
+	for _, sampleResult := range sample.Results {
+		var res classification.Result
+		err := observeCall(
+			ctx,
+			s.config.RepoType,
+			opClassify,
+			func(ctx context.Context) error {
+				var err error
+				res, err = s.classifier.Classify(ctx, sampleResult)
+				return err
+			},
+			attrTablePath.StringSlice(sample.TablePath),
+		)
+		rowsClassifiedCounter.Add(ctx, 1, metric.WithAttributes(attrRepoType.String(s.config.RepoType)))
+		if err != nil {
+			// We received an error while classifying the sample. If we didn't
+			// get any results, return an error. Otherwise, log a warning and
+			// continue with the partial results.
+			if len(res) == 0 {
+				return nil, fmt.Errorf("error(s) classifying sample: %w", err)
+			}
+			log.WithError(err).Warn("error(s) classifying sample, continuing with partial results")
+			report.addFailure(sample.TablePath, scan.PhaseClassify, err)
+		}
+		for attr, labels := range res {
+			existing, ok := attrLabels[attr]
 			if !ok {
-				// The 'out' channel has been closed, so we're done.
-				return ret, errs
+				attrLabels[attr] = labels
+			} else {
+				// Merge the labels from the new result into the existing result.
+				maps.Copy(existing, labels)
 			}
-			ret = append(ret, res.samples...)
-			if res.err != nil {
-				errs = errors.Join(errs, res.err)
+		}
+	}
+	if mc, ok := s.classifier.(classification.MetadataClassifier); ok && hasComments(meta) {
+		var res classification.Result
+		err := observeCall(
+			ctx,
+			s.config.RepoType,
+			opClassify,
+			func(ctx context.Context) error {
+				var err error
+				res, err = mc.ClassifyMetadata(ctx, classificationMetadata(meta))
+				return err
+			},
+			attrTablePath.StringSlice(sample.TablePath),
+		)
+		if err != nil {
+			// The metadata is only additional evidence, so errors never fail
+			// the classification of the sample.
+			log.WithError(err).Warn("error(s) classifying table metadata")
+			report.addFailure(sample.TablePath, scan.PhaseClassify, err)
+		}
+		for attr, labels := range res {
+			existing, ok := attrLabels[attr]
+			if !ok {
+				attrLabels[attr] = labels
+			} else {
+				maps.Copy(existing, labels)
 			}
 		}
 	}
+	classifications := make([]classification.Classification, 0, len(attrLabels))
+	for attr, labels := range attrLabels {
+		classifications = append(
+			classifications,
+			classification.Classification{
+				AttributePath: append(slices.Clone(sample.TablePath), attr),
+				Labels:        labels,
+			},
+		)
+	}
+	return classifications, nil
+}
+
+// hasComments returns true if the given table or any of its attributes has a
+// comment.
+func hasComments(meta *TableMetadata) bool {
+	if meta == nil {
+		return false
+	}
+	if meta.Comment != "" {
+		return true
+	}
+	return slices.ContainsFunc(meta.Attributes, func(attr *AttributeMetadata) bool { return attr.Comment != "" })
+}
+
+// classificationMetadata converts the given table metadata to the input of a
+// classification.MetadataClassifier.
+func classificationMetadata(meta *TableMetadata) classification.TableMetadata {
+	attrs := make(map[string]classification.AttributeMetadata, len(meta.Attributes))
+	for _, attr := range meta.Attributes {
+		attrs[attr.Name] = classification.AttributeMetadata{DataType: attr.DataType, Comment: attr.Comment}
+	}
+	return classification.TableMetadata{
+		Schema:     meta.Schema,
+		Name:       meta.Name,
+		Comment:    meta.Comment,
+		Attributes: attrs,
+	}
+}
+
+// changeIndicators returns the change indicators of the tables of the given
+// database, keyed by schema and table name, if the repository implements
+// ChangeTracker. Errors are only logged, since the tables can still be compared
+// by their metadata alone.
+func (s *Scanner) changeIndicators(ctx context.Context, repo Repository, db string) map[string]map[string]string {
+	tracker, ok := repo.(ChangeTracker)
+	if !ok {
+		return nil
+	}
+	if err := s.limiter.wait(ctx); err != nil {
+		return nil
+	}
+	if s.config.RepoConfig.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.RepoConfig.QueryTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	indicators, err := tracker.ChangeIndicators(ctx)
+	s.limiter.observe(time.Since(start), err)
+	if err != nil {
+		log.WithError(err).Warnf("error getting change indicators for database %s", db)
+		return nil
+	}
+	return indicators
 }
 
-// classifySamples uses the scanner's classifier to classify the provided slice
-// of samples. Each sampled row is individually classified. The returned slice
-// of classifications represents all the UNIQUE classifications for a given
-// sample set.
-func (s *Scanner) classifySamples(
+// operationPhases are the scan phases of the repository operations.
+var operationPhases = map[string]scan.Phase{
+	opListDatabases: scan.PhaseList,
+	opIntrospect:    scan.PhaseIntrospect,
+	opSampleTable:   scan.PhaseSample,
+}
+
+// queryRepo calls fn, which queries the repository for the given operation on
+// the object at the given path, once the rate limiter of the scanner allows it
+// (see RepoConfig.RateLimit). The call is observed with observeCall, with the
+// query timeout of the scanner, if any, which starts once the query is issued
+// rather than while it waits for the rate limiter. The latency of the call is
+// fed back to the rate limiter. If the call fails with a transient error, it is
+// retried (see ScannerConfig.Retry), and the retries are recorded in the given
+// report.
+func (s *Scanner) queryRepo(
 	ctx context.Context,
-	samples []Sample,
-) ([]classification.Classification, error) {
-	uniqueClassifications := make(map[string]classification.Classification)
-	for _, sample := range samples {
-		// Classify each sampled row and combine the classifications.
-		for _, sampleResult := range sample.Results {
-			res, err := s.classifier.Classify(ctx, sampleResult)
-			if err != nil {
-				// We received an error while classifying the sample. If we
-				// didn't get any results, return an error. Otherwise, log a
-				// warning and continue with the partial results.
-				if len(res) == 0 {
-					return nil, fmt.Errorf("error(s) classifying sample: %w", err)
-				}
-				log.WithError(err).Warn("error(s) classifying sample, continuing with partial results")
+	report *scanReport,
+	path []string,
+	operation string,
+	fn func(ctx context.Context) error,
+	attrs ...attribute.KeyValue,
+) error {
+	return s.retryRepo(
+		ctx,
+		report,
+		path,
+		operationPhases[operation],
+		func(ctx context.Context) error {
+			if err := s.limiter.wait(ctx); err != nil {
+				return err
 			}
-			for attr, labels := range res {
-				attrPath := append(sample.TablePath, attr)
-				// U+2063 is an invisible separator. It is used here to ensure
-				// that the path key is unique and does not conflict with any of
-				// the path elements.
-				key := strings.Join(attrPath, "\u2063")
-				result, ok := uniqueClassifications[key]
-				if !ok {
-					uniqueClassifications[key] = classification.Classification{
-						AttributePath: attrPath,
-						Labels:        labels,
-					}
-				} else {
-					// Merge the labels from the new result into the existing result.
-					maps.Copy(result.Labels, labels)
-				}
+			if s.config.RepoConfig.QueryTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, s.config.RepoConfig.QueryTimeout)
+				defer cancel()
 			}
-		}
+			start := time.Now()
+			err := observeCall(ctx, s.config.RepoType, operation, fn, attrs...)
+			s.limiter.observe(time.Since(start), err)
+			return err
+		},
+	)
+}
+
+// connectRepo creates a new Repository instance with the provided
+// configuration, for the object at the given path (see newRepository). If the
+// creation fails with a transient error, it is retried (see
+// ScannerConfig.Retry), and the retries are recorded in the given report.
+func (s *Scanner) connectRepo(
+	ctx context.Context,
+	cfg RepoConfig,
+	report *scanReport,
+	path []string,
+) (Repository, error) {
+	var repo Repository
+	err := s.retryRepo(
+		ctx,
+		report,
+		path,
+		scan.PhaseConnect,
+		func(ctx context.Context) error {
+			var err error
+			repo, err = s.newRepository(ctx, cfg)
+			return err
+		},
+	)
+	return repo, err
+}
+
+// retryRepo calls fn with the retry policy of the scanner, and records the
+// retries of the operation in the given phase on the object at the given path
+// in the report, if there were any.
+func (s *Scanner) retryRepo(
+	ctx context.Context,
+	report *scanReport,
+	path []string,
+	phase scan.Phase,
+	fn func(ctx context.Context) error,
+) error {
+	var lastErr error
+	attempts, err := s.retry.do(
+		ctx,
+		func(ctx context.Context) error {
+			err := fn(ctx)
+			if err != nil {
+				lastErr = err
+			}
+			return err
+		},
+	)
+	if attempts > 1 {
+		report.addRetry(path, phase, attempts, err == nil, lastErr)
 	}
-	// Convert the map of unique classifications to a slice.
-	classifications := make([]classification.Classification, 0, len(uniqueClassifications))
-	for _, result := range uniqueClassifications {
-		classifications = append(classifications, result)
+	return err
+}
+
+// pollLoad polls the load of the database, and adapts the query rate of the
+// scanner to it, until ctx is done, if the scanner is configured to (see
+// RateLimitConfig.MaxLoad) and the repository can report its load (see
+// LoadReporter). The load is polled with a dedicated repository instance, with
+// a single connection.
+func (s *Scanner) pollLoad(ctx context.Context) {
+	rateLimit := s.config.RepoConfig.RateLimit
+	if s.limiter == nil || !rateLimit.Adaptive || rateLimit.MaxLoad == 0 {
+		return
 	}
-	return classifications, nil
+	cfg := s.config.RepoConfig
+	cfg.MaxOpenConns = 1
+	repo, err := s.newRepository(ctx, cfg)
+	if err != nil {
+		log.WithError(err).Warn("error creating repository instance to poll the database load")
+		return
+	}
+	defer func() { _ = repo.Close() }()
+	reporter, ok := repo.(LoadReporter)
+	if !ok {
+		log.Warnf("repository type %s does not report its load, ignoring the max load", s.config.RepoType)
+		return
+	}
+	s.limiter.pollLoad(ctx, reporter)
 }
 
 // newRepository creates a new Repository instance with the provided
@@ -441,6 +1044,14 @@ func (s *Scanner) newRepository(ctx context.Context, cfg RepoConfig) (Repository
 	return s.config.Registry.NewRepository(ctx, s.config.RepoType, cfg)
 }
 
+// pathKey returns a key which uniquely identifies the given path, e.g. a table
+// or attribute path. U+2063 is an invisible separator. It is used here to
+// ensure that the path key is unique and does not conflict with any of the path
+// elements.
+func pathKey(path []string) string {
+	return strings.Join(path, "\u2063")
+}
+
 func int64FromUint(n uint) int64 {
 	if n > math.MaxInt64 {
 		return math.MaxInt64
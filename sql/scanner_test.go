@@ -3,16 +3,20 @@ package sql
 import (
 	"context"
 	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/cyralinc/dmap/classification"
+	"github.com/cyralinc/dmap/scan"
 )
 
-// TODO: tests for Scanner.Scan -ccampo 2024-04-05
-
 func TestScanner_sampleDb_Success(t *testing.T) {
 	ctx := context.Background()
 	repo := NewMockRepository(t)
@@ -94,15 +98,15 @@ func TestScanner_sampleDb_Success(t *testing.T) {
 		},
 	}
 
-	repo.EXPECT().Introspect(ctx, mock.Anything).Return(&meta, nil)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
 	sampleParams1 := SampleParameters{
 		Metadata: meta.Schemas["schema1"].Tables["table1"],
 	}
 	sampleParams2 := SampleParameters{
 		Metadata: meta.Schemas["schema2"].Tables["table2"],
 	}
-	repo.EXPECT().SampleTable(ctx, sampleParams1).Return(table1Sample, nil)
-	repo.EXPECT().SampleTable(ctx, sampleParams2).Return(table2Sample, nil)
+	repo.EXPECT().SampleTable(mock.Anything, sampleParams1).Return(table1Sample, nil)
+	repo.EXPECT().SampleTable(mock.Anything, sampleParams2).Return(table2Sample, nil)
 	repo.EXPECT().Close().Return(nil)
 	repoType := "mock"
 	reg := NewRegistry()
@@ -119,7 +123,9 @@ func TestScanner_sampleDb_Success(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleDb(ctx, meta.Database)
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleDb(ctx, meta.Database, newScanReport(), out)
+	})
 	require.NoError(t, err)
 	// Order is not important and is actually non-deterministic due to concurrency
 	expected := []Sample{table1Sample, table2Sample}
@@ -226,7 +232,7 @@ func TestScanner_sampleDb_PartialError(t *testing.T) {
 		},
 	}
 
-	repo.EXPECT().Introspect(ctx, mock.Anything).Return(&meta, nil)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
 	sampleParams1 := SampleParameters{
 		Metadata: meta.Schemas["schema1"].Tables["table1"],
 	}
@@ -236,10 +242,10 @@ func TestScanner_sampleDb_PartialError(t *testing.T) {
 	sampleParamsForbidden := SampleParameters{
 		Metadata: meta.Schemas["schema2"].Tables["table2"],
 	}
-	repo.EXPECT().SampleTable(ctx, sampleParams1).Return(table1Sample, nil)
+	repo.EXPECT().SampleTable(mock.Anything, sampleParams1).Return(table1Sample, nil)
 	errForbidden := errors.New("forbidden table")
-	repo.EXPECT().SampleTable(ctx, sampleParamsForbidden).Return(Sample{}, errForbidden)
-	repo.EXPECT().SampleTable(ctx, sampleParams2).Return(table2Sample, nil)
+	repo.EXPECT().SampleTable(mock.Anything, sampleParamsForbidden).Return(Sample{}, errForbidden)
+	repo.EXPECT().SampleTable(mock.Anything, sampleParams2).Return(table2Sample, nil)
 	repo.EXPECT().Close().Return(nil)
 	repoType := "mock"
 	reg := NewRegistry()
@@ -256,18 +262,30 @@ func TestScanner_sampleDb_PartialError(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleDb(ctx, meta.Database)
+	report := newScanReport()
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleDb(ctx, meta.Database, report, out)
+	})
 	require.ErrorIs(t, err, errForbidden)
 	// Order is not important and is actually non-deterministic due to concurrency
 	expected := []Sample{table1Sample, table2Sample}
 	require.ElementsMatch(t, expected, samples)
+	failures, coverage := report.results()
+	require.Len(t, failures, 1)
+	require.Equal(t, scan.PhaseSample, failures[0].Phase)
+	require.Equal(t, errForbidden.Error(), failures[0].Message)
+	require.Equal(
+		t,
+		scan.Coverage{TablesDiscovered: 3, TablesSampled: 2, TablesFailed: 1},
+		coverage,
+	)
 }
 
 func TestScanner_sampleAllDbs_Error(t *testing.T) {
 	ctx := context.Background()
 	listDbErr := errors.New("error listing databases")
 	repo := NewMockRepository(t)
-	repo.EXPECT().ListDatabases(ctx).Return(nil, listDbErr)
+	repo.EXPECT().ListDatabases(mock.Anything).Return(nil, listDbErr)
 	repo.EXPECT().Close().Return(nil)
 	repoType := "mock"
 	reg := NewRegistry()
@@ -284,9 +302,58 @@ func TestScanner_sampleAllDbs_Error(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleAllDbs(ctx)
+	report := newScanReport()
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleAllDbs(ctx, report, out)
+	})
 	require.Nil(t, samples)
 	require.ErrorIs(t, err, listDbErr)
+	failures, _ := report.results()
+	require.Equal(
+		t,
+		[]scan.Failure{
+			{
+				Path:     []string{},
+				Phase:    scan.PhaseList,
+				Category: scan.ErrorCategoryUnknown,
+				Message:  listDbErr.Error(),
+			},
+		},
+		failures,
+	)
+}
+
+func TestScanner_sampleAllDbs_Retry(t *testing.T) {
+	ctx := context.Background()
+	transientErr := &pq.Error{Code: "53300"}
+	repo := NewMockRepository(t)
+	repo.EXPECT().ListDatabases(mock.Anything).Return(nil, transientErr).Once()
+	repo.EXPECT().ListDatabases(mock.Anything).Return([]string{}, nil).Once()
+	repo.EXPECT().Close().Return(nil)
+	s := newMockScanner(repo, nil, RepoConfig{})
+	s.retry = newRetryPolicy(&RetryConfig{MaxAttempts: 3})
+	s.retry.sleep = func(context.Context, time.Duration) error { return nil }
+	report := newScanReport()
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleAllDbs(ctx, report, out)
+	})
+	require.NoError(t, err)
+	require.Empty(t, samples)
+	failures, _ := report.results()
+	require.Empty(t, failures)
+	require.Equal(
+		t,
+		[]scan.Retry{
+			{
+				Path:      []string{},
+				Phase:     scan.PhaseList,
+				Attempts:  2,
+				Succeeded: true,
+				Message:   transientErr.Error(),
+			},
+		},
+		report.retried(),
+	)
 }
 
 func TestScanner_sampleAllDbs_Successful_TwoDatabases(t *testing.T) {
@@ -343,7 +410,9 @@ func TestScanner_sampleAllDbs_Successful_TwoDatabases(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleAllDbs(ctx)
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleAllDbs(ctx, newScanReport(), out)
+	})
 	require.NoError(t, err)
 	// Two databases should be sampled, and our mock will return the sample for
 	// each sample call. This really just asserts that we've sampled the correct
@@ -374,9 +443,20 @@ func TestScanner_sampleAllDbs_IntrospectError(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleAllDbs(ctx)
+	report := newScanReport()
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleAllDbs(ctx, report, out)
+	})
 	require.Empty(t, samples)
 	require.NoError(t, err)
+	// The introspection failure of each database is reported.
+	failures, _ := report.results()
+	require.Len(t, failures, 2)
+	for _, failure := range failures {
+		require.Equal(t, scan.PhaseIntrospect, failure.Phase)
+		require.Len(t, failure.Path, 1)
+	}
+	require.ElementsMatch(t, dbs, []string{failures[0].Path[0], failures[1].Path[0]})
 }
 
 func TestScanner_sampleAllDbs_SampleError(t *testing.T) {
@@ -426,7 +506,9 @@ func TestScanner_sampleAllDbs_SampleError(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleAllDbs(ctx)
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleAllDbs(ctx, newScanReport(), out)
+	})
 	require.NoError(t, err)
 	require.Empty(t, samples)
 }
@@ -487,14 +569,16 @@ func TestScanner_sampleAllDbs_TwoDatabases_OneSampleError(t *testing.T) {
 			Registry:   reg,
 		},
 	}
-	samples, err := s.sampleAllDbs(ctx)
+	samples, err := collectSamples(func(out chan<- tableSample) error {
+		return s.sampleAllDbs(ctx, newScanReport(), out)
+	})
 	require.NoError(t, err)
 	// Because of a single sample error, we expect only one database was
 	// sampled.
 	require.ElementsMatch(t, samples, []Sample{sample})
 }
 
-func TestScanner_classifySamples_SingleSample(t *testing.T) {
+func TestScanner_classifySample(t *testing.T) {
 	ctx := context.Background()
 	sample := Sample{
 		TablePath: []string{"db", "schema", "table"},
@@ -514,7 +598,7 @@ func TestScanner_classifySamples_SingleSample(t *testing.T) {
 	classifier := NewMockClassifier(t)
 	// Need to explicitly convert it to a map because Mockery isn't smart enough
 	// to infer the type.
-	classifier.EXPECT().Classify(ctx, map[string]any(sample.Results[0])).Return(
+	classifier.EXPECT().Classify(mock.Anything, map[string]any(sample.Results[0])).Return(
 		classification.Result{
 			"age":             lblSet("AGE"),
 			"social_sec_num":  lblSet("SSN"),
@@ -522,7 +606,7 @@ func TestScanner_classifySamples_SingleSample(t *testing.T) {
 		},
 		nil,
 	)
-	classifier.EXPECT().Classify(ctx, map[string]any(sample.Results[1])).Return(
+	classifier.EXPECT().Classify(mock.Anything, map[string]any(sample.Results[1])).Return(
 		classification.Result{
 			"age":             lblSet("AGE", "CVV"),
 			"credit_card_num": lblSet("CCN"),
@@ -545,16 +629,67 @@ func TestScanner_classifySamples_SingleSample(t *testing.T) {
 		},
 	}
 	s := Scanner{classifier: classifier}
-	actual, err := s.classifySamples(ctx, []Sample{sample})
+	actual, err := s.classifySample(ctx, sample, nil, newScanReport())
 	require.NoError(t, err)
 	require.ElementsMatch(t, expected, actual)
 }
 
-func TestScanner_classifySamples_MultipleSamples(t *testing.T) {
+func TestScanner_classifySample_Metadata(t *testing.T) {
 	ctx := context.Background()
+	meta := &TableMetadata{
+		Schema:  "schema",
+		Name:    "table",
+		Comment: "Customers",
+		Attributes: []*AttributeMetadata{
+			{Schema: "schema", Table: "table", Name: "tax_id", DataType: "varchar", Comment: "Customer tax id"},
+			{Schema: "schema", Table: "table", Name: "age", DataType: "integer"},
+		},
+	}
+	classifier := &metadataClassifier{
+		MockClassifier: NewMockClassifier(t),
+		result:         classification.Result{"tax_id": lblSet("SSN")},
+	}
+	s := Scanner{classifier: classifier}
+	// The metadata is classified even though the table is empty.
+	actual, err := s.classifySample(ctx, Sample{TablePath: []string{"db", "schema", "table"}}, meta, newScanReport())
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]classification.Classification{
+			{AttributePath: []string{"db", "schema", "table", "tax_id"}, Labels: lblSet("SSN")},
+		},
+		actual,
+	)
+	require.Equal(
+		t,
+		classification.TableMetadata{
+			Schema:  "schema",
+			Name:    "table",
+			Comment: "Customers",
+			Attributes: map[string]classification.AttributeMetadata{
+				"tax_id": {DataType: "varchar", Comment: "Customer tax id"},
+				"age":    {DataType: "integer"},
+			},
+		},
+		classifier.input,
+	)
+
+	// Tables without comments are not classified by their metadata.
+	classifier.input = classification.TableMetadata{}
+	meta.Comment = ""
+	meta.Attributes[0].Comment = ""
+	actual, err = s.classifySample(ctx, Sample{TablePath: []string{"db", "schema", "table"}}, meta, newScanReport())
+	require.NoError(t, err)
+	require.Empty(t, actual)
+	require.Empty(t, classifier.input.Name)
+}
+
+func TestScanner_Scan(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
 	samples := []Sample{
 		{
-			TablePath: []string{"db1", "schema1", "table1"},
+			TablePath: []string{"db", "schema1", "table1"},
 			Results: []SampleResult{
 				{
 					"age":             "52",
@@ -569,7 +704,7 @@ func TestScanner_classifySamples_MultipleSamples(t *testing.T) {
 			},
 		},
 		{
-			TablePath: []string{"db2", "schema2", "table2"},
+			TablePath: []string{"db", "schema2", "table2"},
 			Results: []SampleResult{
 				{
 					"fullname": "John Doe",
@@ -579,11 +714,22 @@ func TestScanner_classifySamples_MultipleSamples(t *testing.T) {
 			},
 		},
 	}
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema1"].Tables["table1"]},
+	).Return(samples[0], nil)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema2"].Tables["table2"]},
+	).Return(samples[1], nil)
+	repo.EXPECT().Close().Return(nil)
 
 	classifier := NewMockClassifier(t)
 	// Need to explicitly convert it to a map because Mockery isn't smart enough
 	// to infer the type.
-	classifier.EXPECT().Classify(ctx, map[string]any(samples[0].Results[0])).Return(
+	classifier.EXPECT().Classify(mock.Anything, map[string]any(samples[0].Results[0])).Return(
 		classification.Result{
 			"age":             lblSet("AGE"),
 			"social_sec_num":  lblSet("SSN"),
@@ -591,14 +737,14 @@ func TestScanner_classifySamples_MultipleSamples(t *testing.T) {
 		},
 		nil,
 	)
-	classifier.EXPECT().Classify(ctx, map[string]any(samples[0].Results[1])).Return(
+	classifier.EXPECT().Classify(mock.Anything, map[string]any(samples[0].Results[1])).Return(
 		classification.Result{
 			"age":             lblSet("AGE", "CVV"),
 			"credit_card_num": lblSet("CCN"),
 		},
 		nil,
 	)
-	classifier.EXPECT().Classify(ctx, map[string]any(samples[1].Results[0])).Return(
+	classifier.EXPECT().Classify(mock.Anything, map[string]any(samples[1].Results[0])).Return(
 		classification.Result{
 			"fullname": lblSet("FULL_NAME"),
 			"dob":      lblSet("DOB"),
@@ -628,10 +774,713 @@ func TestScanner_classifySamples_MultipleSamples(t *testing.T) {
 			Labels:        lblSet("DOB"),
 		},
 	}
-	s := Scanner{classifier: classifier}
-	actual, err := s.classifySamples(ctx, samples)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	results, err := s.Scan(ctx)
 	require.NoError(t, err)
-	require.ElementsMatch(t, expected, actual)
+	require.ElementsMatch(t, expected, results.Classifications)
+	require.Empty(t, results.Failures)
+	require.Equal(t, scan.Coverage{TablesDiscovered: 2, TablesSampled: 2}, results.Coverage)
+}
+
+func TestScanner_Scan_ClassifyError(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	sample := Sample{
+		TablePath: []string{"db", "schema", "table"},
+		Results:   []SampleResult{{"attr": "foo"}},
+	}
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+	// The scan may be aborted before the second table is sampled.
+	repo.EXPECT().SampleTable(mock.Anything, mock.Anything).Return(sample, nil).Maybe()
+	repo.EXPECT().Close().Return(nil)
+	classifyErr := errors.New("classify error")
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(nil, classifyErr)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	results, err := s.Scan(ctx)
+	require.ErrorIs(t, err, classifyErr)
+	require.Nil(t, results)
+}
+
+func TestScanner_ScanStream(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	sample := Sample{
+		TablePath: []string{"db", "schema1", "table1"},
+		Results:   []SampleResult{{"attr": "foo"}},
+	}
+	sampleErr := errors.New("sample error")
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema1"].Tables["table1"]},
+	).Return(sample, nil)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema2"].Tables["table2"]},
+	).Return(Sample{}, sampleErr)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"attr": lblSet("FOO")},
+		nil,
+	)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	var events []Event
+	for evt := range s.ScanStream(ctx) {
+		events = append(events, evt)
+	}
+	require.Len(t, events, 3)
+	// The order of the table and failure events is non-deterministic, but the
+	// done event is always last.
+	var classified, failed int
+	for _, evt := range events[:2] {
+		switch evt.Type {
+		case EventTableClassified:
+			classified++
+			require.Equal(t, sample.TablePath, evt.TablePath)
+			require.Equal(
+				t,
+				[]classification.Classification{
+					{
+						AttributePath: []string{"db", "schema1", "table1", "attr"},
+						Labels:        lblSet("FOO"),
+					},
+				},
+				evt.Classifications,
+			)
+		case EventFailure:
+			failed++
+			require.Equal(t, []string{"db", "schema2", "table2"}, evt.Failure.Path)
+			require.Equal(t, scan.PhaseSample, evt.Failure.Phase)
+		}
+	}
+	require.Equal(t, 1, classified)
+	require.Equal(t, 1, failed)
+	done := events[2]
+	require.Equal(t, EventDone, done.Type)
+	require.NoError(t, done.Err)
+	require.Len(t, done.Failures, 1)
+	require.Equal(
+		t,
+		scan.Coverage{TablesDiscovered: 2, TablesSampled: 1, TablesFailed: 1},
+		done.Coverage,
+	)
+}
+
+func TestScanner_ScanStream_BoundedSamples(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const numTables = 50
+	meta := Metadata{
+		Database: "db",
+		Schemas: map[string]*SchemaMetadata{
+			"schema": {Name: "schema", Tables: make(map[string]*TableMetadata, numTables)},
+		},
+	}
+	for i := 0; i < numTables; i++ {
+		name := fmt.Sprintf("table%d", i)
+		meta.Schemas["schema"].Tables[name] = &TableMetadata{Schema: "schema", Name: name}
+	}
+	var sampled atomic.Int64
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+	repo.EXPECT().SampleTable(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, params SampleParameters) (Sample, error) {
+			sampled.Add(1)
+			return Sample{
+				TablePath: []string{"db", params.Metadata.Schema, params.Metadata.Name},
+				Results:   []SampleResult{{"attr": "foo"}},
+			}, nil
+		},
+	)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"attr": lblSet("FOO")},
+		nil,
+	)
+	// MaxConcurrency is unset, so the tables are sampled on at most
+	// MaxOpenConns goroutines.
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db", MaxOpenConns: 3})
+	s.config.ClassifyWorkers = 1
+	events := s.ScanStream(ctx)
+	// While the events aren't consumed, the samples are held by the sampling
+	// goroutines, the buffer of the classification channel, and the workers
+	// blocked on emitting their event.
+	const maxInFlight = 3 + 1 + 1
+	require.Eventually(
+		t,
+		func() bool { return sampled.Load() == maxInFlight },
+		time.Second,
+		time.Millisecond,
+	)
+	require.Never(
+		t,
+		func() bool { return sampled.Load() > maxInFlight },
+		100*time.Millisecond,
+		time.Millisecond,
+	)
+	var classified int
+	for evt := range events {
+		if evt.Type == EventTableClassified {
+			classified++
+		}
+		if evt.Type == EventDone {
+			require.NoError(t, evt.Err)
+		}
+	}
+	require.Equal(t, numTables, classified)
+	require.EqualValues(t, numTables, sampled.Load())
+}
+
+func TestScanner_Scan_Resume(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	resumed := []classification.Classification{
+		{
+			AttributePath: []string{"db", "schema1", "table1", "ssn"},
+			Labels:        lblSet("SSN"),
+		},
+	}
+	fname := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	// The checkpoint was written by a scan with the same identity as the
+	// scanner below.
+	identity := newCheckpointIdentity(ScannerConfig{RepoType: "mock", RepoConfig: RepoConfig{Database: "db"}})
+	cp, _, err := openCheckpoint(fname, identity, false)
+	require.NoError(t, err)
+	require.NoError(t, cp.write(checkpointRecord{TablePath: []string{"db", "schema1", "table1"}, Classifications: resumed}))
+	require.NoError(t, cp.Close())
+
+	sample := Sample{
+		TablePath: []string{"db", "schema2", "table2"},
+		Results:   []SampleResult{{"dob": "2000-01-01"}},
+	}
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+	// Only the table which isn't in the checkpoint is sampled.
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema2"].Tables["table2"]},
+	).Return(sample, nil)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"dob": lblSet("DOB")},
+		nil,
+	)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	s.config.CheckpointFilename = fname
+	s.config.Resume = true
+	results, err := s.Scan(ctx)
+	require.NoError(t, err)
+	expected := append(
+		resumed,
+		classification.Classification{
+			AttributePath: []string{"db", "schema2", "table2", "dob"},
+			Labels:        lblSet("DOB"),
+		},
+	)
+	require.ElementsMatch(t, expected, results.Classifications)
+	require.Equal(
+		t,
+		scan.Coverage{TablesDiscovered: 2, TablesSampled: 1, TablesResumed: 1},
+		results.Coverage,
+	)
+	// The newly scanned table is added to the checkpoint.
+	_, records, _, err := readCheckpoint(fname)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, sample.TablePath, records[1].TablePath)
+}
+
+func TestScanner_Scan_Incremental(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	meta.Schemas["schema1"].Tables["table1"].Attributes = []*AttributeMetadata{
+		{Schema: "schema1", Table: "table1", Name: "ssn", DataType: "varchar"},
+	}
+	meta.Schemas["schema2"].Tables["table2"].Attributes = []*AttributeMetadata{
+		{Schema: "schema2", Table: "table2", Name: "dob", DataType: "date"},
+	}
+	previous := []classification.Classification{
+		{
+			AttributePath: []string{"db", "schema1", "table1", "ssn"},
+			Labels:        lblSet("SSN"),
+		},
+	}
+	// The previous scan recorded both tables, but table2 has changed since.
+	dir := t.TempDir()
+	previousFname := filepath.Join(dir, "previous.jsonl")
+	identity := newCheckpointIdentity(newMockScanner(nil, nil, RepoConfig{Database: "db"}).config)
+	cp, _, err := openCheckpoint(previousFname, identity, false)
+	require.NoError(t, err)
+	require.NoError(
+		t,
+		cp.write(
+			checkpointRecord{
+				TablePath:       []string{"db", "schema1", "table1"},
+				Classifications: previous,
+				tableState: tableState{
+					Fingerprint:     tableFingerprint(meta.Schemas["schema1"].Tables["table1"]),
+					ChangeIndicator: "1",
+				},
+			},
+		),
+	)
+	require.NoError(
+		t,
+		cp.write(
+			checkpointRecord{
+				TablePath:       []string{"db", "schema2", "table2"},
+				Classifications: []classification.Classification{},
+				tableState: tableState{
+					Fingerprint:     tableFingerprint(meta.Schemas["schema2"].Tables["table2"]),
+					ChangeIndicator: "1",
+				},
+			},
+		),
+	)
+	require.NoError(t, cp.Close())
+
+	sample := Sample{
+		TablePath: []string{"db", "schema2", "table2"},
+		Results:   []SampleResult{{"dob": "2000-01-01"}},
+	}
+	repo := &changeTrackingRepository{
+		MockRepository: NewMockRepository(t),
+		indicators: map[string]map[string]string{
+			"schema1": {"table1": "1"},
+			"schema2": {"table2": "2"},
+		},
+	}
+	repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+	// Only the changed table is sampled.
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema2"].Tables["table2"]},
+	).Return(sample, nil)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"dob": lblSet("DOB")},
+		nil,
+	)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	s.config.IncrementalFrom = previousFname
+	s.config.CheckpointFilename = filepath.Join(dir, "current.jsonl")
+	results, err := s.Scan(ctx)
+	require.NoError(t, err)
+	expected := append(
+		previous,
+		classification.Classification{
+			AttributePath: []string{"db", "schema2", "table2", "dob"},
+			Labels:        lblSet("DOB"),
+		},
+	)
+	require.ElementsMatch(t, expected, results.Classifications)
+	require.Equal(
+		t,
+		scan.Coverage{TablesDiscovered: 2, TablesSampled: 1, TablesUnchanged: 1},
+		results.Coverage,
+	)
+	// The new checkpoint records the state of both tables, so that it can be
+	// used as the baseline of the next incremental scan.
+	_, records, _, err := readCheckpoint(s.config.CheckpointFilename)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		require.NotEmpty(t, record.Fingerprint)
+		require.Equal(t, repo.indicators[record.TablePath[1]][record.TablePath[2]], record.ChangeIndicator)
+	}
+}
+
+func TestScanner_Scan_Incremental_ConfigChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *ScannerConfig)
+	}{
+		{
+			name:   "labels",
+			change: func(cfg *ScannerConfig) { cfg.LabelsYamlFilename = "labels.yaml" },
+		},
+		{
+			name:   "sample size",
+			change: func(cfg *ScannerConfig) { cfg.SampleSize = 100 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				meta := twoTableMetadata()
+				repo := &changeTrackingRepository{
+					MockRepository: NewMockRepository(t),
+					indicators: map[string]map[string]string{
+						"schema1": {"table1": "1"},
+						"schema2": {"table2": "1"},
+					},
+				}
+				classifier := NewMockClassifier(t)
+				s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+				// The previous scan recorded both tables, which are unchanged
+				// since, but it was run with another configuration.
+				previousFname := filepath.Join(t.TempDir(), "previous.jsonl")
+				cfg := s.config
+				tt.change(&cfg)
+				cp, _, err := openCheckpoint(previousFname, newCheckpointIdentity(cfg), false)
+				require.NoError(t, err)
+				for _, schema := range meta.Schemas {
+					for _, table := range schema.Tables {
+						require.NoError(
+							t,
+							cp.write(
+								checkpointRecord{
+									TablePath:       []string{"db", table.Schema, table.Name},
+									Classifications: []classification.Classification{},
+									tableState: tableState{
+										Fingerprint:     tableFingerprint(table),
+										ChangeIndicator: "1",
+									},
+								},
+							),
+						)
+					}
+				}
+				require.NoError(t, cp.Close())
+
+				repo.EXPECT().Introspect(mock.Anything, mock.Anything).Return(&meta, nil)
+				// Both tables are sampled again.
+				for _, schema := range meta.Schemas {
+					for _, table := range schema.Tables {
+						repo.EXPECT().SampleTable(mock.Anything, SampleParameters{Metadata: table}).Return(
+							Sample{
+								TablePath: []string{"db", table.Schema, table.Name},
+								Results:   []SampleResult{{"ssn": "512-23-4258"}},
+							},
+							nil,
+						)
+					}
+				}
+				repo.EXPECT().Close().Return(nil)
+				classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+					classification.Result{"ssn": lblSet("SSN")},
+					nil,
+				)
+				s.config.IncrementalFrom = previousFname
+				results, err := s.Scan(ctx)
+				require.NoError(t, err)
+				require.Equal(t, scan.Coverage{TablesDiscovered: 2, TablesSampled: 2}, results.Coverage)
+			},
+		)
+	}
+}
+
+func TestScanner_Scan_TableStats(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	meta.Schemas["schema1"].Tables["table1"].Stats = &TableStats{RowCount: 200000000, SizeBytes: 1 << 30}
+	meta.Schemas["schema2"].Tables["table2"].Stats = &TableStats{RowCount: 0, Exact: true}
+	sample := Sample{
+		TablePath: []string{"db", "schema1", "table1"},
+		Results:   []SampleResult{{"ssn": "512-23-4258"}},
+	}
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, IntrospectParameters{CollectStats: true}).Return(&meta, nil)
+	// The empty table isn't sampled.
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema1"].Tables["table1"]},
+	).Return(sample, nil)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"ssn": lblSet("SSN")},
+		nil,
+	)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	s.config.CollectTableStats = true
+	results, err := s.Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]classification.Classification{
+			{
+				AttributePath: []string{"db", "schema1", "table1", "ssn"},
+				Labels:        lblSet("SSN"),
+			},
+		},
+		results.Classifications,
+	)
+	require.ElementsMatch(
+		t,
+		[]scan.TableStats{
+			{Path: []string{"db", "schema1", "table1"}, RowCount: 200000000, SizeBytes: 1 << 30},
+			{Path: []string{"db", "schema2", "table2"}, RowCount: 0},
+		},
+		results.TableStats,
+	)
+	require.Equal(
+		t,
+		scan.Coverage{TablesDiscovered: 2, TablesSampled: 1, TablesEmpty: 1},
+		results.Coverage,
+	)
+}
+
+func TestScanner_Scan_TableStats_Estimated(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	// The estimated row count of a never analyzed table may be zero.
+	meta.Schemas["schema1"].Tables["table1"].Stats = &TableStats{RowCount: 0}
+	sample := Sample{
+		TablePath: []string{"db", "schema1", "table1"},
+		Results:   []SampleResult{{"ssn": "512-23-4258"}},
+	}
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, IntrospectParameters{CollectStats: true}).Return(&meta, nil)
+	// The table estimated to be empty is still sampled.
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema1"].Tables["table1"]},
+	).Return(sample, nil)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema2"].Tables["table2"]},
+	).Return(Sample{}, nil)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"ssn": lblSet("SSN")},
+		nil,
+	)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	s.config.CollectTableStats = true
+	results, err := s.Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]classification.Classification{
+			{
+				AttributePath: []string{"db", "schema1", "table1", "ssn"},
+				Labels:        lblSet("SSN"),
+			},
+		},
+		results.Classifications,
+	)
+	require.Equal(
+		t,
+		scan.Coverage{TablesDiscovered: 2, TablesSampled: 1, TablesEmpty: 1},
+		results.Coverage,
+	)
+}
+
+func TestScanner_Scan_Relationships(t *testing.T) {
+	ctx := context.Background()
+	meta := twoTableMetadata()
+	meta.Schemas["schema2"].Tables["table2"].ForeignKeys = []ForeignKey{
+		{
+			Name:              "table2_user_fkey",
+			Columns:           []string{"user_id"},
+			ReferencedSchema:  "schema1",
+			ReferencedTable:   "table1",
+			ReferencedColumns: []string{"id"},
+		},
+	}
+	repo := NewMockRepository(t)
+	repo.EXPECT().Introspect(mock.Anything, IntrospectParameters{CollectKeys: true}).Return(&meta, nil)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema1"].Tables["table1"]},
+	).Return(
+		Sample{
+			TablePath: []string{"db", "schema1", "table1"},
+			Results:   []SampleResult{{"id": 1, "ssn": "512-23-4258"}},
+		},
+		nil,
+	)
+	repo.EXPECT().SampleTable(
+		mock.Anything,
+		SampleParameters{Metadata: meta.Schemas["schema2"].Tables["table2"]},
+	).Return(
+		Sample{
+			TablePath: []string{"db", "schema2", "table2"},
+			Results:   []SampleResult{{"user_id": 1}},
+		},
+		nil,
+	)
+	repo.EXPECT().Close().Return(nil)
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, input map[string]any) (classification.Result, error) {
+			if _, ok := input["ssn"]; ok {
+				return classification.Result{"ssn": lblSet("SSN")}, nil
+			}
+			return classification.Result{}, nil
+		},
+	)
+	s := newMockScanner(repo, classifier, RepoConfig{Database: "db"})
+	s.config.CollectRelationships = true
+	results, err := s.Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]scan.Relationship{
+			{
+				Name:                "table2_user_fkey",
+				TablePath:           []string{"db", "schema2", "table2"},
+				Columns:             []string{"user_id"},
+				ReferencedTablePath: []string{"db", "schema1", "table1"},
+				ReferencedColumns:   []string{"id"},
+				LinkedLabels:        lblSet("SSN"),
+			},
+		},
+		results.Relationships,
+	)
+	require.Equal(
+		t,
+		[]scan.LinkedColumn{
+			{
+				AttributePath:       []string{"db", "schema2", "table2", "user_id"},
+				ReferencedTablePath: []string{"db", "schema1", "table1"},
+				LinkedLabels:        lblSet("SSN"),
+			},
+		},
+		results.LinkedColumns,
+	)
+}
+
+func TestTableFingerprint(t *testing.T) {
+	table := &TableMetadata{
+		Schema: "schema",
+		Name:   "table",
+		Attributes: []*AttributeMetadata{
+			{Name: "a", DataType: "int"},
+			{Name: "b", DataType: "varchar"},
+		},
+	}
+	fingerprint := tableFingerprint(table)
+	require.Equal(t, fingerprint, tableFingerprint(table))
+	changedType := &TableMetadata{
+		Attributes: []*AttributeMetadata{
+			{Name: "a", DataType: "bigint"},
+			{Name: "b", DataType: "varchar"},
+		},
+	}
+	require.NotEqual(t, fingerprint, tableFingerprint(changedType))
+	ambiguous := &TableMetadata{
+		Attributes: []*AttributeMetadata{
+			{Name: "ai", DataType: "nt"},
+			{Name: "b", DataType: "varchar"},
+		},
+	}
+	require.NotEqual(t, fingerprint, tableFingerprint(ambiguous))
+	commented := &TableMetadata{
+		Attributes: []*AttributeMetadata{
+			{Name: "a", DataType: "int", Comment: "Customer SSN"},
+			{Name: "b", DataType: "varchar"},
+		},
+	}
+	require.NotEqual(t, fingerprint, tableFingerprint(commented))
+	tableCommented := &TableMetadata{
+		Comment:    "Customers",
+		Attributes: table.Attributes,
+	}
+	require.NotEqual(t, fingerprint, tableFingerprint(tableCommented))
+	view := &TableMetadata{
+		ObjectType: ObjectTypeView,
+		Attributes: table.Attributes,
+	}
+	require.NotEqual(t, fingerprint, tableFingerprint(view))
+	materializedView := &TableMetadata{
+		ObjectType: ObjectTypeMaterializedView,
+		Attributes: table.Attributes,
+	}
+	require.NotEqual(t, tableFingerprint(view), tableFingerprint(materializedView))
+}
+
+// metadataClassifier is a mock Classifier which also implements
+// classification.MetadataClassifier. It records the last classified metadata.
+type metadataClassifier struct {
+	*MockClassifier
+	result classification.Result
+	input  classification.TableMetadata
+}
+
+func (c *metadataClassifier) ClassifyMetadata(
+	_ context.Context,
+	input classification.TableMetadata,
+) (classification.Result, error) {
+	c.input = input
+	return c.result, nil
+}
+
+// changeTrackingRepository is a mock Repository which also implements
+// ChangeTracker.
+type changeTrackingRepository struct {
+	*MockRepository
+	indicators map[string]map[string]string
+}
+
+func (r *changeTrackingRepository) ChangeIndicators(context.Context) (map[string]map[string]string, error) {
+	return r.indicators, nil
+}
+
+func newMockScanner(repo Repository, classifier classification.Classifier, cfg RepoConfig) *Scanner {
+	repoType := "mock"
+	reg := NewRegistry()
+	reg.MustRegister(
+		repoType,
+		func(ctx context.Context, cfg RepoConfig) (Repository, error) {
+			return repo, nil
+		},
+	)
+	return &Scanner{
+		config: ScannerConfig{
+			RepoType:        repoType,
+			RepoConfig:      cfg,
+			Registry:        reg,
+			ClassifyWorkers: 2,
+		},
+		classifier: classifier,
+	}
+}
+
+func twoTableMetadata() Metadata {
+	return Metadata{
+		Database: "db",
+		Schemas: map[string]*SchemaMetadata{
+			"schema1": {
+				Name: "schema1",
+				Tables: map[string]*TableMetadata{
+					"table1": {Schema: "schema1", Name: "table1"},
+				},
+			},
+			"schema2": {
+				Name: "schema2",
+				Tables: map[string]*TableMetadata{
+					"table2": {Schema: "schema2", Name: "table2"},
+				},
+			},
+		},
+	}
+}
+
+// collectSamples calls fn with an out channel, and returns all the samples sent
+// to the channel along with the error returned by fn.
+func collectSamples(fn func(out chan<- tableSample) error) ([]Sample, error) {
+	out := make(chan tableSample)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(out)
+		errCh <- fn(out)
+	}()
+	var samples []Sample
+	for sample := range out {
+		samples = append(samples, sample.Sample)
+	}
+	return samples, <-errCh
 }
 
 func lblSet(labels ...string) classification.LabelSet {
@@ -0,0 +1,98 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sessionConnector is a driver.Connector which initializes each new connection
+// with session statements, which make the sessions read-only and set
+// server-side timeouts, so that the queries of the scanner can neither modify
+// the database nor keep running on the server after being cancelled.
+type sessionConnector struct {
+	connector  driver.Connector
+	statements []string
+}
+
+var _ driver.Connector = sessionConnector{}
+
+// Connect opens a new connection, and executes the session statements on it.
+// See driver.Connector for more details.
+func (c sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range c.statements {
+		if err := execSessionStatement(ctx, conn, stmt); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("error initializing session with %q: %w", stmt, err)
+		}
+	}
+	return conn, nil
+}
+
+// Driver returns the driver of the underlying connector. See driver.Connector
+// for more details.
+func (c sessionConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// execSessionStatement executes the given statement, which has no arguments,
+// on the given connection.
+func execSessionStatement(ctx context.Context, conn driver.Conn, stmt string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, stmt, nil)
+		if !errors.Is(err, driver.ErrSkip) {
+			return err
+		}
+	}
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if preparer, ok := conn.(driver.ConnPrepareContext); ok {
+		s, err = preparer.PrepareContext(ctx, stmt)
+	} else {
+		s, err = conn.Prepare(stmt)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = s.Close() }()
+	execer, ok := s.(driver.StmtExecContext)
+	if !ok {
+		return errors.New("driver does not support executing statements with a context")
+	}
+	_, err = execer.ExecContext(ctx, nil)
+	return err
+}
+
+// openSessionDB opens a database handle with the given connector, whose
+// connections are initialized with the given session statements (see
+// sessionConnector). The maxOpenConns parameter specifies the maximum number of
+// open connections to the database.
+func openSessionDB(connector driver.Connector, statements []string, maxOpenConns uint) *sql.DB {
+	if len(statements) > 0 {
+		connector = sessionConnector{connector: connector, statements: statements}
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(intFromUint(maxOpenConns))
+	return db
+}
+
+// timeoutMillis returns the given timeout in milliseconds, rounded up, so that
+// a positive timeout never becomes zero, which usually disables timeouts.
+func timeoutMillis(timeout time.Duration) int64 {
+	return int64((timeout + time.Millisecond - 1) / time.Millisecond)
+}
+
+// timeoutSeconds returns the given timeout in seconds, rounded up, so that a
+// positive timeout never becomes zero, which usually disables timeouts.
+func timeoutSeconds(timeout time.Duration) int64 {
+	return int64((timeout + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,197 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionConnector_Connect(t *testing.T) {
+	conn := &fakeSessionConn{}
+	connector := sessionConnector{
+		connector:  fakeSessionConnector{conn: conn},
+		statements: []string{"SET a = 1", "SET b = 2"},
+	}
+	got, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, conn, got)
+	require.Equal(t, []string{"SET a = 1", "SET b = 2"}, conn.executed)
+	require.False(t, conn.closed)
+}
+
+func TestSessionConnector_Connect_Error(t *testing.T) {
+	conn := &fakeSessionConn{failOn: "SET b = 2"}
+	connector := sessionConnector{
+		connector:  fakeSessionConnector{conn: conn},
+		statements: []string{"SET a = 1", "SET b = 2", "SET c = 3"},
+	}
+	_, err := connector.Connect(context.Background())
+	require.ErrorContains(t, err, `"SET b = 2"`)
+	require.Equal(t, []string{"SET a = 1"}, conn.executed)
+	require.True(t, conn.closed)
+}
+
+func TestSessionConnector_Connect_Prepare(t *testing.T) {
+	conn := &fakeSessionConn{skipExec: true}
+	connector := sessionConnector{
+		connector:  fakeSessionConnector{conn: conn},
+		statements: []string{"SET a = 1"},
+	}
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"SET a = 1"}, conn.executed)
+}
+
+func TestSessionStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      func(time.Duration) []string
+		timeout time.Duration
+		want    []string
+	}{
+		{
+			name:    "postgres",
+			fn:      postgresSessionStatements,
+			timeout: 1500 * time.Microsecond,
+			want: []string{
+				"SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY",
+				"SET statement_timeout = 2",
+				"SET lock_timeout = 2",
+			},
+		},
+		{
+			name: "postgres without timeout",
+			fn:   postgresSessionStatements,
+			want: []string{"SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY"},
+		},
+		{
+			name:    "redshift",
+			fn:      redshiftSessionStatements,
+			timeout: time.Minute,
+			want:    []string{"SET statement_timeout = 60000"},
+		},
+		{
+			name: "redshift without timeout",
+			fn:   redshiftSessionStatements,
+		},
+		{
+			name:    "mysql",
+			fn:      mySqlSessionStatements,
+			timeout: 1500 * time.Millisecond,
+			want: []string{
+				"SET SESSION TRANSACTION READ ONLY",
+				"SET SESSION max_execution_time = 1500",
+				"SET SESSION lock_wait_timeout = 2",
+				"SET SESSION innodb_lock_wait_timeout = 2",
+			},
+		},
+		{
+			name:    "sqlserver",
+			fn:      sqlServerSessionStatements,
+			timeout: 30 * time.Second,
+			want:    []string{"SET LOCK_TIMEOUT 30000"},
+		},
+		{
+			name:    "snowflake",
+			fn:      snowflakeSessionStatements,
+			timeout: 30 * time.Second,
+			want: []string{
+				"ALTER SESSION SET STATEMENT_TIMEOUT_IN_SECONDS = 30",
+				"ALTER SESSION SET LOCK_TIMEOUT = 30",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				require.Equal(t, tt.want, tt.fn(tt.timeout))
+			},
+		)
+	}
+}
+
+// fakeSessionConnector is a driver.Connector which returns the given
+// connection.
+type fakeSessionConnector struct {
+	conn driver.Conn
+}
+
+func (c fakeSessionConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c fakeSessionConnector) Driver() driver.Driver {
+	return &fakeDriver{}
+}
+
+// fakeSessionConn is a driver.Conn which records the statements executed on
+// it, and fails to execute the failOn statement. If skipExec is set, the
+// statements are executed through prepared statements.
+type fakeSessionConn struct {
+	failOn   string
+	skipExec bool
+	executed []string
+	closed   bool
+}
+
+func (c *fakeSessionConn) ExecContext(
+	_ context.Context,
+	query string,
+	_ []driver.NamedValue,
+) (driver.Result, error) {
+	if c.skipExec {
+		return nil, driver.ErrSkip
+	}
+	return c.exec(query)
+}
+
+func (c *fakeSessionConn) exec(query string) (driver.Result, error) {
+	if query == c.failOn {
+		return nil, errors.New("dummy error")
+	}
+	c.executed = append(c.executed, query)
+	return driver.ResultNoRows, nil
+}
+
+func (c *fakeSessionConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSessionStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeSessionConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeSessionConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+// fakeSessionStmt is a prepared statement of a fakeSessionConn.
+type fakeSessionStmt struct {
+	conn  *fakeSessionConn
+	query string
+}
+
+func (s *fakeSessionStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSessionStmt) NumInput() int {
+	return 0
+}
+
+func (s *fakeSessionStmt) Exec(_ []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeSessionStmt) ExecContext(_ context.Context, _ []driver.NamedValue) (driver.Result, error) {
+	return s.conn.exec(s.query)
+}
+
+func (s *fakeSessionStmt) Query(_ []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not implemented")
+}
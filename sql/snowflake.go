@@ -2,10 +2,18 @@ package sql
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	// Snowflake DB driver
-	_ "github.com/snowflakedb/gosnowflake"
+	"github.com/snowflakedb/gosnowflake"
 )
 
 const (
@@ -18,11 +26,62 @@ FROM
 WHERE 
     IS_TRANSIENT = 'NO'
 `
-	configAccount   = "account"
-	configRole      = "role"
-	configWarehouse = "warehouse"
+	// snowflakeIntrospectQuery extends the generic introspection query with the
+	// column and table comments.
+	snowflakeIntrospectQuery = "SELECT " +
+		genericIntrospectColumns + ", " +
+		"c.comment AS column_comment, " +
+		"t.comment AS table_comment" +
+		genericIntrospectFrom +
+		genericIntrospectWhere
+	snowflakeStatsQuery = `
+SELECT
+    TABLE_SCHEMA,
+    TABLE_NAME,
+    ROW_COUNT,
+    BYTES
+FROM
+    INFORMATION_SCHEMA.TABLES
+WHERE
+    TABLE_TYPE = 'BASE TABLE'
+`
+	// snowflakeLoadQuery counts the recent queries which are queued, e.g.
+	// because their warehouse is overloaded, or blocked by a lock.
+	snowflakeLoadQuery = `
+SELECT
+    COUNT(*)
+FROM
+    TABLE(INFORMATION_SCHEMA.QUERY_HISTORY(RESULT_LIMIT => 1000))
+WHERE
+    EXECUTION_STATUS IN ('QUEUED', 'BLOCKED')
+`
+	snowflakeChangeIndicatorQuery = `
+SELECT
+    TABLE_SCHEMA,
+    TABLE_NAME,
+    TO_VARCHAR(LAST_ALTERED)
+FROM
+    INFORMATION_SCHEMA.TABLES
+WHERE
+    TABLE_SCHEMA <> 'INFORMATION_SCHEMA'
+`
+	configAccount              = "account"
+	configRole                 = "role"
+	configWarehouse            = "warehouse"
+	configPrivateKeyFile       = "private-key-file"
+	configPrivateKeyPassphrase = "private-key-passphrase"
+	configOAuthToken           = "oauth-token"
+	configOAuthTokenFile       = "oauth-token-file"
 )
 
+// snowflakePathFilter pushes the path filters down into the introspection
+// query. LIKE is case-sensitive in Snowflake, unlike ILIKE.
+var snowflakePathFilter = &PathFilterDialect{
+	PathExpr:      pipesPathExpr,
+	Placeholder:   questionPlaceholder,
+	CaseSensitive: true,
+}
+
 // SnowflakeRepository is a Repository implementation for Snowflake databases.
 type SnowflakeRepository struct {
 	// The majority of the Repository functionality is delegated to
@@ -30,8 +89,12 @@ type SnowflakeRepository struct {
 	generic *GenericRepository
 }
 
-// SnowflakeRepository implements Repository
-var _ Repository = (*SnowflakeRepository)(nil)
+// SnowflakeRepository implements Repository, ChangeTracker and LoadReporter
+var (
+	_ Repository    = (*SnowflakeRepository)(nil)
+	_ ChangeTracker = (*SnowflakeRepository)(nil)
+	_ LoadReporter  = (*SnowflakeRepository)(nil)
+)
 
 // NewSnowflakeRepository creates a new SnowflakeRepository.
 func NewSnowflakeRepository(cfg RepoConfig) (*SnowflakeRepository, error) {
@@ -39,25 +102,24 @@ func NewSnowflakeRepository(cfg RepoConfig) (*SnowflakeRepository, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error parsing snowflake config: %w", err)
 	}
+	if cfg.SSHTunnel != nil {
+		return nil, errors.New("ssh tunnels are not supported by snowflake repositories")
+	}
 	database := cfg.Database
 	// Connect to the default database, if unspecified.
 	if database == "" {
 		database = "SNOWFLAKE"
 	}
-	connStr := fmt.Sprintf(
-		"%s:%s@%s/%s?role=%s&warehouse=%s",
-		cfg.User,
-		cfg.Password,
-		snowflakeCfg.Account,
-		cfg.Database,
-		snowflakeCfg.Role,
-		snowflakeCfg.Warehouse,
-	)
-	generic, err := NewGenericRepository(RepoTypeSnowflake, database, connStr, cfg.MaxOpenConns)
+	driverCfg, err := snowflakeDriverConfig(cfg, snowflakeCfg)
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
-	return &SnowflakeRepository{generic: generic}, nil
+	db := openSessionDB(
+		&snowflakeConnector{cfg: *driverCfg, tokenFile: snowflakeCfg.OAuthTokenFile},
+		snowflakeSessionStatements(cfg.QueryTimeout),
+		cfg.MaxOpenConns,
+	)
+	return &SnowflakeRepository{generic: NewGenericRepositoryFromDB(RepoTypeSnowflake, database, db)}, nil
 }
 
 // ListDatabases returns a list of the names of all databases on the server by
@@ -67,11 +129,21 @@ func (r *SnowflakeRepository) ListDatabases(ctx context.Context) ([]string, erro
 	return r.generic.ListDatabasesWithQuery(ctx, snowflakeDatabaseQuery)
 }
 
-// Introspect delegates introspection to GenericRepository. See
-// Repository.Introspect and GenericRepository.IntrospectWithQuery for more
-// details.
+// Introspect delegates introspection to GenericRepository, using
+// Snowflake-specific introspection and table statistics queries based on
+// INFORMATION_SCHEMA, which include the column and table comments.
+// Key constraints are not collected, since Snowflake only exposes them through
+// SHOW commands. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
 func (r *SnowflakeRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.Introspect(ctx, params)
+	queries := IntrospectQueries{
+		Introspect: snowflakeIntrospectQuery,
+		Stats:      snowflakeStatsQuery,
+		// Snowflake maintains the row counts of the tables in their metadata.
+		ExactStats: true,
+		PathFilter: snowflakePathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
 }
 
 // SampleTable delegates sampling to GenericRepository. See
@@ -83,6 +155,21 @@ func (r *SnowflakeRepository) SampleTable(
 	return r.generic.SampleTable(ctx, params)
 }
 
+// Load returns the current load of the database, i.e. the number of recent
+// queries which are queued or blocked. See LoadReporter and
+// GenericRepository.LoadWithQuery for more details.
+func (r *SnowflakeRepository) Load(ctx context.Context) (float64, error) {
+	return r.generic.LoadWithQuery(ctx, snowflakeLoadQuery)
+}
+
+// ChangeIndicators returns the change indicators of the tables of the database,
+// derived from the time they were last altered by a DDL or DML operation. See
+// ChangeTracker and GenericRepository.ChangeIndicatorsWithQuery for more
+// details.
+func (r *SnowflakeRepository) ChangeIndicators(ctx context.Context) (map[string]map[string]string, error) {
+	return r.generic.ChangeIndicatorsWithQuery(ctx, snowflakeChangeIndicatorQuery)
+}
+
 // Ping delegates the ping to GenericRepository. See Repository.Ping and
 // GenericRepository.Ping for more details.
 func (r *SnowflakeRepository) Ping(ctx context.Context) error {
@@ -103,6 +190,129 @@ type SnowflakeConfig struct {
 	Role string
 	// Warehouse is the Snowflake warehouse name.
 	Warehouse string
+	// PrivateKeyFile is the path of the PEM private key of the user, to
+	// authenticate with key-pair (JWT) authentication instead of a password.
+	// PKCS#1 and PKCS#8 RSA keys are supported, including PKCS#8 keys
+	// encrypted with PrivateKeyPassphrase.
+	PrivateKeyFile string
+	// PrivateKeyPassphrase is the passphrase of the private key, if it is
+	// encrypted.
+	PrivateKeyPassphrase string
+	// OAuthToken is an OAuth access token to authenticate with instead of a
+	// password.
+	OAuthToken string
+	// OAuthTokenFile is the path of a file containing an OAuth access token to
+	// authenticate with instead of a password. The file is read each time a
+	// connection is opened, so that the token can be rotated during a scan.
+	OAuthTokenFile string
+}
+
+// snowflakeConnector is a driver.Connector which opens the connections with the
+// given Snowflake driver configuration. If tokenFile is set, the OAuth token of
+// each connection is read from it.
+type snowflakeConnector struct {
+	cfg       gosnowflake.Config
+	tokenFile string
+}
+
+var _ driver.Connector = (*snowflakeConnector)(nil)
+
+// Connect opens a new connection. See driver.Connector for more details.
+func (c *snowflakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	cfg := c.cfg
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snowflake oauth token file: %w", err)
+		}
+		cfg.Token = strings.TrimSpace(string(token))
+	}
+	return gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, cfg).Connect(ctx)
+}
+
+// Driver returns the Snowflake driver. See driver.Connector for more details.
+func (c *snowflakeConnector) Driver() driver.Driver {
+	return gosnowflake.SnowflakeDriver{}
+}
+
+// snowflakeDriverConfig returns the Snowflake driver configuration of the given
+// configuration. The user is authenticated with the private key or the OAuth
+// token of the Snowflake configuration if any, and with the password
+// otherwise.
+func snowflakeDriverConfig(cfg RepoConfig, snowflakeCfg SnowflakeConfig) (*gosnowflake.Config, error) {
+	driverCfg := &gosnowflake.Config{
+		Account:   snowflakeCfg.Account,
+		User:      cfg.User,
+		Password:  cfg.Password,
+		Database:  cfg.Database,
+		Role:      snowflakeCfg.Role,
+		Warehouse: snowflakeCfg.Warehouse,
+	}
+	switch {
+	case snowflakeCfg.PrivateKeyFile != "":
+		if cfg.Password != "" {
+			return nil, errors.New("snowflake password and private key are mutually exclusive")
+		}
+		pemBytes, err := os.ReadFile(snowflakeCfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snowflake private key file: %w", err)
+		}
+		key, err := parseSnowflakePrivateKey(pemBytes, snowflakeCfg.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing snowflake private key: %w", err)
+		}
+		driverCfg.Authenticator = gosnowflake.AuthTypeJwt
+		driverCfg.PrivateKey = key
+	case snowflakeCfg.OAuthToken != "" || snowflakeCfg.OAuthTokenFile != "":
+		if cfg.Password != "" {
+			return nil, errors.New("snowflake password and oauth token are mutually exclusive")
+		}
+		driverCfg.Authenticator = gosnowflake.AuthTypeOAuth
+		// The token file is read by snowflakeConnector.
+		driverCfg.Token = snowflakeCfg.OAuthToken
+	case cfg.Password == "":
+		return nil, errors.New("snowflake requires a password, a private key or an oauth token")
+	}
+	return driverCfg, nil
+}
+
+// parseSnowflakePrivateKey parses the given PEM RSA private key, which Snowflake
+// requires for key-pair authentication. PKCS#1 keys, and PKCS#8 keys encrypted
+// with the given passphrase or not, are supported.
+func parseSnowflakePrivateKey(pemBytes []byte, passphrase string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, errors.New("private key is encrypted, but no passphrase was provided")
+		}
+		der, decryptErr := decryptPKCS8(block.Bytes, []byte(passphrase))
+		if decryptErr != nil {
+			return nil, decryptErr
+		}
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	default:
+		return nil, fmt.Errorf("unsupported pem block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key must be an rsa key, got %T", key)
+	}
+	return rsaKey, nil
 }
 
 // NewSnowflakeConfigFromMap creates a new SnowflakeConfig from the given map.
@@ -121,9 +331,60 @@ func NewSnowflakeConfigFromMap(cfg map[string]any) (SnowflakeConfig, error) {
 	if err != nil {
 		return SnowflakeConfig{}, err
 	}
-	return SnowflakeConfig{
+	snowflakeCfg := SnowflakeConfig{
 		Account:   acct,
 		Role:      role,
 		Warehouse: warehouse,
-	}, nil
+	}
+	optional := []struct {
+		key string
+		val *string
+	}{
+		{key: configPrivateKeyFile, val: &snowflakeCfg.PrivateKeyFile},
+		{key: configPrivateKeyPassphrase, val: &snowflakeCfg.PrivateKeyPassphrase},
+		{key: configOAuthToken, val: &snowflakeCfg.OAuthToken},
+		{key: configOAuthTokenFile, val: &snowflakeCfg.OAuthTokenFile},
+	}
+	for _, opt := range optional {
+		if *opt.val, err = optionalKeyAsString(cfg, opt.key); err != nil {
+			return SnowflakeConfig{}, err
+		}
+	}
+	var methods int
+	for _, val := range []string{
+		snowflakeCfg.PrivateKeyFile,
+		snowflakeCfg.OAuthToken,
+		snowflakeCfg.OAuthTokenFile,
+	} {
+		if val != "" {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return SnowflakeConfig{}, fmt.Errorf(
+			"only one of %s, %s and %s can be set",
+			configPrivateKeyFile,
+			configOAuthToken,
+			configOAuthTokenFile,
+		)
+	}
+	if snowflakeCfg.PrivateKeyPassphrase != "" && snowflakeCfg.PrivateKeyFile == "" {
+		return SnowflakeConfig{}, fmt.Errorf("%s requires %s", configPrivateKeyPassphrase, configPrivateKeyFile)
+	}
+	return snowflakeCfg, nil
+}
+
+// snowflakeSessionStatements returns the statements initializing the sessions
+// of the Snowflake repositories: the statements and lock waits time out on the
+// server after the given query timeout, if any. Snowflake has no read-only
+// sessions, so the role of the repository user should only have read
+// privileges.
+func snowflakeSessionStatements(queryTimeout time.Duration) []string {
+	if queryTimeout <= 0 {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("ALTER SESSION SET STATEMENT_TIMEOUT_IN_SECONDS = %d", timeoutSeconds(queryTimeout)),
+		fmt.Sprintf("ALTER SESSION SET LOCK_TIMEOUT = %d", timeoutSeconds(queryTimeout)),
+	}
 }
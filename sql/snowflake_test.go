@@ -2,11 +2,27 @@ package sql
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"database/sql"
+	"encoding/asn1"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/snowflakedb/gosnowflake"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 func TestSnowflakeRepository_ListDatabases(t *testing.T) {
@@ -78,6 +94,218 @@ func TestNewSnowflakeConfigFromMap(t *testing.T) {
 	}
 }
 
+func TestSnowflakeRepository_ChangeIndicators(t *testing.T) {
+	ctx, db, mock, r := initSnowflakeRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows([]string{"schema", "table", "indicator"}).
+		AddRow("schema1", "table1", "a").
+		AddRow("schema1", "table2", nil).
+		AddRow("schema2", "table1", "b")
+	mock.ExpectQuery(regexp.QuoteMeta(snowflakeChangeIndicatorQuery)).WillReturnRows(rows)
+	indicators, err := r.ChangeIndicators(ctx)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		map[string]map[string]string{
+			"schema1": {"table1": "a"},
+			"schema2": {"table1": "b"},
+		},
+		indicators,
+	)
+}
+
+func TestNewSnowflakeConfigFromMap_Authentication(t *testing.T) {
+	base := func(extra map[string]any) map[string]any {
+		cfg := map[string]any{
+			configAccount:   "testAccount",
+			configRole:      "testRole",
+			configWarehouse: "testWarehouse",
+		}
+		for k, v := range extra {
+			cfg[k] = v
+		}
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		cfg     map[string]any
+		want    SnowflakeConfig
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name: "private key",
+			cfg:  base(map[string]any{configPrivateKeyFile: "key.p8", configPrivateKeyPassphrase: "pass"}),
+			want: SnowflakeConfig{
+				Account:              "testAccount",
+				Role:                 "testRole",
+				Warehouse:            "testWarehouse",
+				PrivateKeyFile:       "key.p8",
+				PrivateKeyPassphrase: "pass",
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name: "oauth token file",
+			cfg:  base(map[string]any{configOAuthTokenFile: "token"}),
+			want: SnowflakeConfig{
+				Account:        "testAccount",
+				Role:           "testRole",
+				Warehouse:      "testWarehouse",
+				OAuthTokenFile: "token",
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "private key and oauth token",
+			cfg:     base(map[string]any{configPrivateKeyFile: "key.p8", configOAuthToken: "token"}),
+			wantErr: require.Error,
+		},
+		{
+			name:    "passphrase without private key",
+			cfg:     base(map[string]any{configPrivateKeyPassphrase: "pass"}),
+			wantErr: require.Error,
+		},
+		{
+			name:    "non-string token",
+			cfg:     base(map[string]any{configOAuthToken: 1}),
+			wantErr: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSnowflakeConfigFromMap(tt.cfg)
+			tt.wantErr(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSnowflakePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	encode := func(typ string, der []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	}
+	encrypted := encode("ENCRYPTED PRIVATE KEY", encryptPKCS8(t, pkcs8, "passphrase"))
+
+	tests := []struct {
+		name       string
+		pem        []byte
+		passphrase string
+		wantErr    require.ErrorAssertionFunc
+	}{
+		{name: "pkcs1", pem: encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)), wantErr: require.NoError},
+		{name: "pkcs8", pem: encode("PRIVATE KEY", pkcs8), wantErr: require.NoError},
+		{name: "encrypted pkcs8", pem: encrypted, passphrase: "passphrase", wantErr: require.NoError},
+		{name: "wrong passphrase", pem: encrypted, passphrase: "wrong", wantErr: require.Error},
+		{name: "missing passphrase", pem: encrypted, wantErr: require.Error},
+		{name: "ecdsa key", pem: encode("PRIVATE KEY", ecPKCS8), wantErr: require.Error},
+		{name: "not pem", pem: []byte("not a key"), wantErr: require.Error},
+		{name: "certificate", pem: encode("CERTIFICATE", []byte{0}), wantErr: require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSnowflakePrivateKey(tt.pem, tt.passphrase)
+			tt.wantErr(t, err)
+			if err == nil {
+				require.True(t, key.Equal(got))
+			}
+		})
+	}
+}
+
+func TestSnowflakeDriverConfig(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(
+		keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		0o600,
+	)
+	require.NoError(t, err)
+	cfg := RepoConfig{User: "dmap", Database: "db"}
+	snowflakeCfg := SnowflakeConfig{Account: "account", Role: "role", Warehouse: "wh"}
+
+	_, err = snowflakeDriverConfig(cfg, snowflakeCfg)
+	require.Error(t, err, "no credentials")
+
+	keyCfg := snowflakeCfg
+	keyCfg.PrivateKeyFile = keyFile
+	driverCfg, err := snowflakeDriverConfig(cfg, keyCfg)
+	require.NoError(t, err)
+	require.Equal(t, gosnowflake.AuthTypeJwt, driverCfg.Authenticator)
+	require.True(t, key.Equal(driverCfg.PrivateKey))
+
+	_, err = snowflakeDriverConfig(RepoConfig{User: "dmap", Password: "secret"}, keyCfg)
+	require.Error(t, err, "password and private key")
+
+	tokenCfg := snowflakeCfg
+	tokenCfg.OAuthToken = "token"
+	driverCfg, err = snowflakeDriverConfig(cfg, tokenCfg)
+	require.NoError(t, err)
+	require.Equal(t, gosnowflake.AuthTypeOAuth, driverCfg.Authenticator)
+	require.Equal(t, "token", driverCfg.Token)
+
+	driverCfg, err = snowflakeDriverConfig(RepoConfig{User: "dmap", Password: "secret"}, snowflakeCfg)
+	require.NoError(t, err)
+	require.Equal(t, "secret", driverCfg.Password)
+}
+
+// encryptPKCS8 encrypts the given DER encoded PKCS#8 private key with the
+// given passphrase, with PBES2, PBKDF2-HMAC-SHA256 and AES-256-CBC, as done by
+// openssl pkcs8 -topk8 -v2 aes256.
+func encryptPKCS8(t *testing.T, der []byte, passphrase string) []byte {
+	salt := make([]byte, 8)
+	iv := make([]byte, aes.BlockSize)
+	_, err := rand.Read(salt)
+	require.NoError(t, err)
+	_, err = rand.Read(iv)
+	require.NoError(t, err)
+	iterations := 2048
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New))
+	require.NoError(t, err)
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	plain := append(append([]byte{}, der...), make([]byte, padLen)...)
+	for i := len(der); i < len(plain); i++ {
+		plain[i] = byte(padLen)
+	}
+	data := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, plain)
+
+	marshal := func(v any) asn1.RawValue {
+		b, err := asn1.Marshal(v)
+		require.NoError(t, err)
+		return asn1.RawValue{FullBytes: b}
+	}
+	kdfParams := struct {
+		Salt           []byte
+		IterationCount int
+		PRF            pkix.AlgorithmIdentifier
+	}{
+		Salt:           salt,
+		IterationCount: iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	}
+	params := pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: marshal(kdfParams)},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: marshal(iv)},
+	}
+	info := encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: marshal(params)},
+		EncryptedData: data,
+	}
+	b, err := asn1.Marshal(info)
+	require.NoError(t, err)
+	return b
+}
+
 func initSnowflakeRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *SnowflakeRepository) {
 	ctx := context.Background()
 	db, mock, err := sqlmock.New()
@@ -2,10 +2,12 @@ package sql
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	// SQL Server DB driver
-	_ "github.com/denisenkom/go-mssqldb"
+	mssql "github.com/denisenkom/go-mssqldb"
 )
 
 const (
@@ -19,8 +21,63 @@ const (
 	// sqlServerDatabaseQuery is the query to list all the databases on the server, minus
 	// the system default databases 'model' and 'tempdb'.
 	sqlServerDatabaseQuery = "SELECT name FROM sys.databases WHERE name != 'model' AND name != 'tempdb'"
+	// sqlServerIntrospectQuery extends the generic introspection query with the
+	// column and table comments, which SQL Server stores as MS_Description
+	// extended properties.
+	sqlServerIntrospectQuery = "SELECT " +
+		genericIntrospectColumns + ", " +
+		"CAST(cep.value AS NVARCHAR(MAX)) AS column_comment, " +
+		"CAST(tep.value AS NVARCHAR(MAX)) AS table_comment" +
+		genericIntrospectFrom +
+		" LEFT JOIN sys.extended_properties cep ON " +
+		"cep.class = 1 AND " +
+		"cep.name = 'MS_Description' AND " +
+		"cep.major_id = OBJECT_ID(QUOTENAME(c.table_schema) + '.' + QUOTENAME(c.table_name)) AND " +
+		"cep.minor_id = COLUMNPROPERTY(" +
+		"OBJECT_ID(QUOTENAME(c.table_schema) + '.' + QUOTENAME(c.table_name)), c.column_name, 'ColumnId'" +
+		")" +
+		" LEFT JOIN sys.extended_properties tep ON " +
+		"tep.class = 1 AND " +
+		"tep.name = 'MS_Description' AND " +
+		"tep.major_id = OBJECT_ID(QUOTENAME(c.table_schema) + '.' + QUOTENAME(c.table_name)) AND " +
+		"tep.minor_id = 0" +
+		genericIntrospectWhere
+	// sqlServerStatsQuery is the query to get the table statistics. The rows
+	// of a table are counted from its heap or clustered index partitions only,
+	// while its size includes all of its indexes. A page is 8 KB. The row
+	// counts of sys.partitions are documented as approximate, so the stats
+	// aren't exact (see IntrospectQueries.ExactStats).
+	sqlServerStatsQuery = `
+SELECT
+	s.name,
+	t.name,
+	(
+		SELECT SUM(p.rows)
+		FROM sys.partitions p
+		WHERE p.object_id = t.object_id AND p.index_id IN (0, 1)
+	),
+	(
+		SELECT SUM(a.total_pages) * 8192
+		FROM sys.partitions p
+		JOIN sys.allocation_units a ON a.container_id = p.partition_id
+		WHERE p.object_id = t.object_id
+	)
+FROM
+	sys.tables t
+	JOIN sys.schemas s ON s.schema_id = t.schema_id
+`
 )
 
+// sqlServerPathFilter pushes the path filters down into the introspection
+// query. LIKE is case-insensitive with the default collations, so only the
+// include paths are pushed down.
+var sqlServerPathFilter = &PathFilterDialect{
+	PathExpr: concatPathExpr,
+	Placeholder: func(n int) string {
+		return fmt.Sprintf("@p%d", n)
+	},
+}
+
 // SqlServerRepository is a Repository implementation for MS SQL Server
 // databases.
 type SqlServerRepository struct {
@@ -34,20 +91,24 @@ var _ Repository = (*SqlServerRepository)(nil)
 
 // NewSqlServerRepository creates a new MS SQL Server sql.
 func NewSqlServerRepository(cfg RepoConfig) (*SqlServerRepository, error) {
-	connStr := fmt.Sprintf(
-		"sqlserver://%s:%s@%s:%d",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
+	generic, err := withSSHTunnel(
+		cfg,
+		func(tunnel *sshTunnel) (*GenericRepository, error) {
+			// The connections are made to the local port of the tunnel, if any.
+			connStr, err := sqlServerConnStr(tunnel.repoConfig(cfg))
+			if err != nil {
+				return nil, err
+			}
+			connector, err := mssql.NewConnector(connStr)
+			if err != nil {
+				return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+			}
+			db := openSessionDB(connector, sqlServerSessionStatements(cfg.QueryTimeout), cfg.MaxOpenConns)
+			return NewGenericRepositoryFromDB(RepoTypeSqlServer, cfg.Database, db), nil
+		},
 	)
-	// The database name is optional for MS SQL Server.
-	if cfg.Database != "" {
-		connStr = fmt.Sprintf(connStr+"?database=%s", cfg.Database)
-	}
-	generic, err := NewGenericRepository(RepoTypeSqlServer, cfg.Database, connStr, cfg.MaxOpenConns)
 	if err != nil {
-		return nil, fmt.Errorf("could not instantiate generic sql repository: %w", err)
+		return nil, err
 	}
 	return &SqlServerRepository{generic: generic}, nil
 }
@@ -59,11 +120,19 @@ func (r *SqlServerRepository) ListDatabases(ctx context.Context) ([]string, erro
 	return r.generic.ListDatabasesWithQuery(ctx, sqlServerDatabaseQuery)
 }
 
-// Introspect delegates introspection to GenericRepository. See
-// Repository.Introspect and GenericRepository.IntrospectWithQuery for more
-// details.
+// Introspect delegates introspection to GenericRepository, using SQL
+// Server-specific introspection and table statistics queries, which include
+// the extended property comments and are based on sys.partitions respectively,
+// and the generic key constraints query. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
 func (r *SqlServerRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
-	return r.generic.Introspect(ctx, params)
+	queries := IntrospectQueries{
+		Introspect: sqlServerIntrospectQuery,
+		Stats:      sqlServerStatsQuery,
+		Keys:       genericKeysQuery,
+		PathFilter: sqlServerPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
 }
 
 // SampleTable delegates sampling to GenericRepository, using a
@@ -74,7 +143,7 @@ func (r *SqlServerRepository) SampleTable(
 	params SampleParameters,
 ) (Sample, error) {
 	// Sqlserver uses double-quotes to quote identifiers
-	attrStr := params.Metadata.QuotedAttributeNamesString("\"")
+	attrStr := params.SelectList(r.generic.database, "\"", sqlServerTruncate)
 	query := fmt.Sprintf(sqlServerSampleQueryTemplate, attrStr, params.Metadata.Schema, params.Metadata.Name)
 	return r.generic.SampleTableWithQuery(ctx, query, params)
 }
@@ -90,3 +159,69 @@ func (r *SqlServerRepository) Ping(ctx context.Context) error {
 func (r *SqlServerRepository) Close() error {
 	return r.generic.Close()
 }
+
+// sqlServerTruncate truncates textual values, which are cast to NVARCHAR(MAX)
+// first since SUBSTRING doesn't accept types such as xml.
+func sqlServerTruncate(quotedColumn string, n uint) string {
+	return fmt.Sprintf("SUBSTRING(CAST(%s AS NVARCHAR(MAX)), 1, %d)", quotedColumn, n)
+}
+
+// sqlServerConnStr returns the SQL Server driver connection string of the given
+// configuration.
+func sqlServerConnStr(cfg RepoConfig) (string, error) {
+	params, err := sqlServerTLSParams(cfg.TLS)
+	if err != nil {
+		return "", fmt.Errorf("invalid tls config: %w", err)
+	}
+	// The database name is optional for MS SQL Server.
+	if cfg.Database != "" {
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params["database"] = cfg.Database
+	}
+	return urlConnStr("sqlserver", cfg, "", params), nil
+}
+
+// sqlServerSessionStatements returns the statements initializing the sessions
+// of the SQL Server repositories: the lock waits time out on the server after
+// the given query timeout, if any. SQL Server has neither read-only sessions nor
+// server-side statement timeouts, but the driver cancels the queries on the
+// server when their context is done, i.e. when the query timeout expires.
+func sqlServerSessionStatements(queryTimeout time.Duration) []string {
+	if queryTimeout <= 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("SET LOCK_TIMEOUT %d", timeoutMillis(queryTimeout))}
+}
+
+// sqlServerTLSParams returns the SQL Server driver connection parameters of the
+// given configuration. The driver always verifies the server name when it
+// verifies the server certificate, and doesn't support client certificates, so
+// the verify-ca mode and client certificates aren't supported.
+func sqlServerTLSParams(c TLSConfig) (map[string]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.CertFile != "" {
+		return nil, errors.New("tls client certificates are not supported by the sqlserver driver")
+	}
+	switch c.Mode {
+	case "":
+		return nil, nil
+	case TLSModeDisable:
+		return map[string]string{"encrypt": "disable"}, nil
+	case TLSModeRequire:
+		return map[string]string{"encrypt": "true", "TrustServerCertificate": "true"}, nil
+	case TLSModeVerifyCA:
+		return nil, errors.New("tls mode verify-ca is not supported by the sqlserver driver, use verify-full")
+	}
+	params := map[string]string{"encrypt": "true", "TrustServerCertificate": "false"}
+	if c.CAFile != "" {
+		params["certificate"] = c.CAFile
+	}
+	if c.ServerName != "" {
+		params["hostNameInCertificate"] = c.ServerName
+	}
+	return params, nil
+}
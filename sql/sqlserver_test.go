@@ -27,3 +27,58 @@ func initSqlServerRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlm
 		generic: NewGenericRepositoryFromDB(RepoTypeSqlServer, "dbName", db),
 	}
 }
+
+func TestSqlServerTLSParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		want    map[string]string
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name:    "driver default",
+			cfg:     TLSConfig{},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "disable",
+			cfg:     TLSConfig{Mode: TLSModeDisable},
+			want:    map[string]string{"encrypt": "disable"},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "require",
+			cfg:     TLSConfig{Mode: TLSModeRequire},
+			want:    map[string]string{"encrypt": "true", "TrustServerCertificate": "true"},
+			wantErr: require.NoError,
+		},
+		{
+			name: "verify-full",
+			cfg:  TLSConfig{Mode: TLSModeVerifyFull, CAFile: "/etc/ca.pem", ServerName: "db.example.com"},
+			want: map[string]string{
+				"encrypt":                "true",
+				"TrustServerCertificate": "false",
+				"certificate":            "/etc/ca.pem",
+				"hostNameInCertificate":  "db.example.com",
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "verify-ca",
+			cfg:     TLSConfig{Mode: TLSModeVerifyCA},
+			wantErr: require.Error,
+		},
+		{
+			name:    "client certificate",
+			cfg:     TLSConfig{Mode: TLSModeRequire, CertFile: "/etc/client.pem", KeyFile: "/etc/client.key"},
+			wantErr: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqlServerTLSParams(tt.cfg)
+			tt.wantErr(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshDialTimeout is the timeout of the connection to the SSH server.
+const sshDialTimeout = 30 * time.Second
+
+// SSHTunnelConfig is the configuration of the SSH tunnel, e.g. through a bastion
+// host, which the connections to a repository are made through. The tunnel is
+// established in-process, and closed with the repository.
+type SSHTunnelConfig struct {
+	// Host is the hostname of the SSH server.
+	Host string
+	// Port is the port of the SSH server. If zero, port 22 is used.
+	Port uint16
+	// User is the username to authenticate to the SSH server with.
+	User string
+	// PrivateKeyFile is the path of the PEM private key to authenticate to the
+	// SSH server with.
+	PrivateKeyFile string
+	// PrivateKeyPassphrase is the passphrase of the private key, if it is
+	// encrypted.
+	PrivateKeyPassphrase string
+	// UseAgent authenticates to the SSH server with the keys of the SSH agent
+	// listening on SSH_AUTH_SOCK, in addition to the private key, if any.
+	UseAgent bool
+	// KnownHostsFile is the path of the known_hosts file the host key of the
+	// SSH server is verified against. If empty, ~/.ssh/known_hosts is used.
+	KnownHostsFile string
+	// InsecureIgnoreHostKey disables the verification of the host key of the
+	// SSH server. It should only be used for testing.
+	InsecureIgnoreHostKey bool
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *SSHTunnelConfig) Validate() error {
+	if c.Host == "" {
+		return errors.New("ssh host is required")
+	}
+	if c.User == "" {
+		return errors.New("ssh user is required")
+	}
+	if c.PrivateKeyFile == "" && !c.UseAgent {
+		return errors.New("ssh private key or agent is required")
+	}
+	if c.PrivateKeyPassphrase != "" && c.PrivateKeyFile == "" {
+		return errors.New("ssh private key passphrase requires a private key")
+	}
+	if c.InsecureIgnoreHostKey && c.KnownHostsFile != "" {
+		return errors.New("ssh known hosts file and insecure host key verification are mutually exclusive")
+	}
+	return nil
+}
+
+// clientConfig builds the configuration of the SSH client. It returns the
+// connection to the SSH agent, if any, which must be closed once the client
+// doesn't authenticate anymore.
+func (c *SSHTunnelConfig) clientConfig() (*ssh.ClientConfig, io.Closer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	var hostKeyCallback ssh.HostKeyCallback
+	if c.InsecureIgnoreHostKey {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		knownHostsFile := c.KnownHostsFile
+		if knownHostsFile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, fmt.Errorf("error finding ssh known hosts file: %w", err)
+			}
+			knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		var err error
+		if hostKeyCallback, err = knownhosts.New(knownHostsFile); err != nil {
+			return nil, nil, fmt.Errorf("error reading ssh known hosts file: %w", err)
+		}
+	}
+	var auth []ssh.AuthMethod
+	if c.PrivateKeyFile != "" {
+		pemBytes, err := os.ReadFile(c.PrivateKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading ssh private key file: %w", err)
+		}
+		var signer ssh.Signer
+		if c.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(c.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pemBytes)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing ssh private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	var agentConn net.Conn
+	if c.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, nil, errors.New("ssh agent requested, but SSH_AUTH_SOCK is not set")
+		}
+		var err error
+		if agentConn, err = net.Dial("unix", sock); err != nil {
+			return nil, nil, fmt.Errorf("error connecting to ssh agent: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+	cfg := &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}
+	if agentConn == nil {
+		return cfg, nil, nil
+	}
+	return cfg, agentConn, nil
+}
+
+// addr returns the address of the SSH server.
+func (c *SSHTunnelConfig) addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(int(port)))
+}
+
+// sshTunnel tunnels connections to a single target address through an SSH
+// server. The connections can either be dialed with DialContext, by the drivers
+// which accept a custom dialer, or be made to a local port which is forwarded
+// to the target, like ssh -L does. The SSH connection is only established when
+// the first connection is tunneled, and it is re-established if it is lost.
+//
+// The methods of a nil *sshTunnel are no-ops, so that the repositories don't
+// have to distinguish whether their connections are tunneled.
+type sshTunnel struct {
+	cfg       *SSHTunnelConfig
+	clientCfg *ssh.ClientConfig
+	agentConn io.Closer
+	target    string
+	listener  net.Listener
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// newSSHTunnel returns a tunnel to the given host and port through the SSH
+// server of the given configuration, and starts forwarding a local port to it.
+// It returns nil if the configuration is nil.
+func newSSHTunnel(cfg *SSHTunnelConfig, host string, port uint16) (*sshTunnel, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	clientCfg, agentConn, err := cfg.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if agentConn != nil {
+			_ = agentConn.Close()
+		}
+		return nil, fmt.Errorf("error listening on local tunnel port: %w", err)
+	}
+	t := &sshTunnel{
+		cfg:       cfg,
+		clientCfg: clientCfg,
+		agentConn: agentConn,
+		target:    net.JoinHostPort(host, strconv.Itoa(int(port))),
+		listener:  listener,
+	}
+	t.wg.Add(1)
+	go t.forward()
+	return t, nil
+}
+
+// sshClient returns the SSH client of the tunnel, and connects it first if it
+// isn't connected.
+func (t *sshTunnel) sshClient(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errors.New("ssh tunnel is closed")
+	}
+	if t.client != nil {
+		return t.client, nil
+	}
+	addr := t.cfg.addr()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to ssh server: %w", err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, t.clientCfg)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error establishing ssh connection: %w", err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	t.client = client
+	go func() {
+		// Forget the client once its connection is lost, so that the next
+		// tunneled connection re-establishes it.
+		_ = client.Wait()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.client == client {
+			t.client = nil
+		}
+	}()
+	return client, nil
+}
+
+// DialContext opens a connection to the target of the tunnel through the SSH
+// server. The network and address are ignored, since the tunnel only has a
+// single target.
+func (t *sshTunnel) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, err := t.sshClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, "tcp", t.target)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s through ssh tunnel: %w", t.target, err)
+	}
+	return conn, nil
+}
+
+// forward accepts the connections to the local port of the tunnel, and
+// forwards them to the target, until the tunnel is closed.
+func (t *sshTunnel) forward() {
+	defer t.wg.Done()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			// The listener is only closed by Close.
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer func() { _ = local.Close() }()
+			remote, err := t.DialContext(context.Background(), "tcp", t.target)
+			if err != nil {
+				log.WithError(err).Warn("error forwarding connection through ssh tunnel")
+				return
+			}
+			defer func() { _ = remote.Close() }()
+			pipe(local, remote)
+		}()
+	}
+}
+
+// pipe copies the data between the given connections in both directions, until
+// either of them is closed.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	// Unblock the other copy.
+	_ = a.Close()
+	_ = b.Close()
+	<-done
+}
+
+// repoConfig returns the given configuration with the host and port of the
+// local port of the tunnel, for the drivers which don't accept a custom dialer.
+// In the verify-full TLS mode, the server certificate is still verified against
+// the host of the repository, unless a server name is configured.
+func (t *sshTunnel) repoConfig(cfg RepoConfig) RepoConfig {
+	if t == nil {
+		return cfg
+	}
+	if cfg.TLS.Mode == TLSModeVerifyFull && cfg.TLS.ServerName == "" {
+		cfg.TLS.ServerName = cfg.Host
+	}
+	addr := t.listener.Addr().(*net.TCPAddr)
+	cfg.Host = addr.IP.String()
+	cfg.Port = uint16(addr.Port)
+	return cfg
+}
+
+// pqDriver returns the lib/pq driver, which dials the connections through the
+// tunnel if it isn't nil. The connection string keeps the host of the
+// repository, which lib/pq verifies the server certificate against.
+func (t *sshTunnel) pqDriver() driver.Driver {
+	if t == nil {
+		return pq.Driver{}
+	}
+	return pqTunnelDriver{tunnel: t}
+}
+
+// Close closes the local port and the SSH connection of the tunnel, which
+// closes the tunneled connections, and waits for them to be closed.
+func (t *sshTunnel) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	t.closed = true
+	client := t.client
+	t.client = nil
+	t.mu.Unlock()
+	err := t.listener.Close()
+	if client != nil {
+		if closeErr := client.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+			err = errors.Join(err, closeErr)
+		}
+	}
+	if t.agentConn != nil {
+		err = errors.Join(err, t.agentConn.Close())
+	}
+	t.wg.Wait()
+	return err
+}
+
+// pqTunnelDriver is a lib/pq driver which dials the connections through an SSH
+// tunnel.
+type pqTunnelDriver struct {
+	tunnel *sshTunnel
+}
+
+var (
+	_ driver.Driver = pqTunnelDriver{}
+	_ pq.Dialer     = pqTunnelDialer{}
+)
+
+// Open opens a new connection through the tunnel. See driver.Driver for more
+// details.
+func (d pqTunnelDriver) Open(connStr string) (driver.Conn, error) {
+	return pq.DialOpen(pqTunnelDialer{tunnel: d.tunnel}, connStr)
+}
+
+// pqTunnelDialer is a pq.Dialer which dials the connections through an SSH
+// tunnel.
+type pqTunnelDialer struct {
+	tunnel *sshTunnel
+}
+
+// Dial dials the target of the tunnel. See pq.Dialer for more details.
+func (d pqTunnelDialer) Dial(network, address string) (net.Conn, error) {
+	return d.tunnel.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout dials the target of the tunnel, with the given timeout. See
+// pq.Dialer for more details.
+func (d pqTunnelDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.tunnel.DialContext(ctx, network, address)
+}
+
+// DialContext dials the target of the tunnel. See pq.DialerContext for more
+// details.
+func (d pqTunnelDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.tunnel.DialContext(ctx, network, address)
+}
+
+// dsnConnector is a driver.Connector which opens the connections of a driver
+// with a fixed connection string.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+var _ driver.Connector = dsnConnector{}
+
+// Connect opens a new connection. See driver.Connector for more details.
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if driverCtx, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := driverCtx.OpenConnector(c.dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(c.dsn)
+}
+
+// Driver returns the driver of the connector. See driver.Connector for more
+// details.
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// withSSHTunnel opens the SSH tunnel of the given configuration, if any, and
+// instantiates a GenericRepository with newGeneric, which may use the tunnel. The
+// tunnel is closed by GenericRepository.Close, or immediately if newGeneric
+// fails.
+func withSSHTunnel(
+	cfg RepoConfig,
+	newGeneric func(tunnel *sshTunnel) (*GenericRepository, error),
+) (*GenericRepository, error) {
+	tunnel, err := newSSHTunnel(cfg.SSHTunnel, cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, fmt.Errorf("error opening ssh tunnel: %w", err)
+	}
+	generic, err := newGeneric(tunnel)
+	if err != nil {
+		_ = tunnel.Close()
+		return nil, err
+	}
+	generic.tunnel = tunnel
+	return generic, nil
+}
@@ -0,0 +1,372 @@
+package sql
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSSHTunnelConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SSHTunnelConfig
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name:    "private key",
+			cfg:     SSHTunnelConfig{Host: "bastion", User: "dmap", PrivateKeyFile: "id_ed25519"},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "agent",
+			cfg:     SSHTunnelConfig{Host: "bastion", User: "dmap", UseAgent: true},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "missing host",
+			cfg:     SSHTunnelConfig{User: "dmap", UseAgent: true},
+			wantErr: require.Error,
+		},
+		{
+			name:    "missing user",
+			cfg:     SSHTunnelConfig{Host: "bastion", UseAgent: true},
+			wantErr: require.Error,
+		},
+		{
+			name:    "no authentication",
+			cfg:     SSHTunnelConfig{Host: "bastion", User: "dmap"},
+			wantErr: require.Error,
+		},
+		{
+			name:    "passphrase without private key",
+			cfg:     SSHTunnelConfig{Host: "bastion", User: "dmap", UseAgent: true, PrivateKeyPassphrase: "pass"},
+			wantErr: require.Error,
+		},
+		{
+			name: "known hosts and insecure",
+			cfg: SSHTunnelConfig{
+				Host:                  "bastion",
+				User:                  "dmap",
+				UseAgent:              true,
+				KnownHostsFile:        "known_hosts",
+				InsecureIgnoreHostKey: true,
+			},
+			wantErr: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.wantErr(t, tt.cfg.Validate())
+		})
+	}
+}
+
+func TestSSHTunnel(t *testing.T) {
+	keyFile, clientKey := newTestSSHKeyFile(t, "passphrase")
+	server := newTestSSHServer(t, clientKey)
+	targetHost, targetPort := newTestEchoServer(t)
+	cfg := server.tunnelConfig(t)
+	cfg.PrivateKeyFile, cfg.PrivateKeyPassphrase = keyFile, "passphrase"
+
+	tunnel, err := newSSHTunnel(cfg, targetHost, targetPort)
+	require.NoError(t, err)
+
+	// Dialed connections.
+	conn, err := tunnel.DialContext(context.Background(), "tcp", "ignored:1")
+	require.NoError(t, err)
+	requireEcho(t, conn)
+
+	// Connections dialed by lib/pq.
+	conn, err = pqTunnelDialer{tunnel: tunnel}.DialTimeout("tcp", "db.example.com:5432", time.Minute)
+	require.NoError(t, err)
+	requireEcho(t, conn)
+
+	// Forwarded connections.
+	forwarded := tunnel.repoConfig(RepoConfig{Host: "db.example.com", Port: 5432})
+	require.Equal(t, "127.0.0.1", forwarded.Host)
+	addr := net.JoinHostPort(forwarded.Host, strconv.Itoa(int(forwarded.Port)))
+	local, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	requireEcho(t, local)
+
+	require.NoError(t, tunnel.Close())
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+	_, err = tunnel.DialContext(context.Background(), "tcp", "ignored:1")
+	require.Error(t, err)
+}
+
+func TestSSHTunnel_Agent(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: priv}))
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	server := newTestSSHServer(t, signer.PublicKey())
+	targetHost, targetPort := newTestEchoServer(t)
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = agent.ServeAgent(keyring, conn) }()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	cfg := server.tunnelConfig(t)
+	cfg.UseAgent = true
+	tunnel, err := newSSHTunnel(cfg, targetHost, targetPort)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Close()) }()
+	conn, err := tunnel.DialContext(context.Background(), "tcp", "")
+	require.NoError(t, err)
+	requireEcho(t, conn)
+}
+
+func TestSSHTunnel_UnknownHostKey(t *testing.T) {
+	keyFile, clientKey := newTestSSHKeyFile(t, "")
+	server := newTestSSHServer(t, clientKey)
+	targetHost, targetPort := newTestEchoServer(t)
+	cfg := server.tunnelConfig(t)
+	cfg.PrivateKeyFile = keyFile
+	// Trust another host key.
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{cfg.addr()}, newTestSSHKey(t).PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+	cfg.KnownHostsFile = knownHosts
+
+	tunnel, err := newSSHTunnel(cfg, targetHost, targetPort)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Close()) }()
+	_, err = tunnel.DialContext(context.Background(), "tcp", "")
+	require.Error(t, err)
+}
+
+func TestSSHTunnel_repoConfig(t *testing.T) {
+	var tunnel *sshTunnel
+	cfg := RepoConfig{Host: "db.example.com", Port: 5432, TLS: TLSConfig{Mode: TLSModeVerifyFull}}
+	require.Equal(t, cfg, tunnel.repoConfig(cfg))
+	require.NoError(t, tunnel.Close())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	tunnel = &sshTunnel{listener: listener}
+	got := tunnel.repoConfig(cfg)
+	require.Equal(t, "127.0.0.1", got.Host)
+	require.Equal(t, listener.Addr().(*net.TCPAddr).Port, int(got.Port))
+	// The server certificate is verified against the host of the repository.
+	require.Equal(t, "db.example.com", got.TLS.ServerName)
+
+	cfg.TLS = TLSConfig{Mode: TLSModeRequire}
+	require.Empty(t, tunnel.repoConfig(cfg).TLS.ServerName)
+}
+
+func TestNewSqlServerRepository_SSHTunnel(t *testing.T) {
+	keyFile, clientKey := newTestSSHKeyFile(t, "")
+	server := newTestSSHServer(t, clientKey)
+	cfg := server.tunnelConfig(t)
+	cfg.PrivateKeyFile = keyFile
+	repo, err := NewSqlServerRepository(
+		RepoConfig{Host: "db.example.com", Port: 1433, User: "dmap", Password: "secret", SSHTunnel: cfg},
+	)
+	require.NoError(t, err)
+	require.NotNil(t, repo.generic.tunnel)
+	addr := repo.generic.tunnel.listener.Addr().String()
+
+	// The tunnel is closed with the repository.
+	require.NoError(t, repo.Close())
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+}
+
+func TestNewSnowflakeRepository_SSHTunnel(t *testing.T) {
+	_, err := NewSnowflakeRepository(
+		RepoConfig{
+			User:      "dmap",
+			Password:  "secret",
+			SSHTunnel: &SSHTunnelConfig{Host: "bastion", User: "dmap", UseAgent: true},
+			Advanced:  map[string]any{configAccount: "account", configRole: "role", configWarehouse: "wh"},
+		},
+	)
+	require.Error(t, err)
+}
+
+// testSSHServer is an in-process SSH server which only supports the
+// direct-tcpip channels used for port forwarding, and authenticates clients with
+// a single public key.
+type testSSHServer struct {
+	addr       string
+	hostKey    ssh.PublicKey
+	authorized ssh.PublicKey
+}
+
+// newTestSSHServer starts a new testSSHServer, which authorizes the given
+// public key, and stops it at the end of the test.
+func newTestSSHServer(t *testing.T, authorized ssh.PublicKey) *testSSHServer {
+	hostKey := newTestSSHKey(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	s := &testSSHServer{
+		addr:       listener.Addr().String(),
+		hostKey:    hostKey.PublicKey(),
+		authorized: authorized,
+	}
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(s.authorized.Marshal()) {
+				return nil, errors.New("unauthorized key")
+			}
+			return nil, nil
+		},
+	}
+	serverCfg.AddHostKey(hostKey)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, serverCfg)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-tcpip" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		var payload struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+			_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			_ = target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			defer func() { _ = ch.Close() }()
+			defer func() { _ = target.Close() }()
+			go func() { _, _ = io.Copy(target, ch) }()
+			_, _ = io.Copy(ch, target)
+		}()
+	}
+}
+
+// tunnelConfig returns a tunnel configuration of the server, which trusts its
+// host key.
+func (s *testSSHServer) tunnelConfig(t *testing.T) *SSHTunnelConfig {
+	host, portStr, err := net.SplitHostPort(s.addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{s.addr}, s.hostKey)
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+	return &SSHTunnelConfig{Host: host, Port: uint16(port), User: "dmap", KnownHostsFile: knownHosts}
+}
+
+func newTestSSHKey(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+// newTestSSHKeyFile writes a new private key file, encrypted with the given
+// passphrase if not empty. It returns the path of the file and the public key.
+func newTestSSHKeyFile(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	}
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(block), 0o600))
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return file, signer.PublicKey()
+}
+
+// newTestEchoServer starts a TCP server which echoes the lines it receives, and
+// stops it at the end of the test. It returns its host and port.
+func newTestEchoServer(t *testing.T) (string, uint16) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), uint16(addr.Port)
+}
+
+// requireEcho requires the given connection to an echo server to echo a line,
+// and closes it.
+func requireEcho(t *testing.T, conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_, err := conn.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", line)
+}
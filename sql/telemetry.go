@@ -0,0 +1,111 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the OpenTelemetry tracer and meter used by
+// this package. The package only uses the global OpenTelemetry providers, so
+// spans and metrics are no-ops unless the application using the package
+// configures them (see otel.SetTracerProvider and otel.SetMeterProvider).
+const instrumentationName = "github.com/cyralinc/dmap/sql"
+
+// Attribute keys used for spans and metrics.
+const (
+	attrRepoType  = attribute.Key("dmap.repo.type")
+	attrDatabase  = attribute.Key("dmap.database")
+	attrTablePath = attribute.Key("dmap.table.path")
+	attrOperation = attribute.Key("dmap.operation")
+)
+
+// Repository operations, used as the attrOperation attribute value.
+const (
+	opListDatabases = "list_databases"
+	opIntrospect    = "introspect"
+	opSampleTable   = "sample_table"
+	opClassify      = "classify"
+)
+
+// operationSpanNames maps each repository operation to the name of the spans
+// created for it.
+var operationSpanNames = map[string]string{
+	opListDatabases: "Repository.ListDatabases",
+	opIntrospect:    "Repository.Introspect",
+	opSampleTable:   "Repository.SampleTable",
+	opClassify:      "Classifier.Classify",
+}
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	// The instruments are created from the global meter, which delegates to the
+	// configured meter provider once it is set. Instrument creation only fails
+	// for invalid instrument names, in which case a no-op instrument is
+	// returned, so the errors are safe to ignore.
+	tablesSampledCounter, _ = meter.Int64Counter(
+		"dmap.scan.tables.sampled",
+		metric.WithDescription("Number of tables successfully sampled."),
+		metric.WithUnit("{table}"),
+	)
+	rowsClassifiedCounter, _ = meter.Int64Counter(
+		"dmap.scan.rows.classified",
+		metric.WithDescription("Number of sampled rows classified."),
+		metric.WithUnit("{row}"),
+	)
+	errorsCounter, _ = meter.Int64Counter(
+		"dmap.scan.errors",
+		metric.WithDescription("Number of errors returned by repository and classifier operations."),
+		metric.WithUnit("{error}"),
+	)
+	operationDurationHistogram, _ = meter.Float64Histogram(
+		"dmap.scan.operation.duration",
+		metric.WithDescription("Duration of repository queries and classifier calls, by operation."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300),
+	)
+)
+
+// startSpan starts a new span with the given name and attributes, as a child of
+// any span contained in ctx.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if non-nil, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// observeCall calls fn within a new span named after the given repository or
+// classifier operation, and records the call duration and any returned error
+// in the package metrics.
+func observeCall(
+	ctx context.Context,
+	repoType, operation string,
+	fn func(ctx context.Context) error,
+	attrs ...attribute.KeyValue,
+) error {
+	metricAttrs := metric.WithAttributes(attrRepoType.String(repoType), attrOperation.String(operation))
+	attrs = append(attrs, attrRepoType.String(repoType))
+	ctx, span := startSpan(ctx, operationSpanNames[operation], attrs...)
+	start := time.Now()
+	err := fn(ctx)
+	operationDurationHistogram.Record(ctx, time.Since(start).Seconds(), metricAttrs)
+	if err != nil {
+		errorsCounter.Add(ctx, 1, metricAttrs)
+	}
+	endSpan(span, err)
+	return err
+}
@@ -0,0 +1,63 @@
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/cyralinc/dmap/classification"
+)
+
+// Note that the global OpenTelemetry providers can only be delegated to once
+// per process, so this should remain the only test in the package which
+// installs them.
+func TestScanner_Telemetry(t *testing.T) {
+	ctx := context.Background()
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	sample := Sample{
+		TablePath: []string{"db", "schema", "table"},
+		Results:   []SampleResult{{"ssn": "512-23-4258"}, {"ssn": "foo"}},
+	}
+	classifier := NewMockClassifier(t)
+	classifier.EXPECT().Classify(mock.Anything, mock.Anything).Return(
+		classification.Result{"ssn": lblSet("SSN")},
+		nil,
+	)
+	s := Scanner{config: ScannerConfig{RepoType: "mock"}, classifier: classifier}
+	_, err := s.classifySample(ctx, sample, nil, newScanReport())
+	require.NoError(t, err)
+
+	var classifySpans int
+	for _, span := range spans.Ended() {
+		if span.Name() == "Classifier.Classify" {
+			classifySpans++
+		}
+	}
+	require.Equal(t, 2, classifySpans)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	var rowsClassified int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "dmap.scan.rows.classified" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				rowsClassified += dp.Value
+			}
+		}
+	}
+	require.Equal(t, int64(2), rowsClassified)
+}
@@ -0,0 +1,114 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	RepoTypeTiDB = "tidb"
+	// tidbDatabaseQuery lists the databases of the server, except the system
+	// databases. TiDB reports the names of some system databases in upper case,
+	// and compares them case-sensitively, so they are compared in upper case.
+	tidbDatabaseQuery = `
+SELECT
+    schema_name
+FROM
+    information_schema.schemata
+WHERE
+    UPPER(schema_name) NOT IN ('INFORMATION_SCHEMA', 'METRICS_SCHEMA', 'MYSQL', 'PERFORMANCE_SCHEMA', 'SYS')
+`
+	// tidbIntrospectQuery is the MySQL introspection query, excluding the TiDB
+	// system databases (see tidbDatabaseQuery).
+	tidbIntrospectQuery = "SELECT " +
+		genericIntrospectColumns + ", " +
+		"c.column_comment AS column_comment, " +
+		"CASE WHEN t.table_type = 'VIEW' THEN NULL ELSE t.table_comment END AS table_comment" +
+		genericIntrospectFrom +
+		" WHERE UPPER(c.table_schema) NOT IN " +
+		"('INFORMATION_SCHEMA', 'METRICS_SCHEMA', 'MYSQL', 'PERFORMANCE_SCHEMA', 'SYS')"
+)
+
+// TiDbRepository is a Repository implementation for TiDB databases. TiDB is
+// compatible with the MySQL protocol and catalog, so the sampling and most of
+// the introspection are the same as MySqlRepository's. TiDB doesn't track the
+// update time of the tables, so it isn't a ChangeTracker.
+type TiDbRepository struct {
+	// The majority of the Repository functionality is delegated to
+	// a generic SQL repository instance.
+	generic *GenericRepository
+}
+
+// TiDbRepository implements Repository
+var _ Repository = (*TiDbRepository)(nil)
+
+// NewTiDbRepository creates a new TiDbRepository.
+func NewTiDbRepository(cfg RepoConfig) (*TiDbRepository, error) {
+	generic, err := newMySqlGenericRepository(RepoTypeTiDB, cfg, tidbSessionStatements(cfg.QueryTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return &TiDbRepository{generic: generic}, nil
+}
+
+// ListDatabases returns a list of the names of all databases on the server by
+// using a TiDB-specific database query. It delegates the actual work to
+// GenericRepository.ListDatabasesWithQuery - see that method for more details.
+func (r *TiDbRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	return r.generic.ListDatabasesWithQuery(ctx, tidbDatabaseQuery)
+}
+
+// Introspect delegates introspection to GenericRepository, using a
+// TiDB-specific introspection query, and the MySQL table statistics and key
+// constraints queries. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
+func (r *TiDbRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
+	queries := IntrospectQueries{
+		Introspect: tidbIntrospectQuery,
+		Stats:      mySqlStatsQuery,
+		Keys:       mySqlKeysQuery,
+		PathFilter: mySqlPathFilter,
+	}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
+}
+
+// SampleTable delegates sampling to GenericRepository, using the MySQL table
+// sample query. See Repository.SampleTable and
+// GenericRepository.SampleTableWithQuery for more details.
+func (r *TiDbRepository) SampleTable(
+	ctx context.Context,
+	params SampleParameters,
+) (Sample, error) {
+	// TiDB uses backticks to quote identifiers.
+	attrStr := params.SelectList(r.generic.database, "`", mySqlTruncate)
+	query := fmt.Sprintf(genericSampleQueryTemplate, attrStr, params.Metadata.Schema, params.Metadata.Name)
+	return r.generic.SampleTableWithQuery(ctx, query, params)
+}
+
+// Ping delegates the ping to GenericRepository. See Repository.Ping and
+// GenericRepository.Ping for more details.
+func (r *TiDbRepository) Ping(ctx context.Context) error {
+	return r.generic.Ping(ctx)
+}
+
+// Close delegates the close to GenericRepository. See Repository.Close and
+// GenericRepository.Close for more details.
+func (r *TiDbRepository) Close() error {
+	return r.generic.Close()
+}
+
+// tidbSessionStatements returns the statements initializing the sessions of
+// the TiDB repositories: the queries and pessimistic lock waits time out on the
+// server after the given query timeout, if any. TiDB only accepts read-only
+// transactions when its no-op functions are enabled, so the sessions are only
+// initialized if there is a timeout.
+func tidbSessionStatements(queryTimeout time.Duration) []string {
+	if queryTimeout <= 0 {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("SET SESSION max_execution_time = %d", timeoutMillis(queryTimeout)),
+		fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", timeoutSeconds(queryTimeout)),
+	}
+}
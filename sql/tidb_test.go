@@ -0,0 +1,57 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiDbRepository_ListDatabases(t *testing.T) {
+	ctx, db, mock, r := initTiDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	dbRows := sqlmock.NewRows([]string{"name"}).AddRow("db1").AddRow("db2")
+	mock.ExpectQuery(regexp.QuoteMeta(tidbDatabaseQuery)).WillReturnRows(dbRows)
+	dbs, err := r.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"db1", "db2"}, dbs)
+}
+
+func TestTiDbRepository_Introspect(t *testing.T) {
+	ctx, db, mock, r := initTiDbRepoTest(t)
+	defer func() { _ = db.Close() }()
+	rows := sqlmock.NewRows(
+		[]string{"table_schema", "table_name", "column_name", "data_type", "object_type", "column_comment", "table_comment"},
+	).AddRow("schema1", "table1", "email", "varchar", "table", "", "")
+	mock.ExpectQuery(regexp.QuoteMeta(tidbIntrospectQuery)).WillReturnRows(rows)
+	meta, err := r.Introspect(ctx, IntrospectParameters{IncludePaths: []glob.Glob{glob.MustCompile("*")}})
+	require.NoError(t, err)
+	require.Contains(t, meta.Schemas["schema1"].Tables, "table1")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTiDbSessionStatements(t *testing.T) {
+	require.Nil(t, tidbSessionStatements(0))
+	require.Equal(
+		t,
+		[]string{
+			"SET SESSION max_execution_time = 1500",
+			"SET SESSION innodb_lock_wait_timeout = 2",
+		},
+		tidbSessionStatements(1500*time.Millisecond),
+	)
+}
+
+func initTiDbRepoTest(t *testing.T) (context.Context, *sql.DB, sqlmock.Sqlmock, *TiDbRepository) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return ctx, db, mock, &TiDbRepository{
+		generic: NewGenericRepositoryFromDB(RepoTypeTiDB, "dbName", db),
+	}
+}
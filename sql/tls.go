@@ -0,0 +1,141 @@
+package sql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSMode is the TLS mode of the connections to a repository. The modes follow
+// the semantics of the Postgres sslmode connection parameter.
+type TLSMode string
+
+const (
+	// TLSModeDisable disables TLS.
+	TLSModeDisable TLSMode = "disable"
+	// TLSModeRequire requires TLS, without verifying the server certificate.
+	TLSModeRequire TLSMode = "require"
+	// TLSModeVerifyCA requires TLS, and verifies that the server certificate
+	// is issued by a trusted certificate authority.
+	TLSModeVerifyCA TLSMode = "verify-ca"
+	// TLSModeVerifyFull requires TLS, and verifies that the server certificate
+	// is issued by a trusted certificate authority and matches the server
+	// name.
+	TLSModeVerifyFull TLSMode = "verify-full"
+)
+
+// ParseTLSMode parses the given TLS mode. An empty string is parsed as the
+// empty mode, i.e. the default of the repository driver.
+func ParseTLSMode(s string) (TLSMode, error) {
+	switch m := TLSMode(s); m {
+	case "", TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown tls mode %q", s)
+	}
+}
+
+// TLSConfig is the TLS configuration of the connections to a repository. Each
+// repository translates it into the connection parameters of its driver, and
+// returns an error if its driver doesn't support some of the settings.
+// Snowflake connections always use verified TLS, so it is ignored by the
+// Snowflake repository.
+type TLSConfig struct {
+	// Mode is the TLS mode. If empty, the default of the repository driver is
+	// used, and the other settings are ignored.
+	Mode TLSMode
+	// CAFile is the path of a PEM bundle of the certificate authorities which
+	// are trusted to issue the server certificate. If empty, the system
+	// certificate authorities are trusted.
+	CAFile string
+	// CertFile is the path of the PEM client certificate, for repositories
+	// which authenticate clients with certificates.
+	CertFile string
+	// KeyFile is the path of the PEM private key of the client certificate.
+	KeyFile string
+	// ServerName is the name the server certificate is verified against in the
+	// verify-full mode. If empty, the host of the repository is used.
+	ServerName string
+}
+
+// enabled returns true if TLS is enabled by the configuration, i.e. if its mode
+// is neither empty nor disable.
+func (c TLSConfig) enabled() bool {
+	return c.Mode != "" && c.Mode != TLSModeDisable
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c TLSConfig) Validate() error {
+	if _, err := ParseTLSMode(string(c.Mode)); err != nil {
+		return err
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("tls client certificate and key must be set together")
+	}
+	return nil
+}
+
+// clientConfig builds the crypto/tls configuration of the connections to the
+// given host, for the drivers which accept one. It returns nil if TLS isn't
+// enabled (see enabled).
+//
+// The server certificate is verified by VerifyConnection rather than by
+// crypto/tls itself, since the verify-ca mode doesn't verify the server name,
+// and since some drivers override the server name of the configuration with the
+// host they connect to.
+func (c TLSConfig) clientConfig(host string) (*tls.Config, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !c.enabled() {
+		return nil, nil
+	}
+	serverName := c.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	cfg := &tls.Config{
+		ServerName: serverName,
+		// The server certificate is verified by VerifyConnection below.
+		InsecureSkipVerify: true,
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.Mode == TLSModeRequire {
+		return cfg, nil
+	}
+	var roots *x509.CertPool
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls ca file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in tls ca file %s", c.CAFile)
+		}
+	}
+	verifyName := c.Mode == TLSModeVerifyFull
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server did not present a tls certificate")
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		if verifyName {
+			opts.DNSName = serverName
+		}
+		_, err := state.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,134 @@
+package sql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		wantErr require.ErrorAssertionFunc
+	}{
+		{name: "empty", cfg: TLSConfig{}, wantErr: require.NoError},
+		{name: "verify-full", cfg: TLSConfig{Mode: TLSModeVerifyFull, CAFile: "ca.pem"}, wantErr: require.NoError},
+		{name: "unknown mode", cfg: TLSConfig{Mode: "prefer"}, wantErr: require.Error},
+		{name: "cert without key", cfg: TLSConfig{Mode: TLSModeRequire, CertFile: "cert.pem"}, wantErr: require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.wantErr(t, tt.cfg.Validate())
+		})
+	}
+}
+
+func TestTLSConfig_clientConfig(t *testing.T) {
+	caFile, serverCert := newTestCertificates(t, "db.example.com")
+	_, otherCert := newTestCertificates(t, "db.example.com")
+	state := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		for _, mode := range []TLSMode{"", TLSModeDisable} {
+			cfg, err := TLSConfig{Mode: mode}.clientConfig("db.example.com")
+			require.NoError(t, err)
+			require.Nil(t, cfg)
+		}
+	})
+
+	t.Run("require", func(t *testing.T) {
+		cfg, err := TLSConfig{Mode: TLSModeRequire, CAFile: caFile}.clientConfig("db.example.com")
+		require.NoError(t, err)
+		require.True(t, cfg.InsecureSkipVerify)
+		require.Nil(t, cfg.VerifyConnection)
+	})
+
+	t.Run("verify-ca", func(t *testing.T) {
+		cfg, err := TLSConfig{Mode: TLSModeVerifyCA, CAFile: caFile}.clientConfig("10.0.0.1")
+		require.NoError(t, err)
+		// The server name isn't verified.
+		require.NoError(t, cfg.VerifyConnection(state(serverCert)))
+		require.Error(t, cfg.VerifyConnection(state(otherCert)))
+	})
+
+	t.Run("verify-full", func(t *testing.T) {
+		cfg, err := TLSConfig{Mode: TLSModeVerifyFull, CAFile: caFile}.clientConfig("db.example.com")
+		require.NoError(t, err)
+		require.NoError(t, cfg.VerifyConnection(state(serverCert)))
+		require.Error(t, cfg.VerifyConnection(state(otherCert)))
+
+		cfg, err = TLSConfig{Mode: TLSModeVerifyFull, CAFile: caFile}.clientConfig("10.0.0.1")
+		require.NoError(t, err)
+		require.Error(t, cfg.VerifyConnection(state(serverCert)))
+
+		cfg, err = TLSConfig{
+			Mode:       TLSModeVerifyFull,
+			CAFile:     caFile,
+			ServerName: "db.example.com",
+		}.clientConfig("10.0.0.1")
+		require.NoError(t, err)
+		require.Equal(t, "db.example.com", cfg.ServerName)
+		require.NoError(t, cfg.VerifyConnection(state(serverCert)))
+	})
+
+	t.Run("missing ca file", func(t *testing.T) {
+		_, err := TLSConfig{Mode: TLSModeVerifyFull, CAFile: "missing.pem"}.clientConfig("db.example.com")
+		require.Error(t, err)
+	})
+}
+
+// newTestCertificates creates a self-signed certificate authority and a server
+// certificate it issued for the given host. It returns the path of the PEM file
+// of the certificate authority, and the server certificate.
+func newTestCertificates(t *testing.T, host string) (string, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600)
+	require.NoError(t, err)
+	return caFile, cert
+}
@@ -0,0 +1,320 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	// Trino DB driver
+	"github.com/trinodb/trino-go-client/trino"
+)
+
+const (
+	RepoTypeTrino = "trino"
+	// trinoDatabaseQuery lists the catalogs of the cluster, which are the
+	// databases of the Trino repositories, except the system catalog.
+	trinoDatabaseQuery = `
+SELECT
+    catalog_name
+FROM
+    system.metadata.catalogs
+WHERE
+    catalog_name <> 'system'
+`
+	// trinoIntrospectQuery extends the generic introspection query with the
+	// column comments. The unqualified INFORMATION_SCHEMA is the one of the
+	// catalog of the session, i.e. the database of the repository.
+	trinoIntrospectQuery = "SELECT " +
+		genericIntrospectColumns + ", " +
+		"c.comment AS column_comment" +
+		genericIntrospectFrom +
+		" WHERE c.table_schema <> 'information_schema'"
+	// trinoLoadQuery counts the queries which are queued on the cluster, e.g.
+	// because its resource groups are saturated.
+	trinoLoadQuery = `
+SELECT
+    COUNT(*)
+FROM
+    system.runtime.queries
+WHERE
+    state = 'QUEUED'
+`
+	configAccessToken     = "access-token"
+	configAccessTokenFile = "access-token-file"
+	configSamplePercent   = "sample-percent"
+)
+
+// trinoClientID numbers the HTTP clients registered with the Trino driver, so
+// that each repository has its own.
+var trinoClientID atomic.Uint64
+
+// TrinoRepository is a Repository implementation for Trino (and Presto)
+// clusters. The catalogs of the cluster are its databases, so the tables are
+// identified by their catalog, schema and name, like in Trino itself.
+type TrinoRepository struct {
+	// The majority of the Repository functionality is delegated to
+	// a generic SQL repository instance.
+	generic *GenericRepository
+	// samplePercent is the percentage of the rows sampled with TABLESAMPLE
+	// BERNOULLI, if positive.
+	samplePercent float64
+	// clientName is the name the HTTP client of the repository is registered
+	// with, if any.
+	clientName string
+}
+
+// TrinoRepository implements Repository and LoadReporter
+var (
+	_ Repository   = (*TrinoRepository)(nil)
+	_ LoadReporter = (*TrinoRepository)(nil)
+)
+
+// NewTrinoRepository creates a new TrinoRepository.
+func NewTrinoRepository(cfg RepoConfig) (*TrinoRepository, error) {
+	trinoCfg, err := NewTrinoConfigFromMap(cfg.Advanced)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing trino config: %w", err)
+	}
+	repo := &TrinoRepository{samplePercent: trinoCfg.SamplePercent}
+	generic, err := withSSHTunnel(
+		cfg,
+		func(tunnel *sshTunnel) (*GenericRepository, error) {
+			// The connections are made to the local port of the tunnel, if any.
+			driverCfg, err := trinoDriverConfig(tunnel.repoConfig(cfg), trinoCfg)
+			if err != nil {
+				return nil, err
+			}
+			repo.clientName = driverCfg.CustomClientName
+			db := openSessionDB(
+				&trinoConnector{cfg: *driverCfg, tokenFile: trinoCfg.AccessTokenFile},
+				nil,
+				cfg.MaxOpenConns,
+			)
+			return NewGenericRepositoryFromDB(RepoTypeTrino, cfg.Database, db), nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	repo.generic = generic
+	return repo, nil
+}
+
+// ListDatabases returns a list of the names of all catalogs on the cluster by
+// using a Trino-specific database query. It delegates the actual work to
+// GenericRepository.ListDatabasesWithQuery - see that method for more details.
+func (r *TrinoRepository) ListDatabases(ctx context.Context) ([]string, error) {
+	return r.generic.ListDatabasesWithQuery(ctx, trinoDatabaseQuery)
+}
+
+// Introspect delegates introspection to GenericRepository, using a
+// Trino-specific introspection query based on the INFORMATION_SCHEMA of the
+// catalog, which includes the column comments. Trino only exposes the table
+// statistics through SHOW STATS, and the key constraints of its connectors
+// aren't enforced, so neither are collected. See Repository.Introspect and
+// GenericRepository.IntrospectWithQueries for more details.
+func (r *TrinoRepository) Introspect(ctx context.Context, params IntrospectParameters) (*Metadata, error) {
+	queries := IntrospectQueries{Introspect: trinoIntrospectQuery}
+	return r.generic.IntrospectWithQueries(ctx, queries, params)
+}
+
+// SampleTable delegates sampling to GenericRepository, using a Trino-specific
+// sample query. If a sample percentage is configured, the rows are sampled with
+// TABLESAMPLE BERNOULLI, so that they are spread over the whole table. The
+// Trino driver executes the queries with placeholders as prepared statements,
+// which take an extra round-trip, so the sample size and offset are inlined.
+// See Repository.SampleTable and GenericRepository.SampleTableWithQuery for more
+// details.
+func (r *TrinoRepository) SampleTable(
+	ctx context.Context,
+	params SampleParameters,
+) (Sample, error) {
+	// Trino uses double-quotes to quote identifiers
+	attrStr := params.SelectList(r.generic.database, "\"", genericTruncate)
+	var tableSample string
+	if r.samplePercent > 0 {
+		tableSample = " TABLESAMPLE BERNOULLI (" + strconv.FormatFloat(r.samplePercent, 'f', -1, 64) + ")"
+	}
+	// Trino requires the OFFSET clause to come before the LIMIT clause.
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s.%s%s OFFSET %d LIMIT %d",
+		attrStr,
+		trinoQuoteIdentifier(params.Metadata.Schema),
+		trinoQuoteIdentifier(params.Metadata.Name),
+		tableSample,
+		params.Offset,
+		params.SampleSize,
+	)
+	return r.generic.sampleTableWithQuery(ctx, query, nil, params)
+}
+
+// Load returns the current load of the cluster, i.e. the number of queued
+// queries. See LoadReporter and GenericRepository.LoadWithQuery for more
+// details.
+func (r *TrinoRepository) Load(ctx context.Context) (float64, error) {
+	return r.generic.LoadWithQuery(ctx, trinoLoadQuery)
+}
+
+// Ping delegates the ping to GenericRepository. See Repository.Ping and
+// GenericRepository.Ping for more details.
+func (r *TrinoRepository) Ping(ctx context.Context) error {
+	return r.generic.Ping(ctx)
+}
+
+// Close delegates the close to GenericRepository, and deregisters the HTTP
+// client of the repository, if any. See Repository.Close and
+// GenericRepository.Close for more details.
+func (r *TrinoRepository) Close() error {
+	err := r.generic.Close()
+	if r.clientName != "" {
+		trino.DeregisterCustomClient(r.clientName)
+	}
+	return err
+}
+
+// TrinoConfig holds Trino-specific configuration parameters.
+type TrinoConfig struct {
+	// AccessToken is a JWT access token to authenticate with instead of a
+	// password.
+	AccessToken string
+	// AccessTokenFile is the path of a file containing a JWT access token to
+	// authenticate with instead of a password. The file is read each time a
+	// connection is opened, so that the token can be rotated during a scan.
+	AccessTokenFile string
+	// SamplePercent is the percentage of the rows of the tables which are
+	// sampled with TABLESAMPLE BERNOULLI, before the sample size is applied.
+	// If zero, the first rows returned by the table are sampled.
+	SamplePercent float64
+}
+
+// NewTrinoConfigFromMap creates a new TrinoConfig from the given map. This is
+// useful for parsing the Trino-specific configuration from the
+// RepoConfig.Advanced map, for example.
+func NewTrinoConfigFromMap(cfg map[string]any) (TrinoConfig, error) {
+	var (
+		trinoCfg TrinoConfig
+		err      error
+	)
+	if trinoCfg.AccessToken, err = optionalKeyAsString(cfg, configAccessToken); err != nil {
+		return TrinoConfig{}, err
+	}
+	if trinoCfg.AccessTokenFile, err = optionalKeyAsString(cfg, configAccessTokenFile); err != nil {
+		return TrinoConfig{}, err
+	}
+	if trinoCfg.AccessToken != "" && trinoCfg.AccessTokenFile != "" {
+		return TrinoConfig{}, fmt.Errorf("only one of %s and %s can be set", configAccessToken, configAccessTokenFile)
+	}
+	percent, err := optionalKeyAsString(cfg, configSamplePercent)
+	if err != nil {
+		return TrinoConfig{}, err
+	}
+	if percent != "" {
+		trinoCfg.SamplePercent, err = strconv.ParseFloat(percent, 64)
+		if err != nil || trinoCfg.SamplePercent <= 0 || trinoCfg.SamplePercent > 100 {
+			return TrinoConfig{}, fmt.Errorf("%s must be a number greater than 0 and at most 100", configSamplePercent)
+		}
+	}
+	return trinoCfg, nil
+}
+
+// trinoConnector is a driver.Connector which opens the connections with the
+// given Trino driver configuration. If tokenFile is set, the access token of
+// each connection is read from it.
+type trinoConnector struct {
+	cfg       trino.Config
+	tokenFile string
+}
+
+var _ driver.Connector = (*trinoConnector)(nil)
+
+// Connect opens a new connection. See driver.Connector for more details.
+func (c *trinoConnector) Connect(_ context.Context) (driver.Conn, error) {
+	cfg := c.cfg
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading trino access token file: %w", err)
+		}
+		cfg.AccessToken = strings.TrimSpace(string(token))
+	}
+	dsn, err := cfg.FormatDSN()
+	if err != nil {
+		return nil, err
+	}
+	return c.Driver().Open(dsn)
+}
+
+// Driver returns the Trino driver. See driver.Connector for more details.
+func (c *trinoConnector) Driver() driver.Driver {
+	return &trino.Driver{}
+}
+
+// trinoDriverConfig returns the Trino driver configuration of the given
+// configuration. The user is authenticated with the access token of the Trino
+// configuration if any, with the password if any, and isn't authenticated
+// otherwise. Trino only accepts credentials over HTTPS, so they require TLS.
+// If TLS is enabled, an HTTP client with the TLS configuration is registered
+// with the driver; it must be deregistered once the repository is closed.
+func trinoDriverConfig(cfg RepoConfig, trinoCfg TrinoConfig) (*trino.Config, error) {
+	hasToken := trinoCfg.AccessToken != "" || trinoCfg.AccessTokenFile != ""
+	if cfg.Password != "" && hasToken {
+		return nil, errors.New("trino password and access token are mutually exclusive")
+	}
+	scheme := "http"
+	if cfg.TLS.enabled() {
+		scheme = "https"
+	} else if cfg.Password != "" || hasToken {
+		return nil, errors.New("trino password and access token authentication require tls")
+	}
+	serverURI := url.URL{
+		Scheme: scheme,
+		User:   url.User(cfg.User),
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))),
+	}
+	if cfg.Password != "" {
+		serverURI.User = url.UserPassword(cfg.User, cfg.Password)
+	}
+	driverCfg := &trino.Config{
+		ServerURI: serverURI.String(),
+		Source:    "dmap",
+		Catalog:   cfg.Database,
+		// The token file is read by trinoConnector.
+		AccessToken: trinoCfg.AccessToken,
+	}
+	if cfg.QueryTimeout > 0 {
+		driverCfg.SessionProperties = map[string]string{
+			"query_max_execution_time": fmt.Sprintf("%dms", timeoutMillis(cfg.QueryTimeout)),
+		}
+	}
+	tlsCfg, err := cfg.TLS.clientConfig(cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+		name := fmt.Sprintf("dmap-%d", trinoClientID.Add(1))
+		client := &http.Client{Transport: transport}
+		if err := trino.RegisterCustomClient(name, client); err != nil {
+			return nil, fmt.Errorf("error registering trino http client: %w", err)
+		}
+		driverCfg.CustomClientName = name
+	}
+	return driverCfg, nil
+}
+
+// trinoQuoteIdentifier quotes the given schema or table name with
+// double-quotes, so that names which are reserved words or which contain
+// special characters are preserved. Double-quotes in the name are escaped by
+// doubling them.
+func trinoQuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}